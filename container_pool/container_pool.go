@@ -1,7 +1,6 @@
 package container_pool
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -35,6 +34,7 @@ import (
 
 var ErrUnknownRootFSProvider = errors.New("unknown rootfs provider")
 var ErrNetworkHostbitsNonZero = errors.New("network host bits non-zero")
+var ErrNoSubordinateUIDPool = errors.New("container has subordinate uids, but there is no pool of them")
 
 //go:generate counterfeiter -o fake_container_pool/FakeFilterProvider.go . FilterProvider
 type FilterProvider interface {
@@ -66,6 +66,11 @@ type LinuxContainerPool struct {
 
 	quotaManager quota_manager.QuotaManager
 
+	processScrollbackSize int
+
+	subordinateUIDPool      uid_pool.UIDRangePool
+	subordinateUIDRangeSize uint32
+
 	containerIDs chan string
 }
 
@@ -83,6 +88,9 @@ func New(
 	denyNetworks, allowNetworks []string,
 	runner command_runner.CommandRunner,
 	quotaManager quota_manager.QuotaManager,
+	processScrollbackSize int,
+	subordinateUIDPool uid_pool.UIDRangePool,
+	subordinateUIDRangeSize uint32,
 ) *LinuxContainerPool {
 	pool := &LinuxContainerPool{
 		logger: logger.Session("pool"),
@@ -110,6 +118,11 @@ func New(
 
 		quotaManager: quotaManager,
 
+		processScrollbackSize: processScrollbackSize,
+
+		subordinateUIDPool:      subordinateUIDPool,
+		subordinateUIDRangeSize: subordinateUIDRangeSize,
+
 		containerIDs: make(chan string),
 	}
 
@@ -121,6 +134,13 @@ func New(
 func (p *LinuxContainerPool) MaxContainers() int {
 	maxNet := p.cnBuilder.Capacity()
 	maxUid := p.uidPool.InitialSize()
+	if p.usesSubordinateUIDs() {
+		maxRanges := p.subordinateUIDPool.InitialSize() / int(p.subordinateUIDRangeSize)
+		if maxRanges < maxUid {
+			maxUid = maxRanges
+		}
+	}
+
 	if maxNet < maxUid {
 		return maxNet
 	}
@@ -266,29 +286,45 @@ func (p *LinuxContainerPool) Create(spec garden.ContainerSpec) (c linux_backend.
 		resources,
 		p.portPool,
 		p.runner,
-		cgroups_manager.New(p.sysconfig.CgroupPath, id),
+		p.cgroupsManager(id),
 		p.quotaManager,
 		bandwidth_manager.New(containerPath, id, p.runner),
-		process_tracker.New(containerPath, p.runner),
+		process_tracker.New(containerPath, p.runner, p.processScrollbackSize),
 		rootFSEnv.Merge(specEnv),
 		p.filterProvider.ProvideFilter(id),
 	), nil
 }
 
-func (p *LinuxContainerPool) releaseUIDs(userUID, rootUID uint32) {
+func (p *LinuxContainerPool) cgroupsManager(id string) cgroups_manager.CgroupsManager {
+	if p.sysconfig.UnifiedCgroups {
+		return cgroups_manager.NewUnified(p.sysconfig.CgroupPath, id)
+	}
+
+	return cgroups_manager.New(p.sysconfig.CgroupPath, id)
+}
+
+// releaseUIDs releases the IDs of a container; its root's ID is part of its
+// subordinate IDs when it has any.
+func (p *LinuxContainerPool) releaseUIDs(userUID, rootUID uint32, subordinateUIDs *uid_pool.UIDRange) {
 	if userUID != 0 {
 		p.uidPool.Release(userUID)
 	}
 
-	if rootUID != 0 {
+	if subordinateUIDs != nil {
+		if p.subordinateUIDPool != nil {
+			p.subordinateUIDPool.ReleaseRange(*subordinateUIDs)
+		}
+	} else if rootUID != 0 {
 		p.uidPool.Release(rootUID)
 	}
 }
 
-func (p *LinuxContainerPool) Restore(snapshot io.Reader) (linux_backend.Container, error) {
-	var containerSnapshot linux_container.ContainerSnapshot
+func (p *LinuxContainerPool) usesSubordinateUIDs() bool {
+	return p.subordinateUIDPool != nil && p.subordinateUIDRangeSize > 0
+}
 
-	err := json.NewDecoder(snapshot).Decode(&containerSnapshot)
+func (p *LinuxContainerPool) Restore(snapshot io.Reader) (linux_backend.Container, error) {
+	containerSnapshot, err := linux_container.ReadSnapshot(snapshot)
 	if err != nil {
 		return nil, err
 	}
@@ -308,7 +344,18 @@ func (p *LinuxContainerPool) Restore(snapshot io.Reader) (linux_backend.Containe
 		return nil, err
 	}
 
-	if resources.RootUID != 0 {
+	if resources.SubordinateUIDs != nil {
+		if p.subordinateUIDPool == nil {
+			p.uidPool.Release(resources.UserUID)
+			return nil, ErrNoSubordinateUIDPool
+		}
+
+		err = p.subordinateUIDPool.RemoveRange(*resources.SubordinateUIDs)
+		if err != nil {
+			p.uidPool.Release(resources.UserUID)
+			return nil, err
+		}
+	} else if resources.RootUID != 0 {
 		err = p.uidPool.Remove(resources.RootUID)
 		if err != nil {
 			return nil, err
@@ -317,14 +364,14 @@ func (p *LinuxContainerPool) Restore(snapshot io.Reader) (linux_backend.Containe
 
 	state, err := p.cnBuilder.Rebuild(resources.Network)
 	if err != nil {
-		p.releaseUIDs(resources.UserUID, resources.RootUID)
+		p.releaseUIDs(resources.UserUID, resources.RootUID, resources.SubordinateUIDs)
 		return nil, err
 	}
 
 	for _, port := range resources.Ports {
 		err = p.portPool.Remove(port)
 		if err != nil {
-			p.releaseUIDs(resources.UserUID, resources.RootUID)
+			p.releaseUIDs(resources.UserUID, resources.RootUID, resources.SubordinateUIDs)
 			p.cnBuilder.Dismantle(state)
 
 			for _, port := range resources.Ports {
@@ -337,7 +384,7 @@ func (p *LinuxContainerPool) Restore(snapshot io.Reader) (linux_backend.Containe
 
 	containerPath := path.Join(p.depotPath, id)
 
-	cgroupsManager := cgroups_manager.New(p.sysconfig.CgroupPath, id)
+	cgroupsManager := p.cgroupsManager(id)
 
 	bandwidthManager := bandwidth_manager.New(containerPath, id, p.runner)
 
@@ -348,6 +395,18 @@ func (p *LinuxContainerPool) Restore(snapshot io.Reader) (linux_backend.Containe
 		return nil, err
 	}
 
+	containerResources := linux_backend.NewResources(
+		resources.UserUID,
+		resources.RootUID,
+		state,
+		resources.Ports,
+		p.cnBuilder.ExternalIP(),
+	)
+
+	containerResources.UIDMappings = resources.UIDMappings
+	containerResources.GIDMappings = resources.GIDMappings
+	containerResources.SubordinateUIDs = resources.SubordinateUIDs
+
 	container := linux_container.NewLinuxContainer(
 		containerLogger,
 		id,
@@ -355,19 +414,13 @@ func (p *LinuxContainerPool) Restore(snapshot io.Reader) (linux_backend.Containe
 		containerPath,
 		containerSnapshot.Properties,
 		containerSnapshot.GraceTime,
-		linux_backend.NewResources(
-			resources.UserUID,
-			resources.RootUID,
-			state,
-			resources.Ports,
-			p.cnBuilder.ExternalIP(),
-		),
+		containerResources,
 		p.portPool,
 		p.runner,
 		cgroupsManager,
 		p.quotaManager,
 		bandwidthManager,
-		process_tracker.New(containerPath, p.runner),
+		process_tracker.New(containerPath, p.runner, p.processScrollbackSize),
 		containerEnv,
 		p.filterProvider.ProvideFilter(id),
 	)
@@ -382,6 +435,25 @@ func (p *LinuxContainerPool) Restore(snapshot io.Reader) (linux_backend.Containe
 	return container, nil
 }
 
+func (p *LinuxContainerPool) DiskUsage(containers []linux_backend.Container) (map[string]garden.ContainerDiskStat, error) {
+	uids := make([]uint32, 0, len(containers))
+	for _, container := range containers {
+		uids = append(uids, container.(*linux_container.LinuxContainer).Resources().UserUID)
+	}
+
+	usages, err := p.quotaManager.GetUsages(p.logger.Session("disk-usage"), uids)
+	if err != nil {
+		return nil, err
+	}
+
+	diskUsage := make(map[string]garden.ContainerDiskStat, len(containers))
+	for i, container := range containers {
+		diskUsage[container.ID()] = usages[uids[i]]
+	}
+
+	return diskUsage, nil
+}
+
 func (p *LinuxContainerPool) Destroy(container linux_backend.Container) error {
 	pLog := p.logger.Session("destroy", lager.Data{
 		"id": container.ID(),
@@ -406,6 +478,8 @@ func (p *LinuxContainerPool) Destroy(container linux_backend.Container) error {
 
 	p.releasePoolResources(resources)
 
+	linuxContainer.Destroyed()
+
 	pLog.Info("destroyed")
 
 	return nil
@@ -430,15 +504,26 @@ func (p *LinuxContainerPool) generateContainerIDs() string {
 
 func (p *LinuxContainerPool) writeBindMounts(containerPath string,
 	rootfsPath string,
-	bindMounts []garden.BindMount) error {
+	bindMounts []garden.BindMount,
+	resources *linux_backend.Resources) error {
 	hook := path.Join(containerPath, "lib", "hook-parent-before-clone.sh")
 
 	for _, bm := range bindMounts {
 		dstMount := path.Join(rootfsPath, bm.DstPath)
 		srcPath := bm.SrcPath
 
+		// files from the host would otherwise appear owned by whichever
+		// container IDs their owners' map to, if any; those from the
+		// container are already owned by its IDs
+		bindOptions := ""
 		if bm.Origin == garden.BindMountOriginContainer {
 			srcPath = path.Join(rootfsPath, srcPath)
+		} else if resources.SubordinateUIDs != nil {
+			bindOptions = fmt.Sprintf(
+				`-o \"X-mount.idmap=%s %s\" `,
+				resources.UIDMappings.MountIDMap("u"),
+				resources.GIDMappings.MountIDMap("g"),
+			)
 		}
 
 		mode := "ro"
@@ -458,7 +543,7 @@ func (p *LinuxContainerPool) writeBindMounts(containerPath string,
 			return err
 		}
 
-		mount := exec.Command("bash", "-c", "echo mount -n --bind "+srcPath+" "+dstMount+" >> "+hook)
+		mount := exec.Command("bash", "-c", "echo mount -n --bind "+bindOptions+srcPath+" "+dstMount+" >> "+hook)
 		err = p.runner.Run(mount)
 		if err != nil {
 			return err
@@ -511,14 +596,35 @@ func (p *LinuxContainerPool) acquireUID(resources *linux_backend.Resources, priv
 	}
 
 	resources.RootUID = 0
-	if !privileged {
+	if privileged {
+		return nil
+	}
+
+	if p.usesSubordinateUIDs() {
+		subordinateUIDs, err := p.subordinateUIDPool.AcquireRange(p.subordinateUIDRangeSize)
+		if err != nil {
+			p.logger.Error("subordinate-uids-acquire-failed", err)
+			p.uidPool.Release(resources.UserUID)
+			resources.UserUID = 0
+			return err
+		}
+
+		resources.SubordinateUIDs = &subordinateUIDs
+		resources.RootUID = subordinateUIDs.Start
+		resources.UIDMappings = linux_backend.RangeIDMappings(subordinateUIDs.Start, subordinateUIDs.Size, resources.UserUID)
+	} else {
 		resources.RootUID, err = p.uidPool.Acquire()
 		if err != nil {
 			p.logger.Error("uid-acquire-failed", err)
 			return err
 		}
+
+		resources.UIDMappings = linux_backend.SingleIDMappings(resources.RootUID, resources.UserUID)
 	}
 
+	// the container's groups map as its users do
+	resources.GIDMappings = resources.UIDMappings
+
 	return nil
 }
 
@@ -527,7 +633,7 @@ func (p *LinuxContainerPool) releasePoolResources(resources *linux_backend.Resou
 		p.portPool.Release(port)
 	}
 
-	p.releaseUIDs(resources.UserUID, resources.RootUID)
+	p.releaseUIDs(resources.UserUID, resources.RootUID, resources.SubordinateUIDs)
 
 	if resources.Network != nil {
 		p.cnBuilder.Dismantle(resources.Network)
@@ -566,6 +672,10 @@ func (p *LinuxContainerPool) acquireSystemResources(id, containerPath, rootFSPat
 		"root_uid":    strconv.FormatUint(uint64(resources.RootUID), 10),
 		"PATH":        os.Getenv("PATH"),
 	}
+	if resources.UIDMappings != nil {
+		env["uid_mappings"] = resources.UIDMappings.String()
+		env["gid_mappings"] = resources.GIDMappings.String()
+	}
 	resources.Network.ConfigureEnvironment(env)
 	p.cnBuilder.ConfigureEnvironment(env)
 	create.Env = env.Array()
@@ -597,7 +707,7 @@ func (p *LinuxContainerPool) acquireSystemResources(id, containerPath, rootFSPat
 		return nil, err
 	}
 
-	err = p.writeBindMounts(containerPath, rootfsPath, bindMounts)
+	err = p.writeBindMounts(containerPath, rootfsPath, bindMounts, resources)
 	if err != nil {
 		p.logger.Error("bind-mounts-failed", err)
 		return nil, err
@@ -22,14 +22,17 @@ import (
 	"github.com/cloudfoundry-incubator/garden-linux/container_pool/fake_cn_persistor"
 	"github.com/cloudfoundry-incubator/garden-linux/container_pool/fake_cnet"
 	"github.com/cloudfoundry-incubator/garden-linux/container_pool/fake_container_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/events"
 	"github.com/cloudfoundry-incubator/garden-linux/linux_container"
 	"github.com/cloudfoundry-incubator/garden-linux/network"
 	"github.com/cloudfoundry-incubator/garden-linux/network/fakes"
 	"github.com/cloudfoundry-incubator/garden-linux/network/iptables"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/port_pool/fake_port_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager/fake_quota_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/rootfs_provider"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/rootfs_provider/fake_rootfs_provider"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/uid_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/uid_pool/fake_uid_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/sysconfig"
 	"github.com/cloudfoundry-incubator/garden-linux/process"
@@ -103,6 +106,9 @@ var _ = Describe("Container pool", func() {
 			[]string{"1.1.1.1/32", "", "2.2.2.2/32"},
 			fakeRunner,
 			fakeQuotaManager,
+			0,
+			nil,
+			0,
 		)
 	})
 
@@ -353,9 +359,11 @@ var _ = Describe("Container pool", func() {
 							"PATH=" + os.Getenv("PATH"),
 							"fake_env=1.2.0.0/30",
 							"fake_global_env=global_value",
+							"gid_mappings=0 10001 1\n10000 10000 1",
 							"id=" + container.ID(),
 							"root_uid=10001",
 							"rootfs_path=/provided/rootfs/path",
+							"uid_mappings=0 10001 1\n10000 10000 1",
 							"user_uid=10000",
 						},
 					},
@@ -378,9 +386,11 @@ var _ = Describe("Container pool", func() {
 							"PATH=" + os.Getenv("PATH"),
 							"fake_env=1.3.0.0/30",
 							"fake_global_env=global_value",
+							"gid_mappings=0 10001 1\n10000 10000 1",
 							"id=" + container.ID(),
 							"root_uid=10001",
 							"rootfs_path=/provided/rootfs/path",
+							"uid_mappings=0 10001 1\n10000 10000 1",
 							"user_uid=10000",
 						},
 					},
@@ -465,9 +475,11 @@ var _ = Describe("Container pool", func() {
 							"PATH=" + os.Getenv("PATH"),
 							"fake_env=1.2.0.0/30",
 							"fake_global_env=global_value",
+							"gid_mappings=0 10001 1\n10000 10000 1",
 							"id=" + container.ID(),
 							"root_uid=10001",
 							"rootfs_path=/var/some/mount/point",
+							"uid_mappings=0 10001 1\n10000 10000 1",
 							"user_uid=10000",
 						},
 					},
@@ -489,7 +501,7 @@ var _ = Describe("Container pool", func() {
 			It("returns an error if the supplied environment is invalid", func() {
 				_, err := pool.Create(garden.ContainerSpec{
 					Env: []string{
-						"var1=spec=value1",
+						"=value1",
 					},
 				})
 				Ω(err).Should(MatchError(HavePrefix("malformed environment")))
@@ -930,6 +942,56 @@ var _ = Describe("Container pool", func() {
 			Ω(fakePortPool.Removed).Should(ContainElement(uint32(61003)))
 		})
 
+		Context("when the snapshot is versioned", func() {
+			var envelope linux_container.SnapshotEnvelope
+
+			JustBeforeEach(func() {
+				var containerSnapshot linux_container.ContainerSnapshot
+
+				err := json.NewDecoder(buf).Decode(&containerSnapshot)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				versioned := new(bytes.Buffer)
+
+				err = linux_container.WriteSnapshot(versioned, containerSnapshot)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = json.NewDecoder(versioned).Decode(&envelope)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = json.NewEncoder(buf).Encode(envelope)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("constructs a container from it", func() {
+				container, err := pool.Restore(snapshot)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(container.ID()).Should(Equal("some-restored-id"))
+				Ω(container.Handle()).Should(Equal("some-restored-handle"))
+			})
+
+			Context("when it does not match its checksum", func() {
+				JustBeforeEach(func() {
+					buf.Reset()
+
+					envelope.Checksum = "sha256:bogus"
+
+					err := json.NewEncoder(buf).Encode(envelope)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("rejects it without acquiring its resources", func() {
+					_, err := pool.Restore(snapshot)
+					Ω(err).Should(BeAssignableToTypeOf(linux_container.CorruptSnapshotError{}))
+
+					Ω(fakeUIDPool.Removed).Should(BeEmpty())
+					Ω(fakePortPool.Removed).Should(BeEmpty())
+					Ω(fakeCN.Recovered).Should(BeEmpty())
+				})
+			})
+		})
+
 		Context("when decoding the snapshot fails", func() {
 			BeforeEach(func() {
 				snapshot = new(bytes.Buffer)
@@ -1175,6 +1237,44 @@ var _ = Describe("Container pool", func() {
 		})
 	})
 
+	Describe("getting disk usage", func() {
+		It("looks up every container's usage at once, keyed by container ID", func() {
+			container1, err := pool.Create(garden.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			container2, err := pool.Create(garden.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeQuotaManager.GetUsageResult = garden.ContainerDiskStat{BytesUsed: 42}
+
+			usage, err := pool.DiskUsage([]linux_backend.Container{container1, container2})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(usage).Should(Equal(map[string]garden.ContainerDiskStat{
+				container1.ID(): {BytesUsed: 42},
+				container2.ID(): {BytesUsed: 42},
+			}))
+
+			Ω(fakeQuotaManager.GetUsagesCalls).Should(Equal([][]uint32{{
+				container1.(*linux_container.LinuxContainer).Resources().UserUID,
+				container2.(*linux_container.LinuxContainer).Resources().UserUID,
+			}}))
+		})
+
+		Context("when getting the usage fails", func() {
+			It("returns the error", func() {
+				container, err := pool.Create(garden.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				disaster := errors.New("oh no!")
+				fakeQuotaManager.GetUsagesError = disaster
+
+				_, err = pool.DiskUsage([]linux_backend.Container{container})
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+
 	Describe("destroying", func() {
 		var createdContainer *linux_container.LinuxContainer
 
@@ -1212,6 +1312,20 @@ var _ = Describe("Container pool", func() {
 			Ω(fakeCN.Released).Should(ContainElement("1.2.0.0/30"))
 		})
 
+		It("publishes a destroy event and ends the container's event stream", func() {
+			subscription := createdContainer.Subscribe()
+
+			err := pool.Destroy(createdContainer)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var event events.Event
+			Ω(subscription.Events()).Should(Receive(&event))
+			Ω(event.Type).Should(Equal(events.TypeDestroy))
+			Ω(event.Handle).Should(Equal(createdContainer.Handle()))
+
+			Ω(subscription.Events()).Should(BeClosed())
+		})
+
 		It("tears down filter chains", func() {
 			err := pool.Destroy(createdContainer)
 			Ω(err).ShouldNot(HaveOccurred())
@@ -1320,6 +1434,251 @@ var _ = Describe("Container pool", func() {
 			})
 		})
 	})
+
+	Describe("with a pool of subordinate uids", func() {
+		var fakeUIDRangePool *fake_uid_pool.FakeUIDRangePool
+
+		mappings := "0 100000 10000\n10000 10000 1\n10001 110001 55535"
+
+		BeforeEach(func() {
+			fakeUIDRangePool = fake_uid_pool.NewRangePool(100000)
+
+			logger := lagertest.NewTestLogger("test")
+			pool = container_pool.New(
+				logger,
+				"/root/path",
+				depotPath,
+				config,
+				map[string]rootfs_provider.RootFSProvider{
+					"": defaultFakeRootFSProvider,
+				},
+				fakeUIDPool,
+				fakeCN,
+				fakeCNPersistor,
+				fakeFilterProvider,
+				iptables.NewGlobalChain("global-default-chain", fakeRunner, logger),
+				fakePortPool,
+				nil,
+				nil,
+				fakeRunner,
+				fakeQuotaManager,
+				0,
+				fakeUIDRangePool,
+				65536,
+			)
+		})
+
+		Describe("MaxContainer", func() {
+			Context("when constrained by the number of subordinate uid ranges", func() {
+				BeforeEach(func() {
+					fakeCN.InitialPoolSize = 666
+					fakeUIDPool.InitialPoolSize = 42
+					fakeUIDRangePool.InitialPoolSize = 65536 * 3
+				})
+
+				It("returns the number of ranges", func() {
+					Ω(pool.MaxContainers()).Should(Equal(3))
+				})
+			})
+		})
+
+		Describe("creating", func() {
+			It("maps the container to a range of subordinate uids", func() {
+				container, err := pool.Create(garden.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeUIDRangePool.AcquiredRanges).Should(Equal([]uid_pool.UIDRange{
+					{Start: 100000, Size: 65536},
+				}))
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/create.sh",
+						Args: []string{path.Join(depotPath, container.ID())},
+						Env: []string{
+							"PATH=" + os.Getenv("PATH"),
+							"fake_env=1.2.0.0/30",
+							"fake_global_env=global_value",
+							"gid_mappings=" + mappings,
+							"id=" + container.ID(),
+							"root_uid=100000",
+							"rootfs_path=/provided/rootfs/path",
+							"uid_mappings=" + mappings,
+							"user_uid=10000",
+						},
+					},
+				))
+			})
+
+			Context("when the container is privileged", func() {
+				It("does not acquire a range", func() {
+					_, err := pool.Create(garden.ContainerSpec{Privileged: true})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeUIDRangePool.AcquiredRanges).Should(BeEmpty())
+				})
+			})
+
+			Context("when bind mounts from the host are specified", func() {
+				It("idmaps them to the container's ids", func() {
+					container, err := pool.Create(garden.ContainerSpec{
+						BindMounts: []garden.BindMount{
+							{
+								SrcPath: "/src/path",
+								DstPath: "/dst/path",
+								Mode:    garden.BindMountModeRO,
+							},
+						},
+					})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					containerPath := path.Join(depotPath, container.ID())
+
+					Ω(fakeRunner).Should(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: "bash",
+							Args: []string{
+								"-c",
+								`echo mount -n --bind -o \"X-mount.idmap=` +
+									"u:100000:0:10000 u:10000:10000:1 u:110001:10001:55535 " +
+									"g:100000:0:10000 g:10000:10000:1 g:110001:10001:55535" +
+									`\" /src/path /provided/rootfs/path/dst/path` +
+									" >> " + containerPath + "/lib/hook-parent-before-clone.sh",
+							},
+						},
+					))
+				})
+			})
+
+			Context("when acquiring a range fails", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakeUIDRangePool.AcquireRangeError = disaster
+				})
+
+				It("returns the error and releases the user uid", func() {
+					_, err := pool.Create(garden.ContainerSpec{})
+					Ω(err).Should(Equal(disaster))
+
+					Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
+				})
+			})
+
+			Context("when create.sh fails", func() {
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: "/root/path/create.sh",
+						}, func(*exec.Cmd) error {
+							return errors.New("oh no!")
+						},
+					)
+				})
+
+				It("releases the range", func() {
+					_, err := pool.Create(garden.ContainerSpec{})
+					Ω(err).Should(HaveOccurred())
+
+					Ω(fakeUIDRangePool.ReleasedRanges).Should(Equal([]uid_pool.UIDRange{
+						{Start: 100000, Size: 65536},
+					}))
+				})
+			})
+		})
+
+		Describe("restoring", func() {
+			var subordinateUIDs *uid_pool.UIDRange
+			var uidMappings linux_backend.IDMappings
+
+			BeforeEach(func() {
+				subordinateUIDs = &uid_pool.UIDRange{Start: 165536, Size: 65536}
+				uidMappings = linux_backend.RangeIDMappings(165536, 65536, 10000)
+			})
+
+			restore := func() (*linux_container.LinuxContainer, error) {
+				network, err := json.Marshal("serializedNetwork")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				restoredNetwork := json.RawMessage(network)
+
+				buf := new(bytes.Buffer)
+
+				err = json.NewEncoder(buf).Encode(
+					linux_container.ContainerSnapshot{
+						ID:     "some-restored-id",
+						Handle: "some-restored-handle",
+
+						Resources: linux_container.ResourcesSnapshot{
+							UserUID:         10000,
+							RootUID:         165536,
+							UIDMappings:     uidMappings,
+							GIDMappings:     uidMappings,
+							SubordinateUIDs: subordinateUIDs,
+							Network:         &restoredNetwork,
+						},
+					},
+				)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				container, err := pool.Restore(buf)
+				if err != nil {
+					return nil, err
+				}
+
+				return container.(*linux_container.LinuxContainer), nil
+			}
+
+			It("removes its range from the pool, rather than its root uid", func() {
+				_, err := restore()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeUIDRangePool.RemovedRanges).Should(Equal([]uid_pool.UIDRange{*subordinateUIDs}))
+				Ω(fakeUIDPool.Removed).ShouldNot(ContainElement(uint32(165536)))
+			})
+
+			It("restores the container's mappings", func() {
+				container, err := restore()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				resources := container.Resources()
+				Ω(resources.UIDMappings).Should(Equal(uidMappings))
+				Ω(resources.GIDMappings).Should(Equal(uidMappings))
+				Ω(resources.SubordinateUIDs).Should(Equal(subordinateUIDs))
+			})
+
+			Context("when removing the range from the pool fails", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakeUIDRangePool.RemoveRangeError = disaster
+				})
+
+				It("returns the error and releases the user uid", func() {
+					_, err := restore()
+					Ω(err).Should(Equal(disaster))
+
+					Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
+				})
+			})
+
+			Context("when the snapshot predates subordinate uids", func() {
+				BeforeEach(func() {
+					subordinateUIDs = nil
+					uidMappings = nil
+				})
+
+				It("maps only the container's root and user", func() {
+					container, err := restore()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					resources := container.Resources()
+					Ω(resources.UIDMappings).Should(Equal(linux_backend.SingleIDMappings(165536, 10000)))
+					Ω(resources.GIDMappings).Should(Equal(resources.UIDMappings))
+				})
+			})
+		})
+	})
 })
 
 func createJsonFile(name string) error {
@@ -1,11 +1,15 @@
 package fake_container_pool
 
 import (
+	"fmt"
 	"io"
 	"sync"
 	"time"
 
 	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/events"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/process_tracker"
 	"github.com/cloudfoundry-incubator/garden/fakes"
 )
 
@@ -22,6 +26,26 @@ type FakeContainer struct {
 	Started    bool
 
 	CleanedUp bool
+
+	InfoDiskStat *garden.ContainerDiskStat
+
+	recordedDiskUsage []garden.ContainerDiskStat
+	diskUsageMutex    *sync.Mutex
+
+	PropertiesObserver func(garden.Properties)
+
+	LimitsAdmission func(linux_backend.CommittedResources) (func(), error)
+
+	Committed linux_backend.CommittedResources
+
+	ProcessLogs     map[uint32]string
+	ProcessLogError error
+
+	SignalledProcesses map[uint32][]process_tracker.SignalRequest
+	SignalProcessError error
+	signalProcessMutex *sync.Mutex
+
+	EventHub *events.Hub
 }
 
 func NewFakeContainer(spec garden.ContainerSpec) *FakeContainer {
@@ -30,7 +54,11 @@ func NewFakeContainer(spec garden.ContainerSpec) *FakeContainer {
 
 		FakeContainer: new(fakes.FakeContainer),
 
-		snapshotMutex: new(sync.RWMutex),
+		snapshotMutex:      new(sync.RWMutex),
+		signalProcessMutex: new(sync.Mutex),
+		diskUsageMutex:     new(sync.Mutex),
+
+		EventHub: events.NewHub(),
 	}
 }
 
@@ -46,6 +74,73 @@ func (c *FakeContainer) Properties() garden.Properties {
 	return c.Spec.Properties
 }
 
+func (c *FakeContainer) CommittedResources() linux_backend.CommittedResources {
+	return c.Committed
+}
+
+// ProcessLog writes ProcessLogs[processID], whatever the request.
+func (c *FakeContainer) ProcessLog(processID uint32, request process_tracker.LogRequest, out io.Writer) error {
+	if c.ProcessLogError != nil {
+		return c.ProcessLogError
+	}
+
+	_, err := io.WriteString(out, c.ProcessLogs[processID])
+	return err
+}
+
+func (c *FakeContainer) SignalProcess(processID uint32, request process_tracker.SignalRequest) error {
+	c.signalProcessMutex.Lock()
+	defer c.signalProcessMutex.Unlock()
+
+	if c.SignalProcessError != nil {
+		return c.SignalProcessError
+	}
+
+	if c.SignalledProcesses == nil {
+		c.SignalledProcesses = make(map[uint32][]process_tracker.SignalRequest)
+	}
+
+	c.SignalledProcesses[processID] = append(c.SignalledProcesses[processID], request)
+
+	return nil
+}
+
+func (c *FakeContainer) RecordDiskUsage(usage garden.ContainerDiskStat) {
+	c.diskUsageMutex.Lock()
+	defer c.diskUsageMutex.Unlock()
+
+	c.recordedDiskUsage = append(c.recordedDiskUsage, usage)
+}
+
+func (c *FakeContainer) RecordedDiskUsage() []garden.ContainerDiskStat {
+	c.diskUsageMutex.Lock()
+	defer c.diskUsageMutex.Unlock()
+
+	return append([]garden.ContainerDiskStat{}, c.recordedDiskUsage...)
+}
+
+func (c *FakeContainer) OnPropertiesChange(observer func(garden.Properties)) {
+	c.PropertiesObserver = observer
+
+	if observer != nil {
+		observer(c.Spec.Properties)
+	}
+}
+
+// ChangeProperties replaces the container's properties and notifies the
+// registered observer, as SetProperty and RemoveProperty would.
+func (c *FakeContainer) ChangeProperties(properties garden.Properties) {
+	c.Spec.Properties = properties
+
+	if c.PropertiesObserver != nil {
+		c.PropertiesObserver(properties)
+	}
+}
+
+func (c *FakeContainer) OnLimitsIncrease(admission func(linux_backend.CommittedResources) (func(), error)) {
+	c.LimitsAdmission = admission
+}
+
 func (c *FakeContainer) Start() error {
 	c.Started = true
 	return c.StartError
@@ -55,6 +150,23 @@ func (c *FakeContainer) Cleanup() {
 	c.CleanedUp = true
 }
 
+func (c *FakeContainer) Subscribe() *events.Subscription {
+	return c.EventHub.Subscribe()
+}
+
+func (c *FakeContainer) InfoWithDiskStat(diskStat garden.ContainerDiskStat) (garden.ContainerInfo, error) {
+	c.InfoDiskStat = &diskStat
+
+	info, err := c.Info()
+	if err != nil {
+		return info, err
+	}
+
+	info.DiskStat = diskStat
+
+	return info, nil
+}
+
 func (c *FakeContainer) GraceTime() time.Duration {
 	return c.Spec.GraceTime
 }
@@ -69,5 +181,15 @@ func (c *FakeContainer) Snapshot(snapshot io.Writer) error {
 
 	c.SavedSnapshots = append(c.SavedSnapshots, snapshot)
 
-	return nil
+	// as read back by FakeContainerPool.Restore
+	_, err := fmt.Fprintf(snapshot, "%s\n", c.Spec.Handle)
+
+	return err
+}
+
+func (c *FakeContainer) SavedSnapshotCount() int {
+	c.snapshotMutex.RLock()
+	defer c.snapshotMutex.RUnlock()
+
+	return len(c.SavedSnapshots)
 }
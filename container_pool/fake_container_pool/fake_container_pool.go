@@ -24,6 +24,10 @@ type FakeContainerPool struct {
 
 	ContainerSetup func(*FakeContainer)
 
+	DiskUsageResult map[string]garden.ContainerDiskStat
+	DiskUsageError  error
+	DiskUsageCalls  int
+
 	CreatedContainers   []linux_backend.Container
 	DestroyedContainers []linux_backend.Container
 	RestoredSnapshots   []io.Reader
@@ -104,6 +108,16 @@ func (p *FakeContainerPool) Restore(snapshot io.Reader) (linux_backend.Container
 	return container, nil
 }
 
+func (p *FakeContainerPool) DiskUsage(containers []linux_backend.Container) (map[string]garden.ContainerDiskStat, error) {
+	p.DiskUsageCalls++
+
+	if p.DiskUsageError != nil {
+		return nil, p.DiskUsageError
+	}
+
+	return p.DiskUsageResult, nil
+}
+
 func (p *FakeContainerPool) Destroy(container linux_backend.Container) error {
 	if p.DestroyError != nil {
 		return p.DestroyError
@@ -0,0 +1,139 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+type Type string
+
+const (
+	TypeOutOfMemory     = Type("oom")
+	TypeStateChange     = Type("state-change")
+	TypeProcessExit     = Type("process-exit")
+	TypeQuotaExceeded   = Type("quota-exceeded")
+	TypePidLimitReached = Type("pid-limit-reached")
+	TypeDestroy         = Type("destroy")
+
+	// published by the backend, with no handle, once draining and every
+	// container is gone
+	TypeDrained = Type("drained")
+)
+
+type Event struct {
+	Type    Type
+	Handle  string
+	Time    time.Time
+	Details map[string]string
+}
+
+func New(eventType Type, handle string, details map[string]string) Event {
+	if details == nil {
+		details = map[string]string{}
+	}
+
+	return Event{
+		Type:    eventType,
+		Handle:  handle,
+		Time:    time.Now(),
+		Details: details,
+	}
+}
+
+// Number of events buffered per subscription before publishing starts
+// dropping them for that subscriber.
+const SubscriptionBufferSize = 256
+
+type Hub struct {
+	subscriptions map[*Subscription]struct{}
+	closed        bool
+	mu            sync.RWMutex
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscriptions: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish delivers the event to every current subscriber. It never blocks;
+// a subscriber whose buffer is full misses the event.
+func (h *Hub) Publish(event Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return
+	}
+
+	for s := range h.subscriptions {
+		select {
+		case s.events <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a subscription receiving every event published after
+// this call. The subscription's channel is closed when either the
+// subscription or the hub is closed.
+func (h *Hub) Subscribe() *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := &Subscription{
+		hub:    h,
+		events: make(chan Event, SubscriptionBufferSize),
+	}
+
+	if h.closed {
+		close(s.events)
+		return s
+	}
+
+	h.subscriptions[s] = struct{}{}
+
+	return s
+}
+
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+
+	h.closed = true
+
+	for s := range h.subscriptions {
+		close(s.events)
+	}
+
+	h.subscriptions = nil
+}
+
+func (h *Hub) unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, found := h.subscriptions[s]; !found {
+		return
+	}
+
+	delete(h.subscriptions, s)
+	close(s.events)
+}
+
+type Subscription struct {
+	hub    *Hub
+	events chan Event
+}
+
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) Close() {
+	s.hub.unsubscribe(s)
+}
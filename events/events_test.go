@@ -0,0 +1,91 @@
+package events_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/events"
+)
+
+var _ = Describe("Hub", func() {
+	var hub *events.Hub
+
+	BeforeEach(func() {
+		hub = events.NewHub()
+	})
+
+	It("delivers published events to every subscriber", func() {
+		sub1 := hub.Subscribe()
+		sub2 := hub.Subscribe()
+
+		event := events.New(events.TypeOutOfMemory, "some-handle", nil)
+		hub.Publish(event)
+
+		Ω(sub1.Events()).Should(Receive(Equal(event)))
+		Ω(sub2.Events()).Should(Receive(Equal(event)))
+	})
+
+	It("does not deliver events published before subscribing", func() {
+		hub.Publish(events.New(events.TypeOutOfMemory, "some-handle", nil))
+
+		sub := hub.Subscribe()
+		Ω(sub.Events()).ShouldNot(Receive())
+	})
+
+	It("timestamps events and defaults their details", func() {
+		event := events.New(events.TypeDestroy, "some-handle", nil)
+
+		Ω(event.Time).ShouldNot(BeZero())
+		Ω(event.Details).ShouldNot(BeNil())
+	})
+
+	Context("when a subscriber is not keeping up", func() {
+		It("drops events for it rather than blocking", func() {
+			sub := hub.Subscribe()
+
+			for i := 0; i < events.SubscriptionBufferSize+10; i++ {
+				hub.Publish(events.New(events.TypeStateChange, "some-handle", nil))
+			}
+
+			Ω(sub.Events()).Should(HaveLen(events.SubscriptionBufferSize))
+		})
+	})
+
+	Context("when a subscription is closed", func() {
+		It("closes its channel and stops delivering to it", func() {
+			sub := hub.Subscribe()
+			sub.Close()
+
+			hub.Publish(events.New(events.TypeOutOfMemory, "some-handle", nil))
+
+			Ω(sub.Events()).Should(BeClosed())
+		})
+
+		It("can be closed again", func() {
+			sub := hub.Subscribe()
+			sub.Close()
+			sub.Close()
+		})
+	})
+
+	Context("when the hub is closed", func() {
+		It("closes every subscription", func() {
+			sub := hub.Subscribe()
+
+			hub.Close()
+
+			Ω(sub.Events()).Should(BeClosed())
+		})
+
+		It("returns closed subscriptions to new subscribers", func() {
+			hub.Close()
+
+			Ω(hub.Subscribe().Events()).Should(BeClosed())
+		})
+
+		It("ignores further publishes", func() {
+			hub.Close()
+			hub.Publish(events.New(events.TypeOutOfMemory, "some-handle", nil))
+		})
+	})
+})
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"syscall"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -534,6 +535,64 @@ var _ = Describe("Through a restart", func() {
 	})
 })
 
+var _ = Describe("Drain mode", func() {
+	var container garden.Container
+
+	BeforeEach(func() {
+		client = startGarden()
+
+		var err error
+
+		container, err = client.Create(garden.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		gardenProcess.Signal(syscall.SIGUSR2)
+		Eventually(client.Ping).Should(Succeed())
+
+		if container != nil {
+			err := client.Destroy(container.Handle())
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+	})
+
+	Context("when sent SIGUSR1", func() {
+		BeforeEach(func() {
+			gardenProcess.Signal(syscall.SIGUSR1)
+			Eventually(client.Ping).Should(HaveOccurred())
+		})
+
+		It("refuses to create containers", func() {
+			_, err := client.Create(garden.ContainerSpec{})
+			Ω(err).Should(MatchError(ContainSubstring("draining")))
+		})
+
+		It("reports no capacity for containers", func() {
+			capacity, err := client.Capacity()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(capacity.MaxContainers).Should(BeZero())
+		})
+
+		It("keeps running the existing containers", func() {
+			runEcho(container)
+		})
+
+		Context("and then SIGUSR2", func() {
+			It("creates containers again", func() {
+				gardenProcess.Signal(syscall.SIGUSR2)
+				Eventually(client.Ping).Should(Succeed())
+
+				created, err := client.Create(garden.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = client.Destroy(created.Handle())
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+})
+
 func getContainerHandles() []string {
 	containers, err := client.Containers(nil)
 	Ω(err).ShouldNot(HaveOccurred())
@@ -3,6 +3,7 @@ package main_test
 import (
 	"os"
 	"os/exec"
+	"syscall"
 
 	linkpkg "github.com/cloudfoundry-incubator/garden-linux/iodaemon/link"
 	. "github.com/onsi/ginkgo"
@@ -64,7 +65,10 @@ var _ = Describe("Iodaemon integration tests", func() {
 		Eventually(spawnS).Should(gbytes.Say("active\n"))
 		Eventually(linkStdout).Should(gbytes.Say("hello\r\ngoodbye"))
 
-		Ω(link.Wait()).Should(Equal(-1)) // -1 indicates unhandled SIGHUP
+		exitStatus, err := link.WaitForExitStatus()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(exitStatus.ExitCode).Should(Equal(-1))
+		Ω(exitStatus.Signal).Should(Equal(syscall.SIGHUP)) // unhandled
 	})
 
 	It("consistently executes a quickly-printing-and-exiting command", func() {
@@ -6,9 +6,13 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"syscall"
 
 	"bytes"
+	"encoding/gob"
 	"io"
+	"net"
+	"sync"
 
 	linkpkg "github.com/cloudfoundry-incubator/garden-linux/iodaemon/link"
 	. "github.com/onsi/ginkgo"
@@ -102,6 +106,36 @@ var _ = Describe("Iodaemon", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("records the exit status beside the socket", func() {
+			spawnProcess("bash", "-c", "exit 42")
+
+			_, _, _, err := createLink(socketPath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Eventually(done).Should(BeClosed())
+
+			exitStatus, err := linkpkg.ReadExitStatus(filepath.Join(tmpdir, "iodaemon.status"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(exitStatus.ExitCode).Should(Equal(42))
+			Ω(exitStatus.Signal).Should(BeZero())
+			Ω(exitStatus.Rusage).ShouldNot(BeNil())
+		})
+
+		It("records the signal which killed the child", func() {
+			spawnProcess("bash", "-c", "kill -9 $$")
+
+			_, _, _, err := createLink(socketPath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Eventually(done).Should(BeClosed())
+
+			exitStatus, err := linkpkg.ReadExitStatus(filepath.Join(tmpdir, "iodaemon.status"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(exitStatus.ExitCode).Should(Equal(-1))
+			Ω(exitStatus.Signal).Should(Equal(syscall.SIGKILL))
+			Ω(exitStatus.CoreDumped).Should(BeFalse())
+		})
+
 		It("closes stdin when the link is closed", func() {
 			spawnProcess("bash")
 
@@ -113,6 +147,156 @@ var _ = Describe("Iodaemon", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("speaks the latest version of the link protocol", func() {
+			spawnProcess("bash")
+
+			l, _, _, err := createLink(socketPath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(l.Version()).Should(Equal(linkpkg.ProtocolVersion))
+			l.Write([]byte("exit\n"))
+		})
+
+		It("sends signals to the child", func() {
+			spawnProcess("bash", "-c", `trap "echo got usr1; exit 0" USR1; echo ready; while true; do sleep 0.1; done`)
+
+			l, linkStdout, _, err := createLink(socketPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(linkStdout).Should(gbytes.Say("ready\n"))
+
+			Ω(l.Signal(int(syscall.SIGUSR1))).Should(Succeed())
+			Eventually(linkStdout).Should(gbytes.Say("got usr1\n"))
+		})
+
+		It("responds to keepalives", func() {
+			spawnProcess("bash")
+
+			l, _, _, err := createLink(socketPath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(l.Keepalive(time.Second)).Should(Succeed())
+			Ω(l.Keepalive(time.Second)).Should(Succeed())
+
+			l.Write([]byte("exit\n"))
+		})
+
+		It("serves links speaking version 1 of the link protocol", func() {
+			spawnProcess("cat")
+
+			conn, stdout := createLegacyLink(socketPath)
+			defer conn.Close()
+
+			encoder := gob.NewEncoder(conn)
+			Ω(encoder.Encode(linkpkg.Input{Data: []byte("hello\n")})).Should(Succeed())
+			Ω(encoder.Encode(linkpkg.Input{EOF: true})).Should(Succeed())
+
+			Eventually(stdout).Should(gbytes.Say("hello\n"))
+		})
+
+		Context("with several links", func() {
+			It("streams the output to each of them", func() {
+				spawnProcess("bash", "-c", "read line; echo got $line; echo err $line >&2")
+
+				l1, l1Stdout, l1Stderr, err := createLink(socketPath)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, l2Stdout, l2Stderr, err := createLink(socketPath)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				l1.Write([]byte("hello\n"))
+
+				Eventually(l1Stdout).Should(gbytes.Say("got hello\n"))
+				Eventually(l2Stdout).Should(gbytes.Say("got hello\n"))
+				Eventually(l1Stderr).Should(gbytes.Say("err hello\n"))
+				Eventually(l2Stderr).Should(gbytes.Say("err hello\n"))
+			})
+
+			It("reports the exit status to each of them", func() {
+				spawnProcess("bash", "-c", "read line; exit 42")
+
+				l1, _, _, err := createLink(socketPath)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				l2, _, _, err := createLink(socketPath)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				l1.Write([]byte("\n"))
+
+				Ω(l1.Wait()).Should(Equal(42))
+				Ω(l2.Wait()).Should(Equal(42))
+			})
+
+			It("only takes stdin from the first of them to send any", func() {
+				spawnProcess("cat")
+
+				l1, l1Stdout, _, err := createLink(socketPath)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				l2, _, _, err := createLink(socketPath)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				l1.Write([]byte("one\n"))
+				Eventually(l1Stdout).Should(gbytes.Say("one\n"))
+
+				l2.Write([]byte("two\n"))
+				l2.Close()
+
+				l1.Write([]byte("three\n"))
+				Eventually(l1Stdout).Should(gbytes.Say("three\n"))
+				Ω(l1Stdout.(*gbytes.Buffer).Contents()).ShouldNot(ContainSubstring("two"))
+
+				Ω(done).ShouldNot(BeClosed())
+				l1.Close()
+			})
+		})
+
+		Context("with a link reading slower than the child writes", func() {
+			It("streams all of the output to it", func() {
+				spawnProcess("head", "-c", "8000000", "/dev/zero")
+
+				stdout := &slowWriter{}
+
+				var l *linkpkg.Link
+				Eventually(func() error {
+					var err error
+					l, err = linkpkg.Create(socketPath, stdout, gbytes.NewBuffer())
+					return err
+				}).ShouldNot(HaveOccurred())
+
+				exitStatus, err := l.WaitForExitStatus()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(exitStatus.ExitCode).Should(Equal(0))
+
+				Ω(stdout.Written()).Should(Equal(8000000))
+			})
+
+			Context("which is not the first", func() {
+				It("cuts it short and tells it so, rather than hold up the first", func() {
+					spawnProcess("bash", "-c", "read line; head -c 8000000 /dev/zero")
+
+					l1, l1Stdout, _, err := createLink(socketPath)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					stalled := make(chan struct{})
+					l2Stdout := &slowWriter{stalled: stalled}
+
+					l2, err := linkpkg.Create(socketPath, l2Stdout, gbytes.NewBuffer())
+					Ω(err).ShouldNot(HaveOccurred())
+
+					l1.Write([]byte("go\n"))
+
+					Ω(l1.Wait()).Should(Equal(0))
+					Ω(l1Stdout.(*gbytes.Buffer).Contents()).Should(HaveLen(8000000))
+
+					close(stalled)
+
+					_, err = l2.WaitForExitStatus()
+					Ω(err).Should(BeAssignableToTypeOf(linkpkg.LinkError{}))
+					Ω(l2Stdout.Written()).Should(BeNumerically("<", 8000000))
+				})
+			})
+		})
+
 		Context("when there is an existing socket file", func() {
 			BeforeEach(func() {
 				file, err := os.Create(socketPath)
@@ -205,6 +389,36 @@ var _ = Describe("Iodaemon", func() {
 
 })
 
+// slowWriter takes a while over each write, and blocks until stalled is
+// closed if given.
+type slowWriter struct {
+	stalled chan struct{}
+
+	written int
+	mutex   sync.Mutex
+}
+
+func (w *slowWriter) Write(data []byte) (int, error) {
+	if w.stalled != nil {
+		<-w.stalled
+	}
+
+	time.Sleep(time.Millisecond)
+
+	w.mutex.Lock()
+	w.written += len(data)
+	w.mutex.Unlock()
+
+	return len(data), nil
+}
+
+func (w *slowWriter) Written() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.written
+}
+
 func createLink(socketPath string) (*linkpkg.Link, io.WriteCloser, io.WriteCloser, error) {
 	linkStdout := gbytes.NewBuffer()
 	linkStderr := gbytes.NewBuffer()
@@ -219,3 +433,76 @@ func createLink(socketPath string) (*linkpkg.Link, io.WriteCloser, io.WriteClose
 	}
 	return l, linkStdout, linkStderr, err
 }
+
+// createLegacyLink connects to the i/o daemon as links speaking version 1
+// of the protocol do, returning the connection and the process's stdout.
+func createLegacyLink(socketPath string) (net.Conn, *gbytes.Buffer) {
+	var conn net.Conn
+	Eventually(func() error {
+		var err error
+		conn, err = net.Dial("unix", socketPath)
+		return err
+	}).ShouldNot(HaveOccurred())
+
+	var b [2048]byte
+	var oob [2048]byte
+
+	_, oobn, _, _, err := conn.(*net.UnixConn).ReadMsgUnix(b[:], oob[:])
+	Ω(err).ShouldNot(HaveOccurred())
+
+	scms, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	Ω(err).ShouldNot(HaveOccurred())
+	Ω(scms).Should(HaveLen(1))
+
+	fds, err := syscall.ParseUnixRights(&scms[0])
+	Ω(err).ShouldNot(HaveOccurred())
+	Ω(fds).Should(HaveLen(3))
+
+	syscall.Close(fds[1])
+	syscall.Close(fds[2])
+
+	stdout := gbytes.NewBuffer()
+	go func() {
+		lstdout := os.NewFile(uintptr(fds[0]), "stdout")
+		io.Copy(stdout, lstdout)
+		lstdout.Close()
+	}()
+
+	return conn, stdout
+}
+
+var _ = Describe("Recorded exit statuses", func() {
+	var tmpdir string
+
+	BeforeEach(func() {
+		var err error
+		tmpdir, err = ioutil.TempDir("", "exit-status-dir")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpdir)
+	})
+
+	It("can be read back", func() {
+		statusPath := filepath.Join(tmpdir, "iodaemon.status")
+		exitStatus := linkpkg.ExitStatus{
+			ExitCode:   -1,
+			Signal:     syscall.SIGSEGV,
+			CoreDumped: true,
+			Rusage:     &linkpkg.Rusage{UserTime: time.Second, MaxRSSInKB: 1024},
+		}
+
+		Ω(linkpkg.WriteExitStatus(statusPath, exitStatus)).Should(Succeed())
+		Ω(linkpkg.ReadExitStatus(statusPath)).Should(Equal(exitStatus))
+	})
+
+	It("can be read when recorded with only an exit code", func() {
+		statusPath := filepath.Join(tmpdir, "iodaemon.status")
+
+		err := ioutil.WriteFile(statusPath, []byte("42\n"), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(linkpkg.ReadExitStatus(statusPath)).Should(Equal(linkpkg.ExitStatus{ExitCode: 42}))
+	})
+})
@@ -0,0 +1,180 @@
+package link
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ExitStatus describes how a process exited.
+//
+// The i/o daemon reports it as the exit code on a line of its own, for
+// links which only know of that, followed by a line with the rest as JSON.
+type ExitStatus struct {
+	// -1 when the process was killed by a signal.
+	ExitCode int `json:"exit_code"`
+
+	// The signal which killed the process, if any.
+	Signal     syscall.Signal `json:"signal,omitempty"`
+	CoreDumped bool           `json:"core_dumped,omitempty"`
+
+	// Nil when reported by an i/o daemon which does not know of it.
+	Rusage *Rusage `json:"rusage,omitempty"`
+}
+
+// Rusage is the resource usage of a process and its waited-for children.
+type Rusage struct {
+	UserTime   time.Duration `json:"user_time"`
+	SystemTime time.Duration `json:"system_time"`
+
+	MaxRSSInKB int64 `json:"max_rss_in_kb"`
+
+	MinorFaults int64 `json:"minor_faults"`
+	MajorFaults int64 `json:"major_faults"`
+
+	VoluntaryContextSwitches   int64 `json:"voluntary_context_switches"`
+	InvoluntaryContextSwitches int64 `json:"involuntary_context_switches"`
+}
+
+// NewExitStatus describes the exit of a process from its state once
+// waited for.
+func NewExitStatus(state *os.ProcessState) ExitStatus {
+	waitStatus := state.Sys().(syscall.WaitStatus)
+
+	status := ExitStatus{
+		ExitCode: waitStatus.ExitStatus(),
+	}
+
+	if waitStatus.Signaled() {
+		status.Signal = waitStatus.Signal()
+		status.CoreDumped = waitStatus.CoreDump()
+	}
+
+	if rusage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		status.Rusage = &Rusage{
+			UserTime:   time.Duration(rusage.Utime.Nano()),
+			SystemTime: time.Duration(rusage.Stime.Nano()),
+
+			MaxRSSInKB: int64(rusage.Maxrss),
+
+			MinorFaults: int64(rusage.Minflt),
+			MajorFaults: int64(rusage.Majflt),
+
+			VoluntaryContextSwitches:   int64(rusage.Nvcsw),
+			InvoluntaryContextSwitches: int64(rusage.Nivcsw),
+		}
+	}
+
+	return status
+}
+
+func WriteStatus(w io.Writer, status ExitStatus) error {
+	details, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%d\n%s\n", status.ExitCode, details)
+	return err
+}
+
+// ReadStatus reads an exit status as written by WriteStatus, or as only an
+// exit code.
+func ReadStatus(r io.Reader) (ExitStatus, error) {
+	reader := bufio.NewReader(r)
+
+	var exitCode int
+	_, err := fmt.Fscanf(reader, "%d\n", &exitCode)
+	if err != nil {
+		return ExitStatus{ExitCode: -1}, err
+	}
+
+	details, err := reader.ReadBytes('\n')
+	if len(bytes.TrimSpace(details)) == 0 {
+		if err != nil && err != io.EOF {
+			return ExitStatus{ExitCode: -1}, err
+		}
+
+		return ExitStatus{ExitCode: exitCode}, nil
+	}
+
+	var status ExitStatus
+	err = json.Unmarshal(details, &status)
+	if err != nil {
+		return ExitStatus{ExitCode: -1}, err
+	}
+
+	status.ExitCode = exitCode
+
+	return status, nil
+}
+
+// ExitStatusPath is where the i/o daemon listening on socketPath records the
+// exit status of its process, e.g. processes/1.status for processes/1.sock.
+func ExitStatusPath(socketPath string) string {
+	return strings.TrimSuffix(socketPath, filepath.Ext(socketPath)) + ".status"
+}
+
+// WriteExitStatus records an exit status so that it survives both the i/o
+// daemon and a crash of the host; the file either has the full status or
+// does not exist.
+func WriteExitStatus(path string, status ExitStatus) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	err = WriteStatus(tmp, status)
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	defer dir.Close()
+
+	return dir.Sync()
+}
+
+func ReadExitStatus(path string) (ExitStatus, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ExitStatus{ExitCode: -1}, err
+	}
+
+	defer file.Close()
+
+	status, err := ReadStatus(file)
+	if err != nil {
+		return ExitStatus{ExitCode: -1}, fmt.Errorf("invalid exit status in %s: %s", path, err)
+	}
+
+	return status, nil
+}
@@ -1,19 +1,53 @@
 package link
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"sync"
 	"syscall"
+	"time"
 )
 
+// HandshakeTimeout bounds how long Create waits for the i/o daemon to
+// acknowledge the protocol version.
+const HandshakeTimeout = 10 * time.Second
+
+var ErrDisconnected = errors.New("link: disconnected from i/o daemon")
+
+// LinkError is an error the i/o daemon reported about the link, e.g. that
+// its output was cut short.
+type LinkError struct {
+	Message string
+}
+
+func (e LinkError) Error() string {
+	return "link: " + e.Message
+}
+
+type KeepaliveTimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e KeepaliveTimeoutError) Error() string {
+	return fmt.Sprintf("link: i/o daemon did not respond to keepalive within %s", e.Timeout)
+}
+
 type Link struct {
 	*Writer
 
 	exitStatus io.Reader
 	streaming  *sync.WaitGroup
+
+	keepalives     chan struct{}
+	disconnected   chan struct{}
+	keepaliveMutex sync.Mutex
+
+	linkErr      error
+	linkErrMutex sync.Mutex
 }
 
 func Create(socketPath string, stdout io.Writer, stderr io.Writer) (*Link, error) {
@@ -46,17 +80,48 @@ func Create(socketPath string, stdout io.Writer, stderr io.Writer) (*Link, error
 		return nil, fmt.Errorf("failed to parse unix rights: %s", err)
 	}
 
-	if len(fds) != 3 {
+	if len(fds) < 3 {
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+
 		return nil, fmt.Errorf("invalid number of fds; need 3, got %d", len(fds))
 	}
 
+	// later versions of the i/o daemon may send more than are known of here
+	for _, fd := range fds[3:] {
+		syscall.Close(fd)
+	}
+
 	lstdout := os.NewFile(uintptr(fds[0]), "stdout")
 	lstderr := os.NewFile(uintptr(fds[1]), "stderr")
 	lstatus := os.NewFile(uintptr(fds[2]), "status")
 
-	streaming := &sync.WaitGroup{}
+	version, err := handshake(conn, b[:n])
+	if err != nil {
+		lstdout.Close()
+		lstderr.Close()
+		lstatus.Close()
+		conn.Close()
+		return nil, err
+	}
 
-	linkWriter := NewWriter(conn)
+	link := &Link{
+		exitStatus: lstatus,
+		streaming:  &sync.WaitGroup{},
+
+		keepalives:   make(chan struct{}, 1),
+		disconnected: make(chan struct{}),
+	}
+
+	if version == LegacyProtocolVersion {
+		link.Writer = NewWriter(conn)
+	} else {
+		link.Writer = NewFramedWriter(conn, version)
+		go link.readFrames(conn)
+	}
+
+	streaming := link.streaming
 
 	streaming.Add(1)
 	go func() {
@@ -72,22 +137,152 @@ func Create(socketPath string, stdout io.Writer, stderr io.Writer) (*Link, error
 		streaming.Done()
 	}()
 
-	return &Link{
-		Writer: linkWriter,
+	return link, nil
+}
 
-		exitStatus: lstatus,
-		streaming:  streaming,
-	}, nil
+// handshake agrees on a version of the protocol with the i/o daemon, given
+// what it sent along with the fds.
+func handshake(conn net.Conn, announcement []byte) (int, error) {
+	if len(announcement) == 0 {
+		return LegacyProtocolVersion, nil
+	}
+
+	frame, err := ReadFrame(bytes.NewReader(announcement))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read protocol version: %s", err)
+	}
+
+	version, err := ParseHello(frame)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read protocol version: %s", err)
+	}
+
+	if version > ProtocolVersion {
+		version = ProtocolVersion
+	}
+
+	if version == LegacyProtocolVersion {
+		return version, nil
+	}
+
+	conn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	err = WriteFrame(conn, HelloFrame(version))
+	if err != nil {
+		return 0, fmt.Errorf("failed to send protocol version: %s", err)
+	}
+
+	frame, err = ReadFrame(conn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read protocol version acknowledgement: %s", err)
+	}
+
+	acknowledged, err := ParseHello(frame)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read protocol version acknowledgement: %s", err)
+	}
+
+	if acknowledged != version {
+		return 0, fmt.Errorf("i/o daemon acknowledged protocol version %d, not %d", acknowledged, version)
+	}
+
+	return version, nil
+}
+
+// Keepalive checks that the i/o daemon is still responsive, failing if it
+// does not respond within the timeout.
+func (link *Link) Keepalive(timeout time.Duration) error {
+	if link.Version() == LegacyProtocolVersion {
+		return UnsupportedError{"keepalive", link.Version()}
+	}
+
+	link.keepaliveMutex.Lock()
+	defer link.keepaliveMutex.Unlock()
+
+	select {
+	case <-link.keepalives:
+	default:
+	}
+
+	err := link.writeFrame(Frame{Type: FrameKeepalive})
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-link.keepalives:
+		return nil
+	case <-link.disconnected:
+		return ErrDisconnected
+	case <-timer.C:
+		return KeepaliveTimeoutError{timeout}
+	}
+}
+
+func (link *Link) readFrames(conn net.Conn) {
+	defer close(link.disconnected)
+
+	for {
+		frame, err := ReadFrame(conn)
+		if err != nil {
+			return
+		}
+
+		switch frame.Type {
+		case FrameKeepalive:
+			select {
+			case link.keepalives <- struct{}{}:
+			default:
+			}
+
+		case FrameError:
+			link.linkErrMutex.Lock()
+			if link.linkErr == nil {
+				link.linkErr = LinkError{string(frame.Payload)}
+			}
+			link.linkErrMutex.Unlock()
+		}
+	}
 }
 
 func (link *Link) Wait() (int, error) {
+	exitStatus, err := link.WaitForExitStatus()
+	return exitStatus.ExitCode, err
+}
+
+// WaitForExitStatus waits for the process to exit and for its output to be
+// streamed, and returns how it exited. It fails with a LinkError, along with
+// the exit status, if the output was cut short.
+func (link *Link) WaitForExitStatus() (ExitStatus, error) {
 	link.streaming.Wait()
 
-	var exitStatus int
-	_, err := fmt.Fscanf(link.exitStatus, "%d\n", &exitStatus)
+	exitStatus, err := ReadStatus(link.exitStatus)
 	if err != nil {
-		return -1, fmt.Errorf("could not determine exit status: %s", err)
+		return ExitStatus{ExitCode: -1}, fmt.Errorf("could not determine exit status: %s", err)
 	}
 
-	return exitStatus, nil
+	return exitStatus, link.reportedError()
+}
+
+func (link *Link) reportedError() error {
+	if link.Version() == LegacyProtocolVersion {
+		return nil
+	}
+
+	// the i/o daemon answers in order, so once it has answered, or gone
+	// away, any error it sent before has been read
+	select {
+	case <-link.disconnected:
+	default:
+		link.Keepalive(HandshakeTimeout)
+	}
+
+	link.linkErrMutex.Lock()
+	defer link.linkErrMutex.Unlock()
+
+	return link.linkErr
 }
@@ -0,0 +1,162 @@
+package link
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Versions of the protocol spoken over a link, once the i/o daemon has sent
+// the process's stdout, stderr and status fds.
+//
+// Version 1 is a stream of gob-encoded Inputs from the link, and is what a
+// daemon speaks when it announces no version alongside the fds. From version
+// 2 the daemon announces its version in a hello frame sent with the fds; the
+// link then sends a hello frame with the version to speak, which the daemon
+// acknowledges, and both sides exchange frames from then on. The first byte
+// of a hello frame can not start a gob stream, so the daemon tells the two
+// versions apart by it.
+const (
+	LegacyProtocolVersion = 1
+	ProtocolVersion       = 2
+)
+
+type FrameType byte
+
+const (
+	FrameHello FrameType = iota
+	FrameData
+	FrameEOF
+	FrameWindowSize
+	FrameSignal
+	FrameKeepalive
+
+	// sent by the i/o daemon when something goes wrong with the link, e.g.
+	// its output was cut short because it fell too far behind
+	FrameError
+)
+
+// MaxFramePayload bounds the payload of a frame, so that a corrupt stream
+// does not have either side allocate arbitrary amounts of memory.
+const MaxFramePayload = 1024 * 1024
+
+var ErrFrameTooLarge = errors.New("link: frame too large")
+
+// Frame is a type byte and a payload, preceded on the wire by its length as
+// a big-endian uint32. Frames of an unknown type are ignored, so that new
+// types can be added without a new version.
+type Frame struct {
+	Type    FrameType
+	Payload []byte
+}
+
+func WriteFrame(w io.Writer, frame Frame) error {
+	if len(frame.Payload) > MaxFramePayload {
+		return ErrFrameTooLarge
+	}
+
+	buf := make([]byte, 5+len(frame.Payload))
+	buf[0] = byte(frame.Type)
+	binary.BigEndian.PutUint32(buf[1:5], uint32(len(frame.Payload)))
+	copy(buf[5:], frame.Payload)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+func ReadFrame(r io.Reader) (Frame, error) {
+	var header [5]byte
+
+	_, err := io.ReadFull(r, header[:])
+	if err != nil {
+		return Frame{}, err
+	}
+
+	size := binary.BigEndian.Uint32(header[1:5])
+	if size > MaxFramePayload {
+		return Frame{}, ErrFrameTooLarge
+	}
+
+	frame := Frame{
+		Type:    FrameType(header[0]),
+		Payload: make([]byte, size),
+	}
+
+	_, err = io.ReadFull(r, frame.Payload)
+	if err != nil {
+		return Frame{}, err
+	}
+
+	return frame, nil
+}
+
+func HelloFrame(version int) Frame {
+	return Frame{Type: FrameHello, Payload: uint32Payload(uint32(version))}
+}
+
+func WindowSizeFrame(columns, rows int) Frame {
+	return Frame{Type: FrameWindowSize, Payload: uint32Payload(uint32(columns), uint32(rows))}
+}
+
+func SignalFrame(signal int) Frame {
+	return Frame{Type: FrameSignal, Payload: uint32Payload(uint32(signal))}
+}
+
+func ErrorFrame(message string) Frame {
+	return Frame{Type: FrameError, Payload: []byte(message)}
+}
+
+// ParseHello returns the version a hello frame is for.
+func ParseHello(frame Frame) (int, error) {
+	values, err := parseUint32Payload(frame, FrameHello, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(values[0]), nil
+}
+
+func ParseWindowSize(frame Frame) (WindowSize, error) {
+	values, err := parseUint32Payload(frame, FrameWindowSize, 2)
+	if err != nil {
+		return WindowSize{}, err
+	}
+
+	return WindowSize{Columns: int(values[0]), Rows: int(values[1])}, nil
+}
+
+func ParseSignal(frame Frame) (int, error) {
+	values, err := parseUint32Payload(frame, FrameSignal, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(values[0]), nil
+}
+
+func uint32Payload(values ...uint32) []byte {
+	payload := make([]byte, 4*len(values))
+	for i, value := range values {
+		binary.BigEndian.PutUint32(payload[4*i:], value)
+	}
+
+	return payload
+}
+
+func parseUint32Payload(frame Frame, frameType FrameType, count int) ([]uint32, error) {
+	if frame.Type != frameType {
+		return nil, fmt.Errorf("link: expected frame of type %d, got %d", frameType, frame.Type)
+	}
+
+	if len(frame.Payload) < 4*count {
+		return nil, fmt.Errorf("link: frame of type %d too short: %d bytes", frame.Type, len(frame.Payload))
+	}
+
+	values := make([]uint32, count)
+	for i := range values {
+		values[i] = binary.BigEndian.Uint32(frame.Payload[4*i:])
+	}
+
+	return values, nil
+}
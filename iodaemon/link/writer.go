@@ -2,9 +2,12 @@ package link
 
 import (
 	"encoding/gob"
+	"fmt"
 	"net"
+	"sync"
 )
 
+// Input is what links send over version 1 of the protocol.
 type Input struct {
 	Data       []byte
 	EOF        bool
@@ -16,16 +19,48 @@ type WindowSize struct {
 	Rows    int
 }
 
+type UnsupportedError struct {
+	Operation string
+	Version   int
+}
+
+func (e UnsupportedError) Error() string {
+	return fmt.Sprintf("link: %s is not supported by protocol version %d", e.Operation, e.Version)
+}
+
 type Writer struct {
+	conn    net.Conn
+	version int
+
+	// only for version 1
 	enc *gob.Encoder
+
+	mutex sync.Mutex
 }
 
+// NewWriter returns a writer speaking version 1 of the protocol.
 func NewWriter(conn net.Conn) *Writer {
-	return &Writer{enc: gob.NewEncoder(conn)}
+	return &Writer{conn: conn, version: LegacyProtocolVersion, enc: gob.NewEncoder(conn)}
+}
+
+// NewFramedWriter returns a writer speaking the given version of the
+// protocol, which must have been agreed on with the i/o daemon.
+func NewFramedWriter(conn net.Conn, version int) *Writer {
+	return &Writer{conn: conn, version: version}
+}
+
+func (w *Writer) Version() int {
+	return w.version
 }
 
 func (w *Writer) Write(d []byte) (int, error) {
-	err := w.enc.Encode(Input{Data: d})
+	var err error
+	if w.enc != nil {
+		err = w.encode(Input{Data: d})
+	} else {
+		err = w.writeFrame(Frame{Type: FrameData, Payload: d})
+	}
+
 	if err != nil {
 		return 0, err
 	}
@@ -34,14 +69,55 @@ func (w *Writer) Write(d []byte) (int, error) {
 }
 
 func (w *Writer) Close() error {
-	return w.enc.Encode(Input{EOF: true})
+	if w.enc != nil {
+		return w.encode(Input{EOF: true})
+	}
+
+	return w.writeFrame(Frame{Type: FrameEOF})
 }
 
 func (w *Writer) SetWindowSize(cols, rows int) error {
-	return w.enc.Encode(Input{
-		WindowSize: &WindowSize{
-			Columns: cols,
-			Rows:    rows,
-		},
-	})
+	if w.enc != nil {
+		return w.encode(Input{
+			WindowSize: &WindowSize{
+				Columns: cols,
+				Rows:    rows,
+			},
+		})
+	}
+
+	return w.writeFrame(WindowSizeFrame(cols, rows))
+}
+
+// Signal has the i/o daemon send a signal to the process.
+func (w *Writer) Signal(signal int) error {
+	if w.enc != nil {
+		return UnsupportedError{"signalling", w.version}
+	}
+
+	return w.writeFrame(SignalFrame(signal))
+}
+
+func (w *Writer) encode(input Input) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.enc.Encode(input)
+}
+
+func (w *Writer) writeFrame(frame Frame) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// data larger than a frame can carry is split across several
+	for len(frame.Payload) > MaxFramePayload {
+		err := WriteFrame(w.conn, Frame{Type: frame.Type, Payload: frame.Payload[:MaxFramePayload]})
+		if err != nil {
+			return err
+		}
+
+		frame.Payload = frame.Payload[MaxFramePayload:]
+	}
+
+	return WriteFrame(w.conn, frame)
 }
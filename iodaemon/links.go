@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"sync"
+
+	linkpkg "github.com/cloudfoundry-incubator/garden-linux/iodaemon/link"
+)
+
+// How far a secondary link may fall behind the child's output before it is
+// dropped; the primary link holds up the child instead.
+const linkBufferSize = 1024 * 1024
+
+// How much of the output produced while no link is attached is kept for the
+// next link to connect.
+const detachedOutputSize = 64 * 1024
+
+// outputFanOut copies a stream of the child's output to a pipe per link, so
+// that every link sees all of the output from when it connected, and the
+// most recent output from while none was attached.
+//
+// The primary link, the first attached while no other is, owns the output:
+// like the pipe it replaces, it holds up the child while it is behind, so
+// that none of the output is lost. Secondary links, e.g. debugging sessions,
+// are dropped instead once they fall too far behind, and told so.
+type outputFanOut struct {
+	source *os.File
+
+	sinks    []*linkSink
+	detached []byte
+	closed   bool
+
+	mutex sync.Mutex
+}
+
+func newOutputFanOut(source *os.File) *outputFanOut {
+	return &outputFanOut{source: source}
+}
+
+// addLink returns the read end of a new pipe for a link to be sent. The
+// link is told through truncated if it is dropped for falling behind.
+func (f *outputFanOut) addLink(truncated func()) (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	sink := newLinkSink(w, f.detached, !f.hasPrimary(), truncated)
+	f.detached = nil
+
+	if f.closed {
+		sink.close()
+	} else {
+		f.sinks = append(f.sinks, sink)
+	}
+
+	return r, nil
+}
+
+// must be called with mutex held
+func (f *outputFanOut) hasPrimary() bool {
+	for _, sink := range f.sinks {
+		if sink.primary && !sink.dropped() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// run copies the output until the child and anything it passed the stream
+// on to are done with it.
+func (f *outputFanOut) run() {
+	buf := make([]byte, 32*1024)
+
+	for {
+		n, err := f.source.Read(buf)
+		if n > 0 {
+			f.write(buf[:n])
+		}
+
+		// reading the master of a tty fails with EIO once the child is done
+		// with it, rather than reaching EOF
+		if err != nil {
+			break
+		}
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, sink := range f.sinks {
+		sink.close()
+	}
+
+	f.sinks = nil
+	f.closed = true
+}
+
+// write queues the data for every link, waiting only for the primary link
+// to have room for it. Links which are dropped, e.g. because they went
+// away, are forgotten.
+func (f *outputFanOut) write(data []byte) {
+	f.mutex.Lock()
+
+	if len(f.sinks) == 0 {
+		f.detached = append(f.detached, data...)
+		if excess := len(f.detached) - detachedOutputSize; excess > 0 {
+			f.detached = append([]byte(nil), f.detached[excess:]...)
+		}
+
+		f.mutex.Unlock()
+		return
+	}
+
+	sinks := append([]*linkSink(nil), f.sinks...)
+
+	// links may connect while waiting on the primary link
+	f.mutex.Unlock()
+
+	for _, sink := range sinks {
+		sink.enqueue(data)
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	remaining := f.sinks[:0]
+
+	for _, sink := range f.sinks {
+		if !sink.dropped() {
+			remaining = append(remaining, sink)
+		}
+	}
+
+	f.sinks = remaining
+}
+
+// linkSink buffers output for one link, written to its pipe by a goroutine
+// of its own so that a link which stops reading holds up no other.
+type linkSink struct {
+	pipe      *os.File
+	primary   bool
+	truncated func()
+
+	buffer  bytes.Buffer
+	closing bool
+	done    bool
+
+	cond  *sync.Cond
+	mutex sync.Mutex
+}
+
+func newLinkSink(pipe *os.File, initial []byte, primary bool, truncated func()) *linkSink {
+	sink := &linkSink{
+		pipe:      pipe,
+		primary:   primary,
+		truncated: truncated,
+	}
+
+	sink.cond = sync.NewCond(&sink.mutex)
+	sink.buffer.Write(initial)
+
+	go sink.run()
+
+	return sink
+}
+
+// enqueue waits for room in the buffer of the primary link, and drops a
+// secondary link which has no room left.
+func (s *linkSink) enqueue(data []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for s.primary && !s.done && s.buffer.Len() > 0 && s.buffer.Len()+len(data) > linkBufferSize {
+		s.cond.Wait()
+	}
+
+	if s.done {
+		return
+	}
+
+	if s.buffer.Len()+len(data) > linkBufferSize {
+		if s.truncated != nil {
+			s.truncated()
+		}
+
+		s.closePipe()
+		return
+	}
+
+	s.buffer.Write(data)
+	s.cond.Broadcast()
+}
+
+func (s *linkSink) dropped() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.done
+}
+
+// close closes the pipe once the link has been sent what is buffered.
+func (s *linkSink) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closing = true
+	s.cond.Broadcast()
+}
+
+// must be called with mutex held; closing the pipe also interrupts a write
+// to it which is blocked
+func (s *linkSink) closePipe() {
+	if !s.done {
+		s.done = true
+		s.pipe.Close()
+		s.cond.Broadcast()
+	}
+}
+
+func (s *linkSink) run() {
+	chunk := make([]byte, 32*1024)
+
+	for {
+		s.mutex.Lock()
+
+		for s.buffer.Len() == 0 && !s.closing && !s.done {
+			s.cond.Wait()
+		}
+
+		if s.done || s.buffer.Len() == 0 {
+			s.closePipe()
+			s.mutex.Unlock()
+			return
+		}
+
+		n, _ := s.buffer.Read(chunk)
+
+		// the primary link may have been waiting for room
+		s.cond.Broadcast()
+
+		s.mutex.Unlock()
+
+		_, err := s.pipe.Write(chunk[:n])
+		if err != nil {
+			s.mutex.Lock()
+			s.closePipe()
+			s.mutex.Unlock()
+			return
+		}
+	}
+}
+
+// statusFanOut reports the exit status of the child to every link, including
+// those connecting after it exited.
+type statusFanOut struct {
+	sinks      []*os.File
+	exitStatus *linkpkg.ExitStatus
+
+	mutex sync.Mutex
+}
+
+func (f *statusFanOut) addLink() (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.exitStatus != nil {
+		linkpkg.WriteStatus(w, *f.exitStatus)
+		w.Close()
+	} else {
+		f.sinks = append(f.sinks, w)
+	}
+
+	return r, nil
+}
+
+func (f *statusFanOut) report(exitStatus linkpkg.ExitStatus) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.exitStatus = &exitStatus
+
+	for _, sink := range f.sinks {
+		linkpkg.WriteStatus(sink, exitStatus)
+		sink.Close()
+	}
+
+	f.sinks = nil
+}
+
+// stdinArbiter lets one link at a time write to the child's stdin: the first
+// to send it anything, until it disconnects. Input from other links is
+// dropped, so that e.g. a debugging session observing the child cannot
+// close its stdin from under the link which owns it.
+type stdinArbiter struct {
+	owner net.Conn
+	mutex sync.Mutex
+}
+
+func (a *stdinArbiter) claim(conn net.Conn) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.owner == nil {
+		a.owner = conn
+	}
+
+	return a.owner == conn
+}
+
+func (a *stdinArbiter) release(conn net.Conn) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.owner == conn {
+		a.owner = nil
+	}
+}
+
+// linkConn is the connection of a link, which frames may be sent to from
+// several goroutines once it has agreed on a framed version of the protocol.
+type linkConn struct {
+	net.Conn
+
+	framed       bool
+	pendingError string
+
+	mutex sync.Mutex
+}
+
+// acknowledge agrees on a framed version of the protocol, sending any error
+// reported meanwhile.
+func (c *linkConn) acknowledge(version int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err := linkpkg.WriteFrame(c.Conn, linkpkg.HelloFrame(version))
+	if err != nil {
+		return err
+	}
+
+	c.framed = true
+
+	if c.pendingError != "" {
+		return linkpkg.WriteFrame(c.Conn, linkpkg.ErrorFrame(c.pendingError))
+	}
+
+	return nil
+}
+
+func (c *linkConn) writeFrame(frame linkpkg.Frame) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return linkpkg.WriteFrame(c.Conn, frame)
+}
+
+// reportError tells the link something went wrong with it, unless it only
+// speaks version 1 of the protocol, which has no way to.
+func (c *linkConn) reportError(message string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.framed {
+		c.pendingError = message
+		return
+	}
+
+	linkpkg.WriteFrame(c.Conn, linkpkg.ErrorFrame(message))
+}
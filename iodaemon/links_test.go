@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Output fan-out", func() {
+	var (
+		source  *os.File
+		child   *os.File
+		fanOut  *outputFanOut
+		running chan struct{}
+	)
+
+	BeforeEach(func() {
+		var err error
+		source, child, err = os.Pipe()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		fanOut = newOutputFanOut(source)
+
+		running = make(chan struct{})
+		go func() {
+			fanOut.run()
+			close(running)
+		}()
+	})
+
+	AfterEach(func() {
+		child.Close()
+		Eventually(running).Should(BeClosed())
+		source.Close()
+	})
+
+	addLink := func() *os.File {
+		link, err := fanOut.addLink(nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		return link
+	}
+
+	readAll := func(link *os.File) <-chan []byte {
+		read := make(chan []byte, 1)
+
+		go func() {
+			defer GinkgoRecover()
+
+			contents, err := ioutil.ReadAll(link)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			read <- contents
+		}()
+
+		return read
+	}
+
+	It("does not hold up other links for a secondary link which stops reading", func() {
+		reading := readAll(addLink())
+
+		stalled := addLink()
+		defer stalled.Close()
+
+		output := bytes.Repeat([]byte("x"), 512*1024)
+
+		_, err := child.Write(output)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		child.Close()
+
+		var contents []byte
+		Eventually(reading).Should(Receive(&contents))
+		Ω(contents).Should(Equal(output))
+	})
+
+	It("drops a secondary link which falls too far behind, telling it so", func() {
+		reading := readAll(addLink())
+
+		truncated := make(chan struct{})
+		stalled, err := fanOut.addLink(func() { close(truncated) })
+		Ω(err).ShouldNot(HaveOccurred())
+		defer stalled.Close()
+
+		written := 0
+
+		chunk := bytes.Repeat([]byte("x"), 64*1024)
+		for written <= 2*linkBufferSize {
+			_, err := child.Write(chunk)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			written += len(chunk)
+		}
+
+		Eventually(truncated).Should(BeClosed())
+
+		var contents []byte
+		Eventually(readAll(stalled)).Should(Receive(&contents))
+		Ω(len(contents)).Should(BeNumerically("<=", 2*linkBufferSize))
+
+		child.Close()
+
+		Eventually(reading).Should(Receive(&contents))
+		Ω(contents).Should(HaveLen(written))
+	})
+
+	It("gives a slow primary link all of the output, holding up the child", func() {
+		link := addLink()
+
+		read := make(chan int, 1)
+		go func() {
+			defer GinkgoRecover()
+
+			total := 0
+			buf := make([]byte, 4096)
+
+			for {
+				n, err := link.Read(buf)
+				total += n
+
+				if err != nil {
+					break
+				}
+
+				time.Sleep(100 * time.Microsecond)
+			}
+
+			read <- total
+		}()
+
+		const size = 8000000
+
+		go func() {
+			defer GinkgoRecover()
+
+			_, err := child.Write(bytes.Repeat([]byte("x"), size))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			child.Close()
+		}()
+
+		Eventually(read, 30*time.Second).Should(Receive(Equal(size)))
+	})
+
+	It("gives the output from while no link was attached to the next to connect", func() {
+		_, err := child.Write([]byte("early\n"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Eventually(func() []byte {
+			fanOut.mutex.Lock()
+			defer fanOut.mutex.Unlock()
+			return fanOut.detached
+		}).Should(Equal([]byte("early\n")))
+
+		reading := readAll(addLink())
+
+		_, err = child.Write([]byte("late\n"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		child.Close()
+
+		Eventually(reading).Should(Receive(Equal([]byte("early\nlate\n"))))
+
+		Eventually(readAll(addLink())).Should(Receive(BeEmpty()))
+	})
+
+	It("only keeps the most recent output from while no link was attached", func() {
+		chunk := bytes.Repeat([]byte("x"), detachedOutputSize)
+
+		_, err := child.Write(chunk)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, err = child.Write([]byte("last"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		child.Close()
+		Eventually(running).Should(BeClosed())
+
+		var contents []byte
+		Eventually(readAll(addLink())).Should(Receive(&contents))
+		Ω(contents).Should(HaveLen(detachedOutputSize))
+		Ω(string(contents)).Should(HaveSuffix("last"))
+	})
+})
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/gob"
 	"fmt"
 	"net"
@@ -9,6 +11,7 @@ import (
 	"path/filepath"
 	debugPkg "runtime/debug"
 	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
@@ -70,11 +73,10 @@ func spawn(
 		return
 	}
 
-	statusR, statusW, err := os.Pipe()
-	if err != nil {
-		fatal(err)
-		return
-	}
+	stdout := newOutputFanOut(stdoutR)
+	stderr := newOutputFanOut(stderrR)
+	status := &statusFanOut{}
+	stdin := &stdinArbiter{}
 
 	notify(notifyStream, "ready")
 
@@ -86,14 +88,14 @@ func spawn(
 
 	// Loop accepting and processing connections from the caller.
 	for {
-		conn, err := acceptConnection(listener, stdoutR, stderrR, statusR)
+		conn, err := acceptConnection(listener, stdout, stderr, status)
 		if err != nil {
 			fatal(err)
 			return
 		}
 
 		if !childProcessStarted {
-			err = startChildProcess(cmd, errStream, notifyStream, statusW, childProcessTerminated)
+			err = startChildProcess(cmd, errStream, notifyStream, stdout, stderr, status, linkpkg.ExitStatusPath(socketPath), childProcessTerminated)
 			if err != nil {
 				fatal(err)
 				return
@@ -102,24 +104,50 @@ func spawn(
 			childProcessStarted = true
 		}
 
-		processLinkRequests(conn, stdinW, cmd, withTty)
+		// links are served concurrently, e.g. a debugging session alongside
+		// the link which owns the child
+		go processLinkRequests(conn, stdinW, stdin, cmd, withTty)
 	}
 }
 
-func startChildProcess(cmd *exec.Cmd, errStream, notifyStream io.WriteCloser, statusW *os.File, done chan bool) error {
+func startChildProcess(cmd *exec.Cmd, errStream, notifyStream io.WriteCloser, stdout, stderr *outputFanOut, status *statusFanOut, exitStatusPath string, done chan bool) error {
 	err := cmd.Start()
 	if err != nil {
 		return err
 	}
 
+	// the child's ends of its stdio must only be held by the child, for its
+	// output to end when it is done with it
+	for _, stream := range []interface{}{cmd.Stdin, cmd.Stdout, cmd.Stderr} {
+		if file, ok := stream.(*os.File); ok {
+			file.Close()
+		}
+	}
+
 	notify(notifyStream, "active")
 	notifyStream.Close()
 
+	output := &sync.WaitGroup{}
+	for _, fanOut := range []*outputFanOut{stdout, stderr} {
+		output.Add(1)
+		go func(fanOut *outputFanOut) {
+			fanOut.run()
+			output.Done()
+		}(fanOut)
+	}
+
 	go func() {
 		cmd.Wait()
+		output.Wait()
 
 		if cmd.ProcessState != nil {
-			fmt.Fprintf(statusW, "%d\n", cmd.ProcessState.Sys().(syscall.WaitStatus).ExitStatus())
+			exitStatus := linkpkg.NewExitStatus(cmd.ProcessState)
+
+			// Record the exit status before reporting it, so that it is not lost
+			// when nothing is linked; there is nowhere left to report a failure.
+			linkpkg.WriteExitStatus(exitStatusPath, exitStatus)
+
+			status.report(exitStatus)
 		}
 
 		done <- true
@@ -170,19 +198,50 @@ func listen(socketPath string) (net.Listener, error) {
 	return net.Listen("unix", socketPath)
 }
 
-func acceptConnection(listener net.Listener, stdoutR, stderrR, statusR *os.File) (net.Conn, error) {
-	conn, err := listener.Accept()
+func acceptConnection(listener net.Listener, stdout, stderr *outputFanOut, status *statusFanOut) (*linkConn, error) {
+	accepted, err := listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &linkConn{Conn: accepted}
+
+	stdoutR, err := stdout.addLink(func() { conn.reportError("stdout truncated: link fell too far behind") })
+	if err != nil {
+		return nil, err
+	}
+
+	defer stdoutR.Close()
+
+	stderrR, err := stderr.addLink(func() { conn.reportError("stderr truncated: link fell too far behind") })
 	if err != nil {
 		return nil, err
 	}
 
+	defer stderrR.Close()
+
+	statusR, err := status.addLink()
+	if err != nil {
+		return nil, err
+	}
+
+	defer statusR.Close()
+
 	rights := syscall.UnixRights(
 		int(stdoutR.Fd()),
 		int(stderrR.Fd()),
 		int(statusR.Fd()),
 	)
 
-	_, _, err = conn.(*net.UnixConn).WriteMsgUnix([]byte{}, rights, nil)
+	// links which only speak version 1 of the protocol ignore the
+	// announcement of the version sent with the fds
+	var announcement bytes.Buffer
+	err = linkpkg.WriteFrame(&announcement, linkpkg.HelloFrame(linkpkg.ProtocolVersion))
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, err = accepted.(*net.UnixConn).WriteMsgUnix(announcement.Bytes(), rights, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -192,8 +251,26 @@ func acceptConnection(listener net.Listener, stdoutR, stderrR, statusR *os.File)
 
 // Loop receiving and processing link requests on the given connection.
 // The loop terminates when the connection is closed or an error occurs.
-func processLinkRequests(conn net.Conn, stdinW *os.File, cmd *exec.Cmd, withTty bool) {
-	decoder := gob.NewDecoder(conn)
+// Input for stdin is only processed while the link owns it; see stdinArbiter.
+func processLinkRequests(conn *linkConn, stdinW *os.File, stdin *stdinArbiter, cmd *exec.Cmd, withTty bool) {
+	defer stdin.release(conn)
+
+	reader := bufio.NewReader(conn)
+
+	first, err := reader.Peek(1)
+	if err != nil {
+		return
+	}
+
+	if linkpkg.FrameType(first[0]) == linkpkg.FrameHello {
+		processFramedLinkRequests(conn, reader, stdinW, stdin, cmd, withTty)
+	} else {
+		processLegacyLinkRequests(conn, reader, stdinW, stdin, cmd, withTty)
+	}
+}
+
+func processLegacyLinkRequests(conn *linkConn, reader io.Reader, stdinW *os.File, stdin *stdinArbiter, cmd *exec.Cmd, withTty bool) {
+	decoder := gob.NewDecoder(reader)
 
 	for {
 		var input linkpkg.Input
@@ -203,14 +280,11 @@ func processLinkRequests(conn net.Conn, stdinW *os.File, cmd *exec.Cmd, withTty
 		}
 
 		if input.WindowSize != nil {
-			setWinSize(stdinW, input.WindowSize.Columns, input.WindowSize.Rows)
-			cmd.Process.Signal(syscall.SIGWINCH)
+			setWindowSize(stdinW, cmd, *input.WindowSize)
+		} else if !stdin.claim(conn) {
+			continue
 		} else if input.EOF {
-			stdinW.Sync()
-			err := stdinW.Close()
-			if withTty {
-				cmd.Process.Signal(syscall.SIGHUP)
-			}
+			err := closeStdin(stdinW, cmd, withTty)
 			if err != nil {
 				conn.Close()
 				break
@@ -225,6 +299,81 @@ func processLinkRequests(conn net.Conn, stdinW *os.File, cmd *exec.Cmd, withTty
 	}
 }
 
+func processFramedLinkRequests(conn *linkConn, reader io.Reader, stdinW *os.File, stdin *stdinArbiter, cmd *exec.Cmd, withTty bool) {
+	defer conn.Close()
+
+	frame, err := linkpkg.ReadFrame(reader)
+	if err != nil {
+		return
+	}
+
+	version, err := linkpkg.ParseHello(frame)
+	if err != nil || version <= linkpkg.LegacyProtocolVersion || version > linkpkg.ProtocolVersion {
+		return
+	}
+
+	err = conn.acknowledge(version)
+	if err != nil {
+		return
+	}
+
+	for {
+		frame, err := linkpkg.ReadFrame(reader)
+		if err != nil {
+			return
+		}
+
+		switch frame.Type {
+		case linkpkg.FrameData:
+			if stdin.claim(conn) {
+				_, err = stdinW.Write(frame.Payload)
+			}
+
+		case linkpkg.FrameEOF:
+			if stdin.claim(conn) {
+				err = closeStdin(stdinW, cmd, withTty)
+			}
+
+		case linkpkg.FrameWindowSize:
+			var windowSize linkpkg.WindowSize
+			windowSize, err = linkpkg.ParseWindowSize(frame)
+			if err == nil {
+				setWindowSize(stdinW, cmd, windowSize)
+			}
+
+		case linkpkg.FrameSignal:
+			var signal int
+			signal, err = linkpkg.ParseSignal(frame)
+			if err == nil {
+				// failing to signal is no reason to drop the link
+				cmd.Process.Signal(syscall.Signal(signal))
+			}
+
+		case linkpkg.FrameKeepalive:
+			err = conn.writeFrame(linkpkg.Frame{Type: linkpkg.FrameKeepalive})
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func setWindowSize(stdinW *os.File, cmd *exec.Cmd, windowSize linkpkg.WindowSize) {
+	setWinSize(stdinW, windowSize.Columns, windowSize.Rows)
+	cmd.Process.Signal(syscall.SIGWINCH)
+}
+
+func closeStdin(stdinW *os.File, cmd *exec.Cmd, withTty bool) error {
+	stdinW.Sync()
+	err := stdinW.Close()
+	if withTty {
+		cmd.Process.Signal(syscall.SIGHUP)
+	}
+
+	return err
+}
+
 func createPipes() (stdinR, stdinW, stdoutR, stdoutW, stderrR, stderrW *os.File, err error) {
 	// stderr will not be assigned in the case of a tty, so make
 	// a dummy pipe to send across instead
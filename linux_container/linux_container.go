@@ -2,9 +2,11 @@ package linux_container
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
@@ -12,9 +14,12 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/events"
+	"github.com/cloudfoundry-incubator/garden-linux/iodaemon/link"
 	"github.com/cloudfoundry-incubator/garden-linux/network"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/bandwidth_manager"
@@ -24,6 +29,7 @@ import (
 	"github.com/cloudfoundry-incubator/garden-linux/process"
 	"github.com/cloudfoundry-incubator/garden-linux/process_tracker"
 	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/pivotal-golang/clock"
 	"github.com/pivotal-golang/lager"
 )
 
@@ -35,6 +41,15 @@ func (err UndefinedPropertyError) Error() string {
 	return fmt.Sprintf("property does not exist: %s", err.Key)
 }
 
+type StateTransitionError struct {
+	Action string
+	State  State
+}
+
+func (err StateTransitionError) Error() string {
+	return fmt.Sprintf("cannot %s container in state: %s", err.Action, err.State)
+}
+
 type LinuxContainer struct {
 	logger lager.Logger
 
@@ -42,8 +57,12 @@ type LinuxContainer struct {
 	handle string
 	path   string
 
-	properties      garden.Properties
-	propertiesMutex sync.RWMutex
+	properties         garden.Properties
+	propertiesObserver func(garden.Properties)
+	propertiesMutex    sync.RWMutex
+
+	limitsAdmission      func(linux_backend.CommittedResources) (func(), error)
+	limitsAdmissionMutex sync.RWMutex
 
 	graceTime time.Duration
 
@@ -53,6 +72,8 @@ type LinuxContainer struct {
 	events      []string
 	eventsMutex sync.RWMutex
 
+	eventHub *events.Hub
+
 	resources *linux_backend.Resources
 
 	portPool PortPool
@@ -69,18 +90,30 @@ type LinuxContainer struct {
 
 	oomMutex    sync.RWMutex
 	oomNotifier *exec.Cmd
+	oomPolicy   OomPolicy
 
 	currentBandwidthLimits *garden.BandwidthLimits
 	bandwidthMutex         sync.RWMutex
 
 	currentDiskLimits *garden.DiskLimits
+	quotaExceeded     bool
+	sampledDiskStat   *garden.ContainerDiskStat
 	diskMutex         sync.RWMutex
 
 	currentMemoryLimits *garden.MemoryLimits
 	memoryMutex         sync.RWMutex
 
-	currentCPULimits *garden.CPULimits
-	cpuMutex         sync.RWMutex
+	currentCPULimits      *garden.CPULimits
+	currentCPUQuotaLimits *CPUQuotaLimits
+	cpuMutex              sync.RWMutex
+
+	currentBlockIOLimits *BlockIOLimits
+	blockIOMutex         sync.RWMutex
+
+	currentPidLimits *PidLimits
+	pidLimitHits     uint64
+	pidWatcherStop   chan struct{}
+	pidMutex         sync.RWMutex
 
 	netIns      []NetInSpec
 	netInsMutex sync.RWMutex
@@ -92,7 +125,15 @@ type LinuxContainer struct {
 
 	env process.Env
 
+	// the environment loaded from the env files, kept until EnvFilesProperty
+	// changes
+	envFilesEnv   process.Env
+	envFilesKey   string
+	envFilesMutex sync.Mutex
+
 	processIDPool *ProcessIDPool
+
+	metricsSampler *MetricsSampler
 }
 
 type ProcessIDPool struct {
@@ -122,6 +163,118 @@ type NetInSpec struct {
 	ContainerPort uint32
 }
 
+// Absolute CPU cap enforced by the CFS bandwidth controller: the container
+// may use at most QuotaInMicroseconds of CPU time every PeriodInMicroseconds.
+type CPUQuotaLimits struct {
+	// Zero removes the cap.
+	QuotaInMicroseconds uint64 `json:"quota_us,omitempty"`
+
+	// Zero leaves the current period (the kernel default is 100ms) in place.
+	PeriodInMicroseconds uint64 `json:"period_us,omitempty"`
+}
+
+type BlockIOLimits struct {
+	// Device to throttle, as "major:minor". Defaults to the whole disk
+	// holding the container's depot directory; it must be given when that
+	// is not on a block device, e.g. on overlay or tmpfs.
+	Device string `json:"device,omitempty"`
+
+	// Proportional weight (10-1000) relative to other containers. Zero
+	// leaves the current weight in place.
+	Weight uint64 `json:"weight,omitempty"`
+
+	// Throttles for the device. Zero removes the throttle.
+	ReadBytesPerSecond  uint64 `json:"read_bps,omitempty"`
+	WriteBytesPerSecond uint64 `json:"write_bps,omitempty"`
+	ReadIOPerSecond     uint64 `json:"read_iops,omitempty"`
+	WriteIOPerSecond    uint64 `json:"write_iops,omitempty"`
+}
+
+// What to do when the container runs out of memory.
+type OomPolicy string
+
+const (
+	// Stop the whole container. This is the default.
+	OomPolicyStop = OomPolicy("stop")
+
+	// Let the kernel kill the offending process and keep the container
+	// running.
+	OomPolicyKillProcess = OomPolicy("kill-process")
+
+	// Only record the event. The kernel's OOM killer is disabled, so
+	// processes wait for memory to be freed or the limit to be raised.
+	OomPolicyNotify = OomPolicy("notify")
+)
+
+type UnknownOomPolicyError struct {
+	Policy OomPolicy
+}
+
+func (err UnknownOomPolicyError) Error() string {
+	return fmt.Sprintf("unknown oom policy: %s", err.Policy)
+}
+
+// Property which, when given at creation, sets the container's OomPolicy.
+const OomPolicyProperty = "garden.oom_policy"
+
+// Property which, when given at creation, limits the number of processes
+// the container may run.
+const PidLimitProperty = "garden.pid_limit"
+
+// Properties which have the output of the container's processes written to
+// log files, rotated once they reach the given size. Unless set, only the
+// current log file is kept.
+const ProcessLogMaxBytesProperty = "garden.process_log_max_bytes"
+const ProcessLogMaxFilesProperty = "garden.process_log_max_files"
+
+// Properties which bound how long the container's processes may run, as
+// durations such as "30m"; see process_tracker.TimeoutSpec.
+const ProcessTimeoutProperty = "garden.process_timeout"
+const ProcessTimeoutGracePeriodProperty = "garden.process_timeout_grace_period"
+
+// Property which has the container's processes load environment variables
+// from files in its rootfs, as a comma-separated list of paths such as
+// "/etc/environment"; see process.ParseEnvFile. Later files take precedence,
+// and a process's own environment over them all.
+const EnvFilesProperty = "garden.env_files"
+
+// How often the pids cgroup is checked for forks refused by the limit.
+const pidEventsPollInterval = time.Second
+
+type PidLimits struct {
+	// Maximum number of processes. Zero removes the limit.
+	Max uint64 `json:"max,omitempty"`
+}
+
+type PidsControllerUnavailableError struct {
+	Cause error
+}
+
+func (err PidsControllerUnavailableError) Error() string {
+	return fmt.Sprintf("pids cgroup controller unavailable: %s", err.Cause)
+}
+
+type ContainerPidStat struct {
+	Current uint64
+	Max     uint64
+}
+
+type ContainerBlockIOStat struct {
+	ReadBytes  uint64
+	WriteBytes uint64
+	ReadOps    uint64
+	WriteOps   uint64
+}
+
+// LinuxInfo extends garden.ContainerInfo with details only this backend
+// can provide.
+type LinuxInfo struct {
+	garden.ContainerInfo
+
+	BlockIOStat ContainerBlockIOStat
+	PidStat     ContainerPidStat
+}
+
 type PortPool interface {
 	Acquire() (uint32, error)
 	Remove(uint32) error
@@ -133,9 +286,19 @@ type State string
 const (
 	StateBorn    = State("born")
 	StateActive  = State("active")
+	StatePaused  = State("paused")
 	StateStopped = State("stopped")
 )
 
+const (
+	freezerFrozen = "FROZEN"
+	freezerThawed = "THAWED"
+)
+
+// how long to wait for the kernel to finish freezing or thawing every task
+// in the container
+const freezerTimeout = 10 * time.Second
+
 func NewLinuxContainer(
 	logger lager.Logger,
 	id, handle, path string,
@@ -151,7 +314,7 @@ func NewLinuxContainer(
 	env process.Env,
 	filter network.Filter,
 ) *LinuxContainer {
-	return &LinuxContainer{
+	c := &LinuxContainer{
 		logger: logger,
 
 		id:     id,
@@ -165,6 +328,8 @@ func NewLinuxContainer(
 		state:  StateBorn,
 		events: []string{},
 
+		eventHub: events.NewHub(),
+
 		resources: resources,
 
 		portPool: portPool,
@@ -182,6 +347,16 @@ func NewLinuxContainer(
 		env:           env,
 		processIDPool: &ProcessIDPool{},
 	}
+
+	c.metricsSampler = NewMetricsSampler(
+		logger.Session("metrics"),
+		clock.NewClock(),
+		MetricsSampleInterval,
+		MetricsHistorySize,
+		c.sampleMetrics,
+	)
+
+	return c
 }
 
 func (c *LinuxContainer) ID() string {
@@ -214,6 +389,15 @@ func (c *LinuxContainer) Events() []string {
 	return events
 }
 
+func (c *LinuxContainer) Subscribe() *events.Subscription {
+	return c.eventHub.Subscribe()
+}
+
+func (c *LinuxContainer) Destroyed() {
+	c.publishEvent(events.TypeDestroy, nil)
+	c.eventHub.Close()
+}
+
 func (c *LinuxContainer) Resources() *linux_backend.Resources {
 	return c.resources
 }
@@ -238,16 +422,27 @@ func (c *LinuxContainer) Snapshot(out io.Writer) error {
 	c.netInsMutex.RLock()
 	defer c.netInsMutex.RUnlock()
 
+	c.blockIOMutex.RLock()
+	defer c.blockIOMutex.RUnlock()
+
+	c.pidMutex.RLock()
+	defer c.pidMutex.RUnlock()
+
 	c.netOutsMutex.RLock()
 	defer c.netOutsMutex.RUnlock()
 
 	processSnapshots := []ProcessSnapshot{}
 
-	for _, p := range c.processTracker.ActiveProcesses() {
+	for _, p := range c.processTracker.Processes() {
 		processSnapshots = append(
 			processSnapshots,
 			ProcessSnapshot{
-				ID: p.ID(),
+				ID:  p.ID,
+				TTY: p.Spec.TTY,
+
+				Spec:      p.Spec,
+				StartedAt: p.StartedAt,
+				HostPID:   p.HostPID,
 			},
 		)
 	}
@@ -261,9 +456,14 @@ func (c *LinuxContainer) Snapshot(out io.Writer) error {
 		State:  string(c.State()),
 		Events: c.Events(),
 
+		OomPolicy: c.OomPolicy(),
+
 		Limits: LimitsSnapshot{
 			Bandwidth: c.currentBandwidthLimits,
 			CPU:       c.currentCPULimits,
+			CPUQuota:  c.currentCPUQuotaLimits,
+			BlockIO:   c.currentBlockIOLimits,
+			Pids:      c.currentPidLimits,
 			Disk:      c.currentDiskLimits,
 			Memory:    c.currentMemoryLimits,
 		},
@@ -272,6 +472,10 @@ func (c *LinuxContainer) Snapshot(out io.Writer) error {
 			UserUID: c.resources.UserUID,
 			RootUID: c.resources.RootUID,
 			Ports:   c.resources.Ports,
+
+			UIDMappings:     c.resources.UIDMappings,
+			GIDMappings:     c.resources.GIDMappings,
+			SubordinateUIDs: c.resources.SubordinateUIDs,
 		},
 
 		NetIns:  c.netIns,
@@ -297,7 +501,7 @@ func (c *LinuxContainer) Snapshot(out io.Writer) error {
 	var rm json.RawMessage = m
 	snapshot.Resources.Network = &rm
 
-	err = json.NewEncoder(out).Encode(snapshot)
+	err = WriteSnapshot(out, snapshot)
 	if err != nil {
 		cLog.Error("failed-to-save", err, lager.Data{
 			"snapshot": snapshot,
@@ -337,6 +541,14 @@ func (c *LinuxContainer) Restore(snapshot ContainerSnapshot) error {
 		c.registerEvent(ev)
 	}
 
+	if snapshot.OomPolicy != "" {
+		err := c.SetOomPolicy(snapshot.OomPolicy)
+		if err != nil {
+			cLog.Error("failed-to-set-oom-policy", err)
+			return err
+		}
+	}
+
 	if snapshot.Limits.Memory != nil {
 		err := c.LimitMemory(*snapshot.Limits.Memory)
 		if err != nil {
@@ -345,6 +557,38 @@ func (c *LinuxContainer) Restore(snapshot ContainerSnapshot) error {
 		}
 	}
 
+	if snapshot.Limits.CPU != nil {
+		err := c.LimitCPU(*snapshot.Limits.CPU)
+		if err != nil {
+			cLog.Error("failed-to-limit-cpu", err)
+			return err
+		}
+	}
+
+	if snapshot.Limits.CPUQuota != nil {
+		err := c.LimitCPUQuota(*snapshot.Limits.CPUQuota)
+		if err != nil {
+			cLog.Error("failed-to-limit-cpu-quota", err)
+			return err
+		}
+	}
+
+	if snapshot.Limits.BlockIO != nil {
+		err := c.LimitBlockIO(*snapshot.Limits.BlockIO)
+		if err != nil {
+			cLog.Error("failed-to-limit-block-io", err)
+			return err
+		}
+	}
+
+	if snapshot.Limits.Pids != nil {
+		err := c.LimitPids(*snapshot.Limits.Pids)
+		if err != nil {
+			cLog.Error("failed-to-limit-pids", err)
+			return err
+		}
+	}
+
 	for _, process := range snapshot.Processes {
 		cLog.Info("restoring-process", lager.Data{
 			"process": process,
@@ -360,7 +604,20 @@ func (c *LinuxContainer) Restore(snapshot ContainerSnapshot) error {
 			PidFilePath:   pidfile,
 		}
 
-		c.processTracker.Restore(process.ID, signaller)
+		spec := process.Spec
+
+		// snapshots from before processes had a spec only know about the tty
+		spec.TTY = process.TTY
+
+		c.processTracker.Restore(process_tracker.ProcessMetadata{
+			ID:        process.ID,
+			Spec:      spec,
+			StartedAt: process.StartedAt,
+		}, signaller)
+	}
+
+	for _, process := range c.processTracker.ActiveProcesses() {
+		go c.watchForExit(process)
 	}
 
 	net := exec.Command(path.Join(c.path, "net.sh"), "setup")
@@ -386,6 +643,10 @@ func (c *LinuxContainer) Restore(snapshot ContainerSnapshot) error {
 		}
 	}
 
+	if c.State() == StateActive || c.State() == StatePaused {
+		c.metricsSampler.Start()
+	}
+
 	cLog.Info("restored")
 
 	return nil
@@ -396,6 +657,47 @@ func (c *LinuxContainer) Start() error {
 
 	cLog.Debug("starting")
 
+	oomPolicy, setOomPolicy := c.properties[OomPolicyProperty]
+	if setOomPolicy {
+		err := checkOomPolicy(OomPolicy(oomPolicy))
+		if err != nil {
+			return fmt.Errorf("container: start: %v", err)
+		}
+	}
+
+	var memoryLimits *garden.MemoryLimits
+	if value, found := c.properties[linux_backend.MemoryLimitProperty]; found {
+		limit, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("container: start: invalid %s: %q", linux_backend.MemoryLimitProperty, value)
+		}
+
+		memoryLimits = &garden.MemoryLimits{LimitInBytes: limit}
+	}
+
+	if value, found := c.properties[linux_backend.DiskLimitProperty]; found {
+		limit, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("container: start: invalid %s: %q", linux_backend.DiskLimitProperty, value)
+		}
+
+		err = c.LimitDisk(garden.DiskLimits{ByteHard: limit})
+		if err != nil {
+			cLog.Error("failed-to-limit-disk", err)
+			return fmt.Errorf("container: start: %v", err)
+		}
+	}
+
+	var pidLimits *PidLimits
+	if value, found := c.properties[PidLimitProperty]; found {
+		max, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("container: start: invalid %s: %q", PidLimitProperty, value)
+		}
+
+		pidLimits = &PidLimits{Max: max}
+	}
+
 	start := exec.Command(path.Join(c.path, "start.sh"))
 	start.Env = []string{
 		"id=" + c.id,
@@ -413,23 +715,82 @@ func (c *LinuxContainer) Start() error {
 		return fmt.Errorf("container: start: %v", err)
 	}
 
+	// the container's cgroups only exist once start.sh has run
+	if setOomPolicy {
+		err := c.SetOomPolicy(OomPolicy(oomPolicy))
+		if err != nil {
+			cLog.Error("failed-to-set-oom-policy", err)
+			return c.abortStart(cLog, err)
+		}
+	}
+
+	if memoryLimits != nil {
+		err := c.LimitMemory(*memoryLimits)
+		if err != nil {
+			cLog.Error("failed-to-limit-memory", err)
+			return c.abortStart(cLog, err)
+		}
+	}
+
+	if pidLimits != nil {
+		err := c.LimitPids(*pidLimits)
+		if err != nil {
+			cLog.Error("failed-to-limit-pids", err)
+			return c.abortStart(cLog, err)
+		}
+	}
+
 	c.setState(StateActive)
 
+	c.metricsSampler.Start()
+
 	cLog.Info("started")
 
 	return nil
 }
 
+// abortStart kills a container whose limits could not be applied once
+// start.sh had run, rather than leave it running without them.
+func (c *LinuxContainer) abortStart(cLog lager.Logger, err error) error {
+	stop := exec.Command(path.Join(c.path, "stop.sh"), "-w", "0")
+
+	stopErr := c.runner.Run(stop)
+	if stopErr != nil {
+		cLog.Error("failed-to-stop", stopErr)
+	}
+
+	c.stopOomNotifier()
+	c.stopPidWatcher()
+
+	return fmt.Errorf("container: start: %v", err)
+}
+
 func (c *LinuxContainer) Cleanup() {
 	cLog := c.logger.Session("cleanup")
 
 	cLog.Debug("stopping-oom-notifier")
 	c.stopOomNotifier()
 
+	cLog.Debug("stopping-pid-watcher")
+	c.stopPidWatcher()
+
+	cLog.Debug("stopping-metrics-sampler")
+	c.metricsSampler.Stop()
+
 	cLog.Info("done")
 }
 
 func (c *LinuxContainer) Stop(kill bool) error {
+	if c.State() == StatePaused {
+		// frozen tasks cannot act on signals, so thaw them first
+		err := c.setFreezerState(freezerThawed)
+		if err != nil {
+			return err
+		}
+
+		c.setState(StateActive)
+	}
+
 	stop := exec.Command(path.Join(c.path, "stop.sh"))
 
 	if kill {
@@ -442,12 +803,64 @@ func (c *LinuxContainer) Stop(kill bool) error {
 	}
 
 	c.stopOomNotifier()
+	c.stopPidWatcher()
+	c.metricsSampler.Stop()
 
 	c.setState(StateStopped)
 
 	return nil
 }
 
+func (c *LinuxContainer) Pause() error {
+	cLog := c.logger.Session("pause")
+
+	state := c.State()
+	if state != StateActive {
+		return StateTransitionError{"pause", state}
+	}
+
+	cLog.Debug("freezing")
+
+	err := c.setFreezerState(freezerFrozen)
+	if err != nil {
+		cLog.Error("failed-to-freeze", err)
+
+		// leave the container running rather than partially frozen
+		c.setFreezerState(freezerThawed)
+
+		return fmt.Errorf("container: pause: %v", err)
+	}
+
+	c.setState(StatePaused)
+
+	cLog.Info("paused")
+
+	return nil
+}
+
+func (c *LinuxContainer) Resume() error {
+	cLog := c.logger.Session("resume")
+
+	state := c.State()
+	if state != StatePaused {
+		return StateTransitionError{"resume", state}
+	}
+
+	cLog.Debug("thawing")
+
+	err := c.setFreezerState(freezerThawed)
+	if err != nil {
+		cLog.Error("failed-to-thaw", err)
+		return fmt.Errorf("container: resume: %v", err)
+	}
+
+	c.setState(StateActive)
+
+	cLog.Info("resumed")
+
+	return nil
+}
+
 func (c *LinuxContainer) Properties() garden.Properties {
 	c.propertiesMutex.RLock()
 	defer c.propertiesMutex.RUnlock()
@@ -482,7 +895,7 @@ func (c *LinuxContainer) SetProperty(key string, value string) error {
 
 	props[key] = value
 
-	c.properties = props
+	c.setProperties(props)
 
 	return nil
 }
@@ -495,34 +908,60 @@ func (c *LinuxContainer) RemoveProperty(key string) error {
 		return UndefinedPropertyError{key}
 	}
 
-	delete(c.properties, key)
+	props := garden.Properties{}
+	for k, v := range c.properties {
+		if k != key {
+			props[k] = v
+		}
+	}
+
+	c.setProperties(props)
 
 	return nil
 }
 
-func (c *LinuxContainer) Info() (garden.ContainerInfo, error) {
-	cLog := c.logger.Session("info")
+// OnPropertiesChange registers a callback invoked with the current
+// properties straight away and with the new properties after every change,
+// all under the same lock, so that no change is missed or seen out of order.
+// The properties passed are never modified afterwards.
+func (c *LinuxContainer) OnPropertiesChange(observer func(garden.Properties)) {
+	c.propertiesMutex.Lock()
+	defer c.propertiesMutex.Unlock()
 
-	memoryStat, err := c.cgroupsManager.Get("memory", "memory.stat")
-	if err != nil {
-		return garden.ContainerInfo{}, err
-	}
+	c.propertiesObserver = observer
 
-	cpuUsage, err := c.cgroupsManager.Get("cpuacct", "cpuacct.usage")
-	if err != nil {
-		return garden.ContainerInfo{}, err
+	if observer != nil {
+		observer(c.properties)
 	}
+}
 
-	cpuStat, err := c.cgroupsManager.Get("cpuacct", "cpuacct.stat")
-	if err != nil {
-		return garden.ContainerInfo{}, err
+// must be called with propertiesMutex held
+func (c *LinuxContainer) setProperties(props garden.Properties) {
+	c.properties = props
+
+	if c.propertiesObserver != nil {
+		c.propertiesObserver(props)
 	}
+}
+
+func (c *LinuxContainer) Info() (garden.ContainerInfo, error) {
+	return c.info(nil)
+}
+
+func (c *LinuxContainer) InfoWithDiskStat(diskStat garden.ContainerDiskStat) (garden.ContainerInfo, error) {
+	return c.info(&diskStat)
+}
+
+func (c *LinuxContainer) info(diskStat *garden.ContainerDiskStat) (garden.ContainerInfo, error) {
+	cLog := c.logger.Session("info")
 
-	diskStat, err := c.quotaManager.GetUsage(cLog, c.resources.UserUID)
+	usage, err := c.resourceUsage(cLog, diskStat)
 	if err != nil {
 		return garden.ContainerInfo{}, err
 	}
 
+	c.checkQuota(usage.DiskStat)
+
 	mappedPorts := []garden.PortMapping{}
 
 	c.netInsMutex.RLock()
@@ -547,9 +986,9 @@ func (c *LinuxContainer) Info() (garden.ContainerInfo, error) {
 		Properties:    c.Properties(),
 		ContainerPath: c.path,
 		ProcessIDs:    processIDs,
-		MemoryStat:    parseMemoryStat(memoryStat),
-		CPUStat:       parseCPUStat(cpuUsage, cpuStat),
-		DiskStat:      diskStat,
+		MemoryStat:    usage.MemoryStat,
+		CPUStat:       usage.CPUStat,
+		DiskStat:      usage.DiskStat,
 		MappedPorts:   mappedPorts,
 	}
 
@@ -559,60 +998,176 @@ func (c *LinuxContainer) Info() (garden.ContainerInfo, error) {
 	return info, nil
 }
 
-func (c *LinuxContainer) StreamIn(dstPath string, tarStream io.Reader) error {
-	nsTarPath := path.Join(c.path, "bin", "nstar")
-	pidPath := path.Join(c.path, "run", "wshd.pid")
+// Metrics returns the recent resource usage history, sampled in the
+// background while the container is running.
+func (c *LinuxContainer) Metrics() ContainerMetrics {
+	return c.metricsSampler.Metrics()
+}
 
-	pidFile, err := os.Open(pidPath)
+// RecordDiskUsage keeps the disk usage sampled by the backend, for the
+// metrics samples to use rather than each running repquota, and checks it
+// against the disk limits.
+func (c *LinuxContainer) RecordDiskUsage(usage garden.ContainerDiskStat) {
+	c.diskMutex.Lock()
+	c.sampledDiskStat = &usage
+	c.diskMutex.Unlock()
+
+	c.checkQuota(usage)
+}
+
+func (c *LinuxContainer) sampleMetrics() (MetricsSample, error) {
+	c.diskMutex.RLock()
+	diskStat := c.sampledDiskStat
+	c.diskMutex.RUnlock()
+
+	// until the backend first samples disk usage, look it up, so that disk
+	// growth is not measured from zero
+	return c.resourceUsage(c.logger.Session("sample-metrics"), diskStat)
+}
+
+// reads the container's memory, cpu and, unless given, disk usage
+func (c *LinuxContainer) resourceUsage(logger lager.Logger, knownDiskStat *garden.ContainerDiskStat) (MetricsSample, error) {
+	memoryStat, err := c.cgroupsManager.Get("memory", "memory.stat")
 	if err != nil {
-		return err
+		return MetricsSample{}, err
 	}
 
-	var pid int
-	_, err = fmt.Fscanf(pidFile, "%d", &pid)
+	cpuUsage, err := c.cgroupsManager.Get("cpuacct", "cpuacct.usage")
 	if err != nil {
-		return err
+		return MetricsSample{}, err
 	}
 
-	tar := exec.Command(
-		nsTarPath,
-		strconv.Itoa(pid),
-		"vcap",
-		dstPath,
-	)
-
-	tar.Stdin = tarStream
-
-	cLog := c.logger.Session("stream-in")
+	cpuStat, err := c.cgroupsManager.Get("cpuacct", "cpuacct.stat")
+	if err != nil {
+		return MetricsSample{}, err
+	}
 
-	cRunner := logging.Runner{
-		CommandRunner: c.runner,
-		Logger:        cLog,
+	var diskStat garden.ContainerDiskStat
+	if knownDiskStat != nil {
+		diskStat = *knownDiskStat
+	} else {
+		diskStat, err = c.quotaManager.GetUsage(logger, c.resources.UserUID)
+		if err != nil {
+			return MetricsSample{}, err
+		}
 	}
 
-	return cRunner.Run(tar)
+	return MetricsSample{
+		MemoryStat: parseMemoryStat(memoryStat),
+		CPUStat:    parseCPUStat(cpuUsage, cpuStat),
+		DiskStat:   diskStat,
+	}, nil
 }
 
-func (c *LinuxContainer) StreamOut(srcPath string) (io.ReadCloser, error) {
-	workingDir := filepath.Dir(srcPath)
-	compressArg := filepath.Base(srcPath)
-	if strings.HasSuffix(srcPath, "/") {
-		workingDir = srcPath
-		compressArg = "."
+func (c *LinuxContainer) LinuxInfo() (LinuxInfo, error) {
+	info, err := c.Info()
+	if err != nil {
+		return LinuxInfo{}, err
 	}
 
-	nsTarPath := path.Join(c.path, "bin", "nstar")
-	pidPath := path.Join(c.path, "run", "wshd.pid")
+	serviceBytes, err := c.cgroupsManager.Get("blkio", "blkio.throttle.io_service_bytes")
+	if err != nil {
+		return LinuxInfo{}, err
+	}
 
-	pidFile, err := os.Open(pidPath)
+	serviced, err := c.cgroupsManager.Get("blkio", "blkio.throttle.io_serviced")
 	if err != nil {
-		return nil, err
+		return LinuxInfo{}, err
 	}
 
-	var pid int
-	_, err = fmt.Fscanf(pidFile, "%d", &pid)
+	pidStat, err := c.pidStat()
 	if err != nil {
-		return nil, err
+		return LinuxInfo{}, err
+	}
+
+	err = c.checkPidEvents()
+	if err != nil {
+		return LinuxInfo{}, err
+	}
+
+	return LinuxInfo{
+		ContainerInfo: info,
+		BlockIOStat:   parseBlockIOStat(serviceBytes, serviced),
+		PidStat:       pidStat,
+	}, nil
+}
+
+func (c *LinuxContainer) pidStat() (ContainerPidStat, error) {
+	current, err := c.cgroupsManager.Get("pids", "pids.current")
+	if err != nil {
+		return ContainerPidStat{}, err
+	}
+
+	numericCurrent, err := strconv.ParseUint(strings.TrimSpace(current), 10, 64)
+	if err != nil {
+		return ContainerPidStat{}, err
+	}
+
+	limits, err := c.CurrentPidLimits()
+	if err != nil {
+		return ContainerPidStat{}, err
+	}
+
+	return ContainerPidStat{
+		Current: numericCurrent,
+		Max:     limits.Max,
+	}, nil
+}
+
+func (c *LinuxContainer) StreamIn(dstPath string, tarStream io.Reader) error {
+	nsTarPath := path.Join(c.path, "bin", "nstar")
+	pidPath := path.Join(c.path, "run", "wshd.pid")
+
+	pidFile, err := os.Open(pidPath)
+	if err != nil {
+		return err
+	}
+
+	var pid int
+	_, err = fmt.Fscanf(pidFile, "%d", &pid)
+	if err != nil {
+		return err
+	}
+
+	tar := exec.Command(
+		nsTarPath,
+		strconv.Itoa(pid),
+		"vcap",
+		dstPath,
+	)
+
+	tar.Stdin = tarStream
+
+	cLog := c.logger.Session("stream-in")
+
+	cRunner := logging.Runner{
+		CommandRunner: c.runner,
+		Logger:        cLog,
+	}
+
+	return cRunner.Run(tar)
+}
+
+func (c *LinuxContainer) StreamOut(srcPath string) (io.ReadCloser, error) {
+	workingDir := filepath.Dir(srcPath)
+	compressArg := filepath.Base(srcPath)
+	if strings.HasSuffix(srcPath, "/") {
+		workingDir = srcPath
+		compressArg = "."
+	}
+
+	nsTarPath := path.Join(c.path, "bin", "nstar")
+	pidPath := path.Join(c.path, "run", "wshd.pid")
+
+	pidFile, err := os.Open(pidPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var pid int
+	_, err = fmt.Fscanf(pidFile, "%d", &pid)
+	if err != nil {
+		return nil, err
 	}
 
 	tar := exec.Command(
@@ -673,7 +1228,17 @@ func (c *LinuxContainer) CurrentBandwidthLimits() (garden.BandwidthLimits, error
 func (c *LinuxContainer) LimitDisk(limits garden.DiskLimits) error {
 	cLog := c.logger.Session("limit-disk")
 
-	err := c.quotaManager.SetLimits(cLog, c.resources.UserUID, limits)
+	committed := c.CommittedResources()
+	committed.DiskInBytes = diskLimitInBytes(limits)
+
+	release, err := c.admitLimits(committed)
+	if err != nil {
+		return err
+	}
+
+	defer release()
+
+	err = c.quotaManager.SetLimits(cLog, c.resources.UserUID, limits)
 	if err != nil {
 		return err
 	}
@@ -692,7 +1257,17 @@ func (c *LinuxContainer) CurrentDiskLimits() (garden.DiskLimits, error) {
 }
 
 func (c *LinuxContainer) LimitMemory(limits garden.MemoryLimits) error {
-	err := c.startOomNotifier()
+	committed := c.CommittedResources()
+	committed.MemoryInBytes = limits.LimitInBytes
+
+	release, err := c.admitLimits(committed)
+	if err != nil {
+		return err
+	}
+
+	defer release()
+
+	err = c.startOomNotifier()
 	if err != nil {
 		return err
 	}
@@ -721,6 +1296,120 @@ func (c *LinuxContainer) LimitMemory(limits garden.MemoryLimits) error {
 	return nil
 }
 
+func (c *LinuxContainer) SetOomPolicy(policy OomPolicy) error {
+	err := checkOomPolicy(policy)
+	if err != nil {
+		return err
+	}
+
+	c.oomMutex.Lock()
+	defer c.oomMutex.Unlock()
+
+	previous := c.oomPolicy
+
+	// only touch the OOM killer when moving to or from notify, so the
+	// default policy works without memory.oom_control
+	if policy == OomPolicyNotify && previous != OomPolicyNotify {
+		err := c.cgroupsManager.Set("memory", "memory.oom_control", "1")
+		if err != nil {
+			return err
+		}
+	} else if policy != OomPolicyNotify && previous == OomPolicyNotify {
+		err := c.cgroupsManager.Set("memory", "memory.oom_control", "0")
+		if err != nil {
+			return err
+		}
+	}
+
+	c.oomPolicy = policy
+
+	return nil
+}
+
+func checkOomPolicy(policy OomPolicy) error {
+	switch policy {
+	case OomPolicyStop, OomPolicyKillProcess, OomPolicyNotify:
+		return nil
+	default:
+		return UnknownOomPolicyError{policy}
+	}
+}
+
+func (c *LinuxContainer) OomPolicy() OomPolicy {
+	c.oomMutex.RLock()
+	defer c.oomMutex.RUnlock()
+
+	if c.oomPolicy == "" {
+		return OomPolicyStop
+	}
+
+	return c.oomPolicy
+}
+
+// CommittedResources reports the memory and disk limits last set on the
+// container, without reading them back from the host.
+func (c *LinuxContainer) CommittedResources() linux_backend.CommittedResources {
+	var committed linux_backend.CommittedResources
+
+	c.memoryMutex.RLock()
+	if c.currentMemoryLimits != nil {
+		committed.MemoryInBytes = c.currentMemoryLimits.LimitInBytes
+	}
+	c.memoryMutex.RUnlock()
+
+	c.diskMutex.RLock()
+	if c.currentDiskLimits != nil {
+		committed.DiskInBytes = diskLimitInBytes(*c.currentDiskLimits)
+	}
+	c.diskMutex.RUnlock()
+
+	return committed
+}
+
+func diskLimitInBytes(limits garden.DiskLimits) uint64 {
+	if limits.ByteHard != 0 {
+		return limits.ByteHard
+	}
+
+	return limits.BlockHard * quota_manager.QUOTA_BLOCK_SIZE
+}
+
+// OnLimitsIncrease registers a callback which must admit raising the
+// container's memory or disk limits before they are set.
+func (c *LinuxContainer) OnLimitsIncrease(admission func(linux_backend.CommittedResources) (func(), error)) {
+	c.limitsAdmissionMutex.Lock()
+	defer c.limitsAdmissionMutex.Unlock()
+
+	c.limitsAdmission = admission
+}
+
+// admitLimits has the registered callback admit going from the currently
+// committed resources to next, returning a function releasing what it
+// reserved
+func (c *LinuxContainer) admitLimits(next linux_backend.CommittedResources) (func(), error) {
+	c.limitsAdmissionMutex.RLock()
+	admission := c.limitsAdmission
+	c.limitsAdmissionMutex.RUnlock()
+
+	current := c.CommittedResources()
+
+	var increase linux_backend.CommittedResources
+
+	if next.MemoryInBytes > current.MemoryInBytes {
+		increase.MemoryInBytes = next.MemoryInBytes - current.MemoryInBytes
+	}
+
+	if next.DiskInBytes > current.DiskInBytes {
+		increase.DiskInBytes = next.DiskInBytes - current.DiskInBytes
+	}
+
+	if admission == nil || increase == (linux_backend.CommittedResources{}) {
+		return func() {}, nil
+	}
+
+	return admission(increase)
+}
+
 func (c *LinuxContainer) CurrentMemoryLimits() (garden.MemoryLimits, error) {
 	limitInBytes, err := c.cgroupsManager.Get("memory", "memory.limit_in_bytes")
 	if err != nil {
@@ -765,7 +1454,176 @@ func (c *LinuxContainer) CurrentCPULimits() (garden.CPULimits, error) {
 	return garden.CPULimits{uint64(numericLimit)}, nil
 }
 
+func (c *LinuxContainer) LimitCPUQuota(limits CPUQuotaLimits) error {
+	if limits.PeriodInMicroseconds != 0 {
+		period := fmt.Sprintf("%d", limits.PeriodInMicroseconds)
+
+		err := c.cgroupsManager.Set("cpu", "cpu.cfs_period_us", period)
+		if err != nil {
+			return err
+		}
+	}
+
+	// -1 tells the kernel not to enforce a cap
+	quota := "-1"
+	if limits.QuotaInMicroseconds != 0 {
+		quota = fmt.Sprintf("%d", limits.QuotaInMicroseconds)
+	}
+
+	err := c.cgroupsManager.Set("cpu", "cpu.cfs_quota_us", quota)
+	if err != nil {
+		return err
+	}
+
+	c.cpuMutex.Lock()
+	defer c.cpuMutex.Unlock()
+
+	c.currentCPUQuotaLimits = &limits
+
+	return nil
+}
+
+func (c *LinuxContainer) CurrentCPUQuotaLimits() (CPUQuotaLimits, error) {
+	quota, err := c.cgroupsManager.Get("cpu", "cpu.cfs_quota_us")
+	if err != nil {
+		return CPUQuotaLimits{}, err
+	}
+
+	numericQuota, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil {
+		return CPUQuotaLimits{}, err
+	}
+
+	period, err := c.cgroupsManager.Get("cpu", "cpu.cfs_period_us")
+	if err != nil {
+		return CPUQuotaLimits{}, err
+	}
+
+	numericPeriod, err := strconv.ParseUint(period, 10, 0)
+	if err != nil {
+		return CPUQuotaLimits{}, err
+	}
+
+	limits := CPUQuotaLimits{
+		PeriodInMicroseconds: numericPeriod,
+	}
+
+	if numericQuota > 0 {
+		limits.QuotaInMicroseconds = uint64(numericQuota)
+	}
+
+	return limits, nil
+}
+
+func (c *LinuxContainer) LimitBlockIO(limits BlockIOLimits) error {
+	device := limits.Device
+	if device == "" {
+		var err error
+		device, err = blockDeviceOf(c.path)
+		if err != nil {
+			return err
+		}
+	}
+
+	if limits.Weight != 0 {
+		err := c.cgroupsManager.Set("blkio", "blkio.weight", fmt.Sprintf("%d", limits.Weight))
+		if err != nil {
+			return err
+		}
+	}
+
+	throttles := []struct {
+		name  string
+		value uint64
+	}{
+		{"blkio.throttle.read_bps_device", limits.ReadBytesPerSecond},
+		{"blkio.throttle.write_bps_device", limits.WriteBytesPerSecond},
+		{"blkio.throttle.read_iops_device", limits.ReadIOPerSecond},
+		{"blkio.throttle.write_iops_device", limits.WriteIOPerSecond},
+	}
+
+	for _, throttle := range throttles {
+		// writing a zero rate removes the device's throttle
+		err := c.cgroupsManager.Set("blkio", throttle.name, fmt.Sprintf("%s %d", device, throttle.value))
+		if err != nil {
+			return err
+		}
+	}
+
+	c.blockIOMutex.Lock()
+	defer c.blockIOMutex.Unlock()
+
+	c.currentBlockIOLimits = &limits
+
+	return nil
+}
+
+func (c *LinuxContainer) CurrentBlockIOLimits() (BlockIOLimits, error) {
+	c.blockIOMutex.RLock()
+	defer c.blockIOMutex.RUnlock()
+
+	if c.currentBlockIOLimits == nil {
+		return BlockIOLimits{}, nil
+	}
+
+	return *c.currentBlockIOLimits, nil
+}
+
+func (c *LinuxContainer) LimitPids(limits PidLimits) error {
+	max := "max"
+	if limits.Max != 0 {
+		max = fmt.Sprintf("%d", limits.Max)
+	}
+
+	// without the pids controller the cgroup is a plain directory, in
+	// which writing pids.max would just create a file
+	_, err := c.cgroupsManager.Get("pids", "pids.max")
+	if err != nil {
+		return PidsControllerUnavailableError{err}
+	}
+
+	err = c.cgroupsManager.Set("pids", "pids.max", max)
+	if err != nil {
+		return err
+	}
+
+	c.pidMutex.Lock()
+	defer c.pidMutex.Unlock()
+
+	c.currentPidLimits = &limits
+
+	if c.pidWatcherStop == nil {
+		c.pidWatcherStop = make(chan struct{})
+		go c.watchPidEvents(c.pidWatcherStop)
+	}
+
+	return nil
+}
+
+func (c *LinuxContainer) CurrentPidLimits() (PidLimits, error) {
+	max, err := c.cgroupsManager.Get("pids", "pids.max")
+	if err != nil {
+		return PidLimits{}, err
+	}
+
+	max = strings.TrimSpace(max)
+	if max == "max" || max == "" {
+		return PidLimits{}, nil
+	}
+
+	numericMax, err := strconv.ParseUint(max, 10, 64)
+	if err != nil {
+		return PidLimits{}, err
+	}
+
+	return PidLimits{Max: numericMax}, nil
+}
+
 func (c *LinuxContainer) Run(spec garden.ProcessSpec, processIO garden.ProcessIO) (garden.Process, error) {
+	if state := c.State(); state == StatePaused {
+		return nil, StateTransitionError{"run a process in", state}
+	}
+
 	wshPath := path.Join(c.path, "bin", "wsh")
 	sockPath := path.Join(c.path, "run", "wshd.sock")
 
@@ -790,8 +1648,12 @@ func (c *LinuxContainer) Run(spec garden.ProcessSpec, processIO garden.ProcessIO
 		"run-env":       specEnv,
 	})
 
-	defaultEnv := langEnv().Merge(c.env)
-	processEnv := defaultEnv.Merge(specEnv)
+	defaultEnv, err := c.loadEnvFiles(wshPath, sockPath, langEnv().Merge(c.env))
+	if err != nil {
+		return nil, err
+	}
+
+	processEnv := defaultEnv.Merge(specEnv.Expand(defaultEnv))
 
 	for _, envVar := range processEnv.Array() {
 		args = append(args, "--env", envVar)
@@ -818,7 +1680,166 @@ func (c *LinuxContainer) Run(spec garden.ProcessSpec, processIO garden.ProcessIO
 
 	setRLimitsEnv(wsh, spec.Limits)
 
-	return c.processTracker.Run(processID, wsh, processIO, spec.TTY, signaller)
+	logSpec, err := c.processLogSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	timeoutSpec, err := c.processTimeoutSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	processSpec := process_tracker.ProcessSpec{
+		Path: spec.Path,
+		Args: spec.Args,
+		User: user,
+		Dir:  spec.Dir,
+		TTY:  spec.TTY != nil,
+
+		Log:     logSpec,
+		Timeout: timeoutSpec,
+	}
+
+	process, err := c.processTracker.Run(processID, processSpec, wsh, processIO, spec.TTY, signaller)
+	if err != nil {
+		return nil, err
+	}
+
+	go c.watchForExit(process)
+
+	return process, nil
+}
+
+// loadEnvFiles merges the files named by EnvFilesProperty into env, each
+// expanded against the environment before it. The files are read once for
+// each value of the property rather than on every run.
+func (c *LinuxContainer) loadEnvFiles(wshPath, sockPath string, env process.Env) (process.Env, error) {
+	envFiles, found := c.Properties()[EnvFilesProperty]
+	if !found {
+		return env, nil
+	}
+
+	// keyed by the property rather than reset by a properties observer,
+	// which would be called with propertiesMutex held
+	c.envFilesMutex.Lock()
+	defer c.envFilesMutex.Unlock()
+
+	if c.envFilesEnv != nil && c.envFilesKey == envFiles {
+		return c.envFilesEnv, nil
+	}
+
+	env, err := c.readEnvFiles(wshPath, sockPath, envFiles, env)
+	if err != nil {
+		return nil, err
+	}
+
+	c.envFilesEnv = env
+	c.envFilesKey = envFiles
+
+	return env, nil
+}
+
+func (c *LinuxContainer) readEnvFiles(wshPath, sockPath, envFiles string, env process.Env) (process.Env, error) {
+	for _, envFile := range strings.Split(envFiles, ",") {
+		envFile = strings.TrimSpace(envFile)
+		if envFile == "" {
+			continue
+		}
+
+		contents := new(bytes.Buffer)
+
+		cat := exec.Command(wshPath, "--socket", sockPath, "--user", "root", "cat", envFile)
+		cat.Stdout = contents
+
+		// not a logging.Runner, which would log the file's contents; they
+		// may well be secret
+		err := c.runner.Run(cat)
+		if err != nil {
+			return nil, fmt.Errorf("container: run: reading env file %s: %s", envFile, err)
+		}
+
+		fileEnv, err := process.ParseEnvFile(contents)
+		if err != nil {
+			return nil, fmt.Errorf("container: run: env file %s: %s", envFile, err)
+		}
+
+		env = env.Merge(fileEnv.Expand(env))
+	}
+
+	return env, nil
+}
+
+// Processes lists what the container's processes were started with, when,
+// and their host PIDs.
+func (c *LinuxContainer) Processes() []process_tracker.ProcessMetadata {
+	return c.processTracker.Processes()
+}
+
+// ProcessLog writes the log of one of the container's processes to out; see
+// ProcessLogMaxBytesProperty.
+func (c *LinuxContainer) ProcessLog(processID uint32, request process_tracker.LogRequest, out io.Writer) error {
+	return c.processTracker.Log(processID, request, out)
+}
+
+// SignalProcess sends any signal to one of the container's processes, or to
+// its process group.
+func (c *LinuxContainer) SignalProcess(processID uint32, request process_tracker.SignalRequest) error {
+	return c.processTracker.Signal(processID, request)
+}
+
+func (c *LinuxContainer) processLogSpec() (*process_tracker.LogSpec, error) {
+	properties := c.Properties()
+
+	maxBytes, found := properties[ProcessLogMaxBytesProperty]
+	if !found {
+		return nil, nil
+	}
+
+	spec := &process_tracker.LogSpec{}
+
+	var err error
+
+	spec.MaxBytes, err = strconv.ParseInt(maxBytes, 10, 64)
+	if err != nil || spec.MaxBytes <= 0 {
+		return nil, fmt.Errorf("container: run: invalid %s: %q", ProcessLogMaxBytesProperty, maxBytes)
+	}
+
+	if maxFiles, found := properties[ProcessLogMaxFilesProperty]; found {
+		spec.MaxFiles, err = strconv.Atoi(maxFiles)
+		if err != nil || spec.MaxFiles < 0 {
+			return nil, fmt.Errorf("container: run: invalid %s: %q", ProcessLogMaxFilesProperty, maxFiles)
+		}
+	}
+
+	return spec, nil
+}
+
+func (c *LinuxContainer) processTimeoutSpec() (*process_tracker.TimeoutSpec, error) {
+	properties := c.Properties()
+
+	timeout, found := properties[ProcessTimeoutProperty]
+	if !found {
+		return nil, nil
+	}
+
+	spec := &process_tracker.TimeoutSpec{}
+
+	var err error
+
+	spec.Duration, err = time.ParseDuration(timeout)
+	if err != nil || spec.Duration <= 0 {
+		return nil, fmt.Errorf("container: run: invalid %s: %q", ProcessTimeoutProperty, timeout)
+	}
+
+	if gracePeriod, found := properties[ProcessTimeoutGracePeriodProperty]; found {
+		spec.GracePeriod, err = time.ParseDuration(gracePeriod)
+		if err != nil || spec.GracePeriod < 0 {
+			return nil, fmt.Errorf("container: run: invalid %s: %q", ProcessTimeoutGracePeriodProperty, gracePeriod)
+		}
+	}
+
+	return spec, nil
 }
 
 func (c *LinuxContainer) Attach(processID uint32, processIO garden.ProcessIO) (garden.Process, error) {
@@ -881,9 +1902,44 @@ func (c *LinuxContainer) CurrentEnvVars() process.Env {
 
 func (c *LinuxContainer) setState(state State) {
 	c.stateMutex.Lock()
-	defer c.stateMutex.Unlock()
-
+	previous := c.state
 	c.state = state
+	c.stateMutex.Unlock()
+
+	if previous != state {
+		c.publishEvent(events.TypeStateChange, map[string]string{
+			"from": string(previous),
+			"to":   string(state),
+		})
+	}
+}
+
+func (c *LinuxContainer) setFreezerState(state string) error {
+	err := c.cgroupsManager.Set("freezer", "freezer.state", state)
+	if err != nil {
+		return err
+	}
+
+	// freezing is asynchronous; freezer.state reads FREEZING until every
+	// task has been stopped
+	deadline := time.Now().Add(freezerTimeout)
+
+	for {
+		current, err := c.cgroupsManager.Get("freezer", "freezer.state")
+		if err != nil {
+			return err
+		}
+
+		if current == state {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for freezer state %s (currently %s)", state, current)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
 }
 
 func (c *LinuxContainer) registerEvent(event string) {
@@ -893,6 +1949,139 @@ func (c *LinuxContainer) registerEvent(event string) {
 	c.events = append(c.events, event)
 }
 
+func (c *LinuxContainer) publishEvent(eventType events.Type, details map[string]string) {
+	c.eventHub.Publish(events.New(eventType, c.handle, details))
+}
+
+func (c *LinuxContainer) watchForExit(process garden.Process) {
+	var exitStatus link.ExitStatus
+	var err error
+
+	if waiter, ok := process.(process_tracker.ExitStatusWaiter); ok {
+		exitStatus, err = waiter.WaitForExitStatus()
+	} else {
+		exitStatus.ExitCode, err = process.Wait()
+	}
+
+	details := map[string]string{
+		"process_id":  strconv.FormatUint(uint64(process.ID()), 10),
+		"exit_status": strconv.Itoa(exitStatus.ExitCode),
+	}
+
+	if exitStatus.Signal != 0 {
+		details["signal"] = strconv.Itoa(int(exitStatus.Signal))
+		details["core_dumped"] = strconv.FormatBool(exitStatus.CoreDumped)
+	}
+
+	if rusage := exitStatus.Rusage; rusage != nil {
+		details["rusage.user_time"] = rusage.UserTime.String()
+		details["rusage.system_time"] = rusage.SystemTime.String()
+		details["rusage.max_rss_in_kb"] = strconv.FormatInt(rusage.MaxRSSInKB, 10)
+		details["rusage.minor_faults"] = strconv.FormatInt(rusage.MinorFaults, 10)
+		details["rusage.major_faults"] = strconv.FormatInt(rusage.MajorFaults, 10)
+		details["rusage.voluntary_context_switches"] = strconv.FormatInt(rusage.VoluntaryContextSwitches, 10)
+		details["rusage.involuntary_context_switches"] = strconv.FormatInt(rusage.InvoluntaryContextSwitches, 10)
+	}
+
+	if err != nil {
+		details["error"] = err.Error()
+	}
+
+	c.publishEvent(events.TypeProcessExit, details)
+}
+
+func (c *LinuxContainer) checkQuota(usage garden.ContainerDiskStat) {
+	c.diskMutex.Lock()
+	defer c.diskMutex.Unlock()
+
+	if c.currentDiskLimits == nil {
+		return
+	}
+
+	exceeded := quotaExceeded(*c.currentDiskLimits, usage)
+	if exceeded && !c.quotaExceeded {
+		c.publishEvent(events.TypeQuotaExceeded, map[string]string{
+			"bytes_used":  strconv.FormatUint(usage.BytesUsed, 10),
+			"inodes_used": strconv.FormatUint(usage.InodesUsed, 10),
+		})
+	}
+
+	c.quotaExceeded = exceeded
+}
+
+func quotaExceeded(limits garden.DiskLimits, usage garden.ContainerDiskStat) bool {
+	byteLimit := diskLimitInBytes(limits)
+
+	if byteLimit != 0 && usage.BytesUsed >= byteLimit {
+		return true
+	}
+
+	return limits.InodeHard != 0 && usage.InodesUsed >= limits.InodeHard
+}
+
+func (c *LinuxContainer) watchPidEvents(stop <-chan struct{}) {
+	ticker := time.NewTicker(pidEventsPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := c.checkPidEvents()
+			if err != nil {
+				c.logger.Error("failed-to-check-pid-events", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (c *LinuxContainer) stopPidWatcher() {
+	c.pidMutex.Lock()
+	defer c.pidMutex.Unlock()
+
+	if c.pidWatcherStop != nil {
+		close(c.pidWatcherStop)
+		c.pidWatcherStop = nil
+	}
+}
+
+// pids.events counts the forks refused because of pids.max; publish an
+// event whenever it goes up
+func (c *LinuxContainer) checkPidEvents() error {
+	contents, err := c.cgroupsManager.Get("pids", "pids.events")
+	if err != nil {
+		return err
+	}
+
+	hits := parsePidEvents(contents)
+
+	c.pidMutex.Lock()
+	previousHits := c.pidLimitHits
+	c.pidLimitHits = hits
+	c.pidMutex.Unlock()
+
+	if hits <= previousHits {
+		return nil
+	}
+
+	if previousHits == 0 {
+		c.registerEvent("pid limit reached")
+	}
+
+	limits, err := c.CurrentPidLimits()
+	if err != nil {
+		return err
+	}
+
+	c.publishEvent(events.TypePidLimitReached, map[string]string{
+		"max":   strconv.FormatUint(limits.Max, 10),
+		"count": strconv.FormatUint(hits, 10),
+	})
+
+	return nil
+}
+
 func (c *LinuxContainer) startOomNotifier() error {
 	c.oomMutex.Lock()
 	defer c.oomMutex.Unlock()
@@ -926,12 +2115,55 @@ func (c *LinuxContainer) stopOomNotifier() {
 
 func (c *LinuxContainer) watchForOom(oom *exec.Cmd) {
 	err := c.runner.Wait(oom)
-	if err == nil {
-		c.registerEvent("out of memory")
+	if err != nil {
+		// TODO: handle case where oom notifier itself failed? kill container?
+		return
+	}
+
+	policy := c.OomPolicy()
+
+	details := map[string]string{
+		"policy": string(policy),
+	}
+
+	memoryStat, err := c.cgroupsManager.Get("memory", "memory.stat")
+	if err != nil {
+		c.logger.Error("failed-to-get-memory-stat-on-oom", err)
+	} else {
+		for key, value := range parseKeyedValues(memoryStat) {
+			details["memory_stat."+key] = value
+		}
+	}
+
+	c.registerEvent("out of memory")
+	c.publishEvent(events.TypeOutOfMemory, details)
+
+	if policy == OomPolicyStop {
 		c.Stop(false)
+		return
 	}
 
-	// TODO: handle case where oom notifier itself failed? kill container?
+	c.rearmOomNotifier(oom)
+}
+
+// the notifier exits after reporting an OOM; start another one if the
+// container lives on
+func (c *LinuxContainer) rearmOomNotifier(exited *exec.Cmd) {
+	c.oomMutex.Lock()
+	current := c.oomNotifier == exited
+	if current {
+		c.oomNotifier = nil
+	}
+	c.oomMutex.Unlock()
+
+	if !current || c.State() == StateStopped {
+		return
+	}
+
+	err := c.startOomNotifier()
+	if err != nil {
+		c.logger.Error("failed-to-restart-oom-notifier", err)
+	}
 }
 
 func parseMemoryStat(contents string) (stat garden.ContainerMemoryStat) {
@@ -1049,6 +2281,126 @@ func parseCPUStat(usage, statContents string) (stat garden.ContainerCPUStat) {
 	return
 }
 
+func parseBlockIOStat(serviceBytes, serviced string) (stat ContainerBlockIOStat) {
+	stat.ReadBytes, stat.WriteBytes = sumBlockIOOperations(serviceBytes)
+	stat.ReadOps, stat.WriteOps = sumBlockIOOperations(serviced)
+	return
+}
+
+// sums the per-device "<major:minor> <Operation> <value>" lines of a blkio
+// stat file
+func sumBlockIOOperations(contents string) (read, write uint64) {
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+
+		value, err := strconv.ParseUint(fields[2], 10, 0)
+		if err != nil {
+			continue
+		}
+
+		switch fields[1] {
+		case "Read":
+			read += value
+		case "Write":
+			write += value
+		}
+	}
+
+	return
+}
+
+func parseKeyedValues(contents string) map[string]string {
+	values := map[string]string{}
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 {
+			values[fields[0]] = fields[1]
+		}
+	}
+
+	return values
+}
+
+func parsePidEvents(contents string) uint64 {
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "max" {
+			count, err := strconv.ParseUint(fields[1], 10, 64)
+			if err == nil {
+				return count
+			}
+		}
+	}
+
+	return 0
+}
+
+// blockDeviceOf is the disk holding path, which is what the blkio throttles
+// apply to; they are not enforced on partitions.
+func blockDeviceOf(path string) (string, error) {
+	var stat syscall.Stat_t
+
+	err := syscall.Stat(path, &stat)
+	if err != nil {
+		return "", err
+	}
+
+	dev := uint64(stat.Dev)
+
+	major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+	minor := dev&0xff | (dev>>12)&^0xff
+
+	return WholeDiskOf("/sys", fmt.Sprintf("%d:%d", major, minor))
+}
+
+type NoBlockDeviceError struct {
+	Device string
+}
+
+func (err NoBlockDeviceError) Error() string {
+	return fmt.Sprintf("device %s is not a block device; give the device to throttle", err.Device)
+}
+
+// WholeDiskOf resolves a block device, as "major:minor", to the disk it is a
+// partition of, using the sysfs mounted at sysPath. Devices which are not
+// partitions are returned as they are.
+func WholeDiskOf(sysPath string, device string) (string, error) {
+	devicePath, err := filepath.EvalSymlinks(path.Join(sysPath, "dev", "block", device))
+	if os.IsNotExist(err) {
+		// e.g. the anonymous devices of overlay, btrfs or tmpfs
+		return "", NoBlockDeviceError{device}
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = os.Stat(path.Join(devicePath, "partition"))
+	if os.IsNotExist(err) {
+		return device, nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	disk, err := ioutil.ReadFile(path.Join(path.Dir(devicePath), "dev"))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(disk)), nil
+}
+
 func langEnv() process.Env {
 	lang := os.Getenv("LANG")
 	if lang == "" {
@@ -13,6 +13,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"sync"
+	"syscall"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -21,6 +22,8 @@ import (
 	"github.com/pivotal-golang/lager/lagertest"
 
 	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/events"
+	"github.com/cloudfoundry-incubator/garden-linux/iodaemon/link"
 	"github.com/cloudfoundry-incubator/garden-linux/linux_container"
 	networkFakes "github.com/cloudfoundry-incubator/garden-linux/network/fakes"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
@@ -28,6 +31,7 @@ import (
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/cgroups_manager/fake_cgroups_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/port_pool/fake_port_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager/fake_quota_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/uid_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/process"
 	"github.com/cloudfoundry-incubator/garden-linux/process_tracker"
 	"github.com/cloudfoundry-incubator/garden-linux/process_tracker/fake_process_tracker"
@@ -76,6 +80,7 @@ var _ = Describe("Linux containers", func() {
 		fakeQuotaManager = fake_quota_manager.New()
 		fakeBandwidthManager = fake_bandwidth_manager.New()
 		fakeProcessTracker = new(fake_process_tracker.FakeProcessTracker)
+		fakeProcessTracker.RunReturns(new(wfakes.FakeProcess), nil)
 		fakeFilter = new(networkFakes.FakeFilter)
 
 		fakePortPool = fake_port_pool.New(1000)
@@ -172,6 +177,20 @@ var _ = Describe("Linux containers", func() {
 			LimitInShares: 1,
 		}
 
+		cpuQuotaLimits := linux_container.CPUQuotaLimits{
+			QuotaInMicroseconds:  50000,
+			PeriodInMicroseconds: 100000,
+		}
+
+		blockIOLimits := linux_container.BlockIOLimits{
+			Device:             "8:0",
+			ReadBytesPerSecond: 1048576,
+		}
+
+		pidLimits := linux_container.PidLimits{
+			Max: 512,
+		}
+
 		JustBeforeEach(func() {
 			var err error
 
@@ -187,16 +206,47 @@ var _ = Describe("Linux containers", func() {
 			container.NetOut(netOutRule1)
 			container.NetOut(netOutRule2)
 
-			p1 := new(wfakes.FakeProcess)
-			p1.IDReturns(1)
+			fakeProcessTracker.ProcessesReturns([]process_tracker.ProcessMetadata{
+				{ID: 1},
+				{ID: 2},
+				{
+					ID: 3,
+					Spec: process_tracker.ProcessSpec{
+						Path: "/some/script",
+						Args: []string{"some", "args"},
+						User: "vcap",
+						Dir:  "/some/dir",
+						TTY:  true,
+					},
+					StartedAt: time.Unix(123, 0).UTC(),
+					HostPID:   4567,
+				},
+			})
+		})
+
+		Context("when the container is mapped to subordinate uids", func() {
+			subordinateUIDs := uid_pool.UIDRange{Start: 100000, Size: 65536}
+			mappings := linux_backend.RangeIDMappings(100000, 65536, 1234)
+
+			BeforeEach(func() {
+				containerResources.SubordinateUIDs = &subordinateUIDs
+				containerResources.UIDMappings = mappings
+				containerResources.GIDMappings = mappings
+			})
+
+			It("saves the mappings", func() {
+				out := new(bytes.Buffer)
 
-			p2 := new(wfakes.FakeProcess)
-			p2.IDReturns(2)
+				err := container.Snapshot(out)
+				Ω(err).ShouldNot(HaveOccurred())
 
-			p3 := new(wfakes.FakeProcess)
-			p3.IDReturns(3)
+				snapshot, err := linux_container.ReadSnapshot(out)
+				Ω(err).ShouldNot(HaveOccurred())
 
-			fakeProcessTracker.ActiveProcessesReturns([]garden.Process{p1, p2, p3})
+				Ω(snapshot.Resources.SubordinateUIDs).Should(Equal(&subordinateUIDs))
+				Ω(snapshot.Resources.UIDMappings).Should(Equal(mappings))
+				Ω(snapshot.Resources.GIDMappings).Should(Equal(mappings))
+			})
 		})
 
 		It("writes a JSON ContainerSnapshot", func() {
@@ -205,9 +255,7 @@ var _ = Describe("Linux containers", func() {
 			err := container.Snapshot(out)
 			Ω(err).ShouldNot(HaveOccurred())
 
-			var snapshot linux_container.ContainerSnapshot
-
-			err = json.NewDecoder(out).Decode(&snapshot)
+			snapshot, err := linux_container.ReadSnapshot(out)
 			Ω(err).ShouldNot(HaveOccurred())
 
 			Ω(snapshot.ID).Should(Equal("some-id"))
@@ -258,7 +306,18 @@ var _ = Describe("Linux containers", func() {
 
 			Ω(snapshot.Processes).Should(ContainElement(
 				linux_container.ProcessSnapshot{
-					ID: 3,
+					ID:  3,
+					TTY: true,
+
+					Spec: process_tracker.ProcessSpec{
+						Path: "/some/script",
+						Args: []string{"some", "args"},
+						User: "vcap",
+						Dir:  "/some/dir",
+						TTY:  true,
+					},
+					StartedAt: time.Unix(123, 0).UTC(),
+					HostPID:   4567,
 				},
 			))
 
@@ -286,6 +345,15 @@ var _ = Describe("Linux containers", func() {
 
 				err = container.LimitCPU(cpuLimits)
 				Ω(err).ShouldNot(HaveOccurred())
+
+				err = container.LimitCPUQuota(cpuQuotaLimits)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = container.LimitBlockIO(blockIOLimits)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = container.LimitPids(pidLimits)
+				Ω(err).ShouldNot(HaveOccurred())
 			})
 
 			It("saves them", func() {
@@ -294,13 +362,12 @@ var _ = Describe("Linux containers", func() {
 				err := container.Snapshot(out)
 				Ω(err).ShouldNot(HaveOccurred())
 
-				var snapshot linux_container.ContainerSnapshot
-
-				err = json.NewDecoder(out).Decode(&snapshot)
+				snapshot, err := linux_container.ReadSnapshot(out)
 				Ω(err).ShouldNot(HaveOccurred())
 
 				Ω(snapshot.State).Should(Equal("stopped"))
 				Ω(snapshot.Events).Should(Equal([]string{"out of memory"}))
+				Ω(snapshot.OomPolicy).Should(Equal(linux_container.OomPolicyStop))
 
 				Ω(snapshot.Limits).Should(Equal(
 					linux_container.LimitsSnapshot{
@@ -308,6 +375,9 @@ var _ = Describe("Linux containers", func() {
 						Disk:      &diskLimits,
 						Bandwidth: &bandwidthLimits,
 						CPU:       &cpuLimits,
+						CPUQuota:  &cpuQuotaLimits,
+						BlockIO:   &blockIOLimits,
+						Pids:      &pidLimits,
 					},
 				))
 			})
@@ -320,9 +390,7 @@ var _ = Describe("Linux containers", func() {
 				err := container.Snapshot(out)
 				Ω(err).ShouldNot(HaveOccurred())
 
-				var snapshot linux_container.ContainerSnapshot
-
-				err = json.NewDecoder(out).Decode(&snapshot)
+				snapshot, err := linux_container.ReadSnapshot(out)
 				Ω(err).ShouldNot(HaveOccurred())
 
 				Ω(snapshot.Limits).Should(Equal(
@@ -331,6 +399,7 @@ var _ = Describe("Linux containers", func() {
 						Disk:      nil,
 						Bandwidth: nil,
 						CPU:       nil,
+						CPUQuota:  nil,
 					},
 				))
 
@@ -354,6 +423,16 @@ var _ = Describe("Linux containers", func() {
 
 		})
 
+		It("restores a paused state", func() {
+			err := container.Restore(linux_container.ContainerSnapshot{
+				State:  "paused",
+				Events: []string{},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(container.State()).Should(Equal(linux_container.StatePaused))
+		})
+
 		It("restores process state", func() {
 			err := container.Restore(linux_container.ContainerSnapshot{
 				State:  "active",
@@ -372,11 +451,47 @@ var _ = Describe("Linux containers", func() {
 			})
 			Ω(err).ShouldNot(HaveOccurred())
 
-			pid, _ := fakeProcessTracker.RestoreArgsForCall(0)
-			Ω(pid).Should(Equal(uint32(0)))
+			metadata, _ := fakeProcessTracker.RestoreArgsForCall(0)
+			Ω(metadata).Should(Equal(process_tracker.ProcessMetadata{ID: 0}))
+
+			metadata, _ = fakeProcessTracker.RestoreArgsForCall(1)
+			Ω(metadata).Should(Equal(process_tracker.ProcessMetadata{ID: 1, Spec: process_tracker.ProcessSpec{TTY: true}}))
+		})
+
+		It("restores the metadata of processes", func() {
+			startedAt := time.Unix(123, 0)
+
+			err := container.Restore(linux_container.ContainerSnapshot{
+				State:  "active",
+				Events: []string{},
+
+				Processes: []linux_container.ProcessSnapshot{
+					{
+						ID:  3,
+						TTY: true,
+
+						Spec: process_tracker.ProcessSpec{
+							Path: "/some/script",
+							User: "vcap",
+							TTY:  true,
+						},
+						StartedAt: startedAt,
+						HostPID:   4567,
+					},
+				},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
 
-			pid, _ = fakeProcessTracker.RestoreArgsForCall(1)
-			Ω(pid).Should(Equal(uint32(1)))
+			metadata, _ := fakeProcessTracker.RestoreArgsForCall(0)
+			Ω(metadata).Should(Equal(process_tracker.ProcessMetadata{
+				ID: 3,
+				Spec: process_tracker.ProcessSpec{
+					Path: "/some/script",
+					User: "vcap",
+					TTY:  true,
+				},
+				StartedAt: startedAt,
+			}))
 		})
 
 		It("makes the next process ID be higher than the highest restored ID", func() {
@@ -402,7 +517,7 @@ var _ = Describe("Linux containers", func() {
 			}, garden.ProcessIO{})
 			Ω(err).ShouldNot(HaveOccurred())
 
-			nextId, _, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+			nextId, _, _, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
 
 			Ω(nextId).Should(BeNumerically(">", 5))
 		})
@@ -565,6 +680,116 @@ var _ = Describe("Linux containers", func() {
 			Eventually(container.Events).Should(ContainElement("out of memory"))
 		})
 
+		It("re-enforces the CPU limits", func() {
+			err := container.Restore(linux_container.ContainerSnapshot{
+				State:  "active",
+				Events: []string{},
+
+				Limits: linux_container.LimitsSnapshot{
+					CPU: &garden.CPULimits{
+						LimitInShares: 512,
+					},
+					CPUQuota: &linux_container.CPUQuotaLimits{
+						QuotaInMicroseconds:  20000,
+						PeriodInMicroseconds: 100000,
+					},
+				},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeCgroups.SetValues()).Should(Equal([]fake_cgroups_manager.SetValue{
+				{Subsystem: "cpu", Name: "cpu.shares", Value: "512"},
+				{Subsystem: "cpu", Name: "cpu.cfs_period_us", Value: "100000"},
+				{Subsystem: "cpu", Name: "cpu.cfs_quota_us", Value: "20000"},
+			}))
+
+			Ω(container.CurrentCPUQuotaLimits()).Should(Equal(linux_container.CPUQuotaLimits{
+				QuotaInMicroseconds:  20000,
+				PeriodInMicroseconds: 100000,
+			}))
+		})
+
+		It("re-enforces the block I/O limits", func() {
+			err := container.Restore(linux_container.ContainerSnapshot{
+				State:  "active",
+				Events: []string{},
+
+				Limits: linux_container.LimitsSnapshot{
+					BlockIO: &linux_container.BlockIOLimits{
+						Device:           "8:0",
+						Weight:           300,
+						WriteIOPerSecond: 40,
+					},
+				},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeCgroups.SetValues()).Should(ContainElement(fake_cgroups_manager.SetValue{
+				Subsystem: "blkio", Name: "blkio.weight", Value: "300",
+			}))
+
+			Ω(fakeCgroups.SetValues()).Should(ContainElement(fake_cgroups_manager.SetValue{
+				Subsystem: "blkio", Name: "blkio.throttle.write_iops_device", Value: "8:0 40",
+			}))
+
+			Ω(container.CurrentBlockIOLimits()).Should(Equal(linux_container.BlockIOLimits{
+				Device:           "8:0",
+				Weight:           300,
+				WriteIOPerSecond: 40,
+			}))
+		})
+
+		It("restores the oom policy", func() {
+			err := container.Restore(linux_container.ContainerSnapshot{
+				State:     "active",
+				Events:    []string{},
+				OomPolicy: linux_container.OomPolicyKillProcess,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(container.OomPolicy()).Should(Equal(linux_container.OomPolicyKillProcess))
+		})
+
+		It("re-enforces the pid limit", func() {
+			err := container.Restore(linux_container.ContainerSnapshot{
+				State:  "active",
+				Events: []string{},
+
+				Limits: linux_container.LimitsSnapshot{
+					Pids: &linux_container.PidLimits{Max: 128},
+				},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeCgroups.SetValues()).Should(ContainElement(fake_cgroups_manager.SetValue{
+				Subsystem: "pids", Name: "pids.max", Value: "128",
+			}))
+		})
+
+		Context("when re-enforcing the CPU quota fails", func() {
+			disaster := errors.New("oh no!")
+
+			JustBeforeEach(func() {
+				fakeCgroups.WhenSetting("cpu", "cpu.cfs_quota_us", func() error {
+					return disaster
+				})
+			})
+
+			It("returns the error", func() {
+				err := container.Restore(linux_container.ContainerSnapshot{
+					State:  "active",
+					Events: []string{},
+
+					Limits: linux_container.LimitsSnapshot{
+						CPUQuota: &linux_container.CPUQuotaLimits{
+							QuotaInMicroseconds: 20000,
+						},
+					},
+				})
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+
 		Context("when no memory limit is present", func() {
 			It("does not set a limit", func() {
 				err := container.Restore(linux_container.ContainerSnapshot{
@@ -631,6 +856,128 @@ var _ = Describe("Linux containers", func() {
 			Ω(container.State()).Should(Equal(linux_container.StateActive))
 		})
 
+		Context("when a pid limit property is given", func() {
+			BeforeEach(func() {
+				containerProps[linux_container.PidLimitProperty] = "100"
+			})
+
+			It("limits the number of processes once the container has started", func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/start.sh",
+					}, func(*exec.Cmd) error {
+						Ω(fakeCgroups.SetValues()).Should(BeEmpty())
+						return nil
+					},
+				)
+
+				err := container.Start()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeCgroups.SetValues()).Should(Equal([]fake_cgroups_manager.SetValue{
+					{Subsystem: "pids", Name: "pids.max", Value: "100"},
+				}))
+
+				Ω(container.CurrentPidLimits()).Should(Equal(linux_container.PidLimits{Max: 100}))
+			})
+
+			Context("when the pids controller is unavailable", func() {
+				BeforeEach(func() {
+					fakeCgroups.WhenGetting("pids", "pids.max", func() (string, error) {
+						return "", errors.New("no such file or directory")
+					})
+				})
+
+				It("kills the container and returns an error", func() {
+					err := container.Start()
+					Ω(err).Should(MatchError("container: start: pids cgroup controller unavailable: no such file or directory"))
+
+					Ω(fakeCgroups.SetValues()).Should(BeEmpty())
+
+					Ω(fakeRunner).Should(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/start.sh",
+						},
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/stop.sh",
+							Args: []string{"-w", "0"},
+						},
+					))
+
+					Ω(container.State()).Should(Equal(linux_container.StateBorn))
+				})
+			})
+
+			Context("when the property is not a number", func() {
+				BeforeEach(func() {
+					containerProps[linux_container.PidLimitProperty] = "lots"
+				})
+
+				It("returns an error without running start.sh", func() {
+					err := container.Start()
+					Ω(err).Should(MatchError(`container: start: invalid garden.pid_limit: "lots"`))
+
+					Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/start.sh",
+						},
+					))
+				})
+			})
+		})
+
+		Context("when memory and disk limit properties are given", func() {
+			BeforeEach(func() {
+				containerProps[linux_backend.MemoryLimitProperty] = "102400"
+				containerProps[linux_backend.DiskLimitProperty] = "204800"
+			})
+
+			It("limits the disk before starting the container and memory after", func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/start.sh",
+					}, func(*exec.Cmd) error {
+						Ω(fakeQuotaManager.Limited).Should(HaveKey(containerResources.UserUID))
+						Ω(fakeCgroups.SetValues()).Should(BeEmpty())
+						return nil
+					},
+				)
+
+				err := container.Start()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeCgroups.SetValues()).Should(ContainElement(fake_cgroups_manager.SetValue{
+					Subsystem: "memory", Name: "memory.limit_in_bytes", Value: "102400",
+				}))
+
+				Ω(fakeQuotaManager.Limited[containerResources.UserUID]).Should(Equal(garden.DiskLimits{
+					ByteHard: 204800,
+				}))
+
+				Ω(container.CommittedResources()).Should(Equal(linux_backend.CommittedResources{
+					MemoryInBytes: 102400,
+					DiskInBytes:   204800,
+				}))
+			})
+
+			Context("when a property is not a number", func() {
+				BeforeEach(func() {
+					containerProps[linux_backend.DiskLimitProperty] = "lots"
+				})
+
+				It("returns an error without running start.sh", func() {
+					err := container.Start()
+					Ω(err).Should(MatchError(`container: start: invalid garden.disk_limit_in_bytes: "lots"`))
+
+					Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/start.sh",
+						},
+					))
+				})
+			})
+		})
+
 		Context("when start.sh fails", func() {
 			nastyError := errors.New("oh no!")
 
@@ -746,1070 +1093,2409 @@ var _ = Describe("Linux containers", func() {
 		})
 	})
 
-	Describe("Cleaning up", func() {
-		Context("when the container has an oom notifier running", func() {
-			JustBeforeEach(func() {
-				err := container.LimitMemory(garden.MemoryLimits{
-					LimitInBytes: 42,
-				})
-
-				Ω(err).ShouldNot(HaveOccurred())
-			})
-
-			It("stops it", func() {
-				container.Cleanup()
+	Describe("Pausing", func() {
+		JustBeforeEach(func() {
+			err := container.Start()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
 
-				Ω(fakeRunner).Should(HaveKilled(fake_command_runner.CommandSpec{
-					Path: containerDir + "/bin/oom",
-				}))
+		It("freezes the container's freezer cgroup", func() {
+			err := container.Pause()
+			Ω(err).ShouldNot(HaveOccurred())
 
-			})
+			Ω(fakeCgroups.SetValues()).Should(ContainElement(
+				fake_cgroups_manager.SetValue{
+					Subsystem: "freezer",
+					Name:      "freezer.state",
+					Value:     "FROZEN",
+				},
+			))
 		})
-	})
 
-	Describe("Streaming data in", func() {
+		It("sets the container's state to paused", func() {
+			err := container.Pause()
+			Ω(err).ShouldNot(HaveOccurred())
 
-		BeforeEach(func() {
-		})
+			Ω(container.State()).Should(Equal(linux_container.StatePaused))
 
-		It("streams the input to tar xf in the container", func() {
-			fakeRunner.WhenRunning(
-				fake_command_runner.CommandSpec{
-					Path: containerDir + "/bin/nstar",
-					Args: []string{
-						"12345",
-						"vcap",
-						"/some/directory/dst",
-					},
-				},
-				func(cmd *exec.Cmd) error {
-					bytes, err := ioutil.ReadAll(cmd.Stdin)
-					Ω(err).ShouldNot(HaveOccurred())
+			info, err := container.Info()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(info.State).Should(Equal("paused"))
+		})
 
-					Ω(string(bytes)).Should(Equal("the-tar-content"))
+		It("waits for the freezer to finish freezing", func() {
+			reads := 0
+			fakeCgroups.WhenGetting("freezer", "freezer.state", func() (string, error) {
+				reads++
+				if reads < 3 {
+					return "FREEZING", nil
+				}
 
-					return nil
-				},
-			)
+				return "FROZEN", nil
+			})
 
-			err := container.StreamIn("/some/directory/dst", bytes.NewBufferString("the-tar-content"))
+			err := container.Pause()
 			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(reads).Should(Equal(3))
 		})
 
-		Context("when tar fails", func() {
+		Context("when the container is not active", func() {
+			JustBeforeEach(func() {
+				err := container.Stop(false)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("returns a StateTransitionError", func() {
+				err := container.Pause()
+				Ω(err).Should(Equal(linux_container.StateTransitionError{
+					Action: "pause",
+					State:  linux_container.StateStopped,
+				}))
+			})
+		})
+
+		Context("when freezing fails", func() {
 			disaster := errors.New("oh no!")
 
 			JustBeforeEach(func() {
-				fakeRunner.WhenRunning(
-					fake_command_runner.CommandSpec{
-						Path: containerDir + "/bin/nstar",
-					},
-					func(cmd *exec.Cmd) error {
-						return disaster
-					},
-				)
+				fakeCgroups.WhenSetting("freezer", "freezer.state", func() error {
+					return disaster
+				})
 			})
 
-			It("returns the error", func() {
-				err := container.StreamIn("/some/directory/dst", nil)
-				Ω(err).Should(Equal(disaster))
+			It("returns a wrapped error", func() {
+				err := container.Pause()
+				Ω(err).Should(MatchError("container: pause: oh no!"))
+			})
+
+			It("does not change the container's state", func() {
+				container.Pause()
+				Ω(container.State()).Should(Equal(linux_container.StateActive))
 			})
 		})
-	})
 
-	Describe("Streaming out", func() {
-		It("streams the output of tar cf to the destination", func() {
-			fakeRunner.WhenRunning(
-				fake_command_runner.CommandSpec{
-					Path: containerDir + "/bin/nstar",
-					Args: []string{
-						"12345",
-						"vcap",
-						"/some/directory",
-						"dst",
-					},
-				},
-				func(cmd *exec.Cmd) error {
-					_, err := cmd.Stdout.Write([]byte("the-compressed-content"))
-					Ω(err).ShouldNot(HaveOccurred())
+		Context("when paused", func() {
+			JustBeforeEach(func() {
+				err := container.Pause()
+				Ω(err).ShouldNot(HaveOccurred())
+			})
 
-					return nil
-				},
-			)
+			It("refuses to run processes", func() {
+				_, err := container.Run(garden.ProcessSpec{Path: "/some/script"}, garden.ProcessIO{})
+				Ω(err).Should(BeAssignableToTypeOf(linux_container.StateTransitionError{}))
 
-			reader, err := container.StreamOut("/some/directory/dst")
+				Ω(fakeProcessTracker.RunCallCount()).Should(Equal(0))
+			})
+
+			It("thaws the container before stopping it", func() {
+				err := container.Stop(false)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				setValues := fakeCgroups.SetValues()
+				Ω(setValues[len(setValues)-1]).Should(Equal(fake_cgroups_manager.SetValue{
+					Subsystem: "freezer",
+					Name:      "freezer.state",
+					Value:     "THAWED",
+				}))
+
+				Ω(container.State()).Should(Equal(linux_container.StateStopped))
+			})
+
+			It("is saved in the snapshot", func() {
+				out := new(bytes.Buffer)
+
+				err := container.Snapshot(out)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				snapshot, err := linux_container.ReadSnapshot(out)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(snapshot.State).Should(Equal("paused"))
+			})
+		})
+	})
+
+	Describe("Resuming", func() {
+		JustBeforeEach(func() {
+			err := container.Start()
 			Ω(err).ShouldNot(HaveOccurred())
 
-			bytes, err := ioutil.ReadAll(reader)
+			err = container.Pause()
 			Ω(err).ShouldNot(HaveOccurred())
-			Ω(string(bytes)).Should(Equal("the-compressed-content"))
 		})
 
-		It("closes the server-side dupe of of the pipe's write end", func() {
-			var outPipe io.Writer
+		It("thaws the container's freezer cgroup", func() {
+			err := container.Resume()
+			Ω(err).ShouldNot(HaveOccurred())
 
-			fakeRunner.WhenRunning(
-				fake_command_runner.CommandSpec{
-					Path: containerDir + "/bin/nstar",
-					Args: []string{
-						"12345",
-						"vcap",
-						"/some/directory",
-						"dst",
-					},
-				},
-				func(cmd *exec.Cmd) error {
-					outPipe = cmd.Stdout
-					return nil
-				},
-			)
+			setValues := fakeCgroups.SetValues()
+			Ω(setValues[len(setValues)-1]).Should(Equal(fake_cgroups_manager.SetValue{
+				Subsystem: "freezer",
+				Name:      "freezer.state",
+				Value:     "THAWED",
+			}))
+		})
 
-			_, err := container.StreamOut("/some/directory/dst")
+		It("sets the container's state to active", func() {
+			err := container.Resume()
 			Ω(err).ShouldNot(HaveOccurred())
 
-			Ω(outPipe).ShouldNot(BeNil())
-
-			_, err = outPipe.Write([]byte("sup"))
-			Ω(err).Should(HaveOccurred())
+			Ω(container.State()).Should(Equal(linux_container.StateActive))
 		})
 
-		Context("when there's a trailing slash", func() {
-			It("compresses the directory's contents", func() {
-				_, err := container.StreamOut("/some/directory/dst/")
+		Context("when the container is not paused", func() {
+			JustBeforeEach(func() {
+				err := container.Resume()
 				Ω(err).ShouldNot(HaveOccurred())
+			})
 
-				Ω(fakeRunner).Should(HaveBackgrounded(
-					fake_command_runner.CommandSpec{
-						Path: containerDir + "/bin/nstar",
-						Args: []string{
-							"12345",
-							"vcap",
-							"/some/directory/dst/",
-							".",
-						},
-					},
-				))
+			It("returns a StateTransitionError", func() {
+				err := container.Resume()
+				Ω(err).Should(Equal(linux_container.StateTransitionError{
+					Action: "resume",
+					State:  linux_container.StateActive,
+				}))
 			})
 		})
 
-		Context("when executing the command fails", func() {
+		Context("when thawing fails", func() {
 			disaster := errors.New("oh no!")
 
 			JustBeforeEach(func() {
-				fakeRunner.WhenRunning(
-					fake_command_runner.CommandSpec{
-						Path: containerDir + "/bin/nstar",
-					}, func(*exec.Cmd) error {
-						return disaster
-					},
-				)
+				fakeCgroups.WhenSetting("freezer", "freezer.state", func() error {
+					return disaster
+				})
 			})
 
-			It("returns the error", func() {
-				_, err := container.StreamOut("/some/dst")
-				Ω(err).Should(Equal(disaster))
+			It("returns a wrapped error and stays paused", func() {
+				err := container.Resume()
+				Ω(err).Should(MatchError("container: resume: oh no!"))
+
+				Ω(container.State()).Should(Equal(linux_container.StatePaused))
 			})
 		})
 	})
 
-	Describe("Running", func() {
-		It("runs the /bin/bash via wsh with the given script as the input, and rlimits in env", func() {
-			_, err := container.Run(garden.ProcessSpec{
-				Path: "/some/script",
-				Args: []string{"arg1", "arg2"},
-				Limits: garden.ResourceLimits{
-					As:         uint64ptr(1),
-					Core:       uint64ptr(2),
-					Cpu:        uint64ptr(3),
-					Data:       uint64ptr(4),
-					Fsize:      uint64ptr(5),
-					Locks:      uint64ptr(6),
-					Memlock:    uint64ptr(7),
-					Msgqueue:   uint64ptr(8),
-					Nice:       uint64ptr(9),
-					Nofile:     uint64ptr(10),
-					Nproc:      uint64ptr(11),
-					Rss:        uint64ptr(12),
-					Rtprio:     uint64ptr(13),
-					Sigpending: uint64ptr(14),
-					Stack:      uint64ptr(15),
-				},
-			}, garden.ProcessIO{})
+	Describe("Cleaning up", func() {
+		Context("when the container has an oom notifier running", func() {
+			JustBeforeEach(func() {
+				err := container.LimitMemory(garden.MemoryLimits{
+					LimitInBytes: 42,
+				})
 
-			Ω(err).ShouldNot(HaveOccurred())
+				Ω(err).ShouldNot(HaveOccurred())
+			})
 
-			_, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
-			Ω(ranCmd.Path).Should(Equal(containerDir + "/bin/wsh"))
+			It("stops it", func() {
+				container.Cleanup()
 
-			Ω(ranCmd.Args).Should(Equal([]string{
-				containerDir + "/bin/wsh",
-				"--socket", containerDir + "/run/wshd.sock",
-				"--user", "vcap",
-				"--env", "LANG=en_US.UTF-8",
-				"--env", "env1=env1Value",
-				"--env", "env2=env2Value",
-				"--pidfile", containerDir + "/processes/1.pid",
-				"/some/script",
-				"arg1",
-				"arg2",
-			}))
+				Ω(fakeRunner).Should(HaveKilled(fake_command_runner.CommandSpec{
+					Path: containerDir + "/bin/oom",
+				}))
 
-			Ω(ranCmd.Env).Should(Equal([]string{
-				"RLIMIT_AS=1",
-				"RLIMIT_CORE=2",
-				"RLIMIT_CPU=3",
-				"RLIMIT_DATA=4",
-				"RLIMIT_FSIZE=5",
-				"RLIMIT_LOCKS=6",
-				"RLIMIT_MEMLOCK=7",
-				"RLIMIT_MSGQUEUE=8",
-				"RLIMIT_NICE=9",
-				"RLIMIT_NOFILE=10",
-				"RLIMIT_NPROC=11",
-				"RLIMIT_RSS=12",
-				"RLIMIT_RTPRIO=13",
-				"RLIMIT_SIGPENDING=14",
-				"RLIMIT_STACK=15",
-			}))
+			})
 		})
+	})
 
-		It("runs wsh with the --pidfile parameter and configures the Process with this pidfile", func() {
-			_, err := container.Run(garden.ProcessSpec{
-				Path: "/some/script",
-			}, garden.ProcessIO{})
+	Describe("Subscribing to events", func() {
+		It("publishes state changes", func() {
+			subscription := container.Subscribe()
+
+			err := container.Start()
 			Ω(err).ShouldNot(HaveOccurred())
 
-			_, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
-			Ω(ranCmd.Args).Should(Equal([]string{
-				containerDir + "/bin/wsh",
-				"--socket", containerDir + "/run/wshd.sock",
-				"--user", "vcap",
-				"--env", "LANG=en_US.UTF-8",
-				"--env", "env1=env1Value",
-				"--env", "env2=env2Value",
-				"--pidfile", containerDir + "/processes/1.pid",
-				"/some/script",
+			var event events.Event
+			Ω(subscription.Events()).Should(Receive(&event))
+			Ω(event.Type).Should(Equal(events.TypeStateChange))
+			Ω(event.Handle).Should(Equal("some-handle"))
+			Ω(event.Details).Should(Equal(map[string]string{
+				"from": "born",
+				"to":   "active",
 			}))
 		})
 
-		It("configures a signaller with the same pid as the pidfile parameter", func() {
-			_, err := container.Run(garden.ProcessSpec{
-				Path: "/some/script",
-			}, garden.ProcessIO{})
-			Ω(err).ShouldNot(HaveOccurred())
+		Context("when the oom notifier exits 0", func() {
+			JustBeforeEach(func() {
+				fakeRunner.WhenWaitingFor(fake_command_runner.CommandSpec{
+					Path: containerDir + "/bin/oom",
+				}, func(cmd *exec.Cmd) error {
+					return nil
+				})
+			})
 
-			_, _, _, _, signaller := fakeProcessTracker.RunArgsForCall(0)
-			Ω(signaller).Should(Equal(&linux_backend.NamespacedSignaller{
-				ContainerPath: containerDir,
-				Runner:        fakeRunner,
-				PidFilePath:   containerDir + "/processes/1.pid",
-			}))
-		})
+			It("publishes an out of memory event", func() {
+				subscription := container.Subscribe()
 
-		It("uses unique process IDs for each process", func() {
-			_, err := container.Run(garden.ProcessSpec{
-				Path: "/some/script",
-			}, garden.ProcessIO{})
-			Ω(err).ShouldNot(HaveOccurred())
+				err := container.LimitMemory(garden.MemoryLimits{LimitInBytes: 42})
+				Ω(err).ShouldNot(HaveOccurred())
 
-			_, err = container.Run(garden.ProcessSpec{
-				Path: "/some/script",
-			}, garden.ProcessIO{})
-			Ω(err).ShouldNot(HaveOccurred())
+				var event events.Event
+				Eventually(subscription.Events()).Should(Receive(&event))
+				Ω(event.Type).Should(Equal(events.TypeOutOfMemory))
+			})
 
-			id1, _, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
-			id2, _, _, _, _ := fakeProcessTracker.RunArgsForCall(1)
+			Context("when memory.stat can be read", func() {
+				BeforeEach(func() {
+					fakeCgroups.WhenGetting("memory", "memory.stat", func() (string, error) {
+						return "cache 1\nrss 2\n", nil
+					})
+				})
 
-			Ω(id1).ShouldNot(Equal(id2))
-		})
+				It("includes a snapshot of it and the policy in the event", func() {
+					subscription := container.Subscribe()
 
-		It("should return an error when an environment variable is malformed", func() {
-			_, err := container.Run(garden.ProcessSpec{
-				Path: "/some/script",
-				Env:  []string{"a=="},
-			}, garden.ProcessIO{})
-			Ω(err).Should(MatchError(HavePrefix("malformed environment")))
-		})
+					err := container.LimitMemory(garden.MemoryLimits{LimitInBytes: 42})
+					Ω(err).ShouldNot(HaveOccurred())
 
-		It("runs the script with environment variables", func() {
-			_, err := container.Run(garden.ProcessSpec{
-				Path: "/some/script",
-				Env:  []string{"ESCAPED=kurt \"russell\"", "UNESCAPED=isaac\nhayes"},
-			}, garden.ProcessIO{})
+					var event events.Event
+					Eventually(subscription.Events()).Should(Receive(&event))
+					Ω(event.Details).Should(Equal(map[string]string{
+						"policy":            "stop",
+						"memory_stat.cache": "1",
+						"memory_stat.rss":   "2",
+					}))
+				})
+			})
+		})
+
+		It("publishes the exit of processes that were run", func() {
+			process := new(wfakes.FakeProcess)
+			process.IDReturns(42)
+			process.WaitReturns(123, nil)
+			fakeProcessTracker.RunReturns(process, nil)
 
+			subscription := container.Subscribe()
+
+			_, err := container.Run(garden.ProcessSpec{Path: "/some/script"}, garden.ProcessIO{})
 			Ω(err).ShouldNot(HaveOccurred())
 
-			_, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
-			Ω(ranCmd.Args).Should(Equal([]string{
-				containerDir + "/bin/wsh",
-				"--socket", containerDir + "/run/wshd.sock",
-				"--user", "vcap",
-				"--env", `ESCAPED=kurt "russell"`,
-				"--env", "LANG=en_US.UTF-8",
-				"--env", "UNESCAPED=isaac\nhayes",
-				"--env", "env1=env1Value",
-				"--env", "env2=env2Value",
-				"--pidfile", containerDir + "/processes/1.pid",
-				"/some/script",
+			var event events.Event
+			Eventually(subscription.Events()).Should(Receive(&event))
+			Ω(event.Type).Should(Equal(events.TypeProcessExit))
+			Ω(event.Details).Should(Equal(map[string]string{
+				"process_id":  "42",
+				"exit_status": "123",
 			}))
 		})
 
-		Describe("LANG environment variable", func() {
-			It("forwards the LANG variable the environment if the user doesn't specify it", func() {
-				os.Setenv("LANG", "C")
+		It("publishes how processes that were run exited, when known", func() {
+			process := &fakeExitStatusProcess{
+				FakeProcess: new(wfakes.FakeProcess),
+				exitStatus: link.ExitStatus{
+					ExitCode:   -1,
+					Signal:     syscall.SIGSEGV,
+					CoreDumped: true,
+					Rusage: &link.Rusage{
+						UserTime:   2 * time.Second,
+						SystemTime: time.Second,
+						MaxRSSInKB: 1024,
+					},
+				},
+			}
+			process.IDReturns(42)
+			fakeProcessTracker.RunReturns(process, nil)
 
-				_, err := container.Run(garden.ProcessSpec{
-					Path: "/some/script",
-				}, garden.ProcessIO{})
+			subscription := container.Subscribe()
+
+			_, err := container.Run(garden.ProcessSpec{Path: "/some/script"}, garden.ProcessIO{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var event events.Event
+			Eventually(subscription.Events()).Should(Receive(&event))
+			Ω(event.Type).Should(Equal(events.TypeProcessExit))
+			Ω(event.Details).Should(Equal(map[string]string{
+				"process_id":                          "42",
+				"exit_status":                         "-1",
+				"signal":                              "11",
+				"core_dumped":                         "true",
+				"rusage.user_time":                    "2s",
+				"rusage.system_time":                  "1s",
+				"rusage.max_rss_in_kb":                "1024",
+				"rusage.minor_faults":                 "0",
+				"rusage.major_faults":                 "0",
+				"rusage.voluntary_context_switches":   "0",
+				"rusage.involuntary_context_switches": "0",
+			}))
+		})
+
+		Context("when the disk usage reaches the hard limit", func() {
+			JustBeforeEach(func() {
+				err := container.LimitDisk(garden.DiskLimits{ByteHard: 1024})
 				Ω(err).ShouldNot(HaveOccurred())
 
-				_, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
-				Ω(ranCmd.Args).Should(ContainElement("LANG=C"))
+				fakeQuotaManager.GetUsageResult = garden.ContainerDiskStat{
+					BytesUsed:  1024,
+					InodesUsed: 3,
+				}
 			})
 
-			It("forwards the LANG variable the environment if the user doesn't specify it", func() {
-				os.Unsetenv("LANG")
+			It("publishes a quota exceeded event once", func() {
+				subscription := container.Subscribe()
 
-				_, err := container.Run(garden.ProcessSpec{
-					Path: "/some/script",
-				}, garden.ProcessIO{})
+				_, err := container.Info()
 				Ω(err).ShouldNot(HaveOccurred())
 
-				_, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
-				Ω(ranCmd.Args).Should(ContainElement("LANG=en_US.UTF-8"))
-			})
-		})
+				_, err = container.Info()
+				Ω(err).ShouldNot(HaveOccurred())
 
-		It("runs the script with the environment variables from the run taking precedence over the container environment variables", func() {
-			_, err := container.Run(garden.ProcessSpec{
-				Path: "/some/script",
-				Env: []string{
-					"env1=overridden",
-					"LANG=POSIX",
-				},
-			}, garden.ProcessIO{})
+				var event events.Event
+				Ω(subscription.Events()).Should(Receive(&event))
+				Ω(event.Type).Should(Equal(events.TypeQuotaExceeded))
+				Ω(event.Details).Should(Equal(map[string]string{
+					"bytes_used":  "1024",
+					"inodes_used": "3",
+				}))
 
-			Ω(err).ShouldNot(HaveOccurred())
+				Ω(subscription.Events()).ShouldNot(Receive())
+			})
 
-			_, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
-			Ω(ranCmd.Args).Should(Equal([]string{
-				containerDir + "/bin/wsh",
-				"--socket", containerDir + "/run/wshd.sock",
-				"--user", "vcap",
-				"--env", "LANG=POSIX",
-				"--env", "env1=overridden",
-				"--env", "env2=env2Value",
-				"--pidfile", containerDir + "/processes/1.pid",
-				"/some/script",
-			}))
-		})
+			It("publishes a quota exceeded event when the usage is recorded", func() {
+				subscription := container.Subscribe()
 
-		It("runs the script with the working dir set if present", func() {
-			_, err := container.Run(garden.ProcessSpec{
-				Path: "/some/script",
-				Dir:  "/some/dir",
-			}, garden.ProcessIO{})
+				container.RecordDiskUsage(garden.ContainerDiskStat{
+					BytesUsed:  2048,
+					InodesUsed: 5,
+				})
 
-			Ω(err).ShouldNot(HaveOccurred())
+				var event events.Event
+				Ω(subscription.Events()).Should(Receive(&event))
+				Ω(event.Type).Should(Equal(events.TypeQuotaExceeded))
+				Ω(event.Details).Should(Equal(map[string]string{
+					"bytes_used":  "2048",
+					"inodes_used": "5",
+				}))
 
-			_, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
-			Ω(ranCmd.Args).Should(Equal([]string{
-				containerDir + "/bin/wsh",
-				"--socket", containerDir + "/run/wshd.sock",
-				"--user", "vcap",
-				"--env", "LANG=en_US.UTF-8",
-				"--env", "env1=env1Value",
-				"--env", "env2=env2Value",
-				"--dir", "/some/dir",
-				"--pidfile", containerDir + "/processes/1.pid",
-				"/some/script",
-			}))
+				_, err := container.Info()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(subscription.Events()).ShouldNot(Receive())
+			})
 		})
 
-		It("runs the script with a TTY if present", func() {
-			ttySpec := &garden.TTYSpec{
-				WindowSize: &garden.WindowSize{
-					Columns: 123,
-					Rows:    456,
-				},
-			}
+		Context("when forks are refused because of the pid limit", func() {
+			var refusedForks string
 
-			_, err := container.Run(garden.ProcessSpec{
-				Path: "/some/script",
-				TTY:  ttySpec,
-			}, garden.ProcessIO{})
+			BeforeEach(func() {
+				refusedForks = "0"
 
-			Ω(err).ShouldNot(HaveOccurred())
+				fakeCgroups.WhenGetting("pids", "pids.events", func() (string, error) {
+					return "max " + refusedForks + "\n", nil
+				})
 
-			_, _, _, tty, _ := fakeProcessTracker.RunArgsForCall(0)
-			Ω(tty).Should(Equal(ttySpec))
-		})
+				fakeCgroups.WhenGetting("pids", "pids.current", func() (string, error) {
+					return "10\n", nil
+				})
+			})
 
-		Describe("streaming", func() {
 			JustBeforeEach(func() {
-				fakeProcessTracker.RunStub = func(processID uint32, cmd *exec.Cmd, io garden.ProcessIO, tty *garden.TTYSpec, _ process_tracker.Signaller) (garden.Process, error) {
-					writing := new(sync.WaitGroup)
-					writing.Add(1)
+				err := container.LimitPids(linux_container.PidLimits{Max: 10})
+				Ω(err).ShouldNot(HaveOccurred())
+			})
 
-					go func() {
-						defer writing.Done()
-						defer GinkgoRecover()
+			It("publishes a pid limit event each time more forks are refused", func() {
+				subscription := container.Subscribe()
 
-						_, err := fmt.Fprintf(io.Stdout, "hi out\n")
-						Ω(err).ShouldNot(HaveOccurred())
+				_, err := container.LinuxInfo()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(subscription.Events()).ShouldNot(Receive())
 
-						_, err = fmt.Fprintf(io.Stderr, "hi err\n")
-						Ω(err).ShouldNot(HaveOccurred())
-					}()
+				refusedForks = "3"
 
-					process := new(wfakes.FakeProcess)
+				_, err = container.LinuxInfo()
+				Ω(err).ShouldNot(HaveOccurred())
 
-					process.IDReturns(processID)
+				_, err = container.LinuxInfo()
+				Ω(err).ShouldNot(HaveOccurred())
 
-					process.WaitStub = func() (int, error) {
-						writing.Wait()
-						return 123, nil
-					}
+				var event events.Event
+				Ω(subscription.Events()).Should(Receive(&event))
+				Ω(event.Type).Should(Equal(events.TypePidLimitReached))
+				Ω(event.Details).Should(Equal(map[string]string{
+					"max":   "10",
+					"count": "3",
+				}))
 
-					return process, nil
-				}
+				Ω(subscription.Events()).ShouldNot(Receive())
+
+				refusedForks = "4"
+
+				_, err = container.LinuxInfo()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(subscription.Events()).Should(Receive(&event))
+				Ω(event.Details["count"]).Should(Equal("4"))
 			})
 
-			It("streams stderr and stdout and exit status", func() {
-				stdout := gbytes.NewBuffer()
-				stderr := gbytes.NewBuffer()
+			It("registers the event once", func() {
+				refusedForks = "3"
 
-				process, err := container.Run(garden.ProcessSpec{
-					Path: "/some/script",
-				}, garden.ProcessIO{
-					Stdout: stdout,
-					Stderr: stderr,
-				})
+				_, err := container.LinuxInfo()
 				Ω(err).ShouldNot(HaveOccurred())
 
-				Ω(process.ID()).Should(Equal(uint32(1)))
+				refusedForks = "5"
 
-				Eventually(stdout).Should(gbytes.Say("hi out\n"))
-				Eventually(stderr).Should(gbytes.Say("hi err\n"))
+				_, err = container.LinuxInfo()
+				Ω(err).ShouldNot(HaveOccurred())
 
-				Ω(process.Wait()).Should(Equal(123))
+				Ω(container.Events()).Should(Equal([]string{"pid limit reached"}))
+			})
+
+			It("notices without being asked for info", func() {
+				subscription := container.Subscribe()
+
+				refusedForks = "1"
+
+				var event events.Event
+				Eventually(subscription.Events(), 3*time.Second).Should(Receive(&event))
+				Ω(event.Type).Should(Equal(events.TypePidLimitReached))
 			})
 		})
 
-		It("only sets the given rlimits", func() {
-			_, err := container.Run(garden.ProcessSpec{
-				Path: "/some/script",
-				Limits: garden.ResourceLimits{
-					As:      uint64ptr(1),
-					Cpu:     uint64ptr(3),
-					Fsize:   uint64ptr(5),
-					Memlock: uint64ptr(7),
-					Nice:    uint64ptr(9),
-					Nproc:   uint64ptr(11),
-					Rtprio:  uint64ptr(13),
-					Stack:   uint64ptr(15),
-				},
-			}, garden.ProcessIO{})
+		Context("when the container is destroyed", func() {
+			It("publishes a destroy event and closes the stream", func() {
+				subscription := container.Subscribe()
 
-			Ω(err).ShouldNot(HaveOccurred())
+				container.Destroyed()
 
-			_, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
-			Ω(ranCmd.Path).Should(Equal(containerDir + "/bin/wsh"))
+				var event events.Event
+				Ω(subscription.Events()).Should(Receive(&event))
+				Ω(event.Type).Should(Equal(events.TypeDestroy))
 
-			Ω(ranCmd.Args).Should(Equal([]string{
-				containerDir + "/bin/wsh",
-				"--socket", containerDir + "/run/wshd.sock",
-				"--user", "vcap",
-				"--env", "LANG=en_US.UTF-8",
-				"--env", "env1=env1Value",
-				"--env", "env2=env2Value",
-				"--pidfile", containerDir + "/processes/1.pid",
-				"/some/script",
-			}))
+				Ω(subscription.Events()).Should(BeClosed())
+			})
+		})
+	})
 
-			Ω(ranCmd.Env).Should(Equal([]string{
-				"RLIMIT_AS=1",
-				"RLIMIT_CPU=3",
-				"RLIMIT_FSIZE=5",
-				"RLIMIT_MEMLOCK=7",
-				"RLIMIT_NICE=9",
-				"RLIMIT_NPROC=11",
-				"RLIMIT_RTPRIO=13",
-				"RLIMIT_STACK=15",
-			}))
+	Describe("Streaming data in", func() {
+
+		BeforeEach(func() {
 		})
 
-		Context("with 'privileged' true", func() {
-			Context("when the user flag is empty", func() {
-				It("runs with --user root", func() {
-					_, err := container.Run(garden.ProcessSpec{
-						Path:       "/some/script",
-						Privileged: true,
-					}, garden.ProcessIO{})
+		It("streams the input to tar xf in the container", func() {
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: containerDir + "/bin/nstar",
+					Args: []string{
+						"12345",
+						"vcap",
+						"/some/directory/dst",
+					},
+				},
+				func(cmd *exec.Cmd) error {
+					bytes, err := ioutil.ReadAll(cmd.Stdin)
+					Ω(err).ShouldNot(HaveOccurred())
 
-					Ω(err).ToNot(HaveOccurred())
+					Ω(string(bytes)).Should(Equal("the-tar-content"))
 
-					_, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
-					Ω(ranCmd.Path).Should(Equal(containerDir + "/bin/wsh"))
+					return nil
+				},
+			)
 
-					Ω(ranCmd.Args).Should(Equal([]string{
-						containerDir + "/bin/wsh",
-						"--socket", containerDir + "/run/wshd.sock",
-						"--user", "root",
-						"--env", "LANG=en_US.UTF-8",
-						"--env", "env1=env1Value",
-						"--env", "env2=env2Value",
-						"--pidfile", containerDir + "/processes/1.pid",
-						"/some/script",
-					}))
-				})
+			err := container.StreamIn("/some/directory/dst", bytes.NewBufferString("the-tar-content"))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		Context("when tar fails", func() {
+			disaster := errors.New("oh no!")
+
+			JustBeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/bin/nstar",
+					},
+					func(cmd *exec.Cmd) error {
+						return disaster
+					},
+				)
 			})
 
-			Context("when the user flag is specified", func() {
-				It("runs with --user set to the specified user", func() {
+			It("returns the error", func() {
+				err := container.StreamIn("/some/directory/dst", nil)
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("Streaming out", func() {
+		It("streams the output of tar cf to the destination", func() {
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: containerDir + "/bin/nstar",
+					Args: []string{
+						"12345",
+						"vcap",
+						"/some/directory",
+						"dst",
+					},
+				},
+				func(cmd *exec.Cmd) error {
+					_, err := cmd.Stdout.Write([]byte("the-compressed-content"))
+					Ω(err).ShouldNot(HaveOccurred())
+
+					return nil
+				},
+			)
+
+			reader, err := container.StreamOut("/some/directory/dst")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			bytes, err := ioutil.ReadAll(reader)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(bytes)).Should(Equal("the-compressed-content"))
+		})
+
+		It("closes the server-side dupe of of the pipe's write end", func() {
+			var outPipe io.Writer
+
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: containerDir + "/bin/nstar",
+					Args: []string{
+						"12345",
+						"vcap",
+						"/some/directory",
+						"dst",
+					},
+				},
+				func(cmd *exec.Cmd) error {
+					outPipe = cmd.Stdout
+					return nil
+				},
+			)
+
+			_, err := container.StreamOut("/some/directory/dst")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(outPipe).ShouldNot(BeNil())
+
+			_, err = outPipe.Write([]byte("sup"))
+			Ω(err).Should(HaveOccurred())
+		})
+
+		Context("when there's a trailing slash", func() {
+			It("compresses the directory's contents", func() {
+				_, err := container.StreamOut("/some/directory/dst/")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveBackgrounded(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/bin/nstar",
+						Args: []string{
+							"12345",
+							"vcap",
+							"/some/directory/dst/",
+							".",
+						},
+					},
+				))
+			})
+		})
+
+		Context("when executing the command fails", func() {
+			disaster := errors.New("oh no!")
+
+			JustBeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/bin/nstar",
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				_, err := container.StreamOut("/some/dst")
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("Running", func() {
+		It("runs the /bin/bash via wsh with the given script as the input, and rlimits in env", func() {
+			_, err := container.Run(garden.ProcessSpec{
+				Path: "/some/script",
+				Args: []string{"arg1", "arg2"},
+				Limits: garden.ResourceLimits{
+					As:         uint64ptr(1),
+					Core:       uint64ptr(2),
+					Cpu:        uint64ptr(3),
+					Data:       uint64ptr(4),
+					Fsize:      uint64ptr(5),
+					Locks:      uint64ptr(6),
+					Memlock:    uint64ptr(7),
+					Msgqueue:   uint64ptr(8),
+					Nice:       uint64ptr(9),
+					Nofile:     uint64ptr(10),
+					Nproc:      uint64ptr(11),
+					Rss:        uint64ptr(12),
+					Rtprio:     uint64ptr(13),
+					Sigpending: uint64ptr(14),
+					Stack:      uint64ptr(15),
+				},
+			}, garden.ProcessIO{})
+
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, _, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+			Ω(ranCmd.Path).Should(Equal(containerDir + "/bin/wsh"))
+
+			Ω(ranCmd.Args).Should(Equal([]string{
+				containerDir + "/bin/wsh",
+				"--socket", containerDir + "/run/wshd.sock",
+				"--user", "vcap",
+				"--env", "LANG=en_US.UTF-8",
+				"--env", "env1=env1Value",
+				"--env", "env2=env2Value",
+				"--pidfile", containerDir + "/processes/1.pid",
+				"/some/script",
+				"arg1",
+				"arg2",
+			}))
+
+			Ω(ranCmd.Env).Should(Equal([]string{
+				"RLIMIT_AS=1",
+				"RLIMIT_CORE=2",
+				"RLIMIT_CPU=3",
+				"RLIMIT_DATA=4",
+				"RLIMIT_FSIZE=5",
+				"RLIMIT_LOCKS=6",
+				"RLIMIT_MEMLOCK=7",
+				"RLIMIT_MSGQUEUE=8",
+				"RLIMIT_NICE=9",
+				"RLIMIT_NOFILE=10",
+				"RLIMIT_NPROC=11",
+				"RLIMIT_RSS=12",
+				"RLIMIT_RTPRIO=13",
+				"RLIMIT_SIGPENDING=14",
+				"RLIMIT_STACK=15",
+			}))
+		})
+
+		It("runs wsh with the --pidfile parameter and configures the Process with this pidfile", func() {
+			_, err := container.Run(garden.ProcessSpec{
+				Path: "/some/script",
+			}, garden.ProcessIO{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, _, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+			Ω(ranCmd.Args).Should(Equal([]string{
+				containerDir + "/bin/wsh",
+				"--socket", containerDir + "/run/wshd.sock",
+				"--user", "vcap",
+				"--env", "LANG=en_US.UTF-8",
+				"--env", "env1=env1Value",
+				"--env", "env2=env2Value",
+				"--pidfile", containerDir + "/processes/1.pid",
+				"/some/script",
+			}))
+		})
+
+		It("tracks the process with its spec", func() {
+			_, err := container.Run(garden.ProcessSpec{
+				Path: "/some/script",
+				Args: []string{"arg1"},
+				User: "alice",
+				Dir:  "/some/dir",
+				TTY:  &garden.TTYSpec{},
+			}, garden.ProcessIO{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, spec, _, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+			Ω(spec).Should(Equal(process_tracker.ProcessSpec{
+				Path: "/some/script",
+				Args: []string{"arg1"},
+				User: "alice",
+				Dir:  "/some/dir",
+				TTY:  true,
+			}))
+		})
+
+		It("lists the tracked processes", func() {
+			processes := []process_tracker.ProcessMetadata{{ID: 1}, {ID: 2}}
+			fakeProcessTracker.ProcessesReturns(processes)
+
+			Ω(container.Processes()).Should(Equal(processes))
+		})
+
+		Context("when the container has process log properties", func() {
+			It("has the process's output logged", func() {
+				Ω(container.SetProperty(linux_container.ProcessLogMaxBytesProperty, "1024")).Should(Succeed())
+				Ω(container.SetProperty(linux_container.ProcessLogMaxFilesProperty, "3")).Should(Succeed())
+
+				_, err := container.Run(garden.ProcessSpec{
+					Path: "/some/script",
+				}, garden.ProcessIO{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, spec, _, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+				Ω(spec.Log).Should(Equal(&process_tracker.LogSpec{MaxBytes: 1024, MaxFiles: 3}))
+			})
+
+			Context("when they are invalid", func() {
+				It("returns an error without running the process", func() {
+					Ω(container.SetProperty(linux_container.ProcessLogMaxBytesProperty, "lots")).Should(Succeed())
+
 					_, err := container.Run(garden.ProcessSpec{
-						Path:       "/some/script",
-						Privileged: true,
-						User:       "potato",
+						Path: "/some/script",
+					}, garden.ProcessIO{})
+					Ω(err).Should(HaveOccurred())
+
+					Ω(fakeProcessTracker.RunCallCount()).Should(Equal(0))
+				})
+			})
+		})
+
+		Context("when the container has process timeout properties", func() {
+			It("has the process stopped once it times out", func() {
+				Ω(container.SetProperty(linux_container.ProcessTimeoutProperty, "30m")).Should(Succeed())
+				Ω(container.SetProperty(linux_container.ProcessTimeoutGracePeriodProperty, "5s")).Should(Succeed())
+
+				_, err := container.Run(garden.ProcessSpec{
+					Path: "/some/script",
+				}, garden.ProcessIO{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, spec, _, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+				Ω(spec.Timeout).Should(Equal(&process_tracker.TimeoutSpec{
+					Duration:    30 * time.Minute,
+					GracePeriod: 5 * time.Second,
+				}))
+			})
+
+			Context("when they are invalid", func() {
+				It("returns an error without running the process", func() {
+					Ω(container.SetProperty(linux_container.ProcessTimeoutProperty, "forever")).Should(Succeed())
+
+					_, err := container.Run(garden.ProcessSpec{
+						Path: "/some/script",
 					}, garden.ProcessIO{})
+					Ω(err).Should(HaveOccurred())
+
+					Ω(fakeProcessTracker.RunCallCount()).Should(Equal(0))
+				})
+			})
+		})
+
+		It("signals processes through the tracker", func() {
+			request := process_tracker.SignalRequest{Signal: syscall.SIGHUP, Group: true}
+
+			Ω(container.SignalProcess(42, request)).Should(Succeed())
+
+			processID, actualRequest := fakeProcessTracker.SignalArgsForCall(0)
+			Ω(processID).Should(Equal(uint32(42)))
+			Ω(actualRequest).Should(Equal(request))
+		})
+
+		It("streams process logs from the tracker", func() {
+			fakeProcessTracker.LogStub = func(processID uint32, request process_tracker.LogRequest, out io.Writer) error {
+				_, err := out.Write([]byte("some log"))
+				return err
+			}
+
+			request := process_tracker.LogRequest{Stream: process_tracker.StderrLog, Lines: 5}
+
+			out := new(bytes.Buffer)
+			Ω(container.ProcessLog(42, request, out)).Should(Succeed())
+			Ω(out.String()).Should(Equal("some log"))
+
+			processID, actualRequest, _ := fakeProcessTracker.LogArgsForCall(0)
+			Ω(processID).Should(Equal(uint32(42)))
+			Ω(actualRequest).Should(Equal(request))
+		})
+
+		It("configures a signaller with the same pid as the pidfile parameter", func() {
+			_, err := container.Run(garden.ProcessSpec{
+				Path: "/some/script",
+			}, garden.ProcessIO{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, _, _, _, _, signaller := fakeProcessTracker.RunArgsForCall(0)
+			Ω(signaller).Should(Equal(&linux_backend.NamespacedSignaller{
+				ContainerPath: containerDir,
+				Runner:        fakeRunner,
+				PidFilePath:   containerDir + "/processes/1.pid",
+			}))
+		})
+
+		It("uses unique process IDs for each process", func() {
+			_, err := container.Run(garden.ProcessSpec{
+				Path: "/some/script",
+			}, garden.ProcessIO{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = container.Run(garden.ProcessSpec{
+				Path: "/some/script",
+			}, garden.ProcessIO{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			id1, _, _, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+			id2, _, _, _, _, _ := fakeProcessTracker.RunArgsForCall(1)
+
+			Ω(id1).ShouldNot(Equal(id2))
+		})
+
+		It("should return an error when an environment variable is malformed", func() {
+			_, err := container.Run(garden.ProcessSpec{
+				Path: "/some/script",
+				Env:  []string{"=a"},
+			}, garden.ProcessIO{})
+			Ω(err).Should(MatchError(HavePrefix("malformed environment")))
+		})
+
+		It("runs the script with environment variables", func() {
+			_, err := container.Run(garden.ProcessSpec{
+				Path: "/some/script",
+				Env:  []string{"ESCAPED=kurt \"russell\"", "UNESCAPED=isaac\nhayes"},
+			}, garden.ProcessIO{})
+
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, _, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+			Ω(ranCmd.Args).Should(Equal([]string{
+				containerDir + "/bin/wsh",
+				"--socket", containerDir + "/run/wshd.sock",
+				"--user", "vcap",
+				"--env", `ESCAPED=kurt "russell"`,
+				"--env", "LANG=en_US.UTF-8",
+				"--env", "UNESCAPED=isaac\nhayes",
+				"--env", "env1=env1Value",
+				"--env", "env2=env2Value",
+				"--pidfile", containerDir + "/processes/1.pid",
+				"/some/script",
+			}))
+		})
+
+		Describe("LANG environment variable", func() {
+			It("forwards the LANG variable the environment if the user doesn't specify it", func() {
+				os.Setenv("LANG", "C")
+
+				_, err := container.Run(garden.ProcessSpec{
+					Path: "/some/script",
+				}, garden.ProcessIO{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, _, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+				Ω(ranCmd.Args).Should(ContainElement("LANG=C"))
+			})
+
+			It("forwards the LANG variable the environment if the user doesn't specify it", func() {
+				os.Unsetenv("LANG")
+
+				_, err := container.Run(garden.ProcessSpec{
+					Path: "/some/script",
+				}, garden.ProcessIO{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, _, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+				Ω(ranCmd.Args).Should(ContainElement("LANG=en_US.UTF-8"))
+			})
+		})
+
+		It("runs the script with the environment variables from the run taking precedence over the container environment variables", func() {
+			_, err := container.Run(garden.ProcessSpec{
+				Path: "/some/script",
+				Env: []string{
+					"env1=overridden",
+					"LANG=POSIX",
+				},
+			}, garden.ProcessIO{})
+
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, _, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+			Ω(ranCmd.Args).Should(Equal([]string{
+				containerDir + "/bin/wsh",
+				"--socket", containerDir + "/run/wshd.sock",
+				"--user", "vcap",
+				"--env", "LANG=POSIX",
+				"--env", "env1=overridden",
+				"--env", "env2=env2Value",
+				"--pidfile", containerDir + "/processes/1.pid",
+				"/some/script",
+			}))
+		})
+
+		It("runs the script with environment variables containing equals signs", func() {
+			_, err := container.Run(garden.ProcessSpec{
+				Path: "/some/script",
+				Env:  []string{"JAVA_OPTS=-Dfoo=bar"},
+			}, garden.ProcessIO{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, _, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+			Ω(ranCmd.Args).Should(ContainElement("JAVA_OPTS=-Dfoo=bar"))
+		})
+
+		It("expands variables of the container environment in the environment of the run", func() {
+			_, err := container.Run(garden.ProcessSpec{
+				Path: "/some/script",
+				Env: []string{
+					"env1=${env1}:extra",
+					"derived=${env2}-${unset}",
+				},
+			}, garden.ProcessIO{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, _, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+			Ω(ranCmd.Args).Should(ContainElement("env1=env1Value:extra"))
+			Ω(ranCmd.Args).Should(ContainElement("derived=env2Value-"))
+		})
+
+		Context("when the container has env files", func() {
+			BeforeEach(func() {
+				containerProps[linux_container.EnvFilesProperty] = "/etc/environment, /etc/more-environment"
+			})
+
+			catEnvFile := func(envFile string, contents string) {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/bin/wsh",
+						Args: []string{
+							"--socket", containerDir + "/run/wshd.sock",
+							"--user", "root",
+							"cat", envFile,
+						},
+					},
+					func(cmd *exec.Cmd) error {
+						_, err := cmd.Stdout.Write([]byte(contents))
+						Ω(err).ShouldNot(HaveOccurred())
+
+						return nil
+					},
+				)
+			}
+
+			It("loads them between the container environment and that of the run", func() {
+				catEnvFile("/etc/environment", "env1=fromFile\nfile1=${env2}\nrun=fromFile\n")
+				catEnvFile("/etc/more-environment", "export file2=\"${file1}-more\"\n")
+
+				_, err := container.Run(garden.ProcessSpec{
+					Path: "/some/script",
+					Env:  []string{"run=fromRun"},
+				}, garden.ProcessIO{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, _, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+				Ω(ranCmd.Args).Should(Equal([]string{
+					containerDir + "/bin/wsh",
+					"--socket", containerDir + "/run/wshd.sock",
+					"--user", "vcap",
+					"--env", "LANG=en_US.UTF-8",
+					"--env", "env1=fromFile",
+					"--env", "env2=env2Value",
+					"--env", "file1=env2Value",
+					"--env", "file2=env2Value-more",
+					"--env", "run=fromRun",
+					"--pidfile", containerDir + "/processes/1.pid",
+					"/some/script",
+				}))
+			})
+
+			It("only reads them again once the property changes", func() {
+				reads := 0
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/bin/wsh",
+					},
+					func(cmd *exec.Cmd) error {
+						if cmd.Args[len(cmd.Args)-2] == "cat" {
+							reads++
+						}
+
+						return nil
+					},
+				)
+
+				for i := 0; i < 2; i++ {
+					_, err := container.Run(garden.ProcessSpec{Path: "/some/script"}, garden.ProcessIO{})
+					Ω(err).ShouldNot(HaveOccurred())
+				}
+
+				Ω(reads).Should(Equal(2))
+
+				err := container.SetProperty(linux_container.EnvFilesProperty, "/etc/environment")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = container.Run(garden.ProcessSpec{Path: "/some/script"}, garden.ProcessIO{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(reads).Should(Equal(3))
+			})
+
+			Context("when reading one fails", func() {
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/bin/wsh",
+							Args: []string{
+								"--socket", containerDir + "/run/wshd.sock",
+								"--user", "root",
+								"cat", "/etc/more-environment",
+							},
+						},
+						func(cmd *exec.Cmd) error {
+							return errors.New("no such file")
+						},
+					)
+				})
+
+				It("returns an error and does not run the process", func() {
+					_, err := container.Run(garden.ProcessSpec{
+						Path: "/some/script",
+					}, garden.ProcessIO{})
+					Ω(err).Should(MatchError("container: run: reading env file /etc/more-environment: no such file"))
+
+					Ω(fakeProcessTracker.RunCallCount()).Should(Equal(0))
+				})
+			})
+
+			Context("when one is malformed", func() {
+				It("returns an error", func() {
+					catEnvFile("/etc/environment", "not-a-variable\n")
+
+					_, err := container.Run(garden.ProcessSpec{
+						Path: "/some/script",
+					}, garden.ProcessIO{})
+					Ω(err).Should(MatchError(HavePrefix("container: run: env file /etc/environment: malformed env file: line 1")))
+				})
+			})
+		})
+
+		It("runs the script with the working dir set if present", func() {
+			_, err := container.Run(garden.ProcessSpec{
+				Path: "/some/script",
+				Dir:  "/some/dir",
+			}, garden.ProcessIO{})
+
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, _, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+			Ω(ranCmd.Args).Should(Equal([]string{
+				containerDir + "/bin/wsh",
+				"--socket", containerDir + "/run/wshd.sock",
+				"--user", "vcap",
+				"--env", "LANG=en_US.UTF-8",
+				"--env", "env1=env1Value",
+				"--env", "env2=env2Value",
+				"--dir", "/some/dir",
+				"--pidfile", containerDir + "/processes/1.pid",
+				"/some/script",
+			}))
+		})
+
+		It("runs the script with a TTY if present", func() {
+			ttySpec := &garden.TTYSpec{
+				WindowSize: &garden.WindowSize{
+					Columns: 123,
+					Rows:    456,
+				},
+			}
+
+			_, err := container.Run(garden.ProcessSpec{
+				Path: "/some/script",
+				TTY:  ttySpec,
+			}, garden.ProcessIO{})
+
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, _, _, _, tty, _ := fakeProcessTracker.RunArgsForCall(0)
+			Ω(tty).Should(Equal(ttySpec))
+		})
+
+		Describe("streaming", func() {
+			JustBeforeEach(func() {
+				fakeProcessTracker.RunStub = func(processID uint32, _ process_tracker.ProcessSpec, cmd *exec.Cmd, io garden.ProcessIO, tty *garden.TTYSpec, _ process_tracker.Signaller) (garden.Process, error) {
+					writing := new(sync.WaitGroup)
+					writing.Add(1)
+
+					go func() {
+						defer writing.Done()
+						defer GinkgoRecover()
+
+						_, err := fmt.Fprintf(io.Stdout, "hi out\n")
+						Ω(err).ShouldNot(HaveOccurred())
+
+						_, err = fmt.Fprintf(io.Stderr, "hi err\n")
+						Ω(err).ShouldNot(HaveOccurred())
+					}()
+
+					process := new(wfakes.FakeProcess)
+
+					process.IDReturns(processID)
+
+					process.WaitStub = func() (int, error) {
+						writing.Wait()
+						return 123, nil
+					}
+
+					return process, nil
+				}
+			})
+
+			It("streams stderr and stdout and exit status", func() {
+				stdout := gbytes.NewBuffer()
+				stderr := gbytes.NewBuffer()
+
+				process, err := container.Run(garden.ProcessSpec{
+					Path: "/some/script",
+				}, garden.ProcessIO{
+					Stdout: stdout,
+					Stderr: stderr,
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(process.ID()).Should(Equal(uint32(1)))
+
+				Eventually(stdout).Should(gbytes.Say("hi out\n"))
+				Eventually(stderr).Should(gbytes.Say("hi err\n"))
+
+				Ω(process.Wait()).Should(Equal(123))
+			})
+		})
+
+		It("only sets the given rlimits", func() {
+			_, err := container.Run(garden.ProcessSpec{
+				Path: "/some/script",
+				Limits: garden.ResourceLimits{
+					As:      uint64ptr(1),
+					Cpu:     uint64ptr(3),
+					Fsize:   uint64ptr(5),
+					Memlock: uint64ptr(7),
+					Nice:    uint64ptr(9),
+					Nproc:   uint64ptr(11),
+					Rtprio:  uint64ptr(13),
+					Stack:   uint64ptr(15),
+				},
+			}, garden.ProcessIO{})
+
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, _, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+			Ω(ranCmd.Path).Should(Equal(containerDir + "/bin/wsh"))
+
+			Ω(ranCmd.Args).Should(Equal([]string{
+				containerDir + "/bin/wsh",
+				"--socket", containerDir + "/run/wshd.sock",
+				"--user", "vcap",
+				"--env", "LANG=en_US.UTF-8",
+				"--env", "env1=env1Value",
+				"--env", "env2=env2Value",
+				"--pidfile", containerDir + "/processes/1.pid",
+				"/some/script",
+			}))
+
+			Ω(ranCmd.Env).Should(Equal([]string{
+				"RLIMIT_AS=1",
+				"RLIMIT_CPU=3",
+				"RLIMIT_FSIZE=5",
+				"RLIMIT_MEMLOCK=7",
+				"RLIMIT_NICE=9",
+				"RLIMIT_NPROC=11",
+				"RLIMIT_RTPRIO=13",
+				"RLIMIT_STACK=15",
+			}))
+		})
+
+		Context("with 'privileged' true", func() {
+			Context("when the user flag is empty", func() {
+				It("runs with --user root", func() {
+					_, err := container.Run(garden.ProcessSpec{
+						Path:       "/some/script",
+						Privileged: true,
+					}, garden.ProcessIO{})
+
+					Ω(err).ToNot(HaveOccurred())
+
+					_, _, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+					Ω(ranCmd.Path).Should(Equal(containerDir + "/bin/wsh"))
+
+					Ω(ranCmd.Args).Should(Equal([]string{
+						containerDir + "/bin/wsh",
+						"--socket", containerDir + "/run/wshd.sock",
+						"--user", "root",
+						"--env", "LANG=en_US.UTF-8",
+						"--env", "env1=env1Value",
+						"--env", "env2=env2Value",
+						"--pidfile", containerDir + "/processes/1.pid",
+						"/some/script",
+					}))
+				})
+			})
+
+			Context("when the user flag is specified", func() {
+				It("runs with --user set to the specified user", func() {
+					_, err := container.Run(garden.ProcessSpec{
+						Path:       "/some/script",
+						Privileged: true,
+						User:       "potato",
+					}, garden.ProcessIO{})
+
+					Ω(err).ToNot(HaveOccurred())
+
+					_, _, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+					Ω(ranCmd.Path).Should(Equal(containerDir + "/bin/wsh"))
+
+					Ω(ranCmd.Args).Should(Equal([]string{
+						containerDir + "/bin/wsh",
+						"--socket", containerDir + "/run/wshd.sock",
+						"--user", "potato",
+						"--env", "LANG=en_US.UTF-8",
+						"--env", "env1=env1Value",
+						"--env", "env2=env2Value",
+						"--pidfile", containerDir + "/processes/1.pid",
+						"/some/script",
+					}))
+				})
+			})
+		})
+
+		Context("with 'privileged' false", func() {
+			Context("when the user flag is empty", func() {
+				It("runs with --user vcap", func() {
+					_, err := container.Run(garden.ProcessSpec{
+						Path:       "/some/script",
+						Privileged: false,
+					}, garden.ProcessIO{})
+
+					Ω(err).ToNot(HaveOccurred())
+
+					_, _, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+					Ω(ranCmd.Path).Should(Equal(containerDir + "/bin/wsh"))
+
+					Ω(ranCmd.Args).Should(Equal([]string{
+						containerDir + "/bin/wsh",
+						"--socket", containerDir + "/run/wshd.sock",
+						"--user", "vcap",
+						"--env", "LANG=en_US.UTF-8",
+						"--env", "env1=env1Value",
+						"--env", "env2=env2Value",
+						"--pidfile", containerDir + "/processes/1.pid",
+						"/some/script",
+					}))
+				})
+			})
+
+			Context("when the user flag is specified", func() {
+				It("runs with --user set to the specified user", func() {
+					_, err := container.Run(garden.ProcessSpec{
+						Path:       "/some/script",
+						Privileged: true,
+						User:       "potato",
+					}, garden.ProcessIO{})
+
+					Ω(err).ToNot(HaveOccurred())
+
+					_, _, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
+					Ω(ranCmd.Path).Should(Equal(containerDir + "/bin/wsh"))
+
+					Ω(ranCmd.Args).Should(Equal([]string{
+						containerDir + "/bin/wsh",
+						"--socket", containerDir + "/run/wshd.sock",
+						"--user", "potato",
+						"--env", "LANG=en_US.UTF-8",
+						"--env", "env1=env1Value",
+						"--env", "env2=env2Value",
+						"--pidfile", containerDir + "/processes/1.pid",
+						"/some/script",
+					}))
+				})
+			})
+		})
+
+		Context("when spawning fails", func() {
+			disaster := errors.New("oh no!")
+
+			JustBeforeEach(func() {
+				fakeProcessTracker.RunReturns(nil, disaster)
+			})
+
+			It("returns the error", func() {
+				_, err := container.Run(garden.ProcessSpec{
+					Path:       "/some/script",
+					Privileged: true,
+				}, garden.ProcessIO{})
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("Attaching", func() {
+		Context("to a started process", func() {
+			JustBeforeEach(func() {
+				fakeProcessTracker.AttachStub = func(id uint32, io garden.ProcessIO) (garden.Process, error) {
+					writing := new(sync.WaitGroup)
+					writing.Add(1)
+
+					go func() {
+						defer writing.Done()
+						defer GinkgoRecover()
+
+						_, err := fmt.Fprintf(io.Stdout, "hi out\n")
+						Ω(err).ShouldNot(HaveOccurred())
+
+						_, err = fmt.Fprintf(io.Stderr, "hi err\n")
+						Ω(err).ShouldNot(HaveOccurred())
+					}()
+
+					process := new(wfakes.FakeProcess)
+
+					process.IDReturns(42)
+
+					process.WaitStub = func() (int, error) {
+						writing.Wait()
+						return 123, nil
+					}
+
+					return process, nil
+				}
+			})
+
+			It("streams stderr and stdout and exit status", func() {
+				stdout := gbytes.NewBuffer()
+				stderr := gbytes.NewBuffer()
+
+				process, err := container.Attach(1, garden.ProcessIO{
+					Stdout: stdout,
+					Stderr: stderr,
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				pid, _ := fakeProcessTracker.AttachArgsForCall(0)
+				Ω(pid).Should(Equal(uint32(1)))
+
+				Ω(process.ID()).Should(Equal(uint32(42)))
+
+				Eventually(stdout).Should(gbytes.Say("hi out\n"))
+				Eventually(stderr).Should(gbytes.Say("hi err\n"))
+
+				Ω(process.Wait()).Should(Equal(123))
+			})
+		})
+
+		Context("when attaching fails", func() {
+			disaster := errors.New("oh no!")
+
+			JustBeforeEach(func() {
+				fakeProcessTracker.AttachReturns(nil, disaster)
+			})
+
+			It("returns the error", func() {
+				_, err := container.Attach(42, garden.ProcessIO{})
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("Limiting bandwidth", func() {
+		limits := garden.BandwidthLimits{
+			RateInBytesPerSecond:      128,
+			BurstRateInBytesPerSecond: 256,
+		}
+
+		It("sets the limit via the bandwidth manager with the new limits", func() {
+			err := container.LimitBandwidth(limits)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeBandwidthManager.EnforcedLimits).Should(ContainElement(limits))
+		})
+
+		Context("when setting the limit fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeBandwidthManager.SetLimitsError = disaster
+			})
+
+			It("returns the error", func() {
+				err := container.LimitBandwidth(limits)
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("Getting the current bandwidth limit", func() {
+		limits := garden.BandwidthLimits{
+			RateInBytesPerSecond:      128,
+			BurstRateInBytesPerSecond: 256,
+		}
+
+		It("returns a zero value if no limits are set", func() {
+			receivedLimits, err := container.CurrentBandwidthLimits()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(receivedLimits).Should(BeZero())
+		})
+
+		Context("when limits are set", func() {
+			It("returns them", func() {
+				err := container.LimitBandwidth(limits)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				receivedLimits, err := container.CurrentBandwidthLimits()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(receivedLimits).Should(Equal(limits))
+			})
+
+			Context("when limits fail to be set", func() {
+				disaster := errors.New("oh no!")
+
+				JustBeforeEach(func() {
+					fakeBandwidthManager.SetLimitsError = disaster
+				})
+
+				It("does not update the current limits", func() {
+					err := container.LimitBandwidth(limits)
+					Ω(err).Should(Equal(disaster))
+
+					receivedLimits, err := container.CurrentBandwidthLimits()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(receivedLimits).Should(BeZero())
+				})
+			})
+		})
+	})
+
+	Describe("committed resources", func() {
+		It("is nothing without limits", func() {
+			Ω(container.CommittedResources()).Should(BeZero())
+		})
+
+		It("counts the memory limit and the hard disk limit", func() {
+			err := container.LimitMemory(garden.MemoryLimits{LimitInBytes: 1024})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = container.LimitDisk(garden.DiskLimits{ByteSoft: 1, ByteHard: 2048})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(container.CommittedResources()).Should(Equal(linux_backend.CommittedResources{
+				MemoryInBytes: 1024,
+				DiskInBytes:   2048,
+			}))
+		})
+
+		It("counts a hard disk limit given in blocks", func() {
+			err := container.LimitDisk(garden.DiskLimits{BlockHard: 3})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(container.CommittedResources().DiskInBytes).Should(Equal(uint64(3 * 1024)))
+		})
+	})
+
+	Describe("Limiting memory", func() {
+		It("starts the oom notifier", func() {
+			limits := garden.MemoryLimits{
+				LimitInBytes: 102400,
+			}
+
+			err := container.LimitMemory(limits)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveStartedExecuting(
+				fake_command_runner.CommandSpec{
+					Path: containerDir + "/bin/oom",
+					Args: []string{"/cgroups/memory/instance-some-id"},
+				},
+			))
+
+		})
+
+		It("sets memory.limit_in_bytes and then memory.memsw.limit_in_bytes", func() {
+			limits := garden.MemoryLimits{
+				LimitInBytes: 102400,
+			}
+
+			err := container.LimitMemory(limits)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeCgroups.SetValues()).Should(Equal(
+				[]fake_cgroups_manager.SetValue{
+					{
+						Subsystem: "memory",
+						Name:      "memory.limit_in_bytes",
+						Value:     "102400",
+					},
+					{
+						Subsystem: "memory",
+						Name:      "memory.memsw.limit_in_bytes",
+						Value:     "102400",
+					},
+					{
+						Subsystem: "memory",
+						Name:      "memory.limit_in_bytes",
+						Value:     "102400",
+					},
+				},
+			))
+
+		})
+
+		Context("when the container has a limits admission callback", func() {
+			var admitted []linux_backend.CommittedResources
+			var released int
+			var admissionError error
+
+			BeforeEach(func() {
+				admitted = nil
+				released = 0
+				admissionError = nil
+			})
+
+			JustBeforeEach(func() {
+				container.OnLimitsIncrease(func(increase linux_backend.CommittedResources) (func(), error) {
+					if admissionError != nil {
+						return nil, admissionError
+					}
+
+					admitted = append(admitted, increase)
+					return func() { released++ }, nil
+				})
+			})
+
+			It("admits the increase over the current limit and releases it once set", func() {
+				err := container.LimitMemory(garden.MemoryLimits{LimitInBytes: 1024})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = container.LimitMemory(garden.MemoryLimits{LimitInBytes: 4096})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(admitted).Should(Equal([]linux_backend.CommittedResources{
+					{MemoryInBytes: 1024},
+					{MemoryInBytes: 3072},
+				}))
+
+				Ω(released).Should(Equal(2))
+			})
+
+			It("does not ask to admit lowering the limit", func() {
+				err := container.LimitMemory(garden.MemoryLimits{LimitInBytes: 1024})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = container.LimitMemory(garden.MemoryLimits{LimitInBytes: 512})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(admitted).Should(HaveLen(1))
+			})
+
+			Context("when the increase is refused", func() {
+				BeforeEach(func() {
+					admissionError = linux_backend.InsufficientCapacityError{"memory", 1024, 0}
+				})
+
+				It("returns the error without setting the limit", func() {
+					err := container.LimitMemory(garden.MemoryLimits{LimitInBytes: 1024})
+					Ω(err).Should(Equal(admissionError))
+
+					Ω(fakeCgroups.SetValues()).Should(BeEmpty())
+					Ω(container.CommittedResources()).Should(Equal(linux_backend.CommittedResources{}))
+				})
+			})
+		})
+
+		Context("when the oom notifier is already running", func() {
+			It("does not start another", func() {
+				started := 0
+
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: containerDir + "/bin/oom",
+				}, func(*exec.Cmd) error {
+					started++
+					return nil
+				})
+
+				limits := garden.MemoryLimits{
+					LimitInBytes: 102400,
+				}
+
+				err := container.LimitMemory(limits)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = container.LimitMemory(limits)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(started).Should(Equal(1))
+			})
+		})
+
+		Context("when the oom notifier exits 0", func() {
+			JustBeforeEach(func() {
+				fakeRunner.WhenWaitingFor(fake_command_runner.CommandSpec{
+					Path: containerDir + "/bin/oom",
+				}, func(cmd *exec.Cmd) error {
+					return nil
+				})
+			})
+
+			It("stops the container", func() {
+				limits := garden.MemoryLimits{
+					LimitInBytes: 102400,
+				}
+
+				err := container.LimitMemory(limits)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Eventually(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/stop.sh",
+					},
+				))
+			})
 
-					Ω(err).ToNot(HaveOccurred())
+			It("registers an 'out of memory' event", func() {
+				limits := garden.MemoryLimits{
+					LimitInBytes: 102400,
+				}
 
-					_, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
-					Ω(ranCmd.Path).Should(Equal(containerDir + "/bin/wsh"))
+				err := container.LimitMemory(limits)
+				Ω(err).ShouldNot(HaveOccurred())
 
-					Ω(ranCmd.Args).Should(Equal([]string{
-						containerDir + "/bin/wsh",
-						"--socket", containerDir + "/run/wshd.sock",
-						"--user", "potato",
-						"--env", "LANG=en_US.UTF-8",
-						"--env", "env1=env1Value",
-						"--env", "env2=env2Value",
-						"--pidfile", containerDir + "/processes/1.pid",
-						"/some/script",
-					}))
-				})
+				Eventually(func() []string {
+					return container.Events()
+				}).Should(ContainElement("out of memory"))
 			})
 		})
 
-		Context("with 'privileged' false", func() {
-			Context("when the user flag is empty", func() {
-				It("runs with --user vcap", func() {
-					_, err := container.Run(garden.ProcessSpec{
-						Path:       "/some/script",
-						Privileged: false,
-					}, garden.ProcessIO{})
+		Context("when the oom notifier exits 0 with a non-stop oom policy", func() {
+			var waits int
+			var waitsMutex sync.Mutex
 
-					Ω(err).ToNot(HaveOccurred())
+			BeforeEach(func() {
+				waits = 0
+			})
 
-					_, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
-					Ω(ranCmd.Path).Should(Equal(containerDir + "/bin/wsh"))
+			JustBeforeEach(func() {
+				err := container.SetOomPolicy(linux_container.OomPolicyKillProcess)
+				Ω(err).ShouldNot(HaveOccurred())
 
-					Ω(ranCmd.Args).Should(Equal([]string{
-						containerDir + "/bin/wsh",
-						"--socket", containerDir + "/run/wshd.sock",
-						"--user", "vcap",
-						"--env", "LANG=en_US.UTF-8",
-						"--env", "env1=env1Value",
-						"--env", "env2=env2Value",
-						"--pidfile", containerDir + "/processes/1.pid",
-						"/some/script",
-					}))
+				fakeRunner.WhenWaitingFor(fake_command_runner.CommandSpec{
+					Path: containerDir + "/bin/oom",
+				}, func(cmd *exec.Cmd) error {
+					waitsMutex.Lock()
+					defer waitsMutex.Unlock()
+
+					waits++
+					if waits == 1 {
+						return nil
+					}
+
+					return errors.New("killed")
 				})
+
+				err = container.LimitMemory(garden.MemoryLimits{LimitInBytes: 102400})
+				Ω(err).ShouldNot(HaveOccurred())
 			})
 
-			Context("when the user flag is specified", func() {
-				It("runs with --user set to the specified user", func() {
-					_, err := container.Run(garden.ProcessSpec{
-						Path:       "/some/script",
-						Privileged: true,
-						User:       "potato",
-					}, garden.ProcessIO{})
+			It("registers the event without stopping the container", func() {
+				Eventually(container.Events).Should(ContainElement("out of memory"))
 
-					Ω(err).ToNot(HaveOccurred())
+				Consistently(fakeRunner).ShouldNot(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/stop.sh",
+					},
+				))
+			})
 
-					_, ranCmd, _, _, _ := fakeProcessTracker.RunArgsForCall(0)
-					Ω(ranCmd.Path).Should(Equal(containerDir + "/bin/wsh"))
+			It("keeps watching for further OOMs", func() {
+				Eventually(func() int {
+					waitsMutex.Lock()
+					defer waitsMutex.Unlock()
+					return waits
+				}).Should(Equal(2))
 
-					Ω(ranCmd.Args).Should(Equal([]string{
-						containerDir + "/bin/wsh",
-						"--socket", containerDir + "/run/wshd.sock",
-						"--user", "potato",
-						"--env", "LANG=en_US.UTF-8",
-						"--env", "env1=env1Value",
-						"--env", "env2=env2Value",
-						"--pidfile", containerDir + "/processes/1.pid",
-						"/some/script",
-					}))
-				})
+				Ω(fakeRunner).Should(HaveStartedExecuting(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/bin/oom",
+					},
+				))
 			})
 		})
 
-		Context("when spawning fails", func() {
+		Context("when setting memory.memsw.limit_in_bytes fails", func() {
 			disaster := errors.New("oh no!")
 
 			JustBeforeEach(func() {
-				fakeProcessTracker.RunReturns(nil, disaster)
+				fakeCgroups.WhenSetting("memory", "memory.memsw.limit_in_bytes", func() error {
+					return disaster
+				})
 			})
 
-			It("returns the error", func() {
-				_, err := container.Run(garden.ProcessSpec{
-					Path:       "/some/script",
-					Privileged: true,
-				}, garden.ProcessIO{})
-				Ω(err).Should(Equal(disaster))
+			It("does not fail", func() {
+				err := container.LimitMemory(garden.MemoryLimits{
+					LimitInBytes: 102400,
+				})
+
+				Ω(err).ShouldNot(HaveOccurred())
 			})
 		})
-	})
-
-	Describe("Attaching", func() {
-		Context("to a started process", func() {
-			JustBeforeEach(func() {
-				fakeProcessTracker.AttachStub = func(id uint32, io garden.ProcessIO) (garden.Process, error) {
-					writing := new(sync.WaitGroup)
-					writing.Add(1)
-
-					go func() {
-						defer writing.Done()
-						defer GinkgoRecover()
-
-						_, err := fmt.Fprintf(io.Stdout, "hi out\n")
-						Ω(err).ShouldNot(HaveOccurred())
 
-						_, err = fmt.Fprintf(io.Stderr, "hi err\n")
-						Ω(err).ShouldNot(HaveOccurred())
-					}()
+		Context("when setting memory.limit_in_bytes fails only the first time", func() {
+			disaster := errors.New("oh no!")
 
-					process := new(wfakes.FakeProcess)
+			BeforeEach(func() {
+				numSet := 0
 
-					process.IDReturns(42)
+				fakeCgroups.WhenSetting("memory", "memory.limit_in_bytes", func() error {
+					numSet++
 
-					process.WaitStub = func() (int, error) {
-						writing.Wait()
-						return 123, nil
+					if numSet == 1 {
+						return disaster
 					}
 
-					return process, nil
-				}
+					return nil
+				})
 			})
 
-			It("streams stderr and stdout and exit status", func() {
-				stdout := gbytes.NewBuffer()
-				stderr := gbytes.NewBuffer()
+			It("succeeds", func() {
+				fakeCgroups.WhenGetting("memory", "memory.limit_in_bytes", func() (string, error) {
+					return "123", nil
+				})
 
-				process, err := container.Attach(1, garden.ProcessIO{
-					Stdout: stdout,
-					Stderr: stderr,
+				err := container.LimitMemory(garden.MemoryLimits{
+					LimitInBytes: 102400,
 				})
+
 				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
 
-				pid, _ := fakeProcessTracker.AttachArgsForCall(0)
-				Ω(pid).Should(Equal(uint32(1)))
+		Context("when setting memory.limit_in_bytes fails the second time", func() {
+			disaster := errors.New("oh no!")
 
-				Ω(process.ID()).Should(Equal(uint32(42)))
+			JustBeforeEach(func() {
+				numSet := 0
 
-				Eventually(stdout).Should(gbytes.Say("hi out\n"))
-				Eventually(stderr).Should(gbytes.Say("hi err\n"))
+				fakeCgroups.WhenSetting("memory", "memory.limit_in_bytes", func() error {
+					numSet++
 
-				Ω(process.Wait()).Should(Equal(123))
+					if numSet == 2 {
+						return disaster
+					}
+
+					return nil
+				})
+			})
+
+			It("returns the error and no limits", func() {
+				err := container.LimitMemory(garden.MemoryLimits{
+					LimitInBytes: 102400,
+				})
+
+				Ω(err).Should(Equal(disaster))
 			})
 		})
 
-		Context("when attaching fails", func() {
+		Context("when starting the oom notifier fails", func() {
 			disaster := errors.New("oh no!")
 
-			JustBeforeEach(func() {
-				fakeProcessTracker.AttachReturns(nil, disaster)
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: containerDir + "/bin/oom",
+				}, func(cmd *exec.Cmd) error {
+					return disaster
+				})
 			})
 
 			It("returns the error", func() {
-				_, err := container.Attach(42, garden.ProcessIO{})
+				err := container.LimitMemory(garden.MemoryLimits{
+					LimitInBytes: 102400,
+				})
+
 				Ω(err).Should(Equal(disaster))
 			})
 		})
 	})
 
-	Describe("Limiting bandwidth", func() {
-		limits := garden.BandwidthLimits{
-			RateInBytesPerSecond:      128,
-			BurstRateInBytesPerSecond: 256,
-		}
+	Describe("Setting the OOM policy", func() {
+		It("defaults to stopping the container", func() {
+			Ω(container.OomPolicy()).Should(Equal(linux_container.OomPolicyStop))
+		})
 
-		It("sets the limit via the bandwidth manager with the new limits", func() {
-			err := container.LimitBandwidth(limits)
+		It("changes the policy", func() {
+			err := container.SetOomPolicy(linux_container.OomPolicyKillProcess)
 			Ω(err).ShouldNot(HaveOccurred())
 
-			Ω(fakeBandwidthManager.EnforcedLimits).Should(ContainElement(limits))
+			Ω(container.OomPolicy()).Should(Equal(linux_container.OomPolicyKillProcess))
+			Ω(fakeCgroups.SetValues()).Should(BeEmpty())
 		})
 
-		Context("when setting the limit fails", func() {
+		It("disables the kernel's OOM killer for notify, and enables it again afterwards", func() {
+			err := container.SetOomPolicy(linux_container.OomPolicyNotify)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = container.SetOomPolicy(linux_container.OomPolicyNotify)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = container.SetOomPolicy(linux_container.OomPolicyStop)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeCgroups.SetValues()).Should(Equal([]fake_cgroups_manager.SetValue{
+				{Subsystem: "memory", Name: "memory.oom_control", Value: "1"},
+				{Subsystem: "memory", Name: "memory.oom_control", Value: "0"},
+			}))
+		})
+
+		It("rejects unknown policies", func() {
+			err := container.SetOomPolicy("explode")
+			Ω(err).Should(Equal(linux_container.UnknownOomPolicyError{"explode"}))
+
+			Ω(container.OomPolicy()).Should(Equal(linux_container.OomPolicyStop))
+		})
+
+		Context("when disabling the OOM killer fails", func() {
 			disaster := errors.New("oh no!")
 
-			BeforeEach(func() {
-				fakeBandwidthManager.SetLimitsError = disaster
+			JustBeforeEach(func() {
+				fakeCgroups.WhenSetting("memory", "memory.oom_control", func() error {
+					return disaster
+				})
 			})
 
-			It("returns the error", func() {
-				err := container.LimitBandwidth(limits)
+			It("returns the error and keeps the previous policy", func() {
+				err := container.SetOomPolicy(linux_container.OomPolicyNotify)
 				Ω(err).Should(Equal(disaster))
+
+				Ω(container.OomPolicy()).Should(Equal(linux_container.OomPolicyStop))
 			})
 		})
-	})
 
-	Describe("Getting the current bandwidth limit", func() {
-		limits := garden.BandwidthLimits{
-			RateInBytesPerSecond:      128,
-			BurstRateInBytesPerSecond: 256,
-		}
+		Context("when an oom policy property is given at creation", func() {
+			BeforeEach(func() {
+				containerProps[linux_container.OomPolicyProperty] = "notify"
+			})
 
-		It("returns a zero value if no limits are set", func() {
-			receivedLimits, err := container.CurrentBandwidthLimits()
-			Ω(err).ShouldNot(HaveOccurred())
-			Ω(receivedLimits).Should(BeZero())
-		})
+			It("sets the policy once the container has started", func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/start.sh",
+					}, func(*exec.Cmd) error {
+						Ω(fakeCgroups.SetValues()).Should(BeEmpty())
+						return nil
+					},
+				)
 
-		Context("when limits are set", func() {
-			It("returns them", func() {
-				err := container.LimitBandwidth(limits)
+				err := container.Start()
 				Ω(err).ShouldNot(HaveOccurred())
 
-				receivedLimits, err := container.CurrentBandwidthLimits()
-				Ω(err).ShouldNot(HaveOccurred())
-				Ω(receivedLimits).Should(Equal(limits))
+				Ω(fakeCgroups.SetValues()).Should(ContainElement(fake_cgroups_manager.SetValue{
+					Subsystem: "memory", Name: "memory.oom_control", Value: "1",
+				}))
+
+				Ω(container.OomPolicy()).Should(Equal(linux_container.OomPolicyNotify))
 			})
 
-			Context("when limits fail to be set", func() {
-				disaster := errors.New("oh no!")
+			Context("and it is unknown", func() {
+				BeforeEach(func() {
+					containerProps[linux_container.OomPolicyProperty] = "explode"
+				})
+
+				It("fails to start without running start.sh", func() {
+					err := container.Start()
+					Ω(err).Should(MatchError("container: start: unknown oom policy: explode"))
 
-				JustBeforeEach(func() {
-					fakeBandwidthManager.SetLimitsError = disaster
+					Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/start.sh",
+						},
+					))
 				})
+			})
 
-				It("does not update the current limits", func() {
-					err := container.LimitBandwidth(limits)
-					Ω(err).Should(Equal(disaster))
+			Context("and setting it fails", func() {
+				BeforeEach(func() {
+					fakeCgroups.WhenSetting("memory", "memory.oom_control", func() error {
+						return errors.New("oh no!")
+					})
+				})
 
-					receivedLimits, err := container.CurrentBandwidthLimits()
-					Ω(err).ShouldNot(HaveOccurred())
-					Ω(receivedLimits).Should(BeZero())
+				It("kills the container and returns an error", func() {
+					err := container.Start()
+					Ω(err).Should(MatchError("container: start: oh no!"))
+
+					Ω(fakeRunner).Should(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/stop.sh",
+							Args: []string{"-w", "0"},
+						},
+					))
 				})
 			})
 		})
 	})
 
-	Describe("Limiting memory", func() {
-		It("starts the oom notifier", func() {
-			limits := garden.MemoryLimits{
-				LimitInBytes: 102400,
-			}
+	Describe("Getting the current memory limit", func() {
+		It("returns the limited memory", func() {
+			fakeCgroups.WhenGetting("memory", "memory.limit_in_bytes", func() (string, error) {
+				return "18446744073709551615", nil
+			})
 
-			err := container.LimitMemory(limits)
+			limits, err := container.CurrentMemoryLimits()
 			Ω(err).ShouldNot(HaveOccurred())
+			Ω(limits.LimitInBytes).Should(Equal(uint64(math.MaxUint64)))
+		})
 
-			Ω(fakeRunner).Should(HaveStartedExecuting(
-				fake_command_runner.CommandSpec{
-					Path: containerDir + "/bin/oom",
-					Args: []string{"/cgroups/memory/instance-some-id"},
-				},
-			))
+		Context("when getting the limit fails", func() {
+			It("returns the error", func() {
+				disaster := errors.New("oh no!")
+				fakeCgroups.WhenGetting("memory", "memory.limit_in_bytes", func() (string, error) {
+					return "", disaster
+				})
 
+				_, err := container.CurrentMemoryLimits()
+				Ω(err).Should(Equal(disaster))
+			})
 		})
 
-		It("sets memory.limit_in_bytes and then memory.memsw.limit_in_bytes", func() {
-			limits := garden.MemoryLimits{
-				LimitInBytes: 102400,
+		Context("when the returned memory limit is malformed", func() {
+			It("returns the error", func() {
+				fakeCgroups.WhenGetting("memory", "memory.limit_in_bytes", func() (string, error) {
+					return "500M", nil
+				})
+
+				_, err := container.CurrentMemoryLimits()
+				Ω(err.Error()).Should(HaveSuffix("invalid syntax"))
+			})
+		})
+
+	})
+
+	Describe("Limiting CPU", func() {
+		It("sets cpu.shares", func() {
+			limits := garden.CPULimits{
+				LimitInShares: 512,
 			}
 
-			err := container.LimitMemory(limits)
+			err := container.LimitCPU(limits)
 			Ω(err).ShouldNot(HaveOccurred())
 
 			Ω(fakeCgroups.SetValues()).Should(Equal(
 				[]fake_cgroups_manager.SetValue{
 					{
-						Subsystem: "memory",
-						Name:      "memory.limit_in_bytes",
-						Value:     "102400",
-					},
-					{
-						Subsystem: "memory",
-						Name:      "memory.memsw.limit_in_bytes",
-						Value:     "102400",
-					},
-					{
-						Subsystem: "memory",
-						Name:      "memory.limit_in_bytes",
-						Value:     "102400",
+						Subsystem: "cpu",
+						Name:      "cpu.shares",
+						Value:     "512",
 					},
 				},
 			))
 
 		})
 
-		Context("when the oom notifier is already running", func() {
-			It("does not start another", func() {
-				started := 0
+		Context("when setting cpu.shares fails", func() {
+			disaster := errors.New("oh no!")
 
-				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
-					Path: containerDir + "/bin/oom",
-				}, func(*exec.Cmd) error {
-					started++
-					return nil
+			BeforeEach(func() {
+				fakeCgroups.WhenSetting("cpu", "cpu.shares", func() error {
+					return disaster
 				})
+			})
 
-				limits := garden.MemoryLimits{
-					LimitInBytes: 102400,
-				}
+			It("returns the error", func() {
+				err := container.LimitCPU(garden.CPULimits{
+					LimitInShares: 512,
+				})
 
-				err := container.LimitMemory(limits)
-				Ω(err).ShouldNot(HaveOccurred())
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
 
-				err = container.LimitMemory(limits)
-				Ω(err).ShouldNot(HaveOccurred())
+	Describe("Getting the current CPU limits", func() {
+		It("returns the CPU limits", func() {
+			fakeCgroups.WhenGetting("cpu", "cpu.shares", func() (string, error) {
+				return "512", nil
+			})
 
-				Ω(started).Should(Equal(1))
+			limits, err := container.CurrentCPULimits()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(limits.LimitInShares).Should(Equal(uint64(512)))
+		})
+
+		Context("when getting the limit fails", func() {
+			It("returns the error", func() {
+				disaster := errors.New("oh no!")
+				fakeCgroups.WhenGetting("cpu", "cpu.shares", func() (string, error) {
+					return "", disaster
+				})
+
+				_, err := container.CurrentCPULimits()
+				Ω(err).Should(Equal(disaster))
 			})
 		})
 
-		Context("when the oom notifier exits 0", func() {
-			JustBeforeEach(func() {
-				fakeRunner.WhenWaitingFor(fake_command_runner.CommandSpec{
-					Path: containerDir + "/bin/oom",
-				}, func(cmd *exec.Cmd) error {
-					return nil
+		Context("when the current CPU limit is malformed", func() {
+			It("returns the error", func() {
+				fakeCgroups.WhenGetting("cpu", "cpu.shares", func() (string, error) {
+					return "50%", nil
 				})
+
+				_, err := container.CurrentCPULimits()
+				Ω(err.Error()).Should(HaveSuffix("invalid syntax"))
 			})
+		})
+	})
 
-			It("stops the container", func() {
-				limits := garden.MemoryLimits{
-					LimitInBytes: 102400,
-				}
+	Describe("Limiting CPU quota", func() {
+		It("sets cpu.cfs_period_us and then cpu.cfs_quota_us", func() {
+			err := container.LimitCPUQuota(linux_container.CPUQuotaLimits{
+				QuotaInMicroseconds:  50000,
+				PeriodInMicroseconds: 200000,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
 
-				err := container.LimitMemory(limits)
+			Ω(fakeCgroups.SetValues()).Should(Equal([]fake_cgroups_manager.SetValue{
+				{Subsystem: "cpu", Name: "cpu.cfs_period_us", Value: "200000"},
+				{Subsystem: "cpu", Name: "cpu.cfs_quota_us", Value: "50000"},
+			}))
+		})
+
+		Context("when no period is given", func() {
+			It("leaves the period alone", func() {
+				err := container.LimitCPUQuota(linux_container.CPUQuotaLimits{
+					QuotaInMicroseconds: 50000,
+				})
 				Ω(err).ShouldNot(HaveOccurred())
 
-				Eventually(fakeRunner).Should(HaveExecutedSerially(
-					fake_command_runner.CommandSpec{
-						Path: containerDir + "/stop.sh",
-					},
-				))
+				Ω(fakeCgroups.SetValues()).Should(Equal([]fake_cgroups_manager.SetValue{
+					{Subsystem: "cpu", Name: "cpu.cfs_quota_us", Value: "50000"},
+				}))
 			})
+		})
 
-			It("registers an 'out of memory' event", func() {
-				limits := garden.MemoryLimits{
-					LimitInBytes: 102400,
-				}
-
-				err := container.LimitMemory(limits)
+		Context("when the quota is zero", func() {
+			It("removes the cap", func() {
+				err := container.LimitCPUQuota(linux_container.CPUQuotaLimits{})
 				Ω(err).ShouldNot(HaveOccurred())
 
-				Eventually(func() []string {
-					return container.Events()
-				}).Should(ContainElement("out of memory"))
+				Ω(fakeCgroups.SetValues()).Should(Equal([]fake_cgroups_manager.SetValue{
+					{Subsystem: "cpu", Name: "cpu.cfs_quota_us", Value: "-1"},
+				}))
 			})
 		})
 
-		Context("when setting memory.memsw.limit_in_bytes fails", func() {
+		Context("when setting cpu.cfs_period_us fails", func() {
 			disaster := errors.New("oh no!")
 
 			JustBeforeEach(func() {
-				fakeCgroups.WhenSetting("memory", "memory.memsw.limit_in_bytes", func() error {
+				fakeCgroups.WhenSetting("cpu", "cpu.cfs_period_us", func() error {
 					return disaster
 				})
 			})
 
-			It("does not fail", func() {
-				err := container.LimitMemory(garden.MemoryLimits{
-					LimitInBytes: 102400,
+			It("returns the error and does not set the quota", func() {
+				err := container.LimitCPUQuota(linux_container.CPUQuotaLimits{
+					QuotaInMicroseconds:  50000,
+					PeriodInMicroseconds: 200000,
 				})
+				Ω(err).Should(Equal(disaster))
 
-				Ω(err).ShouldNot(HaveOccurred())
+				Ω(fakeCgroups.SetValues()).Should(BeEmpty())
 			})
 		})
+	})
 
-		Context("when setting memory.limit_in_bytes fails only the first time", func() {
-			disaster := errors.New("oh no!")
-
-			BeforeEach(func() {
-				numSet := 0
+	Describe("Getting the current CPU quota limits", func() {
+		It("returns the quota and period", func() {
+			fakeCgroups.WhenGetting("cpu", "cpu.cfs_quota_us", func() (string, error) {
+				return "25000", nil
+			})
 
-				fakeCgroups.WhenSetting("memory", "memory.limit_in_bytes", func() error {
-					numSet++
+			fakeCgroups.WhenGetting("cpu", "cpu.cfs_period_us", func() (string, error) {
+				return "100000", nil
+			})
 
-					if numSet == 1 {
-						return disaster
-					}
+			Ω(container.CurrentCPUQuotaLimits()).Should(Equal(linux_container.CPUQuotaLimits{
+				QuotaInMicroseconds:  25000,
+				PeriodInMicroseconds: 100000,
+			}))
+		})
 
-					return nil
+		Context("when the container is not capped", func() {
+			It("returns a zero quota", func() {
+				fakeCgroups.WhenGetting("cpu", "cpu.cfs_quota_us", func() (string, error) {
+					return "-1", nil
 				})
-			})
 
-			It("succeeds", func() {
-				fakeCgroups.WhenGetting("memory", "memory.limit_in_bytes", func() (string, error) {
-					return "123", nil
+				fakeCgroups.WhenGetting("cpu", "cpu.cfs_period_us", func() (string, error) {
+					return "100000", nil
 				})
 
-				err := container.LimitMemory(garden.MemoryLimits{
-					LimitInBytes: 102400,
+				Ω(container.CurrentCPUQuotaLimits()).Should(Equal(linux_container.CPUQuotaLimits{
+					PeriodInMicroseconds: 100000,
+				}))
+			})
+		})
+
+		Context("when getting the quota fails", func() {
+			It("returns the error", func() {
+				disaster := errors.New("oh no!")
+				fakeCgroups.WhenGetting("cpu", "cpu.cfs_quota_us", func() (string, error) {
+					return "", disaster
 				})
 
-				Ω(err).ShouldNot(HaveOccurred())
+				_, err := container.CurrentCPUQuotaLimits()
+				Ω(err).Should(Equal(disaster))
 			})
 		})
 
-		Context("when setting memory.limit_in_bytes fails the second time", func() {
-			disaster := errors.New("oh no!")
+		Context("when the current period is malformed", func() {
+			It("returns the error", func() {
+				fakeCgroups.WhenGetting("cpu", "cpu.cfs_quota_us", func() (string, error) {
+					return "-1", nil
+				})
 
-			JustBeforeEach(func() {
-				numSet := 0
+				fakeCgroups.WhenGetting("cpu", "cpu.cfs_period_us", func() (string, error) {
+					return "forever", nil
+				})
 
-				fakeCgroups.WhenSetting("memory", "memory.limit_in_bytes", func() error {
-					numSet++
+				_, err := container.CurrentCPUQuotaLimits()
+				Ω(err.Error()).Should(HaveSuffix("invalid syntax"))
+			})
+		})
+	})
 
-					if numSet == 2 {
-						return disaster
-					}
+	Describe("Limiting block I/O", func() {
+		It("sets the weight and the per-device throttles", func() {
+			err := container.LimitBlockIO(linux_container.BlockIOLimits{
+				Device:              "8:16",
+				Weight:              500,
+				ReadBytesPerSecond:  1048576,
+				WriteBytesPerSecond: 2097152,
+				ReadIOPerSecond:     100,
+				WriteIOPerSecond:    200,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
 
-					return nil
+			Ω(fakeCgroups.SetValues()).Should(Equal([]fake_cgroups_manager.SetValue{
+				{Subsystem: "blkio", Name: "blkio.weight", Value: "500"},
+				{Subsystem: "blkio", Name: "blkio.throttle.read_bps_device", Value: "8:16 1048576"},
+				{Subsystem: "blkio", Name: "blkio.throttle.write_bps_device", Value: "8:16 2097152"},
+				{Subsystem: "blkio", Name: "blkio.throttle.read_iops_device", Value: "8:16 100"},
+				{Subsystem: "blkio", Name: "blkio.throttle.write_iops_device", Value: "8:16 200"},
+			}))
+		})
+
+		Context("when no weight is given", func() {
+			It("leaves the weight alone and clears unset throttles", func() {
+				err := container.LimitBlockIO(linux_container.BlockIOLimits{
+					Device:             "8:16",
+					ReadBytesPerSecond: 1048576,
 				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeCgroups.SetValues()).Should(Equal([]fake_cgroups_manager.SetValue{
+					{Subsystem: "blkio", Name: "blkio.throttle.read_bps_device", Value: "8:16 1048576"},
+					{Subsystem: "blkio", Name: "blkio.throttle.write_bps_device", Value: "8:16 0"},
+					{Subsystem: "blkio", Name: "blkio.throttle.read_iops_device", Value: "8:16 0"},
+					{Subsystem: "blkio", Name: "blkio.throttle.write_iops_device", Value: "8:16 0"},
+				}))
 			})
+		})
 
-			It("returns the error and no limits", func() {
-				err := container.LimitMemory(garden.MemoryLimits{
-					LimitInBytes: 102400,
+		Context("when no device is given", func() {
+			It("throttles the disk holding the container's directory", func() {
+				var stat syscall.Stat_t
+				err := syscall.Stat(containerDir, &stat)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				dev := uint64(stat.Dev)
+				major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+				minor := dev&0xff | (dev>>12)&^0xff
+
+				disk, resolveErr := linux_container.WholeDiskOf("/sys", fmt.Sprintf("%d:%d", major, minor))
+
+				err = container.LimitBlockIO(linux_container.BlockIOLimits{
+					ReadBytesPerSecond: 1048576,
 				})
 
-				Ω(err).Should(Equal(disaster))
+				// e.g. when the tests run on tmpfs
+				if resolveErr != nil {
+					Ω(err).Should(Equal(resolveErr))
+					return
+				}
+
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeCgroups.SetValues()).Should(ContainElement(fake_cgroups_manager.SetValue{
+					Subsystem: "blkio",
+					Name:      "blkio.throttle.read_bps_device",
+					Value:     disk + " 1048576",
+				}))
 			})
 		})
 
-		Context("when starting the oom notifier fails", func() {
+		Context("when setting a throttle fails", func() {
 			disaster := errors.New("oh no!")
 
-			BeforeEach(func() {
-				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
-					Path: containerDir + "/bin/oom",
-				}, func(cmd *exec.Cmd) error {
+			JustBeforeEach(func() {
+				fakeCgroups.WhenSetting("blkio", "blkio.throttle.read_bps_device", func() error {
 					return disaster
 				})
 			})
 
-			It("returns the error", func() {
-				err := container.LimitMemory(garden.MemoryLimits{
-					LimitInBytes: 102400,
+			It("returns the error and does not record the limits", func() {
+				err := container.LimitBlockIO(linux_container.BlockIOLimits{
+					Device:             "8:16",
+					ReadBytesPerSecond: 1048576,
 				})
-
 				Ω(err).Should(Equal(disaster))
+
+				Ω(container.CurrentBlockIOLimits()).Should(BeZero())
 			})
 		})
 	})
 
-	Describe("Getting the current memory limit", func() {
-		It("returns the limited memory", func() {
-			fakeCgroups.WhenGetting("memory", "memory.limit_in_bytes", func() (string, error) {
-				return "18446744073709551615", nil
-			})
+	Describe("Resolving the disk to throttle", func() {
+		var sysPath string
 
-			limits, err := container.CurrentMemoryLimits()
+		BeforeEach(func() {
+			var err error
+			sysPath, err = ioutil.TempDir("", "sys")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			disk := filepath.Join(sysPath, "devices", "sda")
+			partition := filepath.Join(disk, "sda1")
+
+			err = os.MkdirAll(partition, 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(disk, "dev"), []byte("8:0\n"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(partition, "dev"), []byte("8:1\n"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(partition, "partition"), []byte("1\n"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = os.MkdirAll(filepath.Join(sysPath, "dev", "block"), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = os.Symlink("../../devices/sda", filepath.Join(sysPath, "dev", "block", "8:0"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = os.Symlink("../../devices/sda/sda1", filepath.Join(sysPath, "dev", "block", "8:1"))
 			Ω(err).ShouldNot(HaveOccurred())
-			Ω(limits.LimitInBytes).Should(Equal(uint64(math.MaxUint64)))
 		})
 
-		Context("when getting the limit fails", func() {
-			It("returns the error", func() {
-				disaster := errors.New("oh no!")
-				fakeCgroups.WhenGetting("memory", "memory.limit_in_bytes", func() (string, error) {
-					return "", disaster
-				})
+		AfterEach(func() {
+			os.RemoveAll(sysPath)
+		})
 
-				_, err := container.CurrentMemoryLimits()
-				Ω(err).Should(Equal(disaster))
-			})
+		It("resolves a partition to its disk", func() {
+			Ω(linux_container.WholeDiskOf(sysPath, "8:1")).Should(Equal("8:0"))
 		})
 
-		Context("when the returned memory limit is malformed", func() {
-			It("returns the error", func() {
-				fakeCgroups.WhenGetting("memory", "memory.limit_in_bytes", func() (string, error) {
-					return "500M", nil
-				})
+		It("returns a whole disk as it is", func() {
+			Ω(linux_container.WholeDiskOf(sysPath, "8:0")).Should(Equal("8:0"))
+		})
 
-				_, err := container.CurrentMemoryLimits()
-				Ω(err.Error()).Should(HaveSuffix("invalid syntax"))
+		Context("when the device is not a block device", func() {
+			It("returns a NoBlockDeviceError", func() {
+				_, err := linux_container.WholeDiskOf(sysPath, "0:42")
+				Ω(err).Should(Equal(linux_container.NoBlockDeviceError{"0:42"}))
 			})
 		})
-
 	})
 
-	Describe("Limiting CPU", func() {
-		It("sets cpu.shares", func() {
-			limits := garden.CPULimits{
-				LimitInShares: 512,
+	Describe("Getting the current block I/O limits", func() {
+		It("returns a zero value if no limits are set", func() {
+			Ω(container.CurrentBlockIOLimits()).Should(BeZero())
+		})
+
+		It("returns the limits last set", func() {
+			limits := linux_container.BlockIOLimits{
+				Device:           "8:16",
+				Weight:           100,
+				WriteIOPerSecond: 50,
 			}
 
-			err := container.LimitCPU(limits)
+			err := container.LimitBlockIO(limits)
 			Ω(err).ShouldNot(HaveOccurred())
 
-			Ω(fakeCgroups.SetValues()).Should(Equal(
-				[]fake_cgroups_manager.SetValue{
-					{
-						Subsystem: "cpu",
-						Name:      "cpu.shares",
-						Value:     "512",
-					},
-				},
-			))
+			Ω(container.CurrentBlockIOLimits()).Should(Equal(limits))
+		})
+	})
 
+	Describe("Limiting pids", func() {
+		It("sets pids.max", func() {
+			err := container.LimitPids(linux_container.PidLimits{Max: 256})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeCgroups.SetValues()).Should(Equal([]fake_cgroups_manager.SetValue{
+				{Subsystem: "pids", Name: "pids.max", Value: "256"},
+			}))
 		})
 
-		Context("when setting cpu.shares fails", func() {
+		Context("when the limit is zero", func() {
+			It("removes the limit", func() {
+				err := container.LimitPids(linux_container.PidLimits{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeCgroups.SetValues()).Should(Equal([]fake_cgroups_manager.SetValue{
+					{Subsystem: "pids", Name: "pids.max", Value: "max"},
+				}))
+			})
+		})
+
+		Context("when setting pids.max fails", func() {
 			disaster := errors.New("oh no!")
 
-			BeforeEach(func() {
-				fakeCgroups.WhenSetting("cpu", "cpu.shares", func() error {
+			JustBeforeEach(func() {
+				fakeCgroups.WhenSetting("pids", "pids.max", func() error {
 					return disaster
 				})
 			})
 
 			It("returns the error", func() {
-				err := container.LimitCPU(garden.CPULimits{
-					LimitInShares: 512,
+				err := container.LimitPids(linux_container.PidLimits{Max: 256})
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+
+		Context("when the cgroup has no pids.max", func() {
+			disaster := errors.New("no such file or directory")
+
+			BeforeEach(func() {
+				fakeCgroups.WhenGetting("pids", "pids.max", func() (string, error) {
+					return "", disaster
 				})
+			})
 
-				Ω(err).Should(Equal(disaster))
+			It("returns a PidsControllerUnavailableError without writing pids.max", func() {
+				err := container.LimitPids(linux_container.PidLimits{Max: 256})
+				Ω(err).Should(Equal(linux_container.PidsControllerUnavailableError{disaster}))
+
+				Ω(fakeCgroups.SetValues()).Should(BeEmpty())
 			})
 		})
 	})
 
-	Describe("Getting the current CPU limits", func() {
-		It("returns the CPU limits", func() {
-			fakeCgroups.WhenGetting("cpu", "cpu.shares", func() (string, error) {
-				return "512", nil
+	Describe("Getting the current pid limits", func() {
+		It("returns the limit", func() {
+			fakeCgroups.WhenGetting("pids", "pids.max", func() (string, error) {
+				return "256\n", nil
 			})
 
-			limits, err := container.CurrentCPULimits()
-			Ω(err).ShouldNot(HaveOccurred())
-			Ω(limits.LimitInShares).Should(Equal(uint64(512)))
+			Ω(container.CurrentPidLimits()).Should(Equal(linux_container.PidLimits{Max: 256}))
 		})
 
-		Context("when getting the limit fails", func() {
-			It("returns the error", func() {
-				disaster := errors.New("oh no!")
-				fakeCgroups.WhenGetting("cpu", "cpu.shares", func() (string, error) {
-					return "", disaster
+		Context("when the container is not limited", func() {
+			It("returns a zero limit", func() {
+				fakeCgroups.WhenGetting("pids", "pids.max", func() (string, error) {
+					return "max\n", nil
 				})
 
-				_, err := container.CurrentCPULimits()
-				Ω(err).Should(Equal(disaster))
+				Ω(container.CurrentPidLimits()).Should(Equal(linux_container.PidLimits{}))
 			})
 		})
 
-		Context("when the current CPU limit is malformed", func() {
-			It("returns the error", func() {
-				fakeCgroups.WhenGetting("cpu", "cpu.shares", func() (string, error) {
-					return "50%", nil
+		Context("when the current limit is malformed", func() {
+			It("returns an error", func() {
+				fakeCgroups.WhenGetting("pids", "pids.max", func() (string, error) {
+					return "lots", nil
 				})
 
-				_, err := container.CurrentCPULimits()
-				Ω(err.Error()).Should(HaveSuffix("invalid syntax"))
+				_, err := container.CurrentPidLimits()
+				Ω(err).Should(HaveOccurred())
 			})
 		})
 	})
@@ -1842,6 +3528,47 @@ var _ = Describe("Linux containers", func() {
 			Ω(fakeQuotaManager.Limited[uid]).Should(Equal(limits))
 		})
 
+		Context("when the container has a limits admission callback", func() {
+			var admitted []linux_backend.CommittedResources
+
+			BeforeEach(func() {
+				admitted = nil
+			})
+
+			JustBeforeEach(func() {
+				container.OnLimitsIncrease(func(increase linux_backend.CommittedResources) (func(), error) {
+					admitted = append(admitted, increase)
+					return func() {}, nil
+				})
+			})
+
+			It("admits the increase in bytes", func() {
+				err := container.LimitDisk(limits)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(admitted).Should(Equal([]linux_backend.CommittedResources{
+					{DiskInBytes: 24},
+				}))
+			})
+
+			Context("when the increase is refused", func() {
+				disaster := linux_backend.InsufficientCapacityError{"disk", 24, 0}
+
+				JustBeforeEach(func() {
+					container.OnLimitsIncrease(func(linux_backend.CommittedResources) (func(), error) {
+						return nil, disaster
+					})
+				})
+
+				It("returns the error without setting the quota", func() {
+					err := container.LimitDisk(limits)
+					Ω(err).Should(Equal(disaster))
+
+					Ω(fakeQuotaManager.Limited).Should(BeEmpty())
+				})
+			})
+		})
+
 		Context("when setting the quota fails", func() {
 			disaster := errors.New("oh no!")
 
@@ -2106,6 +3833,52 @@ var _ = Describe("Linux containers", func() {
 			Ω(properties["some-property"]).Should(Equal("some-value"))
 		})
 
+		It("returns a properties snapshot that is kept when removing properties", func() {
+			properties := container.Properties()
+
+			err := container.RemoveProperty("property-name")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(properties).Should(Equal(garden.Properties{"property-name": "property-value"}))
+		})
+
+		Describe("observing changes", func() {
+			var observed []garden.Properties
+
+			BeforeEach(func() {
+				observed = nil
+			})
+
+			JustBeforeEach(func() {
+				container.OnPropertiesChange(func(properties garden.Properties) {
+					observed = append(observed, properties)
+				})
+			})
+
+			It("notifies the observer of the current properties and then of every change", func() {
+				err := container.SetProperty("some-property", "some-value")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = container.RemoveProperty("property-name")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(observed).Should(Equal([]garden.Properties{
+					{"property-name": "property-value"},
+					{"property-name": "property-value", "some-property": "some-value"},
+					{"some-property": "some-value"},
+				}))
+			})
+
+			It("does not notify the observer when removing an undefined property", func() {
+				err := container.RemoveProperty("some-other-property")
+				Ω(err).Should(HaveOccurred())
+
+				Ω(observed).Should(Equal([]garden.Properties{
+					{"property-name": "property-value"},
+				}))
+			})
+		})
+
 		Context("with a nil map of properties at container creation", func() {
 			BeforeEach(func() {
 				containerProps = nil
@@ -2374,6 +4147,145 @@ system 2
 			})
 		})
 	})
+
+	Describe("Metrics", func() {
+		It("has no history before the container is started", func() {
+			Ω(container.Metrics().Samples).Should(BeEmpty())
+		})
+
+		Context("once started", func() {
+			var recordedDiskUsage *garden.ContainerDiskStat
+
+			BeforeEach(func() {
+				fakeCgroups.WhenGetting("cpuacct", "cpuacct.usage", func() (string, error) {
+					return "42\n", nil
+				})
+
+				fakeQuotaManager.GetUsageResult = garden.ContainerDiskStat{BytesUsed: 1024}
+
+				recordedDiskUsage = nil
+			})
+
+			JustBeforeEach(func() {
+				if recordedDiskUsage != nil {
+					container.RecordDiskUsage(*recordedDiskUsage)
+				}
+
+				err := container.Start()
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				container.Cleanup()
+			})
+
+			It("samples the container's usage", func() {
+				Eventually(func() []linux_container.MetricsSample {
+					return container.Metrics().Samples
+				}).Should(HaveLen(1))
+
+				sample := container.Metrics().Samples[0]
+				Ω(sample.CPUStat.Usage).Should(Equal(uint64(42)))
+				Ω(sample.DiskStat.BytesUsed).Should(Equal(uint64(1024)))
+			})
+
+			Context("when the disk usage has been recorded", func() {
+				BeforeEach(func() {
+					fakeQuotaManager.GetUsageError = errors.New("repquota should not run")
+
+					recordedDiskUsage = &garden.ContainerDiskStat{BytesUsed: 2048}
+				})
+
+				It("samples the recorded usage rather than looking it up", func() {
+					Eventually(func() []linux_container.MetricsSample {
+						return container.Metrics().Samples
+					}).Should(HaveLen(1))
+
+					sample := container.Metrics().Samples[0]
+					Ω(sample.CPUStat.Usage).Should(Equal(uint64(42)))
+					Ω(sample.DiskStat.BytesUsed).Should(Equal(uint64(2048)))
+				})
+			})
+		})
+	})
+
+	Describe("Linux info", func() {
+		BeforeEach(func() {
+			fakeCgroups.WhenGetting("blkio", "blkio.throttle.io_service_bytes", func() (string, error) {
+				return `8:0 Read 1024
+8:0 Write 2048
+8:0 Sync 3072
+8:0 Async 0
+8:0 Total 3072
+8:16 Read 1
+8:16 Write 2
+8:16 Total 3
+Total 3075
+`, nil
+			})
+
+			fakeCgroups.WhenGetting("blkio", "blkio.throttle.io_serviced", func() (string, error) {
+				return `8:0 Read 10
+8:0 Write 20
+8:0 Total 30
+Total 30
+`, nil
+			})
+
+			fakeCgroups.WhenGetting("pids", "pids.current", func() (string, error) {
+				return "7\n", nil
+			})
+
+			fakeCgroups.WhenGetting("pids", "pids.max", func() (string, error) {
+				return "64\n", nil
+			})
+		})
+
+		It("includes the garden container info", func() {
+			info, err := container.LinuxInfo()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(info.State).Should(Equal("born"))
+			Ω(info.ContainerPath).Should(Equal(containerDir))
+		})
+
+		It("returns the block I/O totals summed across devices", func() {
+			info, err := container.LinuxInfo()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(info.BlockIOStat).Should(Equal(linux_container.ContainerBlockIOStat{
+				ReadBytes:  1025,
+				WriteBytes: 2050,
+				ReadOps:    10,
+				WriteOps:   20,
+			}))
+		})
+
+		It("returns the number of processes and the pid limit", func() {
+			info, err := container.LinuxInfo()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(info.PidStat).Should(Equal(linux_container.ContainerPidStat{
+				Current: 7,
+				Max:     64,
+			}))
+		})
+
+		Context("when getting the block I/O stats fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeCgroups.WhenGetting("blkio", "blkio.throttle.io_serviced", func() (string, error) {
+					return "", disaster
+				})
+			})
+
+			It("returns the error", func() {
+				_, err := container.LinuxInfo()
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
 })
 
 func uint64ptr(n uint64) *uint64 {
@@ -2406,3 +4318,13 @@ func (f *fakeNetworkResources) Info(i *garden.ContainerInfo) {
 func (f *fakeNetworkResources) String() string {
 	return "fake network resources"
 }
+
+type fakeExitStatusProcess struct {
+	*wfakes.FakeProcess
+
+	exitStatus link.ExitStatus
+}
+
+func (p *fakeExitStatusProcess) WaitForExitStatus() (link.ExitStatus, error) {
+	return p.exitStatus, nil
+}
@@ -0,0 +1,181 @@
+package linux_container
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/pivotal-golang/clock"
+	"github.com/pivotal-golang/lager"
+)
+
+const MetricsSampleInterval = 10 * time.Second
+
+// Number of samples kept per container; with the default interval this is
+// the last ten minutes.
+const MetricsHistorySize = 60
+
+type MetricsSample struct {
+	Time time.Time
+
+	MemoryStat garden.ContainerMemoryStat
+	CPUStat    garden.ContainerCPUStat
+	DiskStat   garden.ContainerDiskStat
+}
+
+type ContainerMetrics struct {
+	// Oldest first.
+	Samples []MetricsSample
+
+	// CPU time used between the two latest samples as a percentage of one
+	// core; a container busy on two cores reports 200.
+	CPUPercent float64
+
+	// Change in resident memory (total_rss) and disk usage per second, over
+	// the whole history. Negative when shrinking.
+	MemoryGrowthBytesPerSecond float64
+	DiskGrowthBytesPerSecond   float64
+}
+
+type MetricsSampler struct {
+	logger   lager.Logger
+	clock    clock.Clock
+	interval time.Duration
+	sample   func() (MetricsSample, error)
+
+	history []MetricsSample
+	next    int
+	full    bool
+
+	stop chan struct{}
+
+	mu sync.RWMutex
+}
+
+func NewMetricsSampler(
+	logger lager.Logger,
+	clock clock.Clock,
+	interval time.Duration,
+	size int,
+	sample func() (MetricsSample, error),
+) *MetricsSampler {
+	return &MetricsSampler{
+		logger:   logger,
+		clock:    clock,
+		interval: interval,
+		sample:   sample,
+
+		history: make([]MetricsSample, size),
+	}
+}
+
+// Start takes a sample immediately and then one every interval until Stop
+// is called. Starting a running sampler does nothing.
+func (s *MetricsSampler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+
+	go s.run(s.stop)
+}
+
+func (s *MetricsSampler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// Sample records the current usage.
+func (s *MetricsSampler) Sample() error {
+	sample, err := s.sample()
+	if err != nil {
+		return err
+	}
+
+	sample.Time = s.clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.history[s.next] = sample
+
+	s.next = (s.next + 1) % len(s.history)
+	if s.next == 0 {
+		s.full = true
+	}
+
+	return nil
+}
+
+func (s *MetricsSampler) Metrics() ContainerMetrics {
+	samples := s.samples()
+
+	metrics := ContainerMetrics{
+		Samples: samples,
+	}
+
+	if len(samples) < 2 {
+		return metrics
+	}
+
+	oldest := samples[0]
+	previous := samples[len(samples)-2]
+	latest := samples[len(samples)-1]
+
+	if elapsed := latest.Time.Sub(previous.Time); elapsed > 0 {
+		used := float64(latest.CPUStat.Usage) - float64(previous.CPUStat.Usage)
+		metrics.CPUPercent = used / float64(elapsed.Nanoseconds()) * 100
+	}
+
+	if elapsed := latest.Time.Sub(oldest.Time).Seconds(); elapsed > 0 {
+		memoryGrowth := float64(latest.MemoryStat.TotalRss) - float64(oldest.MemoryStat.TotalRss)
+		metrics.MemoryGrowthBytesPerSecond = memoryGrowth / elapsed
+
+		diskGrowth := float64(latest.DiskStat.BytesUsed) - float64(oldest.DiskStat.BytesUsed)
+		metrics.DiskGrowthBytesPerSecond = diskGrowth / elapsed
+	}
+
+	return metrics
+}
+
+func (s *MetricsSampler) samples() []MetricsSample {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.full {
+		return append([]MetricsSample{}, s.history[:s.next]...)
+	}
+
+	samples := make([]MetricsSample, 0, len(s.history))
+	samples = append(samples, s.history[s.next:]...)
+	samples = append(samples, s.history[:s.next]...)
+
+	return samples
+}
+
+func (s *MetricsSampler) run(stop <-chan struct{}) {
+	ticker := s.clock.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		err := s.Sample()
+		if err != nil {
+			s.logger.Error("failed-to-sample-metrics", err)
+		}
+
+		select {
+		case <-ticker.C():
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package linux_container_test
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/linux_container"
+	"github.com/pivotal-golang/clock/fakeclock"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics sampler", func() {
+	var (
+		fakeClock *fakeclock.FakeClock
+		sampler   *linux_container.MetricsSampler
+
+		nextSample linux_container.MetricsSample
+		sampleErr  error
+		sampleLock sync.Mutex
+	)
+
+	setNextSample := func(cpuUsage, rss, diskUsage uint64) {
+		sampleLock.Lock()
+		defer sampleLock.Unlock()
+
+		nextSample = linux_container.MetricsSample{
+			CPUStat:    garden.ContainerCPUStat{Usage: cpuUsage},
+			MemoryStat: garden.ContainerMemoryStat{TotalRss: rss},
+			DiskStat:   garden.ContainerDiskStat{BytesUsed: diskUsage},
+		}
+	}
+
+	BeforeEach(func() {
+		fakeClock = fakeclock.NewFakeClock(time.Unix(1000, 0))
+
+		sampleErr = nil
+		setNextSample(0, 0, 0)
+
+		sampler = linux_container.NewMetricsSampler(
+			lagertest.NewTestLogger("test"),
+			fakeClock,
+			10*time.Second,
+			3,
+			func() (linux_container.MetricsSample, error) {
+				sampleLock.Lock()
+				defer sampleLock.Unlock()
+
+				return nextSample, sampleErr
+			},
+		)
+	})
+
+	It("has no samples to begin with", func() {
+		Ω(sampler.Metrics()).Should(Equal(linux_container.ContainerMetrics{
+			Samples: []linux_container.MetricsSample{},
+		}))
+	})
+
+	It("timestamps samples with the clock", func() {
+		err := sampler.Sample()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(sampler.Metrics().Samples).Should(HaveLen(1))
+		Ω(sampler.Metrics().Samples[0].Time).Should(Equal(time.Unix(1000, 0)))
+	})
+
+	It("keeps only the most recent samples, oldest first", func() {
+		for i := uint64(1); i <= 5; i++ {
+			setNextSample(i, 0, 0)
+
+			err := sampler.Sample()
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		samples := sampler.Metrics().Samples
+		Ω(samples).Should(HaveLen(3))
+		Ω(samples[0].CPUStat.Usage).Should(Equal(uint64(3)))
+		Ω(samples[1].CPUStat.Usage).Should(Equal(uint64(4)))
+		Ω(samples[2].CPUStat.Usage).Should(Equal(uint64(5)))
+	})
+
+	It("derives the CPU percentage from the two latest samples", func() {
+		setNextSample(0, 0, 0)
+		Ω(sampler.Sample()).Should(Succeed())
+
+		fakeClock.Increment(10 * time.Second)
+
+		setNextSample(uint64(5*time.Second), 0, 0)
+		Ω(sampler.Sample()).Should(Succeed())
+
+		fakeClock.Increment(10 * time.Second)
+
+		setNextSample(uint64(25*time.Second), 0, 0)
+		Ω(sampler.Sample()).Should(Succeed())
+
+		Ω(sampler.Metrics().CPUPercent).Should(BeNumerically("~", 200))
+	})
+
+	It("derives memory and disk growth over the whole history", func() {
+		setNextSample(0, 1000, 5000)
+		Ω(sampler.Sample()).Should(Succeed())
+
+		fakeClock.Increment(10 * time.Second)
+
+		setNextSample(0, 3000, 4000)
+		Ω(sampler.Sample()).Should(Succeed())
+
+		fakeClock.Increment(10 * time.Second)
+
+		setNextSample(0, 5000, 3000)
+		Ω(sampler.Sample()).Should(Succeed())
+
+		metrics := sampler.Metrics()
+		Ω(metrics.MemoryGrowthBytesPerSecond).Should(BeNumerically("~", 200))
+		Ω(metrics.DiskGrowthBytesPerSecond).Should(BeNumerically("~", -100))
+	})
+
+	Context("when sampling fails", func() {
+		BeforeEach(func() {
+			sampleErr = errors.New("oh no!")
+		})
+
+		It("returns the error and records nothing", func() {
+			Ω(sampler.Sample()).Should(MatchError("oh no!"))
+			Ω(sampler.Metrics().Samples).Should(BeEmpty())
+		})
+	})
+
+	Describe("sampling in the background", func() {
+		AfterEach(func() {
+			sampler.Stop()
+		})
+
+		It("samples immediately and then every interval", func() {
+			sampler.Start()
+
+			Eventually(func() []linux_container.MetricsSample {
+				return sampler.Metrics().Samples
+			}).Should(HaveLen(1))
+
+			Eventually(fakeClock.WatcherCount).Should(Equal(1))
+
+			fakeClock.Increment(10 * time.Second)
+
+			Eventually(func() []linux_container.MetricsSample {
+				return sampler.Metrics().Samples
+			}).Should(HaveLen(2))
+		})
+
+		It("stops sampling when stopped", func() {
+			sampler.Start()
+
+			Eventually(func() []linux_container.MetricsSample {
+				return sampler.Metrics().Samples
+			}).Should(HaveLen(1))
+
+			sampler.Stop()
+
+			Eventually(fakeClock.WatcherCount).Should(Equal(0))
+
+			fakeClock.Increment(10 * time.Second)
+
+			Consistently(func() []linux_container.MetricsSample {
+				return sampler.Metrics().Samples
+			}).Should(HaveLen(1))
+		})
+	})
+})
@@ -1,10 +1,19 @@
 package linux_container
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
 	"time"
 
 	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/uid_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/process_tracker"
 )
 
 type ContainerSnapshot struct {
@@ -16,7 +25,8 @@ type ContainerSnapshot struct {
 	State  string
 	Events []string
 
-	Limits LimitsSnapshot
+	Limits    LimitsSnapshot
+	OomPolicy OomPolicy
 
 	Resources ResourcesSnapshot
 
@@ -35,6 +45,9 @@ type LimitsSnapshot struct {
 	Disk      *garden.DiskLimits
 	Bandwidth *garden.BandwidthLimits
 	CPU       *garden.CPULimits
+	CPUQuota  *CPUQuotaLimits
+	BlockIO   *BlockIOLimits
+	Pids      *PidLimits
 }
 
 type ResourcesSnapshot struct {
@@ -42,9 +55,225 @@ type ResourcesSnapshot struct {
 	RootUID uint32
 	Network *json.RawMessage
 	Ports   []uint32
+
+	// Derived on restoring snapshots taken before containers' user
+	// namespaces were recorded; see deriveIDMappings.
+	UIDMappings     linux_backend.IDMappings
+	GIDMappings     linux_backend.IDMappings
+	SubordinateUIDs *uid_pool.UIDRange
 }
 
 type ProcessSnapshot struct {
 	ID  uint32
 	TTY bool
+
+	Spec      process_tracker.ProcessSpec
+	StartedAt time.Time
+	HostPID   int
+}
+
+// Version of the snapshot format written by Snapshot. Bump it whenever a
+// change to ContainerSnapshot would have older snapshots restore differently
+// than they were meant to, and register a migration from the previous
+// version in SnapshotMigrations.
+const SnapshotVersion = 1
+
+// SnapshotEnvelope is what Snapshot writes: a ContainerSnapshot, as JSON,
+// along with the version of its format and a checksum of it.
+type SnapshotEnvelope struct {
+	Version  int             `json:"version"`
+	Checksum string          `json:"checksum"`
+	Snapshot json.RawMessage `json:"snapshot"`
+}
+
+// A SnapshotMigration rewrites a snapshot, decoded as a JSON object with its
+// numbers as json.Number, from one version of the format to the next.
+type SnapshotMigration func(snapshot map[string]interface{}) error
+
+// SnapshotMigrations are the migrations to the current version of the
+// format, by the version each migrates from. Snapshots taken before they
+// were versioned are version 0.
+var SnapshotMigrations = map[int]SnapshotMigration{
+	0: deriveIDMappings,
+}
+
+type CorruptSnapshotError struct {
+	Reason string
+}
+
+func (err CorruptSnapshotError) Error() string {
+	return fmt.Sprintf("snapshot is corrupt: %s", err.Reason)
+}
+
+type UnsupportedSnapshotVersionError struct {
+	Version int
+}
+
+func (err UnsupportedSnapshotVersionError) Error() string {
+	if err.Version > SnapshotVersion {
+		return fmt.Sprintf("snapshot version %d is newer than the supported version %d", err.Version, SnapshotVersion)
+	}
+
+	return fmt.Sprintf("no migration from snapshot version %d", err.Version)
+}
+
+func WriteSnapshot(out io.Writer, snapshot ContainerSnapshot) error {
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(out).Encode(SnapshotEnvelope{
+		Version:  SnapshotVersion,
+		Checksum: snapshotChecksum(payload),
+		Snapshot: payload,
+	})
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot, or one taken before
+// snapshots were versioned, migrating it to the current version.
+func ReadSnapshot(in io.Reader) (ContainerSnapshot, error) {
+	var raw map[string]json.RawMessage
+
+	err := json.NewDecoder(in).Decode(&raw)
+	if err != nil {
+		return ContainerSnapshot{}, CorruptSnapshotError{err.Error()}
+	}
+
+	envelope := SnapshotEnvelope{}
+
+	if _, found := raw["snapshot"]; found {
+		err := json.Unmarshal(raw["version"], &envelope.Version)
+		if err != nil {
+			return ContainerSnapshot{}, CorruptSnapshotError{"invalid version: " + err.Error()}
+		}
+
+		err = json.Unmarshal(raw["checksum"], &envelope.Checksum)
+		if err != nil {
+			return ContainerSnapshot{}, CorruptSnapshotError{"invalid checksum: " + err.Error()}
+		}
+
+		envelope.Snapshot = raw["snapshot"]
+
+		if checksum := snapshotChecksum(envelope.Snapshot); checksum != envelope.Checksum {
+			return ContainerSnapshot{}, CorruptSnapshotError{
+				fmt.Sprintf("checksum %s does not match its contents (%s)", envelope.Checksum, checksum),
+			}
+		}
+	} else {
+		// unversioned snapshots are the bare ContainerSnapshot, unchecked
+		envelope.Snapshot, err = json.Marshal(raw)
+		if err != nil {
+			return ContainerSnapshot{}, err
+		}
+	}
+
+	if envelope.Version > SnapshotVersion {
+		return ContainerSnapshot{}, UnsupportedSnapshotVersionError{envelope.Version}
+	}
+
+	payload := envelope.Snapshot
+
+	if envelope.Version < SnapshotVersion {
+		payload, err = migrateSnapshot(envelope.Version, payload)
+		if err != nil {
+			return ContainerSnapshot{}, err
+		}
+	}
+
+	var snapshot ContainerSnapshot
+
+	err = json.Unmarshal(payload, &snapshot)
+	if err != nil {
+		return ContainerSnapshot{}, CorruptSnapshotError{err.Error()}
+	}
+
+	return snapshot, nil
+}
+
+func migrateSnapshot(version int, payload json.RawMessage) (json.RawMessage, error) {
+	var snapshot map[string]interface{}
+
+	// numbers are kept as json.Number, as float64 would lose the precision of
+	// e.g. uint64 limits
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	err := decoder.Decode(&snapshot)
+	if err != nil {
+		return nil, CorruptSnapshotError{err.Error()}
+	}
+
+	for ; version < SnapshotVersion; version++ {
+		migration, found := SnapshotMigrations[version]
+		if !found {
+			return nil, UnsupportedSnapshotVersionError{version}
+		}
+
+		err := migration(snapshot)
+		if err != nil {
+			return nil, fmt.Errorf("migrating snapshot from version %d: %s", version, err)
+		}
+	}
+
+	return json.Marshal(snapshot)
+}
+
+func snapshotChecksum(payload []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(payload))
+}
+
+// deriveIDMappings migrates snapshots from before containers' user
+// namespaces were recorded, when unprivileged containers mapped only their
+// root and user.
+func deriveIDMappings(snapshot map[string]interface{}) error {
+	resources, ok := snapshot["Resources"].(map[string]interface{})
+	if !ok {
+		return errors.New("missing resources")
+	}
+
+	if resources["UIDMappings"] != nil {
+		return nil
+	}
+
+	rootUID, err := snapshotUint32(resources["RootUID"])
+	if err != nil {
+		return fmt.Errorf("invalid root uid: %s", err)
+	}
+
+	userUID, err := snapshotUint32(resources["UserUID"])
+	if err != nil {
+		return fmt.Errorf("invalid user uid: %s", err)
+	}
+
+	if rootUID == 0 {
+		return nil
+	}
+
+	mappings := linux_backend.SingleIDMappings(rootUID, userUID)
+
+	resources["UIDMappings"] = mappings
+	resources["GIDMappings"] = mappings
+
+	return nil
+}
+
+// snapshotUint32 reads a number of a snapshot being migrated; a missing one
+// is zero.
+func snapshotUint32(value interface{}) (uint32, error) {
+	if value == nil {
+		return 0, nil
+	}
+
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("not a number: %v", value)
+	}
+
+	n, err := strconv.ParseUint(number.String(), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint32(n), nil
 }
@@ -0,0 +1,165 @@
+package linux_container_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/linux_container"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+)
+
+var _ = Describe("Snapshot format", func() {
+	var snapshot linux_container.ContainerSnapshot
+
+	BeforeEach(func() {
+		mappings := linux_backend.RangeIDMappings(100000, 65536, 10000)
+
+		snapshot = linux_container.ContainerSnapshot{
+			ID:     "some-id",
+			Handle: "some-handle",
+			State:  "active",
+
+			Resources: linux_container.ResourcesSnapshot{
+				UserUID:     10000,
+				RootUID:     100000,
+				Ports:       []uint32{61001},
+				UIDMappings: mappings,
+				GIDMappings: mappings,
+			},
+
+			Properties: map[string]string{"foo": "bar"},
+		}
+	})
+
+	writeEnvelope := func() linux_container.SnapshotEnvelope {
+		buf := new(bytes.Buffer)
+
+		err := linux_container.WriteSnapshot(buf, snapshot)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		var envelope linux_container.SnapshotEnvelope
+
+		err = json.NewDecoder(buf).Decode(&envelope)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return envelope
+	}
+
+	encode := func(value interface{}) *bytes.Buffer {
+		buf := new(bytes.Buffer)
+
+		err := json.NewEncoder(buf).Encode(value)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return buf
+	}
+
+	It("writes the snapshot with the current version and its checksum", func() {
+		envelope := writeEnvelope()
+
+		Ω(envelope.Version).Should(Equal(linux_container.SnapshotVersion))
+		Ω(envelope.Checksum).Should(HavePrefix("sha256:"))
+	})
+
+	It("reads back what it wrote", func() {
+		buf := new(bytes.Buffer)
+
+		err := linux_container.WriteSnapshot(buf, snapshot)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		read, err := linux_container.ReadSnapshot(buf)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(read).Should(Equal(snapshot))
+	})
+
+	Context("when the snapshot predates versioning", func() {
+		It("reads it as version 0 and migrates it", func() {
+			read, err := linux_container.ReadSnapshot(encode(snapshot))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(read).Should(Equal(snapshot))
+		})
+
+		Context("with numbers beyond the precision of a float64", func() {
+			BeforeEach(func() {
+				snapshot.Limits.Memory = &garden.MemoryLimits{LimitInBytes: math.MaxUint64}
+			})
+
+			It("keeps them intact", func() {
+				read, err := linux_container.ReadSnapshot(encode(snapshot))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(read.Limits.Memory.LimitInBytes).Should(Equal(uint64(math.MaxUint64)))
+			})
+		})
+
+		Context("and the container's id mappings", func() {
+			BeforeEach(func() {
+				snapshot.Resources.RootUID = 10001
+				snapshot.Resources.UIDMappings = nil
+				snapshot.Resources.GIDMappings = nil
+			})
+
+			It("derives them from its root and user", func() {
+				read, err := linux_container.ReadSnapshot(encode(snapshot))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(read.Resources.UIDMappings).Should(Equal(linux_backend.SingleIDMappings(10001, 10000)))
+				Ω(read.Resources.GIDMappings).Should(Equal(linux_backend.SingleIDMappings(10001, 10000)))
+			})
+
+			Context("when the container is privileged", func() {
+				BeforeEach(func() {
+					snapshot.Resources.RootUID = 0
+				})
+
+				It("leaves it unmapped", func() {
+					read, err := linux_container.ReadSnapshot(encode(snapshot))
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(read.Resources.UIDMappings).Should(BeNil())
+				})
+			})
+		})
+	})
+
+	Context("when the snapshot does not match its checksum", func() {
+		It("returns a CorruptSnapshotError", func() {
+			envelope := writeEnvelope()
+			envelope.Snapshot = json.RawMessage(strings.Replace(string(envelope.Snapshot), "some-handle", "some-other-handle", 1))
+
+			_, err := linux_container.ReadSnapshot(encode(envelope))
+			Ω(err).Should(BeAssignableToTypeOf(linux_container.CorruptSnapshotError{}))
+			Ω(err.Error()).Should(ContainSubstring("does not match its contents"))
+		})
+	})
+
+	Context("when the snapshot is not JSON", func() {
+		It("returns a CorruptSnapshotError", func() {
+			_, err := linux_container.ReadSnapshot(strings.NewReader(`{"version":1,"checksum":`))
+			Ω(err).Should(BeAssignableToTypeOf(linux_container.CorruptSnapshotError{}))
+		})
+	})
+
+	Context("when the snapshot is newer than the current version", func() {
+		It("returns an UnsupportedSnapshotVersionError", func() {
+			envelope := writeEnvelope()
+			envelope.Version = linux_container.SnapshotVersion + 1
+
+			_, err := linux_container.ReadSnapshot(encode(envelope))
+			Ω(err).Should(Equal(linux_container.UnsupportedSnapshotVersionError{linux_container.SnapshotVersion + 1}))
+		})
+	})
+
+	Context("when migrating the snapshot fails", func() {
+		It("returns the error", func() {
+			_, err := linux_container.ReadSnapshot(strings.NewReader(`{"ID":"some-id"}`))
+			Ω(err).Should(MatchError("migrating snapshot from version 0: missing resources"))
+		})
+	})
+})
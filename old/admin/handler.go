@@ -0,0 +1,253 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/process_tracker"
+	"github.com/pivotal-golang/lager"
+)
+
+type Backend interface {
+	Drain()
+	Undrain()
+	DrainStatus() linux_backend.DrainStatus
+
+	LinuxCapacity() (linux_backend.LinuxCapacity, error)
+
+	ProcessLog(handle string, processID uint32, request process_tracker.LogRequest, out io.Writer) error
+	SignalProcess(handle string, processID uint32, request process_tracker.SignalRequest) error
+}
+
+// NewHandler serves the operator endpoints:
+//
+//	GET    /drain  reports the drain status
+//	PUT    /drain  starts draining
+//	DELETE /drain  stops draining
+//	GET    /capacity  reports the capacity committed to containers and free
+//	GET    /containers/:handle/processes/:id/log  streams a process's log
+//	POST   /containers/:handle/processes/:id/signal  signals a process
+//
+// Every request to /drain responds with the resulting drain status.
+//
+// A process log is its stdout unless ?stream=stderr is given; ?lines=n
+// limits it to its last n lines and ?follow=true keeps streaming it until
+// the process exits.
+//
+// A process is signalled with ?signal=, e.g. HUP, SIGUSR1 or 15, and its
+// whole process group with ?group=true.
+func NewHandler(logger lager.Logger, backend Backend) http.Handler {
+	logger = logger.Session("admin")
+
+	mux := http.NewServeMux()
+
+	mux.Handle("/drain", &drainHandler{
+		logger:  logger,
+		drainer: backend,
+	})
+
+	mux.Handle("/capacity", &capacityHandler{
+		logger:  logger,
+		backend: backend,
+	})
+
+	mux.Handle("/containers/", &processHandler{
+		logger:  logger,
+		backend: backend,
+	})
+
+	return mux
+}
+
+type drainHandler struct {
+	logger  lager.Logger
+	drainer Backend
+}
+
+func (h *drainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		h.logger.Info("drain")
+		h.drainer.Drain()
+	case "DELETE":
+		h.logger.Info("undrain")
+		h.drainer.Undrain()
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(h.drainer.DrainStatus())
+	if err != nil {
+		h.logger.Error("failed-to-write-status", err)
+	}
+}
+
+type capacityHandler struct {
+	logger  lager.Logger
+	backend Backend
+}
+
+func (h *capacityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	capacity, err := h.backend.LinuxCapacity()
+	if err != nil {
+		h.logger.Error("failed-to-get-capacity", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(capacity)
+	if err != nil {
+		h.logger.Error("failed-to-write-capacity", err)
+	}
+}
+
+type processHandler struct {
+	logger  lager.Logger
+	backend Backend
+}
+
+func (h *processHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// containers/:handle/processes/:id/:action
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(segments) != 5 || segments[2] != "processes" {
+		http.NotFound(w, r)
+		return
+	}
+
+	handle := segments[1]
+
+	processID, err := strconv.ParseUint(segments[3], 10, 32)
+	if err != nil {
+		http.Error(w, "invalid process id: "+segments[3], http.StatusBadRequest)
+		return
+	}
+
+	switch segments[4] {
+	case "log":
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		h.serveLog(w, r, handle, uint32(processID))
+
+	case "signal":
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		h.serveSignal(w, r, handle, uint32(processID))
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *processHandler) serveLog(w http.ResponseWriter, r *http.Request, handle string, processID uint32) {
+	request := process_tracker.LogRequest{
+		Stream: process_tracker.StdoutLog,
+		Follow: r.URL.Query().Get("follow") == "true",
+	}
+
+	switch stream := r.URL.Query().Get("stream"); stream {
+	case "", "stdout":
+	case "stderr":
+		request.Stream = process_tracker.StderrLog
+	default:
+		http.Error(w, "invalid stream: "+stream, http.StatusBadRequest)
+		return
+	}
+
+	if lines := r.URL.Query().Get("lines"); lines != "" {
+		var err error
+
+		request.Lines, err = strconv.Atoi(lines)
+		if err != nil || request.Lines < 0 {
+			http.Error(w, "invalid lines: "+lines, http.StatusBadRequest)
+			return
+		}
+	}
+
+	out := &logWriter{ResponseWriter: w}
+
+	err := h.backend.ProcessLog(handle, processID, request, out)
+	if err == nil || out.written {
+		return
+	}
+
+	switch err.(type) {
+	case garden.ContainerNotFoundError, process_tracker.NoProcessLogError:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		h.logger.Error("failed-to-stream-process-log", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *processHandler) serveSignal(w http.ResponseWriter, r *http.Request, handle string, processID uint32) {
+	signal, err := process_tracker.ParseSignal(r.URL.Query().Get("signal"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.backend.SignalProcess(handle, processID, process_tracker.SignalRequest{
+		Signal: signal,
+		Group:  r.URL.Query().Get("group") == "true",
+	})
+
+	switch err.(type) {
+	case nil:
+		h.logger.Info("signalled-process", lager.Data{
+			"handle":  handle,
+			"process": processID,
+			"signal":  signal.String(),
+		})
+
+		w.WriteHeader(http.StatusNoContent)
+	case garden.ContainerNotFoundError, process_tracker.UnknownProcessError:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		h.logger.Error("failed-to-signal-process", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// logWriter flushes every write, so that followers see output as it comes.
+type logWriter struct {
+	http.ResponseWriter
+
+	written bool
+}
+
+func (w *logWriter) Write(data []byte) (int, error) {
+	if !w.written {
+		w.Header().Set("Content-Type", "text/plain")
+		w.written = true
+	}
+
+	n, err := w.ResponseWriter.Write(data)
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	return n, err
+}
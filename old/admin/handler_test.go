@@ -0,0 +1,296 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/old/admin"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/process_tracker"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeBackend struct {
+	status linux_backend.DrainStatus
+
+	capacity    linux_backend.LinuxCapacity
+	capacityErr error
+
+	logHandle    string
+	logProcessID uint32
+	logRequest   process_tracker.LogRequest
+	log          string
+	logErr       error
+
+	signalHandle    string
+	signalProcessID uint32
+	signalRequest   process_tracker.SignalRequest
+	signalErr       error
+}
+
+func (d *fakeBackend) Drain() {
+	d.status.Draining = true
+}
+
+func (d *fakeBackend) Undrain() {
+	d.status.Draining = false
+}
+
+func (d *fakeBackend) DrainStatus() linux_backend.DrainStatus {
+	return d.status
+}
+
+func (d *fakeBackend) LinuxCapacity() (linux_backend.LinuxCapacity, error) {
+	return d.capacity, d.capacityErr
+}
+
+func (d *fakeBackend) ProcessLog(handle string, processID uint32, request process_tracker.LogRequest, out io.Writer) error {
+	d.logHandle = handle
+	d.logProcessID = processID
+	d.logRequest = request
+
+	if d.logErr != nil {
+		return d.logErr
+	}
+
+	_, err := io.WriteString(out, d.log)
+	return err
+}
+
+func (d *fakeBackend) SignalProcess(handle string, processID uint32, request process_tracker.SignalRequest) error {
+	d.signalHandle = handle
+	d.signalProcessID = processID
+	d.signalRequest = request
+
+	return d.signalErr
+}
+
+var _ = Describe("Admin handler", func() {
+	var backend *fakeBackend
+	var handler http.Handler
+
+	BeforeEach(func() {
+		backend = &fakeBackend{
+			status: linux_backend.DrainStatus{Containers: 3},
+		}
+
+		handler = admin.NewHandler(lagertest.NewTestLogger("test"), backend)
+	})
+
+	request := func(method string) (int, linux_backend.DrainStatus) {
+		req, err := http.NewRequest(method, "/drain", nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		var status linux_backend.DrainStatus
+		if recorder.Code == http.StatusOK {
+			err = json.NewDecoder(recorder.Body).Decode(&status)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		return recorder.Code, status
+	}
+
+	It("reports the drain status", func() {
+		code, status := request("GET")
+		Ω(code).Should(Equal(http.StatusOK))
+		Ω(status).Should(Equal(linux_backend.DrainStatus{Containers: 3}))
+	})
+
+	It("starts draining on PUT", func() {
+		code, status := request("PUT")
+		Ω(code).Should(Equal(http.StatusOK))
+		Ω(status.Draining).Should(BeTrue())
+		Ω(backend.status.Draining).Should(BeTrue())
+	})
+
+	It("stops draining on DELETE", func() {
+		backend.status.Draining = true
+
+		code, status := request("DELETE")
+		Ω(code).Should(Equal(http.StatusOK))
+		Ω(status.Draining).Should(BeFalse())
+		Ω(backend.status.Draining).Should(BeFalse())
+	})
+
+	It("rejects other methods", func() {
+		code, _ := request("POST")
+		Ω(code).Should(Equal(http.StatusMethodNotAllowed))
+		Ω(backend.status.Draining).Should(BeFalse())
+	})
+
+	Describe("capacity", func() {
+		get := func() *httptest.ResponseRecorder {
+			req, err := http.NewRequest("GET", "/capacity", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			return recorder
+		}
+
+		It("reports the committed and free capacity", func() {
+			backend.capacity = linux_backend.LinuxCapacity{
+				CommittedMemoryInBytes: 1,
+				CommittedDiskInBytes:   2,
+				FreeMemoryInBytes:      3,
+				FreeDiskInBytes:        4,
+			}
+
+			recorder := get()
+			Ω(recorder.Code).Should(Equal(http.StatusOK))
+
+			var capacity linux_backend.LinuxCapacity
+			err := json.NewDecoder(recorder.Body).Decode(&capacity)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(capacity).Should(Equal(backend.capacity))
+		})
+
+		Context("when getting the capacity fails", func() {
+			It("responds with an error", func() {
+				backend.capacityErr = errors.New("oh no!")
+
+				recorder := get()
+				Ω(recorder.Code).Should(Equal(http.StatusInternalServerError))
+			})
+		})
+	})
+
+	Describe("process logs", func() {
+		get := func(url string) *httptest.ResponseRecorder {
+			req, err := http.NewRequest("GET", url, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			return recorder
+		}
+
+		It("streams the stdout log of the process", func() {
+			backend.log = "hello\n"
+
+			recorder := get("/containers/some-handle/processes/42/log")
+			Ω(recorder.Code).Should(Equal(http.StatusOK))
+			Ω(recorder.Body.String()).Should(Equal("hello\n"))
+
+			Ω(backend.logHandle).Should(Equal("some-handle"))
+			Ω(backend.logProcessID).Should(Equal(uint32(42)))
+			Ω(backend.logRequest).Should(Equal(process_tracker.LogRequest{
+				Stream: process_tracker.StdoutLog,
+			}))
+		})
+
+		It("passes on the stream, lines and follow", func() {
+			recorder := get("/containers/some-handle/processes/42/log?stream=stderr&lines=10&follow=true")
+			Ω(recorder.Code).Should(Equal(http.StatusOK))
+
+			Ω(backend.logRequest).Should(Equal(process_tracker.LogRequest{
+				Stream: process_tracker.StderrLog,
+				Lines:  10,
+				Follow: true,
+			}))
+		})
+
+		It("rejects invalid requests", func() {
+			Ω(get("/containers/some-handle/processes/nope/log").Code).Should(Equal(http.StatusBadRequest))
+			Ω(get("/containers/some-handle/processes/42/log?stream=stdin").Code).Should(Equal(http.StatusBadRequest))
+			Ω(get("/containers/some-handle/processes/42/log?lines=-1").Code).Should(Equal(http.StatusBadRequest))
+			Ω(get("/containers/some-handle/processes/42").Code).Should(Equal(http.StatusNotFound))
+		})
+
+		Context("when the container does not exist", func() {
+			It("responds with not found", func() {
+				backend.logErr = garden.ContainerNotFoundError{"some-handle"}
+
+				recorder := get("/containers/some-handle/processes/42/log")
+				Ω(recorder.Code).Should(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("when the process has no log", func() {
+			It("responds with not found", func() {
+				backend.logErr = process_tracker.NoProcessLogError{42, process_tracker.StdoutLog}
+
+				recorder := get("/containers/some-handle/processes/42/log")
+				Ω(recorder.Code).Should(Equal(http.StatusNotFound))
+			})
+		})
+	})
+
+	Describe("signalling processes", func() {
+		post := func(url string) *httptest.ResponseRecorder {
+			req, err := http.NewRequest("POST", url, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			return recorder
+		}
+
+		It("signals the process", func() {
+			recorder := post("/containers/some-handle/processes/42/signal?signal=HUP")
+			Ω(recorder.Code).Should(Equal(http.StatusNoContent))
+
+			Ω(backend.signalHandle).Should(Equal("some-handle"))
+			Ω(backend.signalProcessID).Should(Equal(uint32(42)))
+			Ω(backend.signalRequest).Should(Equal(process_tracker.SignalRequest{
+				Signal: syscall.SIGHUP,
+			}))
+		})
+
+		It("signals the process group", func() {
+			recorder := post("/containers/some-handle/processes/42/signal?signal=SIGUSR2&group=true")
+			Ω(recorder.Code).Should(Equal(http.StatusNoContent))
+
+			Ω(backend.signalRequest).Should(Equal(process_tracker.SignalRequest{
+				Signal: syscall.SIGUSR2,
+				Group:  true,
+			}))
+		})
+
+		It("rejects unknown signals", func() {
+			Ω(post("/containers/some-handle/processes/42/signal?signal=NOPE").Code).Should(Equal(http.StatusBadRequest))
+			Ω(post("/containers/some-handle/processes/42/signal").Code).Should(Equal(http.StatusBadRequest))
+		})
+
+		It("rejects other methods", func() {
+			req, err := http.NewRequest("GET", "/containers/some-handle/processes/42/signal?signal=HUP", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			Ω(recorder.Code).Should(Equal(http.StatusMethodNotAllowed))
+		})
+
+		Context("when the process does not exist", func() {
+			It("responds with not found", func() {
+				backend.signalErr = process_tracker.UnknownProcessError{42}
+
+				Ω(post("/containers/some-handle/processes/42/signal?signal=HUP").Code).Should(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("when signalling fails", func() {
+			It("responds with an error", func() {
+				backend.signalErr = errors.New("oh no!")
+
+				Ω(post("/containers/some-handle/processes/42/signal?signal=HUP").Code).Should(Equal(http.StatusInternalServerError))
+			})
+		})
+	})
+})
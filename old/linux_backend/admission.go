@@ -0,0 +1,106 @@
+package linux_backend
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/cloudfoundry-incubator/garden"
+)
+
+// Properties which, when given at creation, limit the container's memory and
+// disk usage. They are also what admission control counts against the host's
+// capacity.
+const MemoryLimitProperty = "garden.memory_limit_in_bytes"
+const DiskLimitProperty = "garden.disk_limit_in_bytes"
+
+// AdmissionPolicy bounds the memory and disk limits committed to containers
+// to the host's total memory and disk times the overcommit ratio. A zero
+// ratio admits any amount.
+type AdmissionPolicy struct {
+	MemoryOvercommitRatio float64
+	DiskOvercommitRatio   float64
+}
+
+// CommittedResources are the memory and disk limits given to containers.
+type CommittedResources struct {
+	MemoryInBytes uint64
+	DiskInBytes   uint64
+}
+
+func (r CommittedResources) add(other CommittedResources) CommittedResources {
+	return CommittedResources{
+		MemoryInBytes: r.MemoryInBytes + other.MemoryInBytes,
+		DiskInBytes:   r.DiskInBytes + other.DiskInBytes,
+	}
+}
+
+func (r CommittedResources) sub(other CommittedResources) CommittedResources {
+	return CommittedResources{
+		MemoryInBytes: r.MemoryInBytes - other.MemoryInBytes,
+		DiskInBytes:   r.DiskInBytes - other.DiskInBytes,
+	}
+}
+
+// LinuxCapacity extends garden.Capacity with the resources committed to
+// containers and those left to commit under the admission policy.
+type LinuxCapacity struct {
+	garden.Capacity
+
+	CommittedMemoryInBytes uint64 `json:"committed_memory_in_bytes"`
+	CommittedDiskInBytes   uint64 `json:"committed_disk_in_bytes"`
+
+	FreeMemoryInBytes uint64 `json:"free_memory_in_bytes"`
+	FreeDiskInBytes   uint64 `json:"free_disk_in_bytes"`
+}
+
+type InsufficientCapacityError struct {
+	Resource  string
+	Requested uint64
+	Free      uint64
+}
+
+func (e InsufficientCapacityError) Error() string {
+	return fmt.Sprintf(
+		"insufficient %s capacity: requested %d bytes, %d bytes free",
+		e.Resource,
+		e.Requested,
+		e.Free,
+	)
+}
+
+func requestedResources(spec garden.ContainerSpec) (CommittedResources, error) {
+	var requested CommittedResources
+
+	for property, value := range map[string]*uint64{
+		MemoryLimitProperty: &requested.MemoryInBytes,
+		DiskLimitProperty:   &requested.DiskInBytes,
+	} {
+		limit, found := spec.Properties[property]
+		if !found {
+			continue
+		}
+
+		bytes, err := strconv.ParseUint(limit, 10, 64)
+		if err != nil {
+			return CommittedResources{}, fmt.Errorf("invalid %s: %q", property, limit)
+		}
+
+		*value = bytes
+	}
+
+	return requested, nil
+}
+
+// how much of total is left to commit; a zero ratio counts as no overcommit
+func free(total uint64, ratio float64, committed uint64) uint64 {
+	if ratio == 0 {
+		ratio = 1
+	}
+
+	allowed := uint64(float64(total) * ratio)
+	if committed >= allowed {
+		return 0
+	}
+
+	return allowed - committed
+}
@@ -47,7 +47,23 @@ function mount_nested_cgroup() {
   done
 }
 
-if [ ! -d $cgroup_path ]
+function mount_unified_cgroup() {
+  mkdir -p $1
+
+  if ! mountpoint -q $1; then
+    mount -n -t cgroup2 cgroup2 $1
+  fi
+
+  # let instance cgroups use every controller the host offers
+  for controller in $(cat $1/cgroup.controllers); do
+    echo "+$controller" > $1/cgroup.subtree_control
+  done
+}
+
+if [ "${GARDEN_CGROUP_UNIFIED:-false}" = "true" ]
+then
+  mount_unified_cgroup $cgroup_path
+elif [ ! -d $cgroup_path ]
 then
   mount_nested_cgroup $cgroup_path || \
     mount_flat_cgroup $cgroup_path
@@ -1,7 +1,32 @@
 package cgroups_manager
 
+import (
+	"os"
+	"syscall"
+)
+
+const cgroup2SuperMagic = 0x63677270
+
 type CgroupsManager interface {
 	Set(subsystem, name, value string) error
 	Get(subsystem, name string) (string, error)
 	SubsystemPath(subsystem string) string
 }
+
+// IsUnified reports whether the cgroup filesystem mounted at the given path
+// (usually /sys/fs/cgroup) is the cgroup v2 unified hierarchy. A missing
+// path is taken as cgroup v1, which setup mounts there itself.
+func IsUnified(mountPoint string) (bool, error) {
+	var stat syscall.Statfs_t
+
+	err := syscall.Statfs(mountPoint, &stat)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return stat.Type == cgroup2SuperMagic, nil
+}
@@ -57,13 +57,15 @@ func (m *FakeCgroupsManager) Set(subsystem, name, value string) error {
 }
 
 func (m *FakeCgroupsManager) Get(subsytem, name string) (string, error) {
-	for _, cb := range m.getCallbacks {
+	for i := len(m.getCallbacks) - 1; i >= 0; i-- {
+		cb := m.getCallbacks[i]
 		if cb.Subsystem == subsytem && cb.Name == name {
 			return cb.Callback()
 		}
 	}
 
-	for _, val := range m.setValues {
+	for i := len(m.setValues) - 1; i >= 0; i-- {
+		val := m.setValues[i]
 		if val.Subsystem == subsytem && val.Name == name {
 			return val.Value, nil
 		}
@@ -0,0 +1,445 @@
+package cgroups_manager
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the value cgroup v1 reports for memory.limit_in_bytes when unlimited
+const unlimitedMemory = "9223372036854771712"
+
+// cpuacct.stat is reported in USER_HZ ticks
+const microsecondsPerTick = 10000
+
+var ioThrottles = map[string]string{
+	"blkio.throttle.read_bps_device":   "rbps",
+	"blkio.throttle.write_bps_device":  "wbps",
+	"blkio.throttle.read_iops_device":  "riops",
+	"blkio.throttle.write_iops_device": "wiops",
+}
+
+// UnifiedCgroupsManager manages a container's cgroup on a host using the
+// cgroup v2 unified hierarchy, where every controller shares the single
+// <cgroupsPath>/instance-<id> directory.
+//
+// Callers keep using cgroup v1 subsystem and file names; they are translated
+// to their v2 counterparts, and v2 values are reported in v1 form.
+type UnifiedCgroupsManager struct {
+	cgroupsPath string
+	containerID string
+
+	// cpu.weight is coarser than cpu.shares, so the shares last set are
+	// kept to report them back as they were given
+	cpuShares      uint64
+	cpuSharesMutex sync.Mutex
+}
+
+func NewUnified(cgroupsPath, containerID string) *UnifiedCgroupsManager {
+	return &UnifiedCgroupsManager{
+		cgroupsPath: cgroupsPath,
+		containerID: containerID,
+	}
+}
+
+func (m *UnifiedCgroupsManager) Set(subsystem, name, value string) error {
+	switch name {
+	case "memory.limit_in_bytes":
+		return m.write("memory.max", value)
+
+	case "memory.memsw.limit_in_bytes":
+		return m.setMemoryAndSwapLimit(value)
+
+	case "cpu.shares":
+		shares, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		return m.setCPUShares(shares)
+
+	case "cpu.cfs_quota_us":
+		_, period, err := m.cpuMax()
+		if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(value, "-") {
+			value = "max"
+		}
+
+		return m.write("cpu.max", value+" "+period)
+
+	case "cpu.cfs_period_us":
+		quota, _, err := m.cpuMax()
+		if err != nil {
+			return err
+		}
+
+		return m.write("cpu.max", quota+" "+value)
+
+	case "memory.oom_control":
+		if value != "0" {
+			return errors.New("cgroups: disabling the OOM killer is not supported with cgroup v2")
+		}
+
+		return nil
+
+	case "freezer.state":
+		frozen := "0"
+		if value == "FROZEN" {
+			frozen = "1"
+		}
+
+		return m.write("cgroup.freeze", frozen)
+
+	case "blkio.weight":
+		weight, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		return m.write("io.weight", fmt.Sprintf("default %d", blkioToIOWeight(weight)))
+	}
+
+	if key, found := ioThrottles[name]; found {
+		fields := strings.Fields(value)
+		if len(fields) != 2 {
+			return fmt.Errorf("cgroups: invalid %s value: %q", name, value)
+		}
+
+		rate := fields[1]
+		if rate == "0" {
+			rate = "max"
+		}
+
+		return m.write("io.max", fmt.Sprintf("%s %s=%s", fields[0], key, rate))
+	}
+
+	return m.write(name, value)
+}
+
+func (m *UnifiedCgroupsManager) Get(subsystem, name string) (string, error) {
+	switch name {
+	case "memory.limit_in_bytes":
+		max, err := m.read("memory.max")
+		if err != nil {
+			return "", err
+		}
+
+		if max == "max" {
+			return unlimitedMemory, nil
+		}
+
+		return max, nil
+
+	case "memory.usage_in_bytes":
+		return m.read("memory.current")
+
+	case "memory.stat":
+		return m.memoryStat()
+
+	case "cpu.shares":
+		weight, err := m.read("cpu.weight")
+		if err != nil {
+			return "", err
+		}
+
+		numericWeight, err := strconv.ParseUint(weight, 10, 64)
+		if err != nil {
+			return "", err
+		}
+
+		return strconv.FormatUint(m.cpuSharesOf(numericWeight), 10), nil
+
+	case "cpu.cfs_quota_us":
+		quota, _, err := m.cpuMax()
+		if err != nil {
+			return "", err
+		}
+
+		if quota == "max" {
+			return "-1", nil
+		}
+
+		return quota, nil
+
+	case "cpu.cfs_period_us":
+		_, period, err := m.cpuMax()
+		return period, err
+
+	case "cpuacct.usage":
+		stat, err := m.keyedValues("cpu.stat")
+		if err != nil {
+			return "", err
+		}
+
+		return strconv.FormatUint(stat["usage_usec"]*1000, 10), nil
+
+	case "cpuacct.stat":
+		stat, err := m.keyedValues("cpu.stat")
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf(
+			"user %d\nsystem %d",
+			stat["user_usec"]/microsecondsPerTick,
+			stat["system_usec"]/microsecondsPerTick,
+		), nil
+
+	case "freezer.state":
+		events, err := m.keyedValues("cgroup.events")
+		if err != nil {
+			return "", err
+		}
+
+		if events["frozen"] == 1 {
+			return "FROZEN", nil
+		}
+
+		return "THAWED", nil
+
+	case "blkio.throttle.io_service_bytes":
+		return m.ioStat("rbytes", "wbytes")
+
+	case "blkio.throttle.io_serviced":
+		return m.ioStat("rios", "wios")
+	}
+
+	return m.read(name)
+}
+
+func (m *UnifiedCgroupsManager) SubsystemPath(subsystem string) string {
+	return path.Join(m.cgroupsPath, "instance-"+m.containerID)
+}
+
+// v1 limits memory+swap together, v2 limits swap on its own
+func (m *UnifiedCgroupsManager) setMemoryAndSwapLimit(value string) error {
+	memsw, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	max, err := m.read("memory.max")
+	if err != nil {
+		return err
+	}
+
+	if max == "max" {
+		return m.write("memory.swap.max", "max")
+	}
+
+	memory, err := strconv.ParseUint(max, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	swap := uint64(0)
+	if memsw > memory {
+		swap = memsw - memory
+	}
+
+	return m.write("memory.swap.max", strconv.FormatUint(swap, 10))
+}
+
+func (m *UnifiedCgroupsManager) setCPUShares(shares uint64) error {
+	m.cpuSharesMutex.Lock()
+	defer m.cpuSharesMutex.Unlock()
+
+	err := m.write("cpu.weight", strconv.FormatUint(sharesToWeight(shares), 10))
+	if err != nil {
+		return err
+	}
+
+	m.cpuShares = shares
+
+	return nil
+}
+
+// the shares last set, unless cpu.weight has since been changed directly
+func (m *UnifiedCgroupsManager) cpuSharesOf(weight uint64) uint64 {
+	m.cpuSharesMutex.Lock()
+	defer m.cpuSharesMutex.Unlock()
+
+	if m.cpuShares != 0 && sharesToWeight(m.cpuShares) == weight {
+		return m.cpuShares
+	}
+
+	return weightToShares(weight)
+}
+
+func (m *UnifiedCgroupsManager) cpuMax() (string, string, error) {
+	max, err := m.read("cpu.max")
+	if err != nil {
+		return "", "", err
+	}
+
+	fields := strings.Fields(max)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("cgroups: invalid cpu.max value: %q", max)
+	}
+
+	return fields[0], fields[1], nil
+}
+
+func (m *UnifiedCgroupsManager) memoryStat() (string, error) {
+	stat, err := m.keyedValues("memory.stat")
+	if err != nil {
+		return "", err
+	}
+
+	translated := []struct {
+		v1 string
+		v2 string
+	}{
+		{"cache", "file"},
+		{"rss", "anon"},
+		{"mapped_file", "file_mapped"},
+		{"pgfault", "pgfault"},
+		{"pgmajfault", "pgmajfault"},
+		{"inactive_anon", "inactive_anon"},
+		{"active_anon", "active_anon"},
+		{"inactive_file", "inactive_file"},
+		{"active_file", "active_file"},
+		{"unevictable", "unevictable"},
+	}
+
+	swap := uint64(0)
+	if current, err := m.read("memory.swap.current"); err == nil {
+		swap, _ = strconv.ParseUint(current, 10, 64)
+	}
+
+	limit, err := m.Get("memory", "memory.limit_in_bytes")
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{}
+
+	// v2 statistics are always hierarchical, so they double as the totals
+	for _, prefix := range []string{"", "total_"} {
+		for _, t := range translated {
+			lines = append(lines, fmt.Sprintf("%s%s %d", prefix, t.v1, stat[t.v2]))
+		}
+
+		lines = append(lines, fmt.Sprintf("%sswap %d", prefix, swap))
+	}
+
+	lines = append(lines, "hierarchical_memory_limit "+limit)
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// io.stat has one "<major:minor> rbytes=N wbytes=N rios=N wios=N ..." line
+// per device; v1 reports "<major:minor> Read N" and "<major:minor> Write N"
+func (m *UnifiedCgroupsManager) ioStat(readKey, writeKey string) (string, error) {
+	contents, err := m.read("io.stat")
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{}
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		device := fields[0]
+		values := map[string]string{}
+
+		for _, field := range fields[1:] {
+			keyValue := strings.SplitN(field, "=", 2)
+			if len(keyValue) == 2 {
+				values[keyValue[0]] = keyValue[1]
+			}
+		}
+
+		lines = append(lines, fmt.Sprintf("%s Read %s", device, valueOrZero(values[readKey])))
+		lines = append(lines, fmt.Sprintf("%s Write %s", device, valueOrZero(values[writeKey])))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// reads a flat "<key> <value>" file, ignoring non-numeric values
+func (m *UnifiedCgroupsManager) keyedValues(name string) (map[string]uint64, error) {
+	contents, err := m.read(name)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]uint64{}
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		values[fields[0]] = value
+	}
+
+	return values, nil
+}
+
+func (m *UnifiedCgroupsManager) write(name, value string) error {
+	return ioutil.WriteFile(path.Join(m.SubsystemPath(""), name), []byte(value), 0644)
+}
+
+func (m *UnifiedCgroupsManager) read(name string) (string, error) {
+	body, err := ioutil.ReadFile(path.Join(m.SubsystemPath(""), name))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Trim(string(body), "\n"), nil
+}
+
+// maps cpu.shares (2-262144) onto cpu.weight (1-10000)
+func sharesToWeight(shares uint64) uint64 {
+	if shares < 2 {
+		shares = 2
+	}
+
+	return 1 + ((shares-2)*9999)/262142
+}
+
+func weightToShares(weight uint64) uint64 {
+	if weight < 1 {
+		weight = 1
+	}
+
+	return 2 + ((weight-1)*262142)/9999
+}
+
+// maps blkio.weight (10-1000) onto io.weight (1-10000)
+func blkioToIOWeight(weight uint64) uint64 {
+	if weight < 10 {
+		weight = 10
+	}
+
+	return 1 + ((weight-10)*9999)/990
+}
+
+func valueOrZero(value string) string {
+	if value == "" {
+		return "0"
+	}
+
+	return value
+}
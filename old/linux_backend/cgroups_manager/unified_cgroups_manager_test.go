@@ -0,0 +1,274 @@
+package cgroups_manager_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/cgroups_manager"
+)
+
+var _ = Describe("Unified container cgroups", func() {
+	var cgroupsPath string
+	var instancePath string
+	var cgroupsManager *cgroups_manager.UnifiedCgroupsManager
+
+	writeFile := func(name, contents string) {
+		err := ioutil.WriteFile(path.Join(instancePath, name), []byte(contents), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	readFile := func(name string) string {
+		contents, err := ioutil.ReadFile(path.Join(instancePath, name))
+		Ω(err).ShouldNot(HaveOccurred())
+		return string(contents)
+	}
+
+	BeforeEach(func() {
+		tmpdir, err := ioutil.TempDir(os.TempDir(), "some-cgroups")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		cgroupsPath = tmpdir
+		instancePath = path.Join(cgroupsPath, "instance-some-container-id")
+
+		err = os.MkdirAll(instancePath, 0755)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		cgroupsManager = cgroups_manager.NewUnified(cgroupsPath, "some-container-id")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(cgroupsPath)
+	})
+
+	Describe("retrieving a subsystem path", func() {
+		It("returns <path>/instance-<container-id> for every subsystem", func() {
+			Ω(cgroupsManager.SubsystemPath("memory")).Should(Equal(instancePath))
+			Ω(cgroupsManager.SubsystemPath("cpu")).Should(Equal(instancePath))
+		})
+	})
+
+	Describe("files with the same name in both versions", func() {
+		It("writes and reads them directly", func() {
+			err := cgroupsManager.Set("pids", "pids.max", "100")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(readFile("pids.max")).Should(Equal("100"))
+
+			writeFile("pids.current", "7\n")
+			Ω(cgroupsManager.Get("pids", "pids.current")).Should(Equal("7"))
+		})
+	})
+
+	Describe("memory", func() {
+		It("sets memory.limit_in_bytes as memory.max", func() {
+			err := cgroupsManager.Set("memory", "memory.limit_in_bytes", "1024")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(readFile("memory.max")).Should(Equal("1024"))
+		})
+
+		It("sets the swap allowance left over by memory.memsw.limit_in_bytes", func() {
+			writeFile("memory.max", "1024\n")
+
+			err := cgroupsManager.Set("memory", "memory.memsw.limit_in_bytes", "1024")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(readFile("memory.swap.max")).Should(Equal("0"))
+
+			err = cgroupsManager.Set("memory", "memory.memsw.limit_in_bytes", "4096")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(readFile("memory.swap.max")).Should(Equal("3072"))
+		})
+
+		It("reports an unlimited memory.max the way cgroup v1 does", func() {
+			writeFile("memory.max", "max\n")
+			Ω(cgroupsManager.Get("memory", "memory.limit_in_bytes")).Should(Equal("9223372036854771712"))
+
+			writeFile("memory.max", "2048\n")
+			Ω(cgroupsManager.Get("memory", "memory.limit_in_bytes")).Should(Equal("2048"))
+		})
+
+		It("cannot disable the OOM killer", func() {
+			err := cgroupsManager.Set("memory", "memory.oom_control", "1")
+			Ω(err).Should(HaveOccurred())
+
+			err = cgroupsManager.Set("memory", "memory.oom_control", "0")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("translates memory.stat", func() {
+			writeFile("memory.max", "4096\n")
+			writeFile("memory.swap.current", "5\n")
+			writeFile("memory.stat", `anon 1
+file 2
+kernel_stack 99
+file_mapped 3
+pgfault 4
+pgmajfault 6
+inactive_anon 7
+active_anon 8
+inactive_file 9
+active_file 10
+unevictable 11
+`)
+
+			Ω(cgroupsManager.Get("memory", "memory.stat")).Should(Equal(`cache 2
+rss 1
+mapped_file 3
+pgfault 4
+pgmajfault 6
+inactive_anon 7
+active_anon 8
+inactive_file 9
+active_file 10
+unevictable 11
+swap 5
+total_cache 2
+total_rss 1
+total_mapped_file 3
+total_pgfault 4
+total_pgmajfault 6
+total_inactive_anon 7
+total_active_anon 8
+total_inactive_file 9
+total_active_file 10
+total_unevictable 11
+total_swap 5
+hierarchical_memory_limit 4096`))
+		})
+	})
+
+	Describe("cpu", func() {
+		BeforeEach(func() {
+			writeFile("cpu.max", "max 100000\n")
+		})
+
+		It("maps cpu.shares onto cpu.weight and back", func() {
+			err := cgroupsManager.Set("cpu", "cpu.shares", "262144")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(readFile("cpu.weight")).Should(Equal("10000"))
+			Ω(cgroupsManager.Get("cpu", "cpu.shares")).Should(Equal("262144"))
+
+			err = cgroupsManager.Set("cpu", "cpu.shares", "2")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(readFile("cpu.weight")).Should(Equal("1"))
+			Ω(cgroupsManager.Get("cpu", "cpu.shares")).Should(Equal("2"))
+		})
+
+		It("reports the cpu.shares last set as they were given", func() {
+			err := cgroupsManager.Set("cpu", "cpu.shares", "512")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(readFile("cpu.weight")).Should(Equal("20"))
+			Ω(cgroupsManager.Get("cpu", "cpu.shares")).Should(Equal("512"))
+		})
+
+		Context("when cpu.weight is changed behind its back", func() {
+			It("maps cpu.weight back onto cpu.shares", func() {
+				err := cgroupsManager.Set("cpu", "cpu.shares", "512")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				writeFile("cpu.weight", "10000\n")
+
+				Ω(cgroupsManager.Get("cpu", "cpu.shares")).Should(Equal("262144"))
+			})
+		})
+
+		It("sets the quota and period in cpu.max", func() {
+			err := cgroupsManager.Set("cpu", "cpu.cfs_period_us", "200000")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(readFile("cpu.max")).Should(Equal("max 200000"))
+
+			err = cgroupsManager.Set("cpu", "cpu.cfs_quota_us", "50000")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(readFile("cpu.max")).Should(Equal("50000 200000"))
+
+			Ω(cgroupsManager.Get("cpu", "cpu.cfs_quota_us")).Should(Equal("50000"))
+			Ω(cgroupsManager.Get("cpu", "cpu.cfs_period_us")).Should(Equal("200000"))
+
+			err = cgroupsManager.Set("cpu", "cpu.cfs_quota_us", "-1")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(readFile("cpu.max")).Should(Equal("max 200000"))
+			Ω(cgroupsManager.Get("cpu", "cpu.cfs_quota_us")).Should(Equal("-1"))
+		})
+
+		It("reports cpu.stat as cpuacct.usage and cpuacct.stat", func() {
+			writeFile("cpu.stat", `usage_usec 1500000
+user_usec 1000000
+system_usec 500000
+`)
+
+			Ω(cgroupsManager.Get("cpuacct", "cpuacct.usage")).Should(Equal("1500000000"))
+			Ω(cgroupsManager.Get("cpuacct", "cpuacct.stat")).Should(Equal("user 100\nsystem 50"))
+		})
+	})
+
+	Describe("freezer", func() {
+		It("freezes and thaws with cgroup.freeze", func() {
+			err := cgroupsManager.Set("freezer", "freezer.state", "FROZEN")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(readFile("cgroup.freeze")).Should(Equal("1"))
+
+			err = cgroupsManager.Set("freezer", "freezer.state", "THAWED")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(readFile("cgroup.freeze")).Should(Equal("0"))
+		})
+
+		It("reports the state from cgroup.events", func() {
+			writeFile("cgroup.events", "populated 1\nfrozen 1\n")
+			Ω(cgroupsManager.Get("freezer", "freezer.state")).Should(Equal("FROZEN"))
+
+			writeFile("cgroup.events", "populated 1\nfrozen 0\n")
+			Ω(cgroupsManager.Get("freezer", "freezer.state")).Should(Equal("THAWED"))
+		})
+	})
+
+	Describe("block I/O", func() {
+		It("maps blkio.weight onto io.weight", func() {
+			err := cgroupsManager.Set("blkio", "blkio.weight", "1000")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(readFile("io.weight")).Should(Equal("default 10000"))
+		})
+
+		It("writes throttles to io.max", func() {
+			err := cgroupsManager.Set("blkio", "blkio.throttle.write_iops_device", "8:0 100")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(readFile("io.max")).Should(Equal("8:0 wiops=100"))
+
+			err = cgroupsManager.Set("blkio", "blkio.throttle.read_bps_device", "8:0 0")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(readFile("io.max")).Should(Equal("8:0 rbps=max"))
+		})
+
+		It("reports io.stat in the cgroup v1 format", func() {
+			writeFile("io.stat", "8:0 rbytes=1024 wbytes=2048 rios=1 wios=2 dbytes=0 dios=0\n")
+
+			Ω(cgroupsManager.Get("blkio", "blkio.throttle.io_service_bytes")).Should(Equal("8:0 Read 1024\n8:0 Write 2048"))
+			Ω(cgroupsManager.Get("blkio", "blkio.throttle.io_serviced")).Should(Equal("8:0 Read 1\n8:0 Write 2"))
+		})
+	})
+
+	Describe("detecting the unified hierarchy", func() {
+		It("is false for other filesystems", func() {
+			Ω(cgroups_manager.IsUnified(cgroupsPath)).Should(BeFalse())
+		})
+
+		Context("when the path does not exist", func() {
+			It("is false", func() {
+				Ω(cgroups_manager.IsUnified(path.Join(cgroupsPath, "nope"))).Should(BeFalse())
+			})
+		})
+
+		Context("when the path cannot be looked up", func() {
+			It("returns an error", func() {
+				err := ioutil.WriteFile(path.Join(cgroupsPath, "some-file"), []byte{}, 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = cgroups_manager.IsUnified(path.Join(cgroupsPath, "some-file", "nope"))
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+})
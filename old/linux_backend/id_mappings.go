@@ -0,0 +1,97 @@
+package linux_backend
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IDMap maps Size IDs of a container's user namespace, from ContainerID on,
+// to host IDs from HostID on, as a line of /proc/<pid>/uid_map does.
+type IDMap struct {
+	ContainerID uint32 `json:"container_id"`
+	HostID      uint32 `json:"host_id"`
+	Size        uint32 `json:"size"`
+}
+
+type IDMappings []IDMap
+
+// SingleIDMappings map only the container's root to rootID and its user to
+// the same ID on the host, for containers without a range of subordinate
+// IDs.
+func SingleIDMappings(rootID, userID uint32) IDMappings {
+	return IDMappings{
+		{ContainerID: 0, HostID: rootID, Size: 1},
+		{ContainerID: userID, HostID: userID, Size: 1},
+	}
+}
+
+// RangeIDMappings map the first size IDs of the container to the range of
+// host IDs starting at start, except for the container's user, which keeps
+// its ID so that e.g. disk quotas for it still apply.
+func RangeIDMappings(start, size, userID uint32) IDMappings {
+	if userID >= size {
+		return IDMappings{
+			{ContainerID: 0, HostID: start, Size: size},
+			{ContainerID: userID, HostID: userID, Size: 1},
+		}
+	}
+
+	mappings := IDMappings{}
+
+	if userID > 0 {
+		mappings = append(mappings, IDMap{ContainerID: 0, HostID: start, Size: userID})
+	}
+
+	mappings = append(mappings, IDMap{ContainerID: userID, HostID: userID, Size: 1})
+
+	if userID+1 < size {
+		mappings = append(mappings, IDMap{ContainerID: userID + 1, HostID: start + userID + 1, Size: size - userID - 1})
+	}
+
+	return mappings
+}
+
+// HostID translates an ID of the container to the host.
+func (m IDMappings) HostID(containerID uint32) (uint32, bool) {
+	for _, mapping := range m {
+		if containerID >= mapping.ContainerID && containerID-mapping.ContainerID < mapping.Size {
+			return mapping.HostID + containerID - mapping.ContainerID, true
+		}
+	}
+
+	return 0, false
+}
+
+// ContainerID translates an ID of the host to the container.
+func (m IDMappings) ContainerID(hostID uint32) (uint32, bool) {
+	for _, mapping := range m {
+		if hostID >= mapping.HostID && hostID-mapping.HostID < mapping.Size {
+			return mapping.ContainerID + hostID - mapping.HostID, true
+		}
+	}
+
+	return 0, false
+}
+
+// String is the mappings in the format of /proc/<pid>/uid_map, with a line
+// per mapping.
+func (m IDMappings) String() string {
+	lines := make([]string, len(m))
+	for i, mapping := range m {
+		lines[i] = fmt.Sprintf("%d %d %d", mapping.ContainerID, mapping.HostID, mapping.Size)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// MountIDMap is the value of mount's X-mount.idmap option which has files
+// of a bind mount owned by a host ID appear owned by the same ID in the
+// container, e.g. root's files owned by the container's root.
+func (m IDMappings) MountIDMap(idType string) string {
+	maps := make([]string, len(m))
+	for i, mapping := range m {
+		maps[i] = fmt.Sprintf("%s:%d:%d:%d", idType, mapping.HostID, mapping.ContainerID, mapping.Size)
+	}
+
+	return strings.Join(maps, " ")
+}
@@ -0,0 +1,84 @@
+package linux_backend_test
+
+import (
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ID mappings", func() {
+	Describe("SingleIDMappings", func() {
+		It("maps the container's root and user", func() {
+			mappings := linux_backend.SingleIDMappings(10001, 10000)
+
+			Ω(mappings.String()).Should(Equal("0 10001 1\n10000 10000 1"))
+		})
+	})
+
+	Describe("RangeIDMappings", func() {
+		It("maps the range around the container's user", func() {
+			mappings := linux_backend.RangeIDMappings(100000, 65536, 10000)
+
+			Ω(mappings.String()).Should(Equal("0 100000 10000\n10000 10000 1\n10001 110001 55535"))
+		})
+
+		Context("when the user is outside the range", func() {
+			It("maps the whole range and the user", func() {
+				mappings := linux_backend.RangeIDMappings(100000, 1000, 10000)
+
+				Ω(mappings.String()).Should(Equal("0 100000 1000\n10000 10000 1"))
+			})
+		})
+
+		Context("when the user is the last id of the range", func() {
+			It("does not map an empty range after it", func() {
+				mappings := linux_backend.RangeIDMappings(100000, 10001, 10000)
+
+				Ω(mappings.String()).Should(Equal("0 100000 10000\n10000 10000 1"))
+			})
+		})
+	})
+
+	Describe("translating ids", func() {
+		mappings := linux_backend.RangeIDMappings(100000, 65536, 10000)
+
+		hostID := func(containerID uint32) uint32 {
+			id, ok := mappings.HostID(containerID)
+			Ω(ok).Should(BeTrue())
+			return id
+		}
+
+		containerID := func(hostID uint32) uint32 {
+			id, ok := mappings.ContainerID(hostID)
+			Ω(ok).Should(BeTrue())
+			return id
+		}
+
+		It("translates container ids to the host", func() {
+			Ω(hostID(0)).Should(Equal(uint32(100000)))
+			Ω(hostID(10000)).Should(Equal(uint32(10000)))
+			Ω(hostID(10001)).Should(Equal(uint32(110001)))
+
+			_, ok := mappings.HostID(65536)
+			Ω(ok).Should(BeFalse())
+		})
+
+		It("translates host ids to the container", func() {
+			Ω(containerID(100000)).Should(Equal(uint32(0)))
+			Ω(containerID(10000)).Should(Equal(uint32(10000)))
+			Ω(containerID(110001)).Should(Equal(uint32(10001)))
+
+			_, ok := mappings.ContainerID(0)
+			Ω(ok).Should(BeFalse())
+		})
+	})
+
+	Describe("MountIDMap", func() {
+		It("maps host ids to the container's ids", func() {
+			mappings := linux_backend.SingleIDMappings(10001, 10000)
+
+			Ω(mappings.MountIDMap("u")).Should(Equal("u:10001:0:1 u:10000:10000:1"))
+		})
+	})
+})
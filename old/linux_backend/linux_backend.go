@@ -6,11 +6,14 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/events"
 	"github.com/cloudfoundry-incubator/garden-linux/old/system_info"
+	"github.com/cloudfoundry-incubator/garden-linux/process_tracker"
 	"github.com/pivotal-golang/lager"
 )
 
@@ -24,6 +27,36 @@ type Container interface {
 	Snapshot(io.Writer) error
 	Cleanup()
 
+	Subscribe() *events.Subscription
+
+	// InfoWithDiskStat is Info using already gathered disk usage.
+	InfoWithDiskStat(garden.ContainerDiskStat) (garden.ContainerInfo, error)
+
+	// CommittedResources reports the memory and disk limits given to the
+	// container.
+	CommittedResources() CommittedResources
+
+	// OnPropertiesChange registers a callback invoked with the container's
+	// properties straight away and then whenever they change, serialized
+	// with the changes.
+	OnPropertiesChange(func(garden.Properties))
+
+	// OnLimitsIncrease registers a callback which must admit any increase
+	// of the container's memory or disk limits before it is made. It returns
+	// a function releasing what it reserved once the new limits are
+	// committed.
+	OnLimitsIncrease(func(increase CommittedResources) (release func(), err error))
+
+	// ProcessLog writes the log of one of the container's processes to out.
+	ProcessLog(processID uint32, request process_tracker.LogRequest, out io.Writer) error
+
+	// SignalProcess sends any signal to one of the container's processes.
+	SignalProcess(processID uint32, request process_tracker.SignalRequest) error
+
+	// RecordDiskUsage gives the container its disk usage, as sampled for
+	// every container at once by the backend.
+	RecordDiskUsage(garden.ContainerDiskStat)
+
 	garden.Container
 }
 
@@ -34,6 +67,21 @@ type ContainerPool interface {
 	Destroy(Container) error
 	Prune(keep map[string]bool) error
 	MaxContainers() int
+
+	// DiskUsage gathers the disk usage of the containers at once, keyed
+	// by container ID.
+	DiskUsage([]Container) (map[string]garden.ContainerDiskStat, error)
+}
+
+// Maximum number of containers BulkInfo gathers info for at the same time.
+const BulkInfoParallelism = 16
+
+// How often the disk usage of every container is sampled, in one pass.
+const DiskUsageSampleInterval = 10 * time.Second
+
+type ContainerInfoEntry struct {
+	Info garden.ContainerInfo
+	Err  error
 }
 
 type LinuxBackend struct {
@@ -43,8 +91,31 @@ type LinuxBackend struct {
 	systemInfo    system_info.Provider
 	snapshotsPath string
 
+	snapshotInterval time.Duration
+	stopSnapshotting chan struct{}
+	snapshotting     *sync.WaitGroup
+
+	diskUsageInterval     time.Duration
+	stopSamplingDiskUsage chan struct{}
+	samplingDiskUsage     *sync.WaitGroup
+
+	// serializes writing and removing snapshots
+	snapshotsMutex *sync.Mutex
+
 	containers      map[string]Container
 	containersMutex *sync.RWMutex
+
+	propertyIndex *propertyIndex
+
+	// guarded by containersMutex
+	draining bool
+	creating int
+
+	admissionPolicy  AdmissionPolicy
+	pendingResources CommittedResources
+	admissionMutex   *sync.Mutex
+
+	eventHub *events.Hub
 }
 
 type HandleExistsError struct {
@@ -55,6 +126,20 @@ func (e HandleExistsError) Error() string {
 	return fmt.Sprintf("handle already exists: %s", e.Handle)
 }
 
+type DrainingError struct{}
+
+func (e DrainingError) Error() string {
+	return "backend is draining: not accepting new containers"
+}
+
+type DrainStatus struct {
+	Draining   bool `json:"draining"`
+	Containers int  `json:"containers"`
+
+	// Drained is true once draining and every container is gone.
+	Drained bool `json:"drained"`
+}
+
 type FailedToSnapshotError struct {
 	OriginalError error
 }
@@ -71,8 +156,22 @@ func New(logger lager.Logger, containerPool ContainerPool, systemInfo system_inf
 		systemInfo:    systemInfo,
 		snapshotsPath: snapshotsPath,
 
+		stopSnapshotting: make(chan struct{}),
+		snapshotting:     new(sync.WaitGroup),
+		snapshotsMutex:   new(sync.Mutex),
+
+		diskUsageInterval:     DiskUsageSampleInterval,
+		stopSamplingDiskUsage: make(chan struct{}),
+		samplingDiskUsage:     new(sync.WaitGroup),
+
 		containers:      make(map[string]Container),
 		containersMutex: new(sync.RWMutex),
+
+		propertyIndex: newPropertyIndex(),
+
+		admissionMutex: new(sync.Mutex),
+
+		eventHub: events.NewHub(),
 	}
 }
 
@@ -80,20 +179,46 @@ func (b *LinuxBackend) Setup() error {
 	return b.containerPool.Setup()
 }
 
+// SetSnapshotInterval has the backend snapshot every container periodically
+// once started, besides on creating and destroying them, so that changes
+// made to a container since are not lost to a crash. Zero disables it.
+func (b *LinuxBackend) SetSnapshotInterval(interval time.Duration) {
+	b.snapshotInterval = interval
+}
+
+// SetDiskUsageInterval changes how often the disk usage of every container
+// is sampled, DiskUsageSampleInterval by default.
+func (b *LinuxBackend) SetDiskUsageInterval(interval time.Duration) {
+	b.diskUsageInterval = interval
+}
+
 func (b *LinuxBackend) Start() error {
+	var rejected []string
+
 	if b.snapshotsPath != "" {
 		_, err := os.Stat(b.snapshotsPath)
 		if err == nil {
-			b.restoreSnapshots()
-			os.RemoveAll(b.snapshotsPath)
+			rejected = b.restoreSnapshots()
 		}
 
 		err = os.MkdirAll(b.snapshotsPath, 0755)
 		if err != nil {
 			return err
 		}
+
+		// bring the restored containers' snapshots up to date, e.g. with
+		// the current snapshot version
+		b.saveSnapshots()
+
+		if b.snapshotInterval > 0 {
+			b.snapshotting.Add(1)
+			go b.snapshotPeriodically()
+		}
 	}
 
+	b.samplingDiskUsage.Add(1)
+	go b.sampleDiskUsagePeriodically()
+
 	keep := map[string]bool{}
 
 	b.containersMutex.RLock()
@@ -104,13 +229,56 @@ func (b *LinuxBackend) Start() error {
 		keep[container.ID()] = true
 	}
 
+	// left for an operator to look into
+	for _, id := range rejected {
+		keep[id] = true
+	}
+
 	return b.containerPool.Prune(keep)
 }
 
+// Ping keeps succeeding while draining, so that the existing containers are
+// still looked after; draining shows in Capacity and DrainStatus instead.
 func (b *LinuxBackend) Ping() error {
 	return nil
 }
 
+// Drain makes Create fail with DrainingError, leaving the existing containers
+// running. Once they are all destroyed a drained event is published.
+func (b *LinuxBackend) Drain() {
+	b.containersMutex.Lock()
+	wasDraining := b.draining
+	b.draining = true
+	b.containersMutex.Unlock()
+
+	if !wasDraining {
+		b.logger.Info("draining")
+		b.checkDrained()
+	}
+}
+
+func (b *LinuxBackend) Undrain() {
+	b.containersMutex.Lock()
+	wasDraining := b.draining
+	b.draining = false
+	b.containersMutex.Unlock()
+
+	if wasDraining {
+		b.logger.Info("undrained")
+	}
+}
+
+func (b *LinuxBackend) DrainStatus() DrainStatus {
+	b.containersMutex.RLock()
+	defer b.containersMutex.RUnlock()
+
+	return DrainStatus{
+		Draining:   b.draining,
+		Containers: len(b.containers),
+		Drained:    b.draining && len(b.containers) == 0 && b.creating == 0,
+	}
+}
+
 func (b *LinuxBackend) Capacity() (garden.Capacity, error) {
 	totalMemory, err := b.systemInfo.TotalMemory()
 	if err != nil {
@@ -122,37 +290,113 @@ func (b *LinuxBackend) Capacity() (garden.Capacity, error) {
 		return garden.Capacity{}, err
 	}
 
+	maxContainers := uint64(b.containerPool.MaxContainers())
+
+	// no room for new containers while draining
+	if b.DrainStatus().Draining {
+		maxContainers = 0
+	}
+
 	return garden.Capacity{
 		MemoryInBytes: totalMemory,
 		DiskInBytes:   totalDisk,
-		MaxContainers: uint64(b.containerPool.MaxContainers()),
+		MaxContainers: maxContainers,
+	}, nil
+}
+
+// LinuxCapacity is Capacity along with the resources committed to containers
+// and those left to commit.
+func (b *LinuxBackend) LinuxCapacity() (LinuxCapacity, error) {
+	capacity, err := b.Capacity()
+	if err != nil {
+		return LinuxCapacity{}, err
+	}
+
+	b.admissionMutex.Lock()
+	policy := b.admissionPolicy
+	committed := b.committedResources()
+	b.admissionMutex.Unlock()
+
+	return LinuxCapacity{
+		Capacity: capacity,
+
+		CommittedMemoryInBytes: committed.MemoryInBytes,
+		CommittedDiskInBytes:   committed.DiskInBytes,
+
+		FreeMemoryInBytes: free(capacity.MemoryInBytes, policy.MemoryOvercommitRatio, committed.MemoryInBytes),
+		FreeDiskInBytes:   free(capacity.DiskInBytes, policy.DiskOvercommitRatio, committed.DiskInBytes),
 	}, nil
 }
 
+// SetAdmissionPolicy makes Create refuse containers whose memory or disk
+// limits would exceed what the policy leaves free.
+func (b *LinuxBackend) SetAdmissionPolicy(policy AdmissionPolicy) {
+	b.admissionMutex.Lock()
+	defer b.admissionMutex.Unlock()
+
+	b.admissionPolicy = policy
+}
+
 func (b *LinuxBackend) Create(spec garden.ContainerSpec) (garden.Container, error) {
-	if spec.Handle != "" {
-		b.containersMutex.RLock()
-		_, exists := b.containers[spec.Handle]
-		b.containersMutex.RUnlock()
+	b.containersMutex.Lock()
+	_, exists := b.containers[spec.Handle]
+	draining := b.draining
+	if !draining {
+		b.creating++
+	}
+	b.containersMutex.Unlock()
 
-		if exists {
-			return nil, HandleExistsError{Handle: spec.Handle}
-		}
+	if draining {
+		return nil, DrainingError{}
+	}
+
+	// containers still being created when draining starts hold off the
+	// drained event until they are done
+	defer func() {
+		b.containersMutex.Lock()
+		b.creating--
+		b.containersMutex.Unlock()
+
+		b.checkDrained()
+	}()
+
+	if spec.Handle != "" && exists {
+		return nil, HandleExistsError{Handle: spec.Handle}
 	}
 
+	requested, err := requestedResources(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.admit(requested)
+	if err != nil {
+		return nil, err
+	}
+
+	defer b.release(requested)
+
 	container, err := b.containerPool.Create(spec)
 	if err != nil {
 		return nil, err
 	}
 
+	subscription := b.forwardEvents(container)
+
 	err = container.Start()
 	if err != nil {
+		subscription.Close()
 		return nil, err
 	}
 
-	b.containersMutex.Lock()
-	b.containers[container.Handle()] = container
-	b.containersMutex.Unlock()
+	b.track(container)
+
+	err = b.saveSnapshot(container)
+	if err != nil {
+		b.logger.Error("failed-to-save-snapshot", err, lager.Data{
+			"container": container.ID(),
+		})
+	}
 
 	return container, nil
 }
@@ -175,17 +419,28 @@ func (b *LinuxBackend) Destroy(handle string) error {
 	delete(b.containers, container.Handle())
 	b.containersMutex.Unlock()
 
+	b.propertyIndex.Remove(container.Handle())
+
+	b.removeSnapshot(container)
+
+	b.checkDrained()
+
 	return nil
 }
 
-func (b *LinuxBackend) Containers(filter garden.Properties) (containers []garden.Container, err error) {
-	b.containersMutex.RLock()
-	defer b.containersMutex.RUnlock()
+func (b *LinuxBackend) Containers(filter garden.Properties) ([]garden.Container, error) {
+	filters := make([]PropertyFilter, 0, len(filter))
+	for key, value := range filter {
+		filters = append(filters, EqualsFilter(key, value))
+	}
 
-	for _, container := range b.containers {
-		if containerHasProperties(container, filter) {
-			containers = append(containers, container)
-		}
+	return b.ContainersMatching(filters)
+}
+
+// ContainersMatching returns the containers matching every filter.
+func (b *LinuxBackend) ContainersMatching(filters []PropertyFilter) (containers []garden.Container, err error) {
+	for _, container := range b.propertyIndex.Find(filters) {
+		containers = append(containers, container)
 	}
 
 	return containers, nil
@@ -203,16 +458,216 @@ func (b *LinuxBackend) Lookup(handle string) (garden.Container, error) {
 	return container, nil
 }
 
+// ProcessLog writes the log of a process in the container with the given
+// handle to out.
+func (b *LinuxBackend) ProcessLog(handle string, processID uint32, request process_tracker.LogRequest, out io.Writer) error {
+	b.containersMutex.RLock()
+	container, found := b.containers[handle]
+	b.containersMutex.RUnlock()
+
+	if !found {
+		return garden.ContainerNotFoundError{handle}
+	}
+
+	return container.ProcessLog(processID, request, out)
+}
+
+// SignalProcess sends any signal to a process in the container with the
+// given handle.
+func (b *LinuxBackend) SignalProcess(handle string, processID uint32, request process_tracker.SignalRequest) error {
+	b.containersMutex.RLock()
+	container, found := b.containers[handle]
+	b.containersMutex.RUnlock()
+
+	if !found {
+		return garden.ContainerNotFoundError{handle}
+	}
+
+	return container.SignalProcess(processID, request)
+}
+
+// BulkInfo gathers info for many containers at once, with a single disk
+// usage lookup for all of them. A handle that cannot be looked up or whose
+// info fails gets an entry with Err set.
+func (b *LinuxBackend) BulkInfo(handles []string) (map[string]ContainerInfoEntry, error) {
+	bLog := b.logger.Session("bulk-info", lager.Data{
+		"handles": len(handles),
+	})
+
+	entries := make(map[string]ContainerInfoEntry, len(handles))
+
+	containers := []Container{}
+
+	b.containersMutex.RLock()
+	for _, handle := range handles {
+		container, found := b.containers[handle]
+		if !found {
+			entries[handle] = ContainerInfoEntry{
+				Err: garden.ContainerNotFoundError{handle},
+			}
+
+			continue
+		}
+
+		containers = append(containers, container)
+	}
+	b.containersMutex.RUnlock()
+
+	diskUsage, err := b.containerPool.DiskUsage(containers)
+	if err != nil {
+		// fall back to each container looking up its own usage, so that
+		// one bad container does not fail the rest
+		bLog.Error("failed-to-get-disk-usage", err)
+		diskUsage = nil
+	}
+
+	var entriesMutex sync.Mutex
+	var wg sync.WaitGroup
+
+	work := make(chan Container)
+
+	for i := 0; i < BulkInfoParallelism && i < len(containers); i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for container := range work {
+				var info garden.ContainerInfo
+				var err error
+
+				if diskStat, found := diskUsage[container.ID()]; found {
+					info, err = container.InfoWithDiskStat(diskStat)
+				} else {
+					info, err = container.Info()
+				}
+
+				entriesMutex.Lock()
+				entries[container.Handle()] = ContainerInfoEntry{
+					Info: info,
+					Err:  err,
+				}
+				entriesMutex.Unlock()
+			}
+		}()
+	}
+
+	for _, container := range containers {
+		work <- container
+	}
+
+	close(work)
+
+	wg.Wait()
+
+	return entries, nil
+}
+
+// Subscribe returns a subscription to the events of every container managed
+// by the backend.
+func (b *LinuxBackend) Subscribe() *events.Subscription {
+	return b.eventHub.Subscribe()
+}
+
 func (b *LinuxBackend) GraceTime(container garden.Container) time.Duration {
 	return container.(Container).GraceTime()
 }
 
 func (b *LinuxBackend) Stop() {
+	select {
+	case <-b.stopSnapshotting:
+	default:
+		close(b.stopSnapshotting)
+	}
+
+	b.snapshotting.Wait()
+
+	select {
+	case <-b.stopSamplingDiskUsage:
+	default:
+		close(b.stopSamplingDiskUsage)
+	}
+
+	b.samplingDiskUsage.Wait()
+
+	for _, container := range b.trackedContainers() {
+		container.Cleanup()
+		err := b.saveSnapshot(container)
+		if err != nil {
+			b.logger.Error("failed-to-save-snapshot", err, lager.Data{
+				"container": container.ID(),
+			})
+		}
+	}
+}
+
+func (b *LinuxBackend) trackedContainers() []Container {
 	b.containersMutex.RLock()
 	defer b.containersMutex.RUnlock()
 
+	containers := make([]Container, 0, len(b.containers))
 	for _, container := range b.containers {
-		container.Cleanup()
+		containers = append(containers, container)
+	}
+
+	return containers
+}
+
+func (b *LinuxBackend) snapshotPeriodically() {
+	defer b.snapshotting.Done()
+
+	ticker := time.NewTicker(b.snapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.saveSnapshots()
+		case <-b.stopSnapshotting:
+			return
+		}
+	}
+}
+
+func (b *LinuxBackend) sampleDiskUsagePeriodically() {
+	defer b.samplingDiskUsage.Done()
+
+	ticker := time.NewTicker(b.diskUsageInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.sampleDiskUsage()
+		case <-b.stopSamplingDiskUsage:
+			return
+		}
+	}
+}
+
+// sampleDiskUsage gathers the disk usage of every container in one pass,
+// rather than each container looking up its own.
+func (b *LinuxBackend) sampleDiskUsage() {
+	containers := b.trackedContainers()
+	if len(containers) == 0 {
+		return
+	}
+
+	diskUsage, err := b.containerPool.DiskUsage(containers)
+	if err != nil {
+		b.logger.Error("failed-to-sample-disk-usage", err)
+		return
+	}
+
+	for _, container := range containers {
+		if diskStat, found := diskUsage[container.ID()]; found {
+			container.RecordDiskUsage(diskStat)
+		}
+	}
+}
+
+func (b *LinuxBackend) saveSnapshots() {
+	for _, container := range b.trackedContainers() {
 		err := b.saveSnapshot(container)
 		if err != nil {
 			b.logger.Error("failed-to-save-snapshot", err, lager.Data{
@@ -222,9 +677,14 @@ func (b *LinuxBackend) Stop() {
 	}
 }
 
-func (b *LinuxBackend) restoreSnapshots() {
+// restoreSnapshots restores the containers of the snapshots, returning the
+// IDs of those whose snapshots were rejected. A rejected snapshot is moved
+// aside as <id>.rejected rather than restored again.
+func (b *LinuxBackend) restoreSnapshots() []string {
 	sLog := b.logger.Session("restore")
 
+	rejected := []string{}
+
 	entries, err := ioutil.ReadDir(b.snapshotsPath)
 	if err != nil {
 		b.logger.Error("failed-to-read-snapshots", err, lager.Data{
@@ -239,18 +699,43 @@ func (b *LinuxBackend) restoreSnapshots() {
 			"snapshot": entry.Name(),
 		})
 
+		// left behind by a snapshot interrupted part way through
+		if strings.HasPrefix(entry.Name(), ".") {
+			removeSnapshotFile(lLog, snapshot)
+			continue
+		}
+
+		if strings.HasSuffix(entry.Name(), rejectedSnapshotSuffix) {
+			rejected = append(rejected, strings.TrimSuffix(entry.Name(), rejectedSnapshotSuffix))
+			continue
+		}
+
 		lLog.Debug("loading")
 
 		file, err := os.Open(snapshot)
 		if err != nil {
 			lLog.Error("failed-to-open", err)
+			rejected = append(rejected, entry.Name())
+			continue
 		}
 
 		_, err = b.restore(file)
+
+		file.Close()
+
 		if err != nil {
 			lLog.Error("failed-to-restore", err)
+
+			rejected = append(rejected, entry.Name())
+
+			err := os.Rename(snapshot, snapshot+rejectedSnapshotSuffix)
+			if err != nil {
+				lLog.Error("failed-to-reject", err)
+			}
 		}
 	}
+
+	return rejected
 }
 
 func (b *LinuxBackend) saveSnapshot(container Container) error {
@@ -258,23 +743,100 @@ func (b *LinuxBackend) saveSnapshot(container Container) error {
 		return nil
 	}
 
-	b.logger.Info("save-snapshot", lager.Data{
+	b.snapshotsMutex.Lock()
+	defer b.snapshotsMutex.Unlock()
+
+	// a container destroyed since it was listed must not be brought back
+	// by its snapshot
+	b.containersMutex.RLock()
+	tracked := b.containers[container.Handle()] == container
+	b.containersMutex.RUnlock()
+
+	if !tracked {
+		return nil
+	}
+
+	b.logger.Debug("save-snapshot", lager.Data{
 		"container": container.ID(),
 	})
 
 	snapshotPath := path.Join(b.snapshotsPath, container.ID())
 
-	snapshot, err := os.Create(snapshotPath)
+	// written aside and renamed into place, so that a crash part way
+	// through leaves the previous snapshot rather than a truncated one
+	snapshot, err := ioutil.TempFile(b.snapshotsPath, "."+container.ID()+"-")
 	if err != nil {
 		return &FailedToSnapshotError{err}
 	}
 
+	defer os.Remove(snapshot.Name())
+
 	err = container.Snapshot(snapshot)
+	if err != nil {
+		snapshot.Close()
+		return &FailedToSnapshotError{err}
+	}
+
+	err = snapshot.Sync()
+	if err != nil {
+		snapshot.Close()
+		return &FailedToSnapshotError{err}
+	}
+
+	err = snapshot.Close()
+	if err != nil {
+		return &FailedToSnapshotError{err}
+	}
+
+	err = os.Rename(snapshot.Name(), snapshotPath)
 	if err != nil {
 		return &FailedToSnapshotError{err}
 	}
 
-	return snapshot.Close()
+	// the rename is only durable once the directory is synced too
+	err = syncDir(b.snapshotsPath)
+	if err != nil {
+		return &FailedToSnapshotError{err}
+	}
+
+	return nil
+}
+
+func (b *LinuxBackend) removeSnapshot(container Container) {
+	if b.snapshotsPath == "" {
+		return
+	}
+
+	b.snapshotsMutex.Lock()
+	defer b.snapshotsMutex.Unlock()
+
+	err := os.Remove(path.Join(b.snapshotsPath, container.ID()))
+	if err != nil && !os.IsNotExist(err) {
+		b.logger.Error("failed-to-remove-snapshot", err, lager.Data{
+			"container": container.ID(),
+		})
+	}
+}
+
+// Suffix of snapshots which failed to be restored.
+const rejectedSnapshotSuffix = ".rejected"
+
+func removeSnapshotFile(logger lager.Logger, snapshot string) {
+	err := os.Remove(snapshot)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Error("failed-to-remove", err)
+	}
+}
+
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return file.Sync()
 }
 
 func (b *LinuxBackend) restore(snapshot io.Reader) (garden.Container, error) {
@@ -283,26 +845,121 @@ func (b *LinuxBackend) restore(snapshot io.Reader) (garden.Container, error) {
 		return nil, err
 	}
 
-	b.containersMutex.Lock()
-	b.containers[container.Handle()] = container
-	b.containersMutex.Unlock()
+	b.forwardEvents(container)
+
+	b.track(container)
 
 	return container, nil
 }
 
-func containerHasProperties(container Container, properties garden.Properties) bool {
-	containerProps := container.Properties()
+func (b *LinuxBackend) track(container Container) {
+	handle := container.Handle()
 
-	for key, val := range properties {
-		cval, ok := containerProps[key]
-		if !ok {
-			return false
+	// the properties are indexed by the callback, which is called with them
+	// under the same lock as SetProperty, rather than read here, where a
+	// property set meanwhile would be lost
+	b.propertyIndex.Add(container, nil)
+
+	container.OnPropertiesChange(func(properties garden.Properties) {
+		b.propertyIndex.Update(handle, properties)
+	})
+
+	// limits raised after creation are subject to admission just as those
+	// given at creation
+	container.OnLimitsIncrease(func(increase CommittedResources) (func(), error) {
+		err := b.admit(increase)
+		if err != nil {
+			return nil, err
 		}
 
-		if cval != val {
-			return false
+		return func() { b.release(increase) }, nil
+	})
+
+	b.containersMutex.Lock()
+	b.containers[handle] = container
+	b.containersMutex.Unlock()
+}
+
+// admit reserves the requested resources until released, failing when the
+// admission policy leaves too little free
+func (b *LinuxBackend) admit(requested CommittedResources) error {
+	b.admissionMutex.Lock()
+	defer b.admissionMutex.Unlock()
+
+	policy := b.admissionPolicy
+
+	if policy.MemoryOvercommitRatio != 0 || policy.DiskOvercommitRatio != 0 {
+		committed := b.committedResources()
+
+		if policy.MemoryOvercommitRatio != 0 {
+			totalMemory, err := b.systemInfo.TotalMemory()
+			if err != nil {
+				return err
+			}
+
+			freeMemory := free(totalMemory, policy.MemoryOvercommitRatio, committed.MemoryInBytes)
+			if requested.MemoryInBytes > freeMemory {
+				return InsufficientCapacityError{"memory", requested.MemoryInBytes, freeMemory}
+			}
+		}
+
+		if policy.DiskOvercommitRatio != 0 {
+			totalDisk, err := b.systemInfo.TotalDisk()
+			if err != nil {
+				return err
+			}
+
+			freeDisk := free(totalDisk, policy.DiskOvercommitRatio, committed.DiskInBytes)
+			if requested.DiskInBytes > freeDisk {
+				return InsufficientCapacityError{"disk", requested.DiskInBytes, freeDisk}
+			}
 		}
 	}
 
-	return true
+	b.pendingResources = b.pendingResources.add(requested)
+
+	return nil
+}
+
+func (b *LinuxBackend) release(requested CommittedResources) {
+	b.admissionMutex.Lock()
+	defer b.admissionMutex.Unlock()
+
+	b.pendingResources = b.pendingResources.sub(requested)
+}
+
+// must be called with admissionMutex held
+func (b *LinuxBackend) committedResources() CommittedResources {
+	committed := b.pendingResources
+
+	b.containersMutex.RLock()
+	defer b.containersMutex.RUnlock()
+
+	for _, container := range b.containers {
+		committed = committed.add(container.CommittedResources())
+	}
+
+	return committed
+}
+
+func (b *LinuxBackend) checkDrained() {
+	if !b.DrainStatus().Drained {
+		return
+	}
+
+	b.logger.Info("drained")
+
+	b.eventHub.Publish(events.New(events.TypeDrained, "", nil))
+}
+
+func (b *LinuxBackend) forwardEvents(container Container) *events.Subscription {
+	subscription := container.Subscribe()
+
+	go func() {
+		for event := range subscription.Events() {
+			b.eventHub.Publish(event)
+		}
+	}()
+
+	return subscription
 }
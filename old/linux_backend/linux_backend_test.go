@@ -1,10 +1,13 @@
 package linux_backend_test
 
 import (
+	"bytes"
 	"errors"
 	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
+	"syscall"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -13,8 +16,10 @@ import (
 
 	"github.com/cloudfoundry-incubator/garden"
 	"github.com/cloudfoundry-incubator/garden-linux/container_pool/fake_container_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/events"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
 	"github.com/cloudfoundry-incubator/garden-linux/old/system_info/fake_system_info"
+	"github.com/cloudfoundry-incubator/garden-linux/process_tracker"
 )
 
 var logger *lagertest.TestLogger
@@ -108,13 +113,14 @@ var _ = Describe("Start", func() {
 			err := os.MkdirAll(snapshotsPath, 0755)
 			Ω(err).ShouldNot(HaveOccurred())
 
-			file, err := os.Create(path.Join(snapshotsPath, "some-id"))
+			// the fake containers' ids are their handles
+			file, err := os.Create(path.Join(snapshotsPath, "handle-a"))
 			Ω(err).ShouldNot(HaveOccurred())
 
 			file.Write([]byte("handle-a"))
 			file.Close()
 
-			file, err = os.Create(path.Join(snapshotsPath, "some-other-id"))
+			file, err = os.Create(path.Join(snapshotsPath, "handle-b"))
 			Ω(err).ShouldNot(HaveOccurred())
 
 			file.Write([]byte("handle-b"))
@@ -132,19 +138,19 @@ var _ = Describe("Start", func() {
 			Ω(fakeContainerPool.RestoredSnapshots).Should(HaveLen(2))
 		})
 
-		It("removes the snapshots", func() {
+		It("keeps their snapshots, rewriting them", func() {
 			linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath)
 
-			Ω(fakeContainerPool.RestoredSnapshots).Should(BeEmpty())
-
 			err := linuxBackend.Start()
 			Ω(err).ShouldNot(HaveOccurred())
 
-			_, err = os.Stat(path.Join(snapshotsPath, "some-id"))
-			Ω(err).Should(HaveOccurred())
+			contents, err := ioutil.ReadFile(path.Join(snapshotsPath, "handle-a"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(contents)).Should(Equal("handle-a\n"))
 
-			_, err = os.Stat(path.Join(snapshotsPath, "some-other-id"))
-			Ω(err).Should(HaveOccurred())
+			contents, err = ioutil.ReadFile(path.Join(snapshotsPath, "handle-b"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(contents)).Should(Equal("handle-b\n"))
 		})
 
 		It("registers the containers", func() {
@@ -185,6 +191,53 @@ var _ = Describe("Start", func() {
 				err := linuxBackend.Start()
 				Ω(err).ShouldNot(HaveOccurred())
 			})
+
+			It("moves the snapshots aside", func() {
+				linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath)
+
+				err := linuxBackend.Start()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				entries, err := ioutil.ReadDir(snapshotsPath)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				names := []string{}
+				for _, entry := range entries {
+					names = append(names, entry.Name())
+				}
+
+				Ω(names).Should(ConsistOf("handle-a.rejected", "handle-b.rejected"))
+			})
+
+			It("keeps their containers when pruning the container pool", func() {
+				linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath)
+
+				err := linuxBackend.Start()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeContainerPool.KeptContainers).Should(Equal(map[string]bool{
+					"handle-a": true,
+					"handle-b": true,
+				}))
+			})
+
+			Context("and the backend is started again", func() {
+				It("neither restores them again nor prunes their containers", func() {
+					err := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath).Start()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					fakeContainerPool.RestoreError = nil
+
+					err = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath).Start()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeContainerPool.RestoredSnapshots).Should(BeEmpty())
+					Ω(fakeContainerPool.KeptContainers).Should(Equal(map[string]bool{
+						"handle-a": true,
+						"handle-b": true,
+					}))
+				})
+			})
 		})
 	})
 
@@ -214,6 +267,173 @@ var _ = Describe("Start", func() {
 	})
 })
 
+var _ = Describe("Snapshotting", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var snapshotsPath string
+	var linuxBackend *linux_backend.LinuxBackend
+
+	BeforeEach(func() {
+		tmpdir, err := ioutil.TempDir(os.TempDir(), "garden-server-test")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		snapshotsPath = path.Join(tmpdir, "snapshots")
+
+		fakeContainerPool = fake_container_pool.New()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fake_system_info.NewFakeProvider(), snapshotsPath)
+	})
+
+	JustBeforeEach(func() {
+		err := linuxBackend.Start()
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		linuxBackend.Stop()
+	})
+
+	snapshotFiles := func() []string {
+		entries, err := ioutil.ReadDir(snapshotsPath)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		names := []string{}
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+
+		return names
+	}
+
+	It("saves a snapshot of each container created", func() {
+		_, err := linuxBackend.Create(garden.ContainerSpec{Handle: "some-handle"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		contents, err := ioutil.ReadFile(path.Join(snapshotsPath, "some-handle"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(contents)).Should(Equal("some-handle\n"))
+
+		Ω(snapshotFiles()).Should(Equal([]string{"some-handle"}))
+	})
+
+	It("removes the snapshot of each container destroyed", func() {
+		_, err := linuxBackend.Create(garden.ContainerSpec{Handle: "some-handle"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = linuxBackend.Destroy("some-handle")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(snapshotFiles()).Should(BeEmpty())
+	})
+
+	It("restores the containers after an unclean shutdown", func() {
+		_, err := linuxBackend.Create(garden.ContainerSpec{Handle: "some-handle"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		restarted := linux_backend.New(logger, fakeContainerPool, fake_system_info.NewFakeProvider(), snapshotsPath)
+
+		err = restarted.Start()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, err = restarted.Lookup("some-handle")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		By("saving their snapshots again straight away")
+		Ω(snapshotFiles()).Should(Equal([]string{"some-handle"}))
+	})
+
+	Context("when saving a snapshot fails", func() {
+		It("keeps the previous snapshot", func() {
+			container, err := linuxBackend.Create(garden.ContainerSpec{Handle: "some-handle"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			container.(*fake_container_pool.FakeContainer).SnapshotError = errors.New("oh no!")
+
+			linuxBackend.Stop()
+
+			contents, err := ioutil.ReadFile(path.Join(snapshotsPath, "some-handle"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(contents)).Should(Equal("some-handle\n"))
+
+			Ω(snapshotFiles()).Should(Equal([]string{"some-handle"}))
+		})
+	})
+
+	Context("when a snapshot was left part written", func() {
+		BeforeEach(func() {
+			err := os.MkdirAll(snapshotsPath, 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = ioutil.WriteFile(path.Join(snapshotsPath, ".some-handle-123"), []byte("some-handle"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("does not restore it", func() {
+			Ω(fakeContainerPool.RestoredSnapshots).Should(BeEmpty())
+			Ω(snapshotFiles()).Should(BeEmpty())
+		})
+	})
+
+	Context("with a snapshot interval", func() {
+		BeforeEach(func() {
+			linuxBackend.SetSnapshotInterval(10 * time.Millisecond)
+		})
+
+		It("saves a snapshot of each container periodically until stopped", func() {
+			container, err := linuxBackend.Create(garden.ContainerSpec{Handle: "some-handle"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeContainer := container.(*fake_container_pool.FakeContainer)
+
+			Eventually(fakeContainer.SavedSnapshotCount).Should(BeNumerically(">=", 3))
+
+			linuxBackend.Stop()
+
+			saved := fakeContainer.SavedSnapshotCount()
+			Consistently(fakeContainer.SavedSnapshotCount, 50*time.Millisecond).Should(Equal(saved))
+		})
+	})
+})
+
+var _ = Describe("Sampling disk usage", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fake_system_info.NewFakeProvider(), "")
+		linuxBackend.SetDiskUsageInterval(10 * time.Millisecond)
+
+		fakeContainerPool.DiskUsageResult = map[string]garden.ContainerDiskStat{
+			"handle-a": {BytesUsed: 1024},
+			"handle-b": {BytesUsed: 2048},
+		}
+	})
+
+	AfterEach(func() {
+		linuxBackend.Stop()
+	})
+
+	It("gives each container its usage, sampled for every container at once", func() {
+		containerA, err := linuxBackend.Create(garden.ContainerSpec{Handle: "handle-a"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		containerB, err := linuxBackend.Create(garden.ContainerSpec{Handle: "handle-b"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = linuxBackend.Start()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		fakeContainerA := containerA.(*fake_container_pool.FakeContainer)
+		fakeContainerB := containerB.(*fake_container_pool.FakeContainer)
+
+		Eventually(fakeContainerA.RecordedDiskUsage).Should(ContainElement(garden.ContainerDiskStat{BytesUsed: 1024}))
+		Eventually(fakeContainerB.RecordedDiskUsage).Should(ContainElement(garden.ContainerDiskStat{BytesUsed: 2048}))
+
+		linuxBackend.Stop()
+
+		Ω(fakeContainerPool.DiskUsageCalls).Should(Equal(len(fakeContainerA.RecordedDiskUsage())))
+	})
+})
+
 var _ = Describe("Stop", func() {
 	var fakeContainerPool *fake_container_pool.FakeContainerPool
 	var fakeSystemInfo *fake_system_info.FakeProvider
@@ -242,12 +462,16 @@ var _ = Describe("Stop", func() {
 		container2, err := linuxBackend.Create(garden.ContainerSpec{Handle: "some-other-handle"})
 		Ω(err).ShouldNot(HaveOccurred())
 
-		linuxBackend.Stop()
-
 		fakeContainer1 := container1.(*fake_container_pool.FakeContainer)
 		fakeContainer2 := container2.(*fake_container_pool.FakeContainer)
-		Ω(fakeContainer1.SavedSnapshots).Should(HaveLen(1))
-		Ω(fakeContainer2.SavedSnapshots).Should(HaveLen(1))
+
+		saved1 := fakeContainer1.SavedSnapshotCount()
+		saved2 := fakeContainer2.SavedSnapshotCount()
+
+		linuxBackend.Stop()
+
+		Ω(fakeContainer1.SavedSnapshotCount()).Should(Equal(saved1 + 1))
+		Ω(fakeContainer2.SavedSnapshotCount()).Should(Equal(saved2 + 1))
 	})
 
 	It("cleans up each container", func() {
@@ -266,53 +490,397 @@ var _ = Describe("Stop", func() {
 	})
 })
 
-var _ = Describe("Capacity", func() {
-	var fakeContainerPool *fake_container_pool.FakeContainerPool
-	var fakeSystemInfo *fake_system_info.FakeProvider
-	var linuxBackend *linux_backend.LinuxBackend
+var _ = Describe("Capacity", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var fakeSystemInfo *fake_system_info.FakeProvider
+	var linuxBackend *linux_backend.LinuxBackend
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo = fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, "")
+	})
+
+	It("returns the right capacity values", func() {
+		fakeSystemInfo.TotalMemoryResult = 1111
+		fakeSystemInfo.TotalDiskResult = 2222
+		fakeContainerPool.MaxContainersValue = 42
+
+		capacity, err := linuxBackend.Capacity()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(capacity.MemoryInBytes).Should(Equal(uint64(1111)))
+		Ω(capacity.DiskInBytes).Should(Equal(uint64(2222)))
+		Ω(capacity.MaxContainers).Should(Equal(uint64(42)))
+	})
+
+	Context("when getting memory info fails", func() {
+		disaster := errors.New("oh no!")
+
+		BeforeEach(func() {
+			fakeSystemInfo.TotalMemoryError = disaster
+		})
+
+		It("returns the error", func() {
+			_, err := linuxBackend.Capacity()
+			Ω(err).Should(Equal(disaster))
+		})
+	})
+
+	Context("when getting disk info fails", func() {
+		disaster := errors.New("oh no!")
+
+		BeforeEach(func() {
+			fakeSystemInfo.TotalDiskError = disaster
+		})
+
+		It("returns the error", func() {
+			_, err := linuxBackend.Capacity()
+			Ω(err).Should(Equal(disaster))
+		})
+	})
+})
+
+var _ = Describe("Draining", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+	var container garden.Container
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeContainerPool.MaxContainersValue = 42
+
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fake_system_info.NewFakeProvider(), "")
+
+		var err error
+		container, err = linuxBackend.Create(garden.ContainerSpec{Handle: "some-handle"})
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("is not draining to begin with", func() {
+		Ω(linuxBackend.DrainStatus()).Should(Equal(linux_backend.DrainStatus{
+			Containers: 1,
+		}))
+
+		Ω(linuxBackend.Ping()).Should(Succeed())
+	})
+
+	Context("when draining", func() {
+		BeforeEach(func() {
+			linuxBackend.Drain()
+		})
+
+		It("refuses to create containers", func() {
+			_, err := linuxBackend.Create(garden.ContainerSpec{})
+			Ω(err).Should(Equal(linux_backend.DrainingError{}))
+
+			Ω(fakeContainerPool.CreatedContainers).Should(HaveLen(1))
+		})
+
+		It("keeps the existing containers", func() {
+			_, err := linuxBackend.Lookup("some-handle")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeContainerPool.DestroyedContainers).Should(BeEmpty())
+		})
+
+		It("still pings", func() {
+			Ω(linuxBackend.Ping()).Should(Succeed())
+		})
+
+		It("reports no capacity for containers", func() {
+			capacity, err := linuxBackend.Capacity()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(capacity.MaxContainers).Should(BeZero())
+		})
+
+		It("reports the draining status", func() {
+			Ω(linuxBackend.DrainStatus()).Should(Equal(linux_backend.DrainStatus{
+				Draining:   true,
+				Containers: 1,
+			}))
+		})
+
+		Context("and every container is destroyed", func() {
+			var subscription *events.Subscription
+
+			BeforeEach(func() {
+				subscription = linuxBackend.Subscribe()
+
+				err := linuxBackend.Destroy(container.Handle())
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("reports that it is drained", func() {
+				Ω(linuxBackend.DrainStatus()).Should(Equal(linux_backend.DrainStatus{
+					Draining: true,
+					Drained:  true,
+				}))
+			})
+
+			It("publishes a drained event", func() {
+				var event events.Event
+				Eventually(subscription.Events()).Should(Receive(&event))
+
+				Ω(event.Type).Should(Equal(events.TypeDrained))
+				Ω(event.Handle).Should(BeEmpty())
+			})
+		})
+
+		Context("and then undrained", func() {
+			BeforeEach(func() {
+				linuxBackend.Undrain()
+			})
+
+			It("creates containers again", func() {
+				_, err := linuxBackend.Create(garden.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("pings and reports capacity again", func() {
+				Ω(linuxBackend.Ping()).Should(Succeed())
+
+				capacity, err := linuxBackend.Capacity()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(capacity.MaxContainers).Should(Equal(uint64(42)))
+			})
+		})
+	})
+
+	Context("when draining while a container is being created", func() {
+		var subscription *events.Subscription
+		var statusWhileCreating linux_backend.DrainStatus
+
+		BeforeEach(func() {
+			err := linuxBackend.Destroy(container.Handle())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			subscription = linuxBackend.Subscribe()
+
+			fakeContainerPool.ContainerSetup = func(*fake_container_pool.FakeContainer) {
+				linuxBackend.Drain()
+				statusWhileCreating = linuxBackend.DrainStatus()
+			}
+		})
+
+		It("is not drained until the container is destroyed", func() {
+			created, err := linuxBackend.Create(garden.ContainerSpec{Handle: "some-other-handle"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(statusWhileCreating.Drained).Should(BeFalse())
+			Ω(linuxBackend.DrainStatus().Drained).Should(BeFalse())
+			Consistently(subscription.Events()).ShouldNot(Receive())
+
+			err = linuxBackend.Destroy(created.Handle())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var event events.Event
+			Eventually(subscription.Events()).Should(Receive(&event))
+			Ω(event.Type).Should(Equal(events.TypeDrained))
+		})
+
+		Context("and creating it fails", func() {
+			BeforeEach(func() {
+				fakeContainerPool.ContainerSetup = func(container *fake_container_pool.FakeContainer) {
+					linuxBackend.Drain()
+					container.StartError = errors.New("oh no!")
+				}
+			})
+
+			It("is drained once the creation is done", func() {
+				_, err := linuxBackend.Create(garden.ContainerSpec{Handle: "some-other-handle"})
+				Ω(err).Should(HaveOccurred())
+
+				Ω(linuxBackend.DrainStatus().Drained).Should(BeTrue())
+
+				var event events.Event
+				Eventually(subscription.Events()).Should(Receive(&event))
+				Ω(event.Type).Should(Equal(events.TypeDrained))
+			})
+		})
+	})
+
+	Context("when draining with no containers", func() {
+		It("is drained immediately", func() {
+			err := linuxBackend.Destroy(container.Handle())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			subscription := linuxBackend.Subscribe()
+
+			linuxBackend.Drain()
+
+			Ω(linuxBackend.DrainStatus().Drained).Should(BeTrue())
+			Eventually(subscription.Events()).Should(Receive())
+		})
+	})
+})
+
+var _ = Describe("Admission control", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var fakeSystemInfo *fake_system_info.FakeProvider
+	var linuxBackend *linux_backend.LinuxBackend
+
+	createWithLimits := func(memory, disk string) (garden.Container, error) {
+		return linuxBackend.Create(garden.ContainerSpec{
+			Properties: garden.Properties{
+				linux_backend.MemoryLimitProperty: memory,
+				linux_backend.DiskLimitProperty:   disk,
+			},
+		})
+	}
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+
+		// the fake containers commit what their properties ask for
+		fakeContainerPool.ContainerSetup = func(c *fake_container_pool.FakeContainer) {
+			memory, _ := strconv.ParseUint(c.Spec.Properties[linux_backend.MemoryLimitProperty], 10, 64)
+			disk, _ := strconv.ParseUint(c.Spec.Properties[linux_backend.DiskLimitProperty], 10, 64)
+
+			c.Committed = linux_backend.CommittedResources{
+				MemoryInBytes: memory,
+				DiskInBytes:   disk,
+			}
+		}
+
+		fakeSystemInfo = fake_system_info.NewFakeProvider()
+		fakeSystemInfo.TotalMemoryResult = 1000
+		fakeSystemInfo.TotalDiskResult = 10000
+
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, "")
+
+		_, err := createWithLimits("600", "6000")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("admits any container by default", func() {
+		_, err := createWithLimits("600", "6000")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("reports committed and free capacity", func() {
+		capacity, err := linuxBackend.LinuxCapacity()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(capacity.MemoryInBytes).Should(Equal(uint64(1000)))
+		Ω(capacity.CommittedMemoryInBytes).Should(Equal(uint64(600)))
+		Ω(capacity.CommittedDiskInBytes).Should(Equal(uint64(6000)))
+		Ω(capacity.FreeMemoryInBytes).Should(Equal(uint64(400)))
+		Ω(capacity.FreeDiskInBytes).Should(Equal(uint64(4000)))
+	})
+
+	Context("with an overcommit ratio", func() {
+		BeforeEach(func() {
+			linuxBackend.SetAdmissionPolicy(linux_backend.AdmissionPolicy{
+				MemoryOvercommitRatio: 1.5,
+				DiskOvercommitRatio:   1,
+			})
+		})
+
+		It("admits containers within the overcommitted capacity", func() {
+			_, err := createWithLimits("900", "4000")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("refuses containers exceeding the free memory", func() {
+			_, err := createWithLimits("901", "0")
+			Ω(err).Should(Equal(linux_backend.InsufficientCapacityError{
+				Resource:  "memory",
+				Requested: 901,
+				Free:      900,
+			}))
+
+			Ω(fakeContainerPool.CreatedContainers).Should(HaveLen(1))
+		})
+
+		It("refuses containers exceeding the free disk", func() {
+			_, err := createWithLimits("0", "4001")
+			Ω(err).Should(Equal(linux_backend.InsufficientCapacityError{
+				Resource:  "disk",
+				Requested: 4001,
+				Free:      4000,
+			}))
+		})
+
+		It("reports free capacity with the ratio applied", func() {
+			capacity, err := linuxBackend.LinuxCapacity()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(capacity.FreeMemoryInBytes).Should(Equal(uint64(900)))
+			Ω(capacity.FreeDiskInBytes).Should(Equal(uint64(4000)))
+		})
+
+		It("frees capacity when containers are destroyed", func() {
+			err := linuxBackend.Destroy(fakeContainerPool.CreatedContainers[0].Handle())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = createWithLimits("1500", "10000")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		Context("when a container's limits are raised after creation", func() {
+			var admission func(linux_backend.CommittedResources) (func(), error)
+
+			BeforeEach(func() {
+				admission = fakeContainerPool.CreatedContainers[0].(*fake_container_pool.FakeContainer).LimitsAdmission
+				Ω(admission).ShouldNot(BeNil())
+			})
+
+			It("admits increases within the free capacity, reserving them until released", func() {
+				release, err := admission(linux_backend.CommittedResources{MemoryInBytes: 900})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				capacity, err := linuxBackend.LinuxCapacity()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(capacity.FreeMemoryInBytes).Should(BeZero())
 
-	BeforeEach(func() {
-		fakeContainerPool = fake_container_pool.New()
-		fakeSystemInfo = fake_system_info.NewFakeProvider()
-		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, "")
-	})
+				release()
 
-	It("returns the right capacity values", func() {
-		fakeSystemInfo.TotalMemoryResult = 1111
-		fakeSystemInfo.TotalDiskResult = 2222
-		fakeContainerPool.MaxContainersValue = 42
+				capacity, err = linuxBackend.LinuxCapacity()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(capacity.FreeMemoryInBytes).Should(Equal(uint64(900)))
+			})
 
-		capacity, err := linuxBackend.Capacity()
-		Ω(err).ShouldNot(HaveOccurred())
+			It("refuses increases exceeding the free capacity", func() {
+				_, err := admission(linux_backend.CommittedResources{DiskInBytes: 4001})
+				Ω(err).Should(Equal(linux_backend.InsufficientCapacityError{
+					Resource:  "disk",
+					Requested: 4001,
+					Free:      4000,
+				}))
+			})
+		})
 
-		Ω(capacity.MemoryInBytes).Should(Equal(uint64(1111)))
-		Ω(capacity.DiskInBytes).Should(Equal(uint64(2222)))
-		Ω(capacity.MaxContainers).Should(Equal(uint64(42)))
-	})
+		It("does not count containers that failed to be created", func() {
+			fakeContainerPool.CreateError = errors.New("oh no!")
 
-	Context("when getting memory info fails", func() {
-		disaster := errors.New("oh no!")
+			_, err := createWithLimits("900", "0")
+			Ω(err).Should(HaveOccurred())
 
-		BeforeEach(func() {
-			fakeSystemInfo.TotalMemoryError = disaster
+			capacity, err := linuxBackend.LinuxCapacity()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(capacity.CommittedMemoryInBytes).Should(Equal(uint64(600)))
 		})
 
-		It("returns the error", func() {
-			_, err := linuxBackend.Capacity()
-			Ω(err).Should(Equal(disaster))
+		Context("when a limit property is not a number", func() {
+			It("returns an error", func() {
+				_, err := createWithLimits("lots", "0")
+				Ω(err).Should(MatchError(`invalid garden.memory_limit_in_bytes: "lots"`))
+			})
 		})
-	})
 
-	Context("when getting disk info fails", func() {
-		disaster := errors.New("oh no!")
+		Context("when getting the host's memory fails", func() {
+			disaster := errors.New("oh no!")
 
-		BeforeEach(func() {
-			fakeSystemInfo.TotalDiskError = disaster
-		})
+			BeforeEach(func() {
+				fakeSystemInfo.TotalMemoryError = disaster
+			})
 
-		It("returns the error", func() {
-			_, err := linuxBackend.Capacity()
-			Ω(err).Should(Equal(disaster))
+			It("returns the error", func() {
+				_, err := createWithLimits("1", "1")
+				Ω(err).Should(Equal(disaster))
+			})
 		})
 	})
 })
@@ -407,6 +975,76 @@ var _ = Describe("Create", func() {
 	})
 })
 
+var _ = Describe("Subscribe", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, "")
+	})
+
+	It("forwards events from created containers", func() {
+		subscription := linuxBackend.Subscribe()
+
+		container, err := linuxBackend.Create(garden.ContainerSpec{Handle: "some-handle"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		event := events.New(events.TypeOutOfMemory, "some-handle", nil)
+		container.(*fake_container_pool.FakeContainer).EventHub.Publish(event)
+
+		Eventually(subscription.Events()).Should(Receive(Equal(event)))
+	})
+
+	It("forwards events from restored containers", func() {
+		tmpdir, err := ioutil.TempDir(os.TempDir(), "garden-server-test")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		snapshotsPath := path.Join(tmpdir, "snapshots")
+
+		err = os.MkdirAll(snapshotsPath, 0755)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = ioutil.WriteFile(path.Join(snapshotsPath, "some-id"), []byte("handle-a"), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fake_system_info.NewFakeProvider(), snapshotsPath)
+		subscription := linuxBackend.Subscribe()
+
+		err = linuxBackend.Start()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		container, err := linuxBackend.Lookup("handle-a")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		event := events.New(events.TypeDestroy, "handle-a", nil)
+		container.(*fake_container_pool.FakeContainer).EventHub.Publish(event)
+
+		Eventually(subscription.Events()).Should(Receive(Equal(event)))
+	})
+
+	Context("when starting the container fails", func() {
+		BeforeEach(func() {
+			fakeContainerPool.ContainerSetup = func(c *fake_container_pool.FakeContainer) {
+				c.StartError = errors.New("failed to start")
+			}
+		})
+
+		It("stops forwarding its events", func() {
+			subscription := linuxBackend.Subscribe()
+
+			_, err := linuxBackend.Create(garden.ContainerSpec{})
+			Ω(err).Should(HaveOccurred())
+
+			container := fakeContainerPool.CreatedContainers[0].(*fake_container_pool.FakeContainer)
+			container.EventHub.Publish(events.New(events.TypeOutOfMemory, container.Handle(), nil))
+
+			Consistently(subscription.Events()).ShouldNot(Receive())
+		})
+	})
+})
+
 var _ = Describe("Destroy", func() {
 	var fakeContainerPool *fake_container_pool.FakeContainerPool
 	var linuxBackend *linux_backend.LinuxBackend
@@ -474,6 +1112,118 @@ var _ = Describe("Destroy", func() {
 	})
 })
 
+var _ = Describe("BulkInfo", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+
+	var container1, container2 *fake_container_pool.FakeContainer
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, "")
+
+		c1, err := linuxBackend.Create(garden.ContainerSpec{Handle: "handle-1"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		c2, err := linuxBackend.Create(garden.ContainerSpec{Handle: "handle-2"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		container1 = c1.(*fake_container_pool.FakeContainer)
+		container2 = c2.(*fake_container_pool.FakeContainer)
+
+		container1.InfoReturns(garden.ContainerInfo{State: "active"}, nil)
+		container2.InfoReturns(garden.ContainerInfo{State: "stopped"}, nil)
+
+		fakeContainerPool.DiskUsageResult = map[string]garden.ContainerDiskStat{
+			"handle-1": {BytesUsed: 1},
+			"handle-2": {BytesUsed: 2},
+		}
+	})
+
+	It("returns the info of each container by handle", func() {
+		entries, err := linuxBackend.BulkInfo([]string{"handle-1", "handle-2"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(entries).Should(Equal(map[string]linux_backend.ContainerInfoEntry{
+			"handle-1": {Info: garden.ContainerInfo{State: "active", DiskStat: garden.ContainerDiskStat{BytesUsed: 1}}},
+			"handle-2": {Info: garden.ContainerInfo{State: "stopped", DiskStat: garden.ContainerDiskStat{BytesUsed: 2}}},
+		}))
+	})
+
+	It("gathers disk usage for all of the containers at once", func() {
+		_, err := linuxBackend.BulkInfo([]string{"handle-1", "handle-2"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(fakeContainerPool.DiskUsageCalls).Should(Equal(1))
+
+		Ω(container1.InfoDiskStat).Should(Equal(&garden.ContainerDiskStat{BytesUsed: 1}))
+		Ω(container2.InfoDiskStat).Should(Equal(&garden.ContainerDiskStat{BytesUsed: 2}))
+	})
+
+	Context("when a handle is not found", func() {
+		It("returns ContainerNotFoundError for that handle only", func() {
+			entries, err := linuxBackend.BulkInfo([]string{"handle-1", "bogus-handle"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(entries["handle-1"].Err).ShouldNot(HaveOccurred())
+			Ω(entries["bogus-handle"].Err).Should(Equal(garden.ContainerNotFoundError{"bogus-handle"}))
+		})
+	})
+
+	Context("when getting a container's info fails", func() {
+		disaster := errors.New("oh no!")
+
+		BeforeEach(func() {
+			container2.InfoReturns(garden.ContainerInfo{}, disaster)
+		})
+
+		It("returns the error for that handle only", func() {
+			entries, err := linuxBackend.BulkInfo([]string{"handle-1", "handle-2"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(entries["handle-1"].Err).ShouldNot(HaveOccurred())
+			Ω(entries["handle-1"].Info.State).Should(Equal("active"))
+
+			Ω(entries["handle-2"].Err).Should(Equal(disaster))
+		})
+	})
+
+	Context("when gathering disk usage at once fails", func() {
+		BeforeEach(func() {
+			fakeContainerPool.DiskUsageError = errors.New("oh no!")
+		})
+
+		It("falls back to each container's own info", func() {
+			entries, err := linuxBackend.BulkInfo([]string{"handle-1", "handle-2"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(entries["handle-1"]).Should(Equal(linux_backend.ContainerInfoEntry{
+				Info: garden.ContainerInfo{State: "active"},
+			}))
+
+			Ω(container1.InfoDiskStat).Should(BeNil())
+			Ω(container1.InfoCallCount()).Should(Equal(1))
+		})
+	})
+
+	Context("with more containers than the parallelism bound", func() {
+		It("gathers info for all of them", func() {
+			handles := []string{}
+			for i := 0; i < linux_backend.BulkInfoParallelism*2; i++ {
+				container, err := linuxBackend.Create(garden.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				handles = append(handles, container.Handle())
+			}
+
+			entries, err := linuxBackend.BulkInfo(handles)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(entries).Should(HaveLen(len(handles)))
+		})
+	})
+})
+
 var _ = Describe("Lookup", func() {
 	var fakeContainerPool *fake_container_pool.FakeContainerPool
 	var linuxBackend *linux_backend.LinuxBackend
@@ -505,6 +1255,71 @@ var _ = Describe("Lookup", func() {
 	})
 })
 
+var _ = Describe("ProcessLog", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, "")
+	})
+
+	It("streams the log of a process in the container", func() {
+		container, err := linuxBackend.Create(garden.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		container.(*fake_container_pool.FakeContainer).ProcessLogs = map[uint32]string{
+			42: "some log",
+		}
+
+		out := new(bytes.Buffer)
+		err = linuxBackend.ProcessLog(container.Handle(), 42, process_tracker.LogRequest{}, out)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(out.String()).Should(Equal("some log"))
+	})
+
+	Context("when the handle is not found", func() {
+		It("returns ContainerNotFoundError", func() {
+			err := linuxBackend.ProcessLog("bogus-handle", 42, process_tracker.LogRequest{}, new(bytes.Buffer))
+			Ω(err).Should(Equal(garden.ContainerNotFoundError{"bogus-handle"}))
+		})
+	})
+})
+
+var _ = Describe("SignalProcess", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, "")
+	})
+
+	It("signals the process in the container", func() {
+		container, err := linuxBackend.Create(garden.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		request := process_tracker.SignalRequest{Signal: syscall.SIGUSR1}
+
+		err = linuxBackend.SignalProcess(container.Handle(), 42, request)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(container.(*fake_container_pool.FakeContainer).SignalledProcesses).Should(Equal(
+			map[uint32][]process_tracker.SignalRequest{42: {request}},
+		))
+	})
+
+	Context("when the handle is not found", func() {
+		It("returns ContainerNotFoundError", func() {
+			err := linuxBackend.SignalProcess("bogus-handle", 42, process_tracker.SignalRequest{Signal: syscall.SIGHUP})
+			Ω(err).Should(Equal(garden.ContainerNotFoundError{"bogus-handle"}))
+		})
+	})
+})
+
 var _ = Describe("Containers", func() {
 	var fakeContainerPool *fake_container_pool.FakeContainerPool
 	var linuxBackend *linux_backend.LinuxBackend
@@ -556,6 +1371,98 @@ var _ = Describe("Containers", func() {
 			Ω(containers).Should(ContainElement(container3))
 		})
 	})
+
+	Describe("matching property filters", func() {
+		var web, worker, bare garden.Container
+
+		BeforeEach(func() {
+			var err error
+
+			web, err = linuxBackend.Create(garden.ContainerSpec{
+				Properties: garden.Properties{"app": "web", "owner": "team-a"},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			worker, err = linuxBackend.Create(garden.ContainerSpec{
+				Properties: garden.Properties{"app": "web-worker", "owner": "team-b"},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			bare, err = linuxBackend.Create(garden.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("matches containers that have a property", func() {
+			containers, err := linuxBackend.ContainersMatching([]linux_backend.PropertyFilter{
+				linux_backend.ExistsFilter("app"),
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(containers).Should(ConsistOf(web, worker))
+		})
+
+		It("matches containers by property prefix", func() {
+			containers, err := linuxBackend.ContainersMatching([]linux_backend.PropertyFilter{
+				linux_backend.PrefixFilter("app", "web-"),
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(containers).Should(ConsistOf(worker))
+		})
+
+		It("matches containers by regular expression", func() {
+			filter, err := linux_backend.RegexpFilter("owner", "^team-[ab]$")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			containers, err := linuxBackend.ContainersMatching([]linux_backend.PropertyFilter{filter})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(containers).Should(ConsistOf(web, worker))
+		})
+
+		It("matches negated filters, including containers without the property", func() {
+			containers, err := linuxBackend.ContainersMatching([]linux_backend.PropertyFilter{
+				linux_backend.EqualsFilter("owner", "team-a").Not(),
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(containers).Should(ConsistOf(worker, bare))
+		})
+
+		It("matches only containers matching every filter", func() {
+			containers, err := linuxBackend.ContainersMatching([]linux_backend.PropertyFilter{
+				linux_backend.PrefixFilter("app", "web"),
+				linux_backend.EqualsFilter("owner", "team-b").Not(),
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(containers).Should(ConsistOf(web))
+		})
+
+		It("matches properties changed after creation", func() {
+			bare.(*fake_container_pool.FakeContainer).ChangeProperties(garden.Properties{"app": "web-cron"})
+			web.(*fake_container_pool.FakeContainer).ChangeProperties(garden.Properties{})
+
+			containers, err := linuxBackend.ContainersMatching([]linux_backend.PropertyFilter{
+				linux_backend.PrefixFilter("app", "web"),
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(containers).Should(ConsistOf(worker, bare))
+		})
+
+		It("does not match destroyed containers", func() {
+			err := linuxBackend.Destroy(worker.Handle())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			containers, err := linuxBackend.ContainersMatching([]linux_backend.PropertyFilter{
+				linux_backend.ExistsFilter("app"),
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(containers).Should(ConsistOf(web))
+		})
+	})
 })
 
 var _ = Describe("GraceTime", func() {
@@ -2,9 +2,12 @@ package linux_backend
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/cloudfoundry/gunk/command_runner"
 )
@@ -15,23 +18,135 @@ type NamespacedSignaller struct {
 	Runner        command_runner.CommandRunner
 	ContainerPath string
 	PidFilePath   string
+
+	// Where proc is mounted; defaults to /proc.
+	ProcPath string
 }
 
 func (n *NamespacedSignaller) Signal(signal os.Signal) error {
-	pidfile, err := os.Open(n.PidFilePath)
+	pid, err := readPid(n.PidFilePath)
+	if err != nil {
+		return fmt.Errorf("namespaced-signaller: can't read pidfile: %v", err)
+	}
+
+	return n.kill(signal, fmt.Sprintf("%d", pid))
+}
+
+// SignalGroup signals the process group led by the process; wshd starts
+// every process in a session of its own.
+func (n *NamespacedSignaller) SignalGroup(signal os.Signal) error {
+	pid, err := readPid(n.PidFilePath)
 	if err != nil {
 		return fmt.Errorf("namespaced-signaller: can't read pidfile: %v", err)
 	}
 
+	return n.kill(signal, "--", fmt.Sprintf("-%d", pid))
+}
+
+func (n *NamespacedSignaller) kill(signal os.Signal, targets ...string) error {
+	args := []string{
+		"--socket", filepath.Join(n.ContainerPath, "run/wshd.sock"),
+		"kill", fmt.Sprintf("-%d", signal),
+	}
+
+	return n.Runner.Run(exec.Command(filepath.Join(n.ContainerPath, "bin/wsh"), append(args, targets...)...))
+}
+
+// HostPid finds the process's PID on the host: the process in the container's
+// PID namespace whose innermost PID (the last in NSpid) is the one in the
+// pidfile.
+func (n *NamespacedSignaller) HostPid() (int, error) {
+	pid, err := readPid(n.PidFilePath)
+	if err != nil {
+		return 0, fmt.Errorf("namespaced-signaller: can't read pidfile: %v", err)
+	}
+
+	wshdPid, err := readPid(filepath.Join(n.ContainerPath, "run", "wshd.pid"))
+	if err != nil {
+		return 0, fmt.Errorf("namespaced-signaller: can't read wshd pidfile: %v", err)
+	}
+
+	procPath := n.ProcPath
+	if procPath == "" {
+		procPath = "/proc"
+	}
+
+	namespace, err := os.Readlink(filepath.Join(procPath, strconv.Itoa(wshdPid), "ns", "pid"))
+	if err != nil {
+		return 0, fmt.Errorf("namespaced-signaller: can't find pid namespace: %v", err)
+	}
+
+	entries, err := ioutil.ReadDir(procPath)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		hostPid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		processNamespace, err := os.Readlink(filepath.Join(procPath, entry.Name(), "ns", "pid"))
+		if err != nil || processNamespace != namespace {
+			continue
+		}
+
+		nsPids, err := namespacedPids(filepath.Join(procPath, entry.Name(), "status"))
+		if err != nil || len(nsPids) == 0 {
+			continue
+		}
+
+		if nsPids[len(nsPids)-1] == pid {
+			return hostPid, nil
+		}
+	}
+
+	return 0, fmt.Errorf("namespaced-signaller: no host process found for pid %d", pid)
+}
+
+func readPid(pidFilePath string) (int, error) {
+	pidfile, err := os.Open(pidFilePath)
+	if err != nil {
+		return 0, err
+	}
+
 	defer pidfile.Close()
 
 	var pid int
 	_, err = fmt.Fscanf(pidfile, "%d", &pid)
 	if err != nil {
-		return fmt.Errorf("namespaced-signaller: can't read pidfile: %v", err)
+		return 0, err
 	}
 
-	return n.Runner.Run(exec.Command(filepath.Join(n.ContainerPath, "bin/wsh"),
-		"--socket", filepath.Join(n.ContainerPath, "run/wshd.sock"),
-		"kill", fmt.Sprintf("-%d", signal), fmt.Sprintf("%d", pid)))
+	return pid, nil
+}
+
+// the PIDs of a process in each nested PID namespace, outermost first
+func namespacedPids(statusPath string) ([]int, error) {
+	status, err := ioutil.ReadFile(statusPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(status), "\n") {
+		if !strings.HasPrefix(line, "NSpid:") {
+			continue
+		}
+
+		pids := []int{}
+
+		for _, field := range strings.Fields(strings.TrimPrefix(line, "NSpid:")) {
+			pid, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, err
+			}
+
+			pids = append(pids, pid)
+		}
+
+		return pids, nil
+	}
+
+	return nil, nil
 }
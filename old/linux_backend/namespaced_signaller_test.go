@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"syscall"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -41,6 +42,33 @@ var _ = Describe("Namespaced Signaller", func() {
 			}))
 	})
 
+	It("signals the process group led by the process", func() {
+		tmp, err := ioutil.TempDir("", "namespacedsignaller")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(tmp)
+
+		pidFile := filepath.Join(tmp, "thepid.file")
+
+		fakeRunner := fake_command_runner.New()
+		signaller := &linux_backend.NamespacedSignaller{
+			Runner:        fakeRunner,
+			ContainerPath: "/fish/finger",
+			PidFilePath:   pidFile,
+		}
+
+		Ω(ioutil.WriteFile(pidFile, []byte("12345\n"), 0755)).Should(Succeed())
+
+		Ω(signaller.SignalGroup(syscall.SIGHUP)).Should(Succeed())
+		Ω(fakeRunner).Should(HaveExecutedSerially(
+			fake_command_runner.CommandSpec{
+				Path: "/fish/finger/bin/wsh",
+				Args: []string{
+					"--socket", "/fish/finger/run/wshd.sock",
+					"kill", "-1", "--", "-12345",
+				},
+			}))
+	})
+
 	It("returns an appropriate error when the pidfile is not present", func() {
 		fakeRunner := fake_command_runner.New()
 		signaller := &linux_backend.NamespacedSignaller{
@@ -0,0 +1,304 @@
+package linux_backend
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden"
+)
+
+type PropertyMatch int
+
+const (
+	PropertyEquals PropertyMatch = iota
+	PropertyExists
+	PropertyHasPrefix
+	PropertyMatchesRegexp
+)
+
+// PropertyFilter matches containers by one of their properties. A negated
+// filter matches every container the filter itself does not, including
+// those without the property.
+type PropertyFilter struct {
+	Key    string
+	Match  PropertyMatch
+	Value  string
+	Negate bool
+
+	regexp *regexp.Regexp
+}
+
+type InvalidPropertyFilterError struct {
+	Expression string
+	Reason     string
+}
+
+func (e InvalidPropertyFilterError) Error() string {
+	return fmt.Sprintf("invalid property filter %q: %s", e.Expression, e.Reason)
+}
+
+func EqualsFilter(key, value string) PropertyFilter {
+	return PropertyFilter{Key: key, Match: PropertyEquals, Value: value}
+}
+
+func ExistsFilter(key string) PropertyFilter {
+	return PropertyFilter{Key: key, Match: PropertyExists}
+}
+
+func PrefixFilter(key, prefix string) PropertyFilter {
+	return PropertyFilter{Key: key, Match: PropertyHasPrefix, Value: prefix}
+}
+
+func RegexpFilter(key, pattern string) (PropertyFilter, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return PropertyFilter{}, err
+	}
+
+	return PropertyFilter{Key: key, Match: PropertyMatchesRegexp, Value: pattern, regexp: re}, nil
+}
+
+func (f PropertyFilter) Not() PropertyFilter {
+	f.Negate = !f.Negate
+	return f
+}
+
+// ParsePropertyFilter parses a filter expression:
+//
+//	key          key is set
+//	key=value    key is set to value
+//	key^=prefix  key is set to a value starting with prefix
+//	key~=regexp  key is set to a value matching regexp
+//
+// A leading '!' negates the expression, e.g. "!key" or "!key=value".
+func ParsePropertyFilter(expression string) (PropertyFilter, error) {
+	expr := expression
+
+	negate := strings.HasPrefix(expr, "!")
+	if negate {
+		expr = expr[1:]
+	}
+
+	var filter PropertyFilter
+
+	separator := strings.Index(expr, "=")
+	if separator == -1 {
+		filter = ExistsFilter(expr)
+	} else {
+		key, value := expr[:separator], expr[separator+1:]
+
+		switch {
+		case strings.HasSuffix(key, "^"):
+			filter = PrefixFilter(key[:len(key)-1], value)
+
+		case strings.HasSuffix(key, "~"):
+			var err error
+			filter, err = RegexpFilter(key[:len(key)-1], value)
+			if err != nil {
+				return PropertyFilter{}, InvalidPropertyFilterError{expression, err.Error()}
+			}
+
+		default:
+			filter = EqualsFilter(key, value)
+		}
+	}
+
+	if filter.Key == "" {
+		return PropertyFilter{}, InvalidPropertyFilterError{expression, "missing key"}
+	}
+
+	filter.Negate = negate
+
+	return filter, nil
+}
+
+func (f PropertyFilter) Matches(properties garden.Properties) bool {
+	value, found := properties[f.Key]
+	if !found {
+		return f.Negate
+	}
+
+	return f.matchesValue(value) != f.Negate
+}
+
+func (f PropertyFilter) matchesValue(value string) bool {
+	switch f.Match {
+	case PropertyEquals:
+		return value == f.Value
+	case PropertyHasPrefix:
+		return strings.HasPrefix(value, f.Value)
+	case PropertyMatchesRegexp:
+		return f.regexp != nil && f.regexp.MatchString(value)
+	default:
+		return true
+	}
+}
+
+// propertyIndex keeps each container's properties indexed by key and value,
+// so that a filter only looks at the containers having the values it is
+// after rather than at every container.
+type propertyIndex struct {
+	containers map[string]indexedContainer
+
+	// key -> value -> handle
+	values map[string]map[string]map[string]struct{}
+
+	mutex sync.RWMutex
+}
+
+type indexedContainer struct {
+	container  Container
+	properties garden.Properties
+}
+
+func newPropertyIndex() *propertyIndex {
+	return &propertyIndex{
+		containers: make(map[string]indexedContainer),
+		values:     make(map[string]map[string]map[string]struct{}),
+	}
+}
+
+func (i *propertyIndex) Add(container Container, properties garden.Properties) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.remove(container.Handle())
+	i.add(container, properties)
+}
+
+// Update replaces the indexed properties of a container already in the index.
+func (i *propertyIndex) Update(handle string, properties garden.Properties) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	entry, found := i.containers[handle]
+	if !found {
+		return
+	}
+
+	i.remove(handle)
+	i.add(entry.container, properties)
+}
+
+func (i *propertyIndex) Remove(handle string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.remove(handle)
+}
+
+func (i *propertyIndex) Find(filters []PropertyFilter) []Container {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	containers := []Container{}
+
+	for handle := range i.candidates(filters) {
+		entry := i.containers[handle]
+
+		if matchesAll(filters, entry.properties) {
+			containers = append(containers, entry.container)
+		}
+	}
+
+	return containers
+}
+
+// candidates narrows down the containers to the smallest set matching one of
+// the non-negated filters; negated filters cannot use the index.
+func (i *propertyIndex) candidates(filters []PropertyFilter) map[string]struct{} {
+	var smallest map[string]struct{}
+
+	for _, filter := range filters {
+		if filter.Negate {
+			continue
+		}
+
+		handles := map[string]struct{}{}
+
+		for value, valueHandles := range i.values[filter.Key] {
+			if !filter.matchesValue(value) {
+				continue
+			}
+
+			for handle := range valueHandles {
+				handles[handle] = struct{}{}
+			}
+		}
+
+		if smallest == nil || len(handles) < len(smallest) {
+			smallest = handles
+		}
+	}
+
+	if smallest != nil {
+		return smallest
+	}
+
+	all := make(map[string]struct{}, len(i.containers))
+	for handle := range i.containers {
+		all[handle] = struct{}{}
+	}
+
+	return all
+}
+
+func (i *propertyIndex) add(container Container, properties garden.Properties) {
+	handle := container.Handle()
+
+	i.containers[handle] = indexedContainer{
+		container:  container,
+		properties: properties,
+	}
+
+	for key, value := range properties {
+		values, found := i.values[key]
+		if !found {
+			values = make(map[string]map[string]struct{})
+			i.values[key] = values
+		}
+
+		handles, found := values[value]
+		if !found {
+			handles = make(map[string]struct{})
+			values[value] = handles
+		}
+
+		handles[handle] = struct{}{}
+	}
+}
+
+func (i *propertyIndex) remove(handle string) {
+	entry, found := i.containers[handle]
+	if !found {
+		return
+	}
+
+	delete(i.containers, handle)
+
+	for key, value := range entry.properties {
+		values := i.values[key]
+
+		delete(values[value], handle)
+
+		if len(values[value]) == 0 {
+			delete(values, value)
+		}
+
+		if len(values) == 0 {
+			delete(i.values, key)
+		}
+	}
+}
+
+func matchesAll(filters []PropertyFilter, properties garden.Properties) bool {
+	for _, filter := range filters {
+		if !filter.Matches(properties) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,72 @@
+package linux_backend_test
+
+import (
+	"github.com/cloudfoundry-incubator/garden"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Property filters", func() {
+	properties := garden.Properties{"app": "web-worker"}
+
+	matches := func(expression string) bool {
+		filter, err := linux_backend.ParsePropertyFilter(expression)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return filter.Matches(properties)
+	}
+
+	It("parses existence filters", func() {
+		Ω(matches("app")).Should(BeTrue())
+		Ω(matches("owner")).Should(BeFalse())
+		Ω(matches("!owner")).Should(BeTrue())
+		Ω(matches("!app")).Should(BeFalse())
+	})
+
+	It("parses equality filters", func() {
+		Ω(matches("app=web-worker")).Should(BeTrue())
+		Ω(matches("app=web")).Should(BeFalse())
+		Ω(matches("!app=web")).Should(BeTrue())
+		Ω(matches("!owner=me")).Should(BeTrue())
+	})
+
+	It("parses prefix filters", func() {
+		Ω(matches("app^=web-")).Should(BeTrue())
+		Ω(matches("app^=worker")).Should(BeFalse())
+		Ω(matches("!app^=worker")).Should(BeTrue())
+	})
+
+	It("parses regular expression filters", func() {
+		Ω(matches("app~=-w.*r$")).Should(BeTrue())
+		Ω(matches("app~=^worker")).Should(BeFalse())
+		Ω(matches("!app~=^worker")).Should(BeTrue())
+	})
+
+	It("keeps everything after the operator as the value", func() {
+		filter, err := linux_backend.ParsePropertyFilter("env=A=B")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(filter).Should(Equal(linux_backend.EqualsFilter("env", "A=B")))
+
+		filter, err = linux_backend.ParsePropertyFilter("env=A^=B")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(filter).Should(Equal(linux_backend.EqualsFilter("env", "A^=B")))
+	})
+
+	Context("when the key is missing", func() {
+		It("returns an error", func() {
+			_, err := linux_backend.ParsePropertyFilter("=value")
+			Ω(err).Should(Equal(linux_backend.InvalidPropertyFilterError{"=value", "missing key"}))
+		})
+	})
+
+	Context("when the regular expression is invalid", func() {
+		It("returns an error", func() {
+			_, err := linux_backend.ParsePropertyFilter("app~=(")
+			Ω(err).Should(BeAssignableToTypeOf(linux_backend.InvalidPropertyFilterError{}))
+		})
+	})
+})
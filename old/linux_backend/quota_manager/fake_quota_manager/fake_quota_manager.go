@@ -11,10 +11,13 @@ type FakeQuotaManager struct {
 	SetLimitsError error
 	GetLimitsError error
 	GetUsageError  error
+	GetUsagesError error
 
 	GetLimitsResult garden.DiskLimits
 	GetUsageResult  garden.ContainerDiskStat
 
+	GetUsagesCalls [][]uint32
+
 	MountPointResult string
 
 	Limited map[uint32]garden.DiskLimits
@@ -67,6 +70,24 @@ func (m *FakeQuotaManager) GetUsage(logger lager.Logger, uid uint32) (garden.Con
 	return m.GetUsageResult, nil
 }
 
+func (m *FakeQuotaManager) GetUsages(logger lager.Logger, uids []uint32) (map[uint32]garden.ContainerDiskStat, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.GetUsagesCalls = append(m.GetUsagesCalls, uids)
+
+	if m.GetUsagesError != nil {
+		return nil, m.GetUsagesError
+	}
+
+	usages := make(map[uint32]garden.ContainerDiskStat, len(uids))
+	for _, uid := range uids {
+		usages[uid] = m.GetUsageResult
+	}
+
+	return usages, nil
+}
+
 func (m *FakeQuotaManager) MountPoint() string {
 	return m.MountPointResult
 }
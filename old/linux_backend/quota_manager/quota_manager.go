@@ -1,6 +1,7 @@
 package quota_manager
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"os"
@@ -17,6 +18,7 @@ type QuotaManager interface {
 	SetLimits(logger lager.Logger, uid uint32, limits garden.DiskLimits) error
 	GetLimits(logger lager.Logger, uid uint32) (garden.DiskLimits, error)
 	GetUsage(logger lager.Logger, uid uint32) (garden.ContainerDiskStat, error)
+	GetUsages(logger lager.Logger, uids []uint32) (map[uint32]garden.ContainerDiskStat, error)
 
 	MountPoint() string
 	Disable()
@@ -171,6 +173,74 @@ func (m *LinuxQuotaManager) GetUsage(logger lager.Logger, uid uint32) (garden.Co
 	return usage, err
 }
 
+// GetUsages reports usage for all of the given uids with a single repquota.
+func (m *LinuxQuotaManager) GetUsages(logger lager.Logger, uids []uint32) (map[uint32]garden.ContainerDiskStat, error) {
+	usages := make(map[uint32]garden.ContainerDiskStat, len(uids))
+
+	if !m.enabled || len(uids) == 0 {
+		for _, uid := range uids {
+			usages[uid] = garden.ContainerDiskStat{}
+		}
+
+		return usages, nil
+	}
+
+	args := []string{m.mountPoint}
+	for _, uid := range uids {
+		args = append(args, fmt.Sprintf("%d", uid))
+	}
+
+	repquota := exec.Command(path.Join(m.binPath, "repquota"), args...)
+
+	out := new(bytes.Buffer)
+
+	repquota.Stdout = out
+
+	runner := logging.Runner{
+		Logger:        logger,
+		CommandRunner: m.runner,
+	}
+
+	err := runner.Run(repquota)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		var uid uint32
+		var skip uint64
+
+		usage := garden.ContainerDiskStat{}
+
+		_, err := fmt.Sscanf(
+			scanner.Text(),
+			"%d %d %d %d %d %d %d %d",
+			&uid,
+			&usage.BytesUsed,
+			&skip,
+			&skip,
+			&skip,
+			&usage.InodesUsed,
+			&skip,
+			&skip,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		usages[uid] = usage
+	}
+
+	for _, uid := range uids {
+		if _, found := usages[uid]; !found {
+			return nil, fmt.Errorf("quota_manager: no usage reported for uid %d", uid)
+		}
+	}
+
+	return usages, nil
+}
+
 func (m *LinuxQuotaManager) MountPoint() string {
 	return m.mountPoint
 }
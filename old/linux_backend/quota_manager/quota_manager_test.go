@@ -275,6 +275,104 @@ var _ = Describe("Linux Quota manager", func() {
 		})
 	})
 
+	Describe("getting usage for many uids", func() {
+		It("executes repquota once for all of them", func() {
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: "/root/path/repquota",
+					Args: []string{"/some/mount/point", "1234", "5678"},
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("1234 111 222 333 444 555 666 777 888\n"))
+					cmd.Stdout.Write([]byte("5678 11 22 33 44 55 66 77 88\n"))
+
+					return nil
+				},
+			)
+
+			usages, err := quotaManager.GetUsages(logger, []uint32{1234, 5678})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(usages).Should(Equal(map[uint32]garden.ContainerDiskStat{
+				1234: {BytesUsed: 111, InodesUsed: 555},
+				5678: {BytesUsed: 11, InodesUsed: 55},
+			}))
+		})
+
+		Context("when repquota fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/repquota",
+					}, func(cmd *exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				_, err := quotaManager.GetUsages(logger, []uint32{1234, 5678})
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+
+		Context("when a uid is missing from the output", func() {
+			It("returns an error", func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/repquota",
+					}, func(cmd *exec.Cmd) error {
+						cmd.Stdout.Write([]byte("1234 111 222 333 444 555 666 777 888\n"))
+
+						return nil
+					},
+				)
+
+				_, err := quotaManager.GetUsages(logger, []uint32{1234, 5678})
+				Ω(err).Should(MatchError("quota_manager: no usage reported for uid 5678"))
+			})
+		})
+
+		Context("when the output of repquota is malformed", func() {
+			It("returns an error", func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/repquota",
+					}, func(cmd *exec.Cmd) error {
+						cmd.Stdout.Write([]byte("abc\n"))
+
+						return nil
+					},
+				)
+
+				_, err := quotaManager.GetUsages(logger, []uint32{1234})
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+
+		Context("when quotas are disabled", func() {
+			BeforeEach(func() {
+				quotaManager.Disable()
+			})
+
+			It("reports zero usage without running anything", func() {
+				usages, err := quotaManager.GetUsages(logger, []uint32{1234})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(usages).Should(Equal(map[uint32]garden.ContainerDiskStat{
+					1234: {},
+				}))
+
+				Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/repquota",
+					},
+				))
+			})
+		})
+	})
+
 	Describe("getting the mount point", func() {
 		It("returns the mount point of the container depot", func() {
 			Ω(quotaManager.MountPoint()).Should(Equal("/some/mount/point"))
@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"github.com/cloudfoundry-incubator/garden-linux/network/cnet"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/uid_pool"
 )
 
 type Resources struct {
@@ -14,6 +15,15 @@ type Resources struct {
 	Ports      []uint32
 	ExternalIP net.IP
 
+	// How the IDs of the container's user namespace map to the host; nil
+	// when it has none, i.e. when privileged.
+	UIDMappings IDMappings
+	GIDMappings IDMappings
+
+	// The range of host IDs the container's user namespace maps to, when it
+	// has one of its own rather than only RootUID.
+	SubordinateUIDs *uid_pool.UIDRange
+
 	portsLock *sync.Mutex
 }
 
@@ -17,12 +17,28 @@ if [ -f ./run/wshd.pid ]
 then
   pid=$(cat ./run/wshd.pid)
 
-  # Arbitrarily pick the cpu substem to check for live tasks.
-  path=${cgroup_path}/cpu/instance-$id
-  tasks=$path/tasks
+  if [ "${GARDEN_CGROUP_UNIFIED:-false}" = "true" ]
+  then
+    path=${cgroup_path}/instance-$id
+    tasks=$path/cgroup.procs
+    freezer_state=$path/cgroup.freeze
+    thawed=0
+  else
+    # Arbitrarily pick the cpu substem to check for live tasks.
+    path=${cgroup_path}/cpu/instance-$id
+    tasks=$path/tasks
+    freezer_state=${cgroup_path}/freezer/instance-$id/freezer.state
+    thawed=THAWED
+  fi
 
   if [ -d $path ]
   then
+    # Thaw the container in case it is paused; frozen tasks cannot be reaped.
+    if [ -f $freezer_state ]
+    then
+      echo $thawed > $freezer_state
+    fi
+
     # Kill the container's init pid; the kernel will reap all tasks.
     kill -9 $pid
 
@@ -39,7 +55,7 @@ then
   rm -f ./run/wshd.pid
 
   # Remove cgroups
-  for system_path in ${cgroup_path}/*
+  for system_path in ${cgroup_path} ${cgroup_path}/*
   do
     path=$system_path/instance-$id
 
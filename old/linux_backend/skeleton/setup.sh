@@ -22,6 +22,8 @@ bridge_iface="${bridge_iface}"
 network_cidr_suffix=${network_cidr_suffix:-30}
 user_uid=${user_uid:-10000}
 root_uid=${root_uid:-10000}
+uid_mappings=${uid_mappings:-$(printf "0 $root_uid 1\n$user_uid $user_uid 1")}
+gid_mappings=${gid_mappings:-$uid_mappings}
 rootfs_path=$(readlink -f $rootfs_path)
 
 # Write configuration
@@ -41,6 +43,11 @@ rootfs_path=$rootfs_path
 external_ip=$external_ip
 EOS
 
+# Write user namespace mappings, a line per range of ids, as the kernel
+# expects them in /proc/<pid>/{uid,gid}_map
+echo "$uid_mappings" > etc/uid_map
+echo "$gid_mappings" > etc/gid_map
+
 # Strip /dev down to the bare minimum
 rm -rf $rootfs_path/dev/*
 
@@ -47,8 +47,12 @@ ms_start=$(ms)
 ms_end=$(($ms_start + ($WAIT * 1000)))
 
 pid=$(cat ./run/wshd.pid)
-path=${GARDEN_CGROUP_PATH}/cpu/instance-$id
-tasks=$path/tasks
+if [ "${GARDEN_CGROUP_UNIFIED:-false}" = "true" ]
+then
+  tasks=${GARDEN_CGROUP_PATH}/instance-$id/cgroup.threads
+else
+  tasks=${GARDEN_CGROUP_PATH}/cpu/instance-$id/tasks
+fi
 
 while true
 do
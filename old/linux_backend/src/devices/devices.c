@@ -0,0 +1,196 @@
+#include <errno.h>
+#include <fcntl.h>
+#include <linux/bpf.h>
+#include <stdio.h>
+#include <string.h>
+#include <sys/syscall.h>
+#include <unistd.h>
+
+/* Restricts device access of a cgroup v2 group to the same whitelist
+ * hook-parent-after-clone.sh writes to devices.allow on cgroup v1. Cgroup v2
+ * has no devices controller files; access is instead decided by a
+ * BPF_PROG_TYPE_CGROUP_DEVICE program attached to the group, which stays
+ * attached for as long as the group exists. */
+
+#define ANY -1
+
+#define ACC_M (BPF_DEVCG_ACC_MKNOD)
+#define ACC_RWM (BPF_DEVCG_ACC_MKNOD | BPF_DEVCG_ACC_READ | BPF_DEVCG_ACC_WRITE)
+
+struct rule {
+  int type;
+  int major;
+  int minor;
+  int access;
+};
+
+static const struct rule whitelist[] = {
+  /* mknod for everything */
+  { BPF_DEVCG_DEV_CHAR, ANY, ANY, ACC_M },
+  { BPF_DEVCG_DEV_BLOCK, ANY, ANY, ACC_M },
+
+  /* /dev/null */
+  { BPF_DEVCG_DEV_CHAR, 1, 3, ACC_RWM },
+  /* /dev/zero */
+  { BPF_DEVCG_DEV_CHAR, 1, 5, ACC_RWM },
+  /* /dev/full */
+  { BPF_DEVCG_DEV_CHAR, 1, 7, ACC_RWM },
+  /* /dev/random */
+  { BPF_DEVCG_DEV_CHAR, 1, 8, ACC_RWM },
+  /* /dev/urandom */
+  { BPF_DEVCG_DEV_CHAR, 1, 9, ACC_RWM },
+  /* /dev/tty0 */
+  { BPF_DEVCG_DEV_CHAR, 4, 0, ACC_RWM },
+  /* /dev/tty1 */
+  { BPF_DEVCG_DEV_CHAR, 4, 1, ACC_RWM },
+  /* /dev/tty */
+  { BPF_DEVCG_DEV_CHAR, 5, 0, ACC_RWM },
+  /* /dev/console */
+  { BPF_DEVCG_DEV_CHAR, 5, 1, ACC_RWM },
+  /* /dev/ptmx */
+  { BPF_DEVCG_DEV_CHAR, 5, 2, ACC_RWM },
+  /* /dev/pts/* */
+  { BPF_DEVCG_DEV_CHAR, 136, ANY, ACC_RWM },
+  /* tuntap (?) */
+  { BPF_DEVCG_DEV_CHAR, 10, 200, ACC_RWM },
+  /* /dev/fuse */
+  { BPF_DEVCG_DEV_CHAR, 10, 229, ACC_RWM },
+};
+
+#define RULES (sizeof(whitelist) / sizeof(whitelist[0]))
+
+/* type check, access check (3), major and minor checks, allow (2) */
+#define MAX_RULE_INSNS 8
+
+/* loading the context (5), each rule, deny (2) */
+#define MAX_INSNS (5 + RULES * MAX_RULE_INSNS + 2)
+
+#define INSN(c, d, s, o, i) \
+  ((struct bpf_insn) { .code = (c), .dst_reg = (d), .src_reg = (s), .off = (o), .imm = (i) })
+
+#define LDX_W(dst, src, off) INSN(BPF_LDX | BPF_MEM | BPF_W, dst, src, off, 0)
+#define ALU32_IMM(op, dst, imm) INSN(BPF_ALU | (op) | BPF_K, dst, 0, 0, imm)
+#define MOV32_REG(dst, src) INSN(BPF_ALU | BPF_MOV | BPF_X, dst, src, 0, 0)
+#define MOV64_IMM(dst, imm) INSN(BPF_ALU64 | BPF_MOV | BPF_K, dst, 0, 0, imm)
+#define JNE_IMM(dst, imm, off) INSN(BPF_JMP | BPF_JNE | BPF_K, dst, 0, off, imm)
+#define JNE_REG(dst, src, off) INSN(BPF_JMP | BPF_JNE | BPF_X, dst, src, off, 0)
+#define EXIT() INSN(BPF_JMP | BPF_EXIT, 0, 0, 0, 0)
+
+/* `emit_rule` appends the instructions allowing access matching `rule`,
+ * returning how many were appended. Any check failing jumps past them, on
+ * to the next rule. */
+size_t emit_rule(struct bpf_insn *insns, const struct rule *rule) {
+  struct bpf_insn checks[MAX_RULE_INSNS];
+  size_t n = 0;
+  size_t i;
+
+  /* R2 holds the device type, R3 the access requested, R4 and R5 the major
+   * and minor numbers */
+  checks[n++] = JNE_IMM(BPF_REG_2, rule->type, 0);
+
+  if (rule->access != ACC_RWM) {
+    /* requested access must be a subset of the access allowed */
+    checks[n++] = MOV32_REG(BPF_REG_1, BPF_REG_3);
+    checks[n++] = ALU32_IMM(BPF_AND, BPF_REG_1, rule->access);
+    checks[n++] = JNE_REG(BPF_REG_1, BPF_REG_3, 0);
+  }
+
+  if (rule->major != ANY) {
+    checks[n++] = JNE_IMM(BPF_REG_4, rule->major, 0);
+  }
+
+  if (rule->minor != ANY) {
+    checks[n++] = JNE_IMM(BPF_REG_5, rule->minor, 0);
+  }
+
+  for (i = 0; i < n; i++) {
+    if (BPF_CLASS(checks[i].code) == BPF_JMP) {
+      /* skip the remaining checks and the two instructions allowing access */
+      checks[i].off = n - i - 1 + 2;
+    }
+
+    insns[i] = checks[i];
+  }
+
+  insns[n++] = MOV64_IMM(BPF_REG_0, 1);
+  insns[n++] = EXIT();
+
+  return n;
+}
+
+size_t build_program(struct bpf_insn *insns) {
+  size_t n = 0;
+  size_t i;
+
+  insns[n++] = LDX_W(BPF_REG_2, BPF_REG_1, offsetof(struct bpf_cgroup_dev_ctx, access_type));
+  insns[n++] = ALU32_IMM(BPF_AND, BPF_REG_2, 0xFFFF);
+  insns[n++] = LDX_W(BPF_REG_3, BPF_REG_1, offsetof(struct bpf_cgroup_dev_ctx, access_type));
+  insns[n++] = ALU32_IMM(BPF_RSH, BPF_REG_3, 16);
+  insns[n++] = LDX_W(BPF_REG_4, BPF_REG_1, offsetof(struct bpf_cgroup_dev_ctx, major));
+  insns[n++] = LDX_W(BPF_REG_5, BPF_REG_1, offsetof(struct bpf_cgroup_dev_ctx, minor));
+
+  for (i = 0; i < RULES; i++) {
+    n += emit_rule(insns + n, &whitelist[i]);
+  }
+
+  /* deny everything else */
+  insns[n++] = MOV64_IMM(BPF_REG_0, 0);
+  insns[n++] = EXIT();
+
+  return n;
+}
+
+int bpf(int cmd, union bpf_attr *attr) {
+  return syscall(__NR_bpf, cmd, attr, sizeof(*attr));
+}
+
+int main(int argc, char **argv) {
+  struct bpf_insn insns[MAX_INSNS + 1];
+  char log[4096];
+  union bpf_attr attr;
+  int prog_fd;
+  int cgroup_fd;
+  int rv;
+
+  if (argc != 2) {
+    fprintf(stderr, "Usage: %s <path to cgroup>\n", argv[0]);
+    return 1;
+  }
+
+  cgroup_fd = open(argv[1], O_RDONLY | O_DIRECTORY);
+  if (cgroup_fd == -1) {
+    perror("open");
+    return 1;
+  }
+
+  log[0] = '\0';
+
+  memset(&attr, 0, sizeof(attr));
+  attr.prog_type = BPF_PROG_TYPE_CGROUP_DEVICE;
+  attr.insns = (unsigned long) insns;
+  attr.insn_cnt = build_program(insns);
+  attr.license = (unsigned long) "Apache";
+  attr.log_buf = (unsigned long) log;
+  attr.log_size = sizeof(log);
+  attr.log_level = 1;
+
+  prog_fd = bpf(BPF_PROG_LOAD, &attr);
+  if (prog_fd == -1) {
+    perror("bpf(BPF_PROG_LOAD)");
+    fprintf(stderr, "%s", log);
+    return 1;
+  }
+
+  memset(&attr, 0, sizeof(attr));
+  attr.target_fd = cgroup_fd;
+  attr.attach_bpf_fd = prog_fd;
+  attr.attach_type = BPF_CGROUP_DEVICE;
+
+  rv = bpf(BPF_PROG_ATTACH, &attr);
+  if (rv == -1) {
+    perror("bpf(BPF_PROG_ATTACH)");
+    return 1;
+  }
+
+  return 0;
+}
@@ -6,6 +6,7 @@
 #include <stdlib.h>
 #include <string.h>
 #include <sys/eventfd.h>
+#include <sys/inotify.h>
 #include <sys/param.h>
 #include <sys/prctl.h>
 #include <sys/stat.h>
@@ -61,6 +62,81 @@ int detect_oom(int event_fd, const char *event_control_path) {
   return 0;
 }
 
+/* `read_oom_count` returns the "oom" counter of a cgroup v2 memory.events
+ * file, or -1 if it cannot be read. */
+long long read_oom_count(const char *memory_events_path) {
+  FILE *events;
+  char key[64];
+  long long value;
+  long long count = -1;
+
+  events = fopen(memory_events_path, "r");
+  if (events == NULL) {
+    return -1;
+  }
+
+  while (fscanf(events, "%63s %lld", key, &value) == 2) {
+    if (strcmp(key, "oom") == 0) {
+      count = value;
+      break;
+    }
+  }
+
+  fclose(events);
+
+  return count;
+}
+
+/* `detect_unified_oom` watches memory.events of a cgroup v2 group, returning
+ * zero when its oom counter goes up, non-zero otherwise. */
+int detect_unified_oom(const char *memory_events_path) {
+  char buf[4096] __attribute__ ((aligned(__alignof__(struct inotify_event))));
+  long long initial_count;
+  long long count;
+  int inotify_fd;
+  int rv;
+
+  inotify_fd = inotify_init();
+  if (inotify_fd == -1) {
+    perror("inotify_init");
+    return -1;
+  }
+
+  rv = inotify_add_watch(inotify_fd, memory_events_path, IN_MODIFY);
+  if (rv == -1) {
+    perror("inotify_add_watch");
+    return -1;
+  }
+
+  initial_count = read_oom_count(memory_events_path);
+  if (initial_count == -1) {
+    fprintf(stderr, "failed to read %s\n", memory_events_path);
+    return -1;
+  }
+
+  for (;;) {
+    do {
+      rv = read(inotify_fd, buf, sizeof(buf));
+    } while (rv == -1 && errno == EINTR);
+
+    if (rv == -1) {
+      perror("read");
+      return -1;
+    }
+
+    count = read_oom_count(memory_events_path);
+
+    /* The cgroup was removed */
+    if (count == -1) {
+      return -1;
+    }
+
+    if (count > initial_count) {
+      return 0;
+    }
+  }
+}
+
 int main(int argc, char **argv) {
   int event_fd = -1;
   char oom_control_path[PATH_MAX];
@@ -85,6 +161,25 @@ int main(int argc, char **argv) {
     return 1;
   }
 
+  /* Hosts using the cgroup v2 unified hierarchy report OOMs via memory.events */
+  event_control_path_len = snprintf(event_control_path, sizeof(event_control_path), "%s/cgroup.event_control", argv[1]);
+  assert(event_control_path_len < sizeof(event_control_path));
+
+  if (access(event_control_path, F_OK) == -1) {
+    char memory_events_path[PATH_MAX];
+    size_t memory_events_path_len;
+
+    memory_events_path_len = snprintf(memory_events_path, sizeof(memory_events_path), "%s/memory.events", argv[1]);
+    assert(memory_events_path_len < sizeof(memory_events_path));
+
+    if (detect_unified_oom(memory_events_path) == -1) {
+      return 1;
+    }
+
+    /* OOM happened */
+    return 0;
+  }
+
   /* Open event fd */
   event_fd = eventfd(0, 0);
   if (event_fd == -1) {
@@ -103,9 +198,6 @@ int main(int argc, char **argv) {
   }
 
   /* Open event control file */
-  event_control_path_len = snprintf(event_control_path, sizeof(event_control_path), "%s/cgroup.event_control", argv[1]);
-  assert(event_control_path_len < sizeof(event_control_path));
-
   event_control_fd = open(event_control_path, O_WRONLY);
   if (event_control_fd == -1) {
     perror("open");
@@ -1,5 +1,7 @@
 package fake_uid_pool
 
+import "github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/uid_pool"
+
 type FakeUIDPool struct {
 	nextUID uint32
 
@@ -47,3 +49,53 @@ func (p *FakeUIDPool) Remove(uid uint32) error {
 func (p *FakeUIDPool) Release(uid uint32) {
 	p.Released = append(p.Released, uid)
 }
+
+type FakeUIDRangePool struct {
+	nextStart uint32
+
+	InitialPoolSize int
+
+	AcquireRangeError error
+	RemoveRangeError  error
+
+	AcquiredRanges []uid_pool.UIDRange
+	ReleasedRanges []uid_pool.UIDRange
+	RemovedRanges  []uid_pool.UIDRange
+}
+
+func NewRangePool(start uint32) *FakeUIDRangePool {
+	return &FakeUIDRangePool{
+		nextStart: start,
+	}
+}
+
+func (p *FakeUIDRangePool) InitialSize() int {
+	return p.InitialPoolSize
+}
+
+func (p *FakeUIDRangePool) AcquireRange(size uint32) (uid_pool.UIDRange, error) {
+	if p.AcquireRangeError != nil {
+		return uid_pool.UIDRange{}, p.AcquireRangeError
+	}
+
+	uidRange := uid_pool.UIDRange{Start: p.nextStart, Size: size}
+	p.nextStart += size
+
+	p.AcquiredRanges = append(p.AcquiredRanges, uidRange)
+
+	return uidRange, nil
+}
+
+func (p *FakeUIDRangePool) RemoveRange(uidRange uid_pool.UIDRange) error {
+	if p.RemoveRangeError != nil {
+		return p.RemoveRangeError
+	}
+
+	p.RemovedRanges = append(p.RemovedRanges, uidRange)
+
+	return nil
+}
+
+func (p *FakeUIDRangePool) ReleaseRange(uidRange uid_pool.UIDRange) {
+	p.ReleasedRanges = append(p.ReleasedRanges, uidRange)
+}
@@ -0,0 +1,128 @@
+package uid_pool
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// UIDRange is a contiguous range of IDs, e.g. the host IDs the IDs of a
+// container's user namespace map to.
+type UIDRange struct {
+	Start uint32 `json:"start"`
+	Size  uint32 `json:"size"`
+}
+
+func (r UIDRange) End() uint32 {
+	return r.Start + r.Size
+}
+
+func (r UIDRange) overlaps(other UIDRange) bool {
+	return r.Start < other.End() && other.Start < r.End()
+}
+
+type UIDRangePool interface {
+	AcquireRange(size uint32) (UIDRange, error)
+	RemoveRange(UIDRange) error
+	ReleaseRange(UIDRange)
+	InitialSize() int
+}
+
+type UIDRangeTakenError struct {
+	Range UIDRange
+}
+
+func (e UIDRangeTakenError) Error() string {
+	return fmt.Sprintf("uid range already acquired: %d-%d", e.Range.Start, e.Range.End()-1)
+}
+
+// UnixUIDRangePool hands out ranges of IDs from a larger range, keeping
+// track of those acquired rather than of every free ID.
+type UnixUIDRangePool struct {
+	start uint32
+	size  uint32
+
+	acquired      []UIDRange
+	acquiredMutex *sync.Mutex
+}
+
+func NewRangePool(start, size uint32) *UnixUIDRangePool {
+	return &UnixUIDRangePool{
+		start: start,
+		size:  size,
+
+		acquiredMutex: new(sync.Mutex),
+	}
+}
+
+func (p *UnixUIDRangePool) InitialSize() int {
+	return int(p.size)
+}
+
+// AcquireRange acquires the lowest free range of the given size.
+func (p *UnixUIDRangePool) AcquireRange(size uint32) (UIDRange, error) {
+	p.acquiredMutex.Lock()
+	defer p.acquiredMutex.Unlock()
+
+	candidate := UIDRange{Start: p.start, Size: size}
+
+	for _, acquired := range p.acquired {
+		if acquired.End() <= candidate.Start {
+			continue
+		}
+
+		if !candidate.overlaps(acquired) {
+			break
+		}
+
+		candidate.Start = acquired.End()
+	}
+
+	if size == 0 || uint64(candidate.Start)+uint64(size) > uint64(p.start)+uint64(p.size) {
+		return UIDRange{}, PoolExhaustedError{}
+	}
+
+	p.add(candidate)
+
+	return candidate, nil
+}
+
+// RemoveRange acquires a specific range, e.g. one acquired before a restart.
+func (p *UnixUIDRangePool) RemoveRange(uidRange UIDRange) error {
+	p.acquiredMutex.Lock()
+	defer p.acquiredMutex.Unlock()
+
+	for _, acquired := range p.acquired {
+		if uidRange.overlaps(acquired) {
+			return UIDRangeTakenError{uidRange}
+		}
+	}
+
+	p.add(uidRange)
+
+	return nil
+}
+
+func (p *UnixUIDRangePool) ReleaseRange(uidRange UIDRange) {
+	p.acquiredMutex.Lock()
+	defer p.acquiredMutex.Unlock()
+
+	for i, acquired := range p.acquired {
+		if acquired == uidRange {
+			p.acquired = append(p.acquired[:i], p.acquired[i+1:]...)
+			return
+		}
+	}
+}
+
+func (p *UnixUIDRangePool) add(uidRange UIDRange) {
+	p.acquired = append(p.acquired, uidRange)
+
+	sort.Sort(byStart(p.acquired))
+}
+
+type byStart []UIDRange
+
+func (r byStart) Len() int           { return len(r) }
+func (r byStart) Less(i, j int) bool { return r[i].Start < r[j].Start }
+func (r byStart) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
@@ -0,0 +1,101 @@
+package uid_pool_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/uid_pool"
+)
+
+var _ = Describe("Unix UID range pool", func() {
+	Describe("acquiring", func() {
+		It("returns the lowest available range of the given size", func() {
+			pool := uid_pool.NewRangePool(100000, 1000)
+
+			range1, err := pool.AcquireRange(100)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			range2, err := pool.AcquireRange(200)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(range1).Should(Equal(uid_pool.UIDRange{Start: 100000, Size: 100}))
+			Ω(range2).Should(Equal(uid_pool.UIDRange{Start: 100100, Size: 200}))
+		})
+
+		It("fills gaps left by released ranges", func() {
+			pool := uid_pool.NewRangePool(100000, 1000)
+
+			range1, err := pool.AcquireRange(100)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = pool.AcquireRange(100)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			pool.ReleaseRange(range1)
+
+			range3, err := pool.AcquireRange(100)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(range3).Should(Equal(range1))
+
+			range4, err := pool.AcquireRange(100)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(range4).Should(Equal(uid_pool.UIDRange{Start: 100200, Size: 100}))
+		})
+
+		Context("when no range of the size is left", func() {
+			It("returns an error", func() {
+				pool := uid_pool.NewRangePool(100000, 250)
+
+				_, err := pool.AcquireRange(100)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = pool.AcquireRange(100)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = pool.AcquireRange(100)
+				Ω(err).Should(Equal(uid_pool.PoolExhaustedError{}))
+			})
+		})
+	})
+
+	Describe("removing", func() {
+		It("acquires a specific range from the pool", func() {
+			pool := uid_pool.NewRangePool(100000, 1000)
+
+			err := pool.RemoveRange(uid_pool.UIDRange{Start: 100000, Size: 100})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			uidRange, err := pool.AcquireRange(100)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(uidRange).Should(Equal(uid_pool.UIDRange{Start: 100100, Size: 100}))
+		})
+
+		Context("when the range overlaps an acquired one", func() {
+			It("returns a UIDRangeTakenError", func() {
+				pool := uid_pool.NewRangePool(100000, 1000)
+
+				_, err := pool.AcquireRange(100)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				overlapping := uid_pool.UIDRange{Start: 100050, Size: 100}
+
+				err = pool.RemoveRange(overlapping)
+				Ω(err).Should(Equal(uid_pool.UIDRangeTakenError{overlapping}))
+			})
+		})
+	})
+
+	Describe("releasing", func() {
+		It("makes the range available again", func() {
+			pool := uid_pool.NewRangePool(100000, 100)
+
+			uidRange, err := pool.AcquireRange(100)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			pool.ReleaseRange(uidRange)
+
+			_, err = pool.AcquireRange(100)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+})
@@ -3,12 +3,15 @@ package old
 import (
 	"bytes"
 	"flag"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/cloudfoundry/gunk/command_runner"
 	"github.com/docker/docker/daemon/graphdriver"
@@ -25,7 +28,9 @@ import (
 	"github.com/cloudfoundry-incubator/garden-linux/network"
 	"github.com/cloudfoundry-incubator/garden-linux/network/cnet"
 	"github.com/cloudfoundry-incubator/garden-linux/network/iptables"
+	"github.com/cloudfoundry-incubator/garden-linux/old/admin"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/cgroups_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/port_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/repository_fetcher"
@@ -56,6 +61,12 @@ var snapshotsPath = flag.String(
 	"directory in which to store container state to persist through restarts",
 )
 
+var snapshotInterval = flag.Duration(
+	"snapshotInterval",
+	time.Minute,
+	"how often to snapshot every container, besides on creating and destroying them (0 disables)",
+)
+
 var binPath = flag.String(
 	"bin",
 	"",
@@ -116,6 +127,24 @@ var uidPoolSize = flag.Uint(
 	"size of the uid pool",
 )
 
+var subordinateUIDPoolStart = flag.Uint(
+	"subordinateUIDPoolStart",
+	100000,
+	"start of the host ids which unprivileged containers' user namespaces map to",
+)
+
+var subordinateUIDPoolSize = flag.Uint(
+	"subordinateUIDPoolSize",
+	0,
+	"size of the pool of host ids which unprivileged containers' user namespaces map to; 0 maps only their root and vcap users",
+)
+
+var subordinateUIDRangeSize = flag.Uint(
+	"subordinateUIDRangeSize",
+	65536,
+	"number of host ids each unprivileged container's user namespace maps to",
+)
+
 var denyNetworks = flag.String(
 	"denyNetworks",
 	"",
@@ -166,6 +195,36 @@ var allowHostAccess = flag.Bool(
 	"allow network access to host",
 )
 
+var processScrollbackBytes = flag.Int(
+	"processScrollbackBytes",
+	0,
+	"bytes of recent stdout and stderr to keep per process and replay when attaching to it; 0 disables",
+)
+
+var memoryOvercommitRatio = flag.Float64(
+	"memoryOvercommitRatio",
+	0,
+	"refuse to create containers once their summed memory limits would exceed the host's memory times this ratio; 0 disables",
+)
+
+var diskOvercommitRatio = flag.Float64(
+	"diskOvercommitRatio",
+	0,
+	"refuse to create containers once their summed disk limits would exceed the host's disk times this ratio; 0 disables",
+)
+
+var adminNetwork = flag.String(
+	"adminNetwork",
+	"unix",
+	"how to listen on the admin address (unix, tcp, etc.); the admin endpoints are unauthenticated, so keep them local",
+)
+
+var adminAddr = flag.String(
+	"adminAddr",
+	"",
+	"address for serving the admin endpoints (e.g. PUT/DELETE /drain), e.g. /tmp/garden-admin.sock or 127.0.0.1:7778; disabled if empty",
+)
+
 var iptablesLogMethod = flag.String(
 	"iptablesLogMethod",
 	"kernel",
@@ -196,6 +255,11 @@ func Main(builder cnet.Builder) {
 
 	uidPool := uid_pool.New(uint32(*uidPoolStart), uint32(*uidPoolSize))
 
+	var subordinateUIDPool uid_pool.UIDRangePool
+	if *subordinateUIDPoolSize > 0 {
+		subordinateUIDPool = uid_pool.NewRangePool(uint32(*subordinateUIDPoolStart), uint32(*subordinateUIDPoolSize))
+	}
+
 	// TODO: use /proc/sys/net/ipv4/ip_local_port_range by default (end + 1)
 	portPool := port_pool.New(uint32(*portPoolStart), uint32(*portPoolSize))
 
@@ -214,6 +278,17 @@ func Main(builder cnet.Builder) {
 
 	config := sysconfig.NewConfig(*tag, *allowHostAccess)
 
+	unifiedCgroups, err := cgroups_manager.IsUnified("/sys/fs/cgroup")
+	if err != nil {
+		logger.Fatal("failed-to-detect-cgroup-version", err)
+	}
+
+	config.UnifiedCgroups = unifiedCgroups
+
+	logger.Info("detected-cgroups", lager.Data{
+		"unified": unifiedCgroups,
+	})
+
 	runner := sysconfig.NewRunner(config, linux_command_runner.New())
 
 	quotaManager := quota_manager.New(runner, getMountPoint(logger, *depotPath), *binPath)
@@ -279,12 +354,22 @@ func Main(builder cnet.Builder) {
 		strings.Split(*allowNetworks, ","),
 		runner,
 		quotaManager,
+		*processScrollbackBytes,
+		subordinateUIDPool,
+		uint32(*subordinateUIDRangeSize),
 	)
 
 	systemInfo := system_info.NewProvider(*depotPath)
 
 	backend := linux_backend.New(logger, pool, systemInfo, *snapshotsPath)
 
+	backend.SetSnapshotInterval(*snapshotInterval)
+
+	backend.SetAdmissionPolicy(linux_backend.AdmissionPolicy{
+		MemoryOvercommitRatio: *memoryOvercommitRatio,
+		DiskOvercommitRatio:   *diskOvercommitRatio,
+	})
+
 	err = backend.Setup()
 	if err != nil {
 		logger.Fatal("failed-to-set-up-backend", err)
@@ -309,6 +394,42 @@ func Main(builder cnet.Builder) {
 
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
+	// SIGUSR1 starts draining, SIGUSR2 stops it
+	drainSignals := make(chan os.Signal, 1)
+
+	go func() {
+		for sig := range drainSignals {
+			if sig == syscall.SIGUSR1 {
+				backend.Drain()
+			} else {
+				backend.Undrain()
+			}
+		}
+	}()
+
+	signal.Notify(drainSignals, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	if *adminAddr != "" {
+		if *adminNetwork == "unix" {
+			// a stale socket from a previous run
+			os.Remove(*adminAddr)
+		}
+
+		listener, err := net.Listen(*adminNetwork, *adminAddr)
+		if err != nil {
+			logger.Fatal("failed-to-listen-for-admin", err)
+		}
+
+		if *adminNetwork == "unix" {
+			err = os.Chmod(*adminAddr, 0700)
+			if err != nil {
+				logger.Fatal("failed-to-restrict-admin-socket", err)
+			}
+		}
+
+		go http.Serve(listener, admin.NewHandler(logger, backend))
+	}
+
 	logger.Info("started", lager.Data{
 		"network": *listenNetwork,
 		"addr":    *listenAddr,
@@ -9,6 +9,7 @@ import (
 
 type Config struct {
 	CgroupPath             string
+	UnifiedCgroups         bool
 	NetworkInterfacePrefix string
 	IPTables               IPTablesConfig
 	Tag                    string
@@ -59,7 +60,8 @@ func NewConfig(tag string, allowHostAccess bool) Config {
 
 func (config Config) Environ() process.Env {
 	return process.Env{
-		"GARDEN_CGROUP_PATH": config.CgroupPath,
+		"GARDEN_CGROUP_PATH":    config.CgroupPath,
+		"GARDEN_CGROUP_UNIFIED": strconv.FormatBool(config.UnifiedCgroups),
 
 		"GARDEN_NETWORK_INTERFACE_PREFIX": config.NetworkInterfacePrefix,
 		"GARDEN_TAG":                      config.Tag,
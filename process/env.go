@@ -1,8 +1,10 @@
 package process
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"sort"
 	"strings"
 )
@@ -17,7 +19,8 @@ func NewEnv(array []string) (Env, error) {
 			return nil, errors.New("malformed environment: empty string")
 		}
 
-		tokens := strings.Split(str, "=")
+		// values may themselves contain '=', e.g. JAVA_OPTS=-Dfoo=bar
+		tokens := strings.SplitN(str, "=", 2)
 
 		if len(tokens) != 2 {
 			return nil, fmt.Errorf("malformed environment: invalid format (not key=value): %q", str)
@@ -35,6 +38,51 @@ func NewEnv(array []string) (Env, error) {
 	return env, nil
 }
 
+// ParseEnvFile parses a file of environment variables such as
+// /etc/environment: a key=value per line, optionally preceded by "export"
+// and with the value in quotes. Blank lines and comments are skipped.
+func ParseEnvFile(r io.Reader) (Env, error) {
+	var array []string
+
+	scanner := bufio.NewScanner(r)
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		tokens := strings.SplitN(line, "=", 2)
+		if len(tokens) != 2 {
+			return nil, fmt.Errorf("malformed env file: line %d: invalid format (not key=value): %q", lineNum, line)
+		}
+
+		array = append(array, tokens[0]+"="+unquote(tokens[1]))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewEnv(array)
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 {
+		first, last := value[0], value[len(value)-1]
+		if first == last && (first == '"' || first == '\'') {
+			return value[1 : len(value)-1]
+		}
+	}
+
+	return value
+}
+
 func (env Env) Merge(other Env) Env {
 	merged := make(Env, len(env)+len(other))
 
@@ -49,6 +97,50 @@ func (env Env) Merge(other Env) Env {
 	return merged
 }
 
+// Expand replaces each ${VAR} in the values of env with the value of VAR in
+// vars, or with nothing if it is not set, as a shell would. $${ is left as a
+// literal ${; other uses of '$' are left alone, so need no escaping.
+func (env Env) Expand(vars Env) Env {
+	expanded := make(Env, len(env))
+
+	for key, value := range env {
+		expanded[key] = expand(value, vars)
+	}
+
+	return expanded
+}
+
+func expand(value string, vars Env) string {
+	var expanded []byte
+
+	for {
+		start := strings.Index(value, "${")
+		if start == -1 {
+			break
+		}
+
+		if start > 0 && value[start-1] == '$' {
+			expanded = append(expanded, value[:start-1]...)
+			expanded = append(expanded, "${"...)
+
+			value = value[start+2:]
+			continue
+		}
+
+		length := strings.Index(value[start+2:], "}")
+		if length == -1 {
+			break
+		}
+
+		expanded = append(expanded, value[:start]...)
+		expanded = append(expanded, vars[value[start+2:start+2+length]]...)
+
+		value = value[start+2+length+1:]
+	}
+
+	return string(append(expanded, value...))
+}
+
 func (env Env) Array() []string {
 	array := make([]string, len(env))
 
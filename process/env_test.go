@@ -1,6 +1,8 @@
 package process_test
 
 import (
+	"strings"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -98,6 +100,19 @@ var _ = Describe("Environment", func() {
 			))
 		})
 
+		It("keeps equals signs in values", func() {
+			env, err := process.NewEnv([]string{
+				"JAVA_OPTS=-Dfoo=bar",
+				"EMPTY=",
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(env).Should(Equal(process.Env{
+				"JAVA_OPTS": "-Dfoo=bar",
+				"EMPTY":     "",
+			}))
+		})
+
 		Context("when the array is malformed", func() {
 			It("returns an error when the array contains an empty string", func() {
 				env, err := process.NewEnv([]string{""})
@@ -113,13 +128,6 @@ var _ = Describe("Environment", func() {
 				Ω(env).Should(BeNil())
 			})
 
-			It("returns an error when the array contains an element with too many equals signs", func() {
-				env, err := process.NewEnv([]string{"key=value="})
-
-				Ω(err).Should(MatchError(`malformed environment: invalid format (not key=value): "key=value="`))
-				Ω(env).Should(BeNil())
-			})
-
 			It("returns an error when the array contains an element without an equals sign", func() {
 				env, err := process.NewEnv([]string{"x"})
 
@@ -129,6 +137,83 @@ var _ = Describe("Environment", func() {
 		})
 	})
 
+	Describe("expanding variables", func() {
+		vars := process.Env{
+			"HOME": "/home/vcap",
+			"PATH": "/usr/bin:/bin",
+		}
+
+		It("replaces ${VAR} with the value of the variable", func() {
+			env := process.Env{
+				"PATH":    "/opt/bin:${PATH}",
+				"CONFIG":  "${HOME}/config-${HOME}",
+				"LITERAL": "no variables",
+			}
+
+			Ω(env.Expand(vars)).Should(Equal(process.Env{
+				"PATH":    "/opt/bin:/usr/bin:/bin",
+				"CONFIG":  "/home/vcap/config-/home/vcap",
+				"LITERAL": "no variables",
+			}))
+		})
+
+		It("replaces unset variables with nothing", func() {
+			env := process.Env{"A": "x${UNSET}y"}
+
+			Ω(env.Expand(vars)).Should(Equal(process.Env{"A": "xy"}))
+		})
+
+		It("leaves other uses of $ alone", func() {
+			env := process.Env{
+				"PASSWORD": "pa$$word",
+				"SHELLISH": "$HOME",
+				"UNCLOSED": "${HOME",
+			}
+
+			Ω(env.Expand(vars)).Should(Equal(env))
+		})
+
+		It("leaves $${VAR} as a literal ${VAR}", func() {
+			env := process.Env{
+				"TEMPLATE": "$${HOME} is ${HOME}",
+				"DOLLARS":  "$$$${HOME}",
+			}
+
+			Ω(env.Expand(vars)).Should(Equal(process.Env{
+				"TEMPLATE": "${HOME} is /home/vcap",
+				"DOLLARS":  "$$${HOME}",
+			}))
+		})
+	})
+
+	Describe("parsing env files", func() {
+		It("parses a variable per line", func() {
+			env, err := process.ParseEnvFile(strings.NewReader(`
+# comments and blank lines are skipped
+
+PATH=/usr/bin:/bin
+export JAVA_OPTS=-Dfoo=bar
+QUOTED="some value"
+SINGLE_QUOTED='some other value'
+`))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(env).Should(Equal(process.Env{
+				"PATH":          "/usr/bin:/bin",
+				"JAVA_OPTS":     "-Dfoo=bar",
+				"QUOTED":        "some value",
+				"SINGLE_QUOTED": "some other value",
+			}))
+		})
+
+		Context("when a line is malformed", func() {
+			It("returns an error naming the line", func() {
+				_, err := process.ParseEnvFile(strings.NewReader("A=b\nnot-a-variable\n"))
+				Ω(err).Should(MatchError(`malformed env file: line 2: invalid format (not key=value): "not-a-variable"`))
+			})
+		})
+	})
+
 	It("produces a string representation", func() {
 		Ω(process.Env{"a": "b"}.String()).Should(Equal(`process.Env{"a":"b"}`))
 	})
@@ -2,6 +2,7 @@
 package fake_process_tracker
 
 import (
+	"io"
 	"os/exec"
 	"sync"
 
@@ -10,14 +11,15 @@ import (
 )
 
 type FakeProcessTracker struct {
-	RunStub        func(uint32, *exec.Cmd, garden.ProcessIO, *garden.TTYSpec, process_tracker.Signaller) (garden.Process, error)
+	RunStub        func(uint32, process_tracker.ProcessSpec, *exec.Cmd, garden.ProcessIO, *garden.TTYSpec, process_tracker.Signaller) (garden.Process, error)
 	runMutex       sync.RWMutex
 	runArgsForCall []struct {
 		arg1 uint32
-		arg2 *exec.Cmd
-		arg3 garden.ProcessIO
-		arg4 *garden.TTYSpec
-		arg5 process_tracker.Signaller
+		arg2 process_tracker.ProcessSpec
+		arg3 *exec.Cmd
+		arg4 garden.ProcessIO
+		arg5 *garden.TTYSpec
+		arg6 process_tracker.Signaller
 	}
 	runReturns struct {
 		result1 garden.Process
@@ -33,10 +35,10 @@ type FakeProcessTracker struct {
 		result1 garden.Process
 		result2 error
 	}
-	RestoreStub        func(processID uint32, signaller process_tracker.Signaller)
+	RestoreStub        func(metadata process_tracker.ProcessMetadata, signaller process_tracker.Signaller)
 	restoreMutex       sync.RWMutex
 	restoreArgsForCall []struct {
-		processID uint32
+		metadata  process_tracker.ProcessMetadata
 		signaller process_tracker.Signaller
 	}
 	ActiveProcessesStub        func() []garden.Process
@@ -45,20 +47,46 @@ type FakeProcessTracker struct {
 	activeProcessesReturns     struct {
 		result1 []garden.Process
 	}
+	ProcessesStub        func() []process_tracker.ProcessMetadata
+	processesMutex       sync.RWMutex
+	processesArgsForCall []struct{}
+	processesReturns     struct {
+		result1 []process_tracker.ProcessMetadata
+	}
+	LogStub        func(processID uint32, request process_tracker.LogRequest, out io.Writer) error
+	logMutex       sync.RWMutex
+	logArgsForCall []struct {
+		processID uint32
+		request   process_tracker.LogRequest
+		out       io.Writer
+	}
+	logReturns struct {
+		result1 error
+	}
+	SignalStub        func(processID uint32, request process_tracker.SignalRequest) error
+	signalMutex       sync.RWMutex
+	signalArgsForCall []struct {
+		processID uint32
+		request   process_tracker.SignalRequest
+	}
+	signalReturns struct {
+		result1 error
+	}
 }
 
-func (fake *FakeProcessTracker) Run(arg1 uint32, arg2 *exec.Cmd, arg3 garden.ProcessIO, arg4 *garden.TTYSpec, arg5 process_tracker.Signaller) (garden.Process, error) {
+func (fake *FakeProcessTracker) Run(arg1 uint32, arg2 process_tracker.ProcessSpec, arg3 *exec.Cmd, arg4 garden.ProcessIO, arg5 *garden.TTYSpec, arg6 process_tracker.Signaller) (garden.Process, error) {
 	fake.runMutex.Lock()
 	fake.runArgsForCall = append(fake.runArgsForCall, struct {
 		arg1 uint32
-		arg2 *exec.Cmd
-		arg3 garden.ProcessIO
-		arg4 *garden.TTYSpec
-		arg5 process_tracker.Signaller
-	}{arg1, arg2, arg3, arg4, arg5})
+		arg2 process_tracker.ProcessSpec
+		arg3 *exec.Cmd
+		arg4 garden.ProcessIO
+		arg5 *garden.TTYSpec
+		arg6 process_tracker.Signaller
+	}{arg1, arg2, arg3, arg4, arg5, arg6})
 	fake.runMutex.Unlock()
 	if fake.RunStub != nil {
-		return fake.RunStub(arg1, arg2, arg3, arg4, arg5)
+		return fake.RunStub(arg1, arg2, arg3, arg4, arg5, arg6)
 	} else {
 		return fake.runReturns.result1, fake.runReturns.result2
 	}
@@ -70,10 +98,10 @@ func (fake *FakeProcessTracker) RunCallCount() int {
 	return len(fake.runArgsForCall)
 }
 
-func (fake *FakeProcessTracker) RunArgsForCall(i int) (uint32, *exec.Cmd, garden.ProcessIO, *garden.TTYSpec, process_tracker.Signaller) {
+func (fake *FakeProcessTracker) RunArgsForCall(i int) (uint32, process_tracker.ProcessSpec, *exec.Cmd, garden.ProcessIO, *garden.TTYSpec, process_tracker.Signaller) {
 	fake.runMutex.RLock()
 	defer fake.runMutex.RUnlock()
-	return fake.runArgsForCall[i].arg1, fake.runArgsForCall[i].arg2, fake.runArgsForCall[i].arg3, fake.runArgsForCall[i].arg4, fake.runArgsForCall[i].arg5
+	return fake.runArgsForCall[i].arg1, fake.runArgsForCall[i].arg2, fake.runArgsForCall[i].arg3, fake.runArgsForCall[i].arg4, fake.runArgsForCall[i].arg5, fake.runArgsForCall[i].arg6
 }
 
 func (fake *FakeProcessTracker) RunReturns(result1 garden.Process, result2 error) {
@@ -118,15 +146,15 @@ func (fake *FakeProcessTracker) AttachReturns(result1 garden.Process, result2 er
 	}{result1, result2}
 }
 
-func (fake *FakeProcessTracker) Restore(processID uint32, signaller process_tracker.Signaller) {
+func (fake *FakeProcessTracker) Restore(metadata process_tracker.ProcessMetadata, signaller process_tracker.Signaller) {
 	fake.restoreMutex.Lock()
 	fake.restoreArgsForCall = append(fake.restoreArgsForCall, struct {
-		processID uint32
+		metadata  process_tracker.ProcessMetadata
 		signaller process_tracker.Signaller
-	}{processID, signaller})
+	}{metadata, signaller})
 	fake.restoreMutex.Unlock()
 	if fake.RestoreStub != nil {
-		fake.RestoreStub(processID, signaller)
+		fake.RestoreStub(metadata, signaller)
 	}
 }
 
@@ -136,10 +164,10 @@ func (fake *FakeProcessTracker) RestoreCallCount() int {
 	return len(fake.restoreArgsForCall)
 }
 
-func (fake *FakeProcessTracker) RestoreArgsForCall(i int) (uint32, process_tracker.Signaller) {
+func (fake *FakeProcessTracker) RestoreArgsForCall(i int) (process_tracker.ProcessMetadata, process_tracker.Signaller) {
 	fake.restoreMutex.RLock()
 	defer fake.restoreMutex.RUnlock()
-	return fake.restoreArgsForCall[i].processID, fake.restoreArgsForCall[i].signaller
+	return fake.restoreArgsForCall[i].metadata, fake.restoreArgsForCall[i].signaller
 }
 
 func (fake *FakeProcessTracker) ActiveProcesses() []garden.Process {
@@ -166,4 +194,95 @@ func (fake *FakeProcessTracker) ActiveProcessesReturns(result1 []garden.Process)
 	}{result1}
 }
 
+func (fake *FakeProcessTracker) Processes() []process_tracker.ProcessMetadata {
+	fake.processesMutex.Lock()
+	fake.processesArgsForCall = append(fake.processesArgsForCall, struct{}{})
+	fake.processesMutex.Unlock()
+	if fake.ProcessesStub != nil {
+		return fake.ProcessesStub()
+	} else {
+		return fake.processesReturns.result1
+	}
+}
+
+func (fake *FakeProcessTracker) ProcessesCallCount() int {
+	fake.processesMutex.RLock()
+	defer fake.processesMutex.RUnlock()
+	return len(fake.processesArgsForCall)
+}
+
+func (fake *FakeProcessTracker) ProcessesReturns(result1 []process_tracker.ProcessMetadata) {
+	fake.ProcessesStub = nil
+	fake.processesReturns = struct {
+		result1 []process_tracker.ProcessMetadata
+	}{result1}
+}
+
+func (fake *FakeProcessTracker) Log(processID uint32, request process_tracker.LogRequest, out io.Writer) error {
+	fake.logMutex.Lock()
+	fake.logArgsForCall = append(fake.logArgsForCall, struct {
+		processID uint32
+		request   process_tracker.LogRequest
+		out       io.Writer
+	}{processID, request, out})
+	fake.logMutex.Unlock()
+	if fake.LogStub != nil {
+		return fake.LogStub(processID, request, out)
+	} else {
+		return fake.logReturns.result1
+	}
+}
+
+func (fake *FakeProcessTracker) LogCallCount() int {
+	fake.logMutex.RLock()
+	defer fake.logMutex.RUnlock()
+	return len(fake.logArgsForCall)
+}
+
+func (fake *FakeProcessTracker) LogArgsForCall(i int) (uint32, process_tracker.LogRequest, io.Writer) {
+	fake.logMutex.RLock()
+	defer fake.logMutex.RUnlock()
+	return fake.logArgsForCall[i].processID, fake.logArgsForCall[i].request, fake.logArgsForCall[i].out
+}
+
+func (fake *FakeProcessTracker) LogReturns(result1 error) {
+	fake.LogStub = nil
+	fake.logReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeProcessTracker) Signal(processID uint32, request process_tracker.SignalRequest) error {
+	fake.signalMutex.Lock()
+	fake.signalArgsForCall = append(fake.signalArgsForCall, struct {
+		processID uint32
+		request   process_tracker.SignalRequest
+	}{processID, request})
+	fake.signalMutex.Unlock()
+	if fake.SignalStub != nil {
+		return fake.SignalStub(processID, request)
+	} else {
+		return fake.signalReturns.result1
+	}
+}
+
+func (fake *FakeProcessTracker) SignalCallCount() int {
+	fake.signalMutex.RLock()
+	defer fake.signalMutex.RUnlock()
+	return len(fake.signalArgsForCall)
+}
+
+func (fake *FakeProcessTracker) SignalArgsForCall(i int) (uint32, process_tracker.SignalRequest) {
+	fake.signalMutex.RLock()
+	defer fake.signalMutex.RUnlock()
+	return fake.signalArgsForCall[i].processID, fake.signalArgsForCall[i].request
+}
+
+func (fake *FakeProcessTracker) SignalReturns(result1 error) {
+	fake.SignalStub = nil
+	fake.signalReturns = struct {
+		result1 error
+	}{result1}
+}
+
 var _ process_tracker.ProcessTracker = new(FakeProcessTracker)
@@ -3,11 +3,13 @@ package process_tracker
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/cloudfoundry-incubator/garden"
 	"github.com/cloudfoundry/gunk/command_runner"
@@ -19,6 +21,12 @@ import (
 type Process struct {
 	id uint32
 
+	spec      ProcessSpec
+	startedAt time.Time
+	exitedAt  *time.Time
+	timedOut  bool
+	metaMutex sync.RWMutex
+
 	containerPath string
 	runner        command_runner.CommandRunner
 
@@ -27,29 +35,83 @@ type Process struct {
 	link        *link.Link
 
 	exited     chan struct{}
-	exitStatus int
+	exitStatus link.ExitStatus
 	exitErr    error
 
 	stdin  writer.FanIn
 	stdout writer.FanOut
 	stderr writer.FanOut
 
+	logs map[LogStream]*processLog
+
 	signaller Signaller
+
+	// looked up once known, as finding it means scanning /proc
+	hostPid      int
+	hostPidMutex sync.Mutex
 }
 
 type Signaller interface {
 	Signal(os.Signal) error
 }
 
+// HostPidReporter is implemented by signallers which can tell the PID of
+// the process they signal, as seen from the host.
+type HostPidReporter interface {
+	HostPid() (int, error)
+}
+
+// ExitStatusWaiter is implemented by processes which can tell how they
+// exited, beyond their exit code.
+type ExitStatusWaiter interface {
+	WaitForExitStatus() (link.ExitStatus, error)
+}
+
+// ProcessSpec describes what a process was started with.
+type ProcessSpec struct {
+	Path string   `json:"path"`
+	Args []string `json:"args,omitempty"`
+	User string   `json:"user,omitempty"`
+	Dir  string   `json:"dir,omitempty"`
+	TTY  bool     `json:"tty,omitempty"`
+
+	Log     *LogSpec     `json:"log,omitempty"`
+	Timeout *TimeoutSpec `json:"timeout,omitempty"`
+}
+
+type ProcessMetadata struct {
+	ID        uint32      `json:"id"`
+	Spec      ProcessSpec `json:"spec"`
+	StartedAt time.Time   `json:"started_at"`
+
+	// Zero when it cannot be determined, e.g. before the process started.
+	HostPID int `json:"host_pid,omitempty"`
+
+	// Nil while running.
+	ExitedAt *time.Time `json:"exited_at,omitempty"`
+
+	// Whether the process was stopped for exceeding its timeout.
+	TimedOut bool `json:"timed_out,omitempty"`
+
+	// How the process exited; nil while running.
+	ExitStatus *link.ExitStatus `json:"exit_status,omitempty"`
+}
+
 func NewProcess(
 	id uint32,
+	spec ProcessSpec,
+	startedAt time.Time,
 	containerPath string,
 	runner command_runner.CommandRunner,
 	signaller Signaller,
+	scrollbackSize int,
 ) *Process {
 	return &Process{
 		id: id,
 
+		spec:      spec,
+		startedAt: startedAt,
+
 		containerPath: containerPath,
 		runner:        runner,
 
@@ -60,8 +122,10 @@ func NewProcess(
 		exited: make(chan struct{}),
 
 		stdin:  writer.NewFanIn(),
-		stdout: writer.NewFanOut(),
-		stderr: writer.NewFanOut(),
+		stdout: writer.NewFanOutWithScrollback(scrollbackSize),
+		stderr: writer.NewFanOutWithScrollback(scrollbackSize),
+
+		logs: make(map[LogStream]*processLog),
 
 		signaller: signaller,
 	}
@@ -71,7 +135,56 @@ func (p *Process) ID() uint32 {
 	return p.id
 }
 
+func (p *Process) Metadata() ProcessMetadata {
+	p.metaMutex.RLock()
+	metadata := ProcessMetadata{
+		ID:        p.id,
+		Spec:      p.spec,
+		StartedAt: p.startedAt,
+		ExitedAt:  p.exitedAt,
+		TimedOut:  p.timedOut,
+	}
+
+	if p.exitedAt != nil {
+		exitStatus := p.exitStatus
+		metadata.ExitStatus = &exitStatus
+	}
+	p.metaMutex.RUnlock()
+
+	if metadata.ExitedAt == nil {
+		metadata.HostPID = p.resolveHostPid()
+	}
+
+	return metadata
+}
+
+func (p *Process) resolveHostPid() int {
+	reporter, ok := p.signaller.(HostPidReporter)
+	if !ok {
+		return 0
+	}
+
+	p.hostPidMutex.Lock()
+	defer p.hostPidMutex.Unlock()
+
+	if p.hostPid == 0 {
+		pid, err := reporter.HostPid()
+		if err == nil {
+			p.hostPid = pid
+		}
+	}
+
+	return p.hostPid
+}
+
 func (p *Process) Wait() (int, error) {
+	exitStatus, err := p.WaitForExitStatus()
+	return exitStatus.ExitCode, err
+}
+
+// WaitForExitStatus is like Wait, but tells how the process exited, e.g. the
+// signal which killed it and the resources it used.
+func (p *Process) WaitForExitStatus() (link.ExitStatus, error) {
 	<-p.exited
 	return p.exitStatus, p.exitErr
 }
@@ -102,7 +215,7 @@ func (p *Process) Spawn(cmd *exec.Cmd, tty *garden.TTYSpec) (ready, active chan
 	active = make(chan error, 1)
 
 	spawnPath := path.Join(p.containerPath, "bin", "iodaemon")
-	processSock := path.Join(p.containerPath, "processes", fmt.Sprintf("%d.sock", p.ID()))
+	processSock := p.socketPath()
 
 	bashFlags := []string{
 		"-c",
@@ -125,6 +238,14 @@ func (p *Process) Spawn(cmd *exec.Cmd, tty *garden.TTYSpec) (ready, active chan
 
 	bashFlags = append(bashFlags, "spawn", processSock)
 
+	// a process which exited earlier under the same id left its exit status
+	// behind; it must not be taken for this one's
+	err := os.Remove(link.ExitStatusPath(processSock))
+	if err != nil && !os.IsNotExist(err) {
+		ready <- err
+		return
+	}
+
 	spawn := exec.Command("bash", append(bashFlags, cmd.Args...)...)
 	spawn.Env = cmd.Env
 
@@ -183,13 +304,89 @@ func (p *Process) Attach(processIO garden.ProcessIO) {
 	}
 }
 
+// startLogging has the process's output written to log files, if its spec
+// asks for it, appending to those already there when resuming a restored
+// process. It must be called before the process is linked to.
+func (p *Process) startLogging(resume bool) error {
+	if p.spec.Log == nil {
+		return nil
+	}
+
+	for stream, sink := range map[LogStream]writer.FanOut{
+		StdoutLog: p.stdout,
+		StderrLog: p.stderr,
+	} {
+		log, err := openProcessLog(processLogPath(p.containerPath, p.id, stream), *p.spec.Log, resume)
+		if err != nil {
+			p.stopLogging()
+			return err
+		}
+
+		p.logs[stream] = log
+		sink.AddSink(log)
+	}
+
+	return nil
+}
+
+func (p *Process) stopLogging() {
+	for _, log := range p.logs {
+		log.Close()
+	}
+}
+
+// Log writes the process's log to out, following it until the process exits
+// if asked to.
+func (p *Process) Log(request LogRequest, out io.Writer) error {
+	log, found := p.logs[request.Stream]
+	if !found {
+		return readProcessLog(p.containerPath, p.id, request, out)
+	}
+
+	done, err := log.Tail(out, request.Lines, request.Follow)
+	if err != nil {
+		return err
+	}
+
+	<-done
+
+	return nil
+}
+
+// restoreExitStatus completes the process with the exit status its i/o
+// daemon recorded, if it exited while nothing was linked to it.
+func (p *Process) restoreExitStatus() bool {
+	exitStatusPath := link.ExitStatusPath(p.socketPath())
+
+	exitStatus, err := link.ReadExitStatus(exitStatusPath)
+	if err != nil {
+		return false
+	}
+
+	exitedAt := time.Now()
+	if info, err := os.Stat(exitStatusPath); err == nil {
+		exitedAt = info.ModTime()
+	}
+
+	p.completedAt(exitedAt, exitStatus, nil)
+
+	return true
+}
+
 // This is guarded by runningLink so will only run once per Process per garden.
 func (p *Process) runLinker() {
-	processSock := path.Join(p.containerPath, "processes", fmt.Sprintf("%d.sock", p.ID()))
+	select {
+	case <-p.exited:
+		return
+	default:
+	}
 
-	link, err := link.Create(processSock, p.stdout, p.stderr)
+	link, err := link.Create(p.socketPath(), p.stdout, p.stderr)
 	if err != nil {
-		p.completed(-1, err)
+		if !p.restoreExitStatus() {
+			p.failed(err)
+		}
+
 		return
 	}
 
@@ -198,14 +395,37 @@ func (p *Process) runLinker() {
 	p.link = link
 	close(p.linked)
 
-	p.completed(p.link.Wait())
+	p.completed(p.link.WaitForExitStatus())
 
 	// don't leak stdin pipe
 	p.stdin.Close()
 }
 
-func (p *Process) completed(exitStatus int, err error) {
+func (p *Process) socketPath() string {
+	return path.Join(p.containerPath, "processes", fmt.Sprintf("%d.sock", p.ID()))
+}
+
+func (p *Process) failed(err error) {
+	p.completed(link.ExitStatus{ExitCode: -1}, err)
+}
+
+func (p *Process) completed(exitStatus link.ExitStatus, err error) {
+	p.completedAt(time.Now(), exitStatus, err)
+}
+
+func (p *Process) completedAt(exitedAt time.Time, exitStatus link.ExitStatus, err error) {
+	p.metaMutex.Lock()
+	p.exitedAt = &exitedAt
 	p.exitStatus = exitStatus
+	timedOut := p.timedOut
+	p.metaMutex.Unlock()
+
+	p.stopLogging()
+
+	if timedOut && err == nil {
+		err = TimedOutError{p.spec.Timeout.Duration}
+	}
+
 	p.exitErr = err
 	close(p.exited)
 }
@@ -0,0 +1,442 @@
+package process_tracker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+)
+
+// LogSpec has a process's stdout and stderr written to log files under the
+// container's processes directory, e.g. processes/1.stdout.log. A log file
+// which would grow past MaxBytes is moved to <file>.1, shifting older ones to
+// <file>.2 and so on, keeping at most MaxFiles of them.
+type LogSpec struct {
+	MaxBytes int64 `json:"max_bytes"`
+	MaxFiles int   `json:"max_files,omitempty"`
+}
+
+type LogStream string
+
+const (
+	StdoutLog LogStream = "stdout"
+	StderrLog LogStream = "stderr"
+)
+
+type LogRequest struct {
+	Stream LogStream
+
+	// Only the last Lines lines of the log; all of it when zero.
+	Lines int
+
+	// Keep streaming output after the existing log until the process exits.
+	Follow bool
+}
+
+type NoProcessLogError struct {
+	ProcessID uint32
+	Stream    LogStream
+}
+
+func (e NoProcessLogError) Error() string {
+	return fmt.Sprintf("process_tracker: no %s log for process: %d", e.Stream, e.ProcessID)
+}
+
+// How many writes of output a follower of a log may fall behind before it is
+// dropped.
+const logFollowerBacklog = 256
+
+type processLog struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+
+	file *os.File
+	size int64
+
+	followers map[*logFollower]bool
+
+	mutex sync.Mutex
+}
+
+// openProcessLog opens the log at logPath to be appended to. Unless resuming
+// it, e.g. for a restored process, the files left by an earlier process with
+// the same ID are removed first.
+func openProcessLog(logPath string, spec LogSpec, resume bool) (*processLog, error) {
+	log := &processLog{
+		path:     logPath,
+		maxBytes: spec.MaxBytes,
+		maxFiles: spec.MaxFiles,
+
+		followers: make(map[*logFollower]bool),
+	}
+
+	err := os.MkdirAll(path.Dir(logPath), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	if !resume {
+		err = removeLogFiles(logPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = log.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return log, nil
+}
+
+// Write never fails, as it is a sink of the process's output; failures to
+// write the file are lost, and followers failing to write are dropped.
+func (l *processLog) Write(data []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return len(data), nil
+	}
+
+	if l.size > 0 && l.size+int64(len(data)) > l.maxBytes {
+		if err := l.rotate(); err != nil {
+			return len(data), nil
+		}
+	}
+
+	n, _ := l.file.Write(data)
+	l.size += int64(n)
+
+	for follower := range l.followers {
+		if !follower.send(data) {
+			delete(l.followers, follower)
+			follower.stop()
+		}
+	}
+
+	return len(data), nil
+}
+
+// Tail writes the end of the log to out. When following, it returns a
+// channel closed once the log is closed or out fails to be written to, or
+// falls too far behind.
+func (l *processLog) Tail(out io.Writer, lines int, follow bool) (<-chan struct{}, error) {
+	l.mutex.Lock()
+
+	// the files are only opened while holding the mutex; they are read
+	// after, so that tailing does not hold up the process's output
+	snapshot, err := snapshotLogFiles(l.path)
+	if err != nil {
+		l.mutex.Unlock()
+		return nil, err
+	}
+
+	var follower *logFollower
+	if follow && l.file != nil {
+		follower = newLogFollower(out)
+		l.followers[follower] = true
+	}
+
+	l.mutex.Unlock()
+
+	defer snapshot.Close()
+
+	err = snapshot.tail(lines, out)
+	if err != nil {
+		if follower != nil {
+			l.removeFollower(follower)
+		}
+
+		return nil, err
+	}
+
+	if follower == nil {
+		done := make(chan struct{})
+		close(done)
+		return done, nil
+	}
+
+	// what was written since the snapshot is queued for the follower
+	go follower.run()
+
+	return follower.done, nil
+}
+
+func (l *processLog) removeFollower(follower *logFollower) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.followers[follower] {
+		delete(l.followers, follower)
+		follower.stop()
+	}
+}
+
+func (l *processLog) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for follower := range l.followers {
+		delete(l.followers, follower)
+		follower.stop()
+	}
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+
+	return err
+}
+
+func (l *processLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	l.file = file
+	l.size = info.Size()
+
+	return nil
+}
+
+func (l *processLog) rotate() error {
+	err := l.file.Close()
+	if err != nil {
+		return err
+	}
+
+	l.file = nil
+
+	if l.maxFiles == 0 {
+		err = os.Remove(l.path)
+	} else {
+		for i := l.maxFiles - 1; i > 0; i-- {
+			err := os.Rename(rotatedLogPath(l.path, i), rotatedLogPath(l.path, i+1))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+
+		err = os.Rename(l.path, rotatedLogPath(l.path, 1))
+	}
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return l.open()
+}
+
+// logFollower writes the output of a log to a follower from a goroutine of its
+// own, so that a slow follower does not hold up the process's output.
+type logFollower struct {
+	out io.Writer
+
+	data chan []byte
+	done chan struct{}
+}
+
+func newLogFollower(out io.Writer) *logFollower {
+	return &logFollower{
+		out: out,
+
+		data: make(chan []byte, logFollowerBacklog),
+		done: make(chan struct{}),
+	}
+}
+
+// send returns false once the follower has failed to be written to or has
+// fallen too far behind.
+func (f *logFollower) send(data []byte) bool {
+	select {
+	case <-f.done:
+		return false
+	default:
+	}
+
+	select {
+	case f.data <- append([]byte(nil), data...):
+		return true
+	default:
+		return false
+	}
+}
+
+// stop has the follower finish once it has written what was sent to it.
+func (f *logFollower) stop() {
+	close(f.data)
+}
+
+func (f *logFollower) run() {
+	defer close(f.done)
+
+	for data := range f.data {
+		_, err := f.out.Write(data)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func processLogPath(containerPath string, processID uint32, stream LogStream) string {
+	return path.Join(containerPath, "processes", fmt.Sprintf("%d.%s.log", processID, stream))
+}
+
+// readProcessLog writes the log of a process which is not being written to.
+func readProcessLog(containerPath string, processID uint32, request LogRequest, out io.Writer) error {
+	snapshot, err := snapshotLogFiles(processLogPath(containerPath, processID, request.Stream))
+	if os.IsNotExist(err) {
+		return NoProcessLogError{processID, request.Stream}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer snapshot.Close()
+
+	return snapshot.tail(request.Lines, out)
+}
+
+func rotatedLogPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// removeLogFiles removes the log at path and its rotated files.
+func removeLogFiles(path string) error {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for i := 1; ; i++ {
+		err := os.Remove(rotatedLogPath(path, i))
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// logSnapshot is the log at a path and its rotated files, newest first, as
+// they were when opened; rotating or writing the log afterwards leaves it be.
+type logSnapshot struct {
+	files    []*os.File
+	sections []*io.SectionReader
+}
+
+func snapshotLogFiles(path string) (*logSnapshot, error) {
+	snapshot := &logSnapshot{}
+
+	for i := 0; ; i++ {
+		filePath := path
+		if i > 0 {
+			filePath = rotatedLogPath(path, i)
+		}
+
+		file, err := os.Open(filePath)
+		if os.IsNotExist(err) {
+			if i == 0 {
+				continue
+			}
+
+			break
+		}
+
+		if err != nil {
+			snapshot.Close()
+			return nil, err
+		}
+
+		snapshot.files = append(snapshot.files, file)
+
+		info, err := file.Stat()
+		if err != nil {
+			snapshot.Close()
+			return nil, err
+		}
+
+		snapshot.sections = append(snapshot.sections, io.NewSectionReader(file, 0, info.Size()))
+	}
+
+	if len(snapshot.files) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	return snapshot, nil
+}
+
+func (s *logSnapshot) Close() {
+	for _, file := range s.files {
+		file.Close()
+	}
+}
+
+// tail writes the last lines of the log, reaching into the rotated files for
+// as many as it needs.
+func (s *logSnapshot) tail(lines int, out io.Writer) error {
+	var contents [][]byte
+	var count int
+
+	for _, section := range s.sections {
+		data, err := ioutil.ReadAll(section)
+		if err != nil {
+			return err
+		}
+
+		contents = append([][]byte{data}, contents...)
+
+		count += bytes.Count(data, []byte("\n"))
+		if lines > 0 && count > lines {
+			break
+		}
+	}
+
+	log := bytes.Join(contents, nil)
+
+	if lines > 0 {
+		log = lastLines(log, lines)
+	}
+
+	_, err := out.Write(log)
+	return err
+}
+
+func lastLines(data []byte, lines int) []byte {
+	end := len(data)
+	if end > 0 && data[end-1] == '\n' {
+		end--
+	}
+
+	for i := end - 1; i >= 0; i-- {
+		if data[i] != '\n' {
+			continue
+		}
+
+		lines--
+		if lines == 0 {
+			return data[i+1:]
+		}
+	}
+
+	return data
+}
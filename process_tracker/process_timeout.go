@@ -0,0 +1,68 @@
+package process_tracker
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+const DefaultTimeoutGracePeriod = 10 * time.Second
+
+// TimeoutSpec bounds how long a process may run, counting from when it
+// started. Once Duration has passed the process is sent SIGTERM, and
+// SIGKILL if it is still running GracePeriod later.
+type TimeoutSpec struct {
+	Duration    time.Duration `json:"duration"`
+	GracePeriod time.Duration `json:"grace_period,omitempty"`
+}
+
+// TimedOutError is returned by Wait, with the exit status of the process,
+// when the process was stopped for running out of time.
+type TimedOutError struct {
+	Timeout time.Duration
+}
+
+func (e TimedOutError) Error() string {
+	return fmt.Sprintf("process_tracker: process timed out after %s", e.Timeout)
+}
+
+// enforceTimeout stops the process once it has run for longer than its spec
+// allows. It returns when the process exits.
+func (p *Process) enforceTimeout() {
+	spec := p.spec.Timeout
+	if spec == nil || p.signaller == nil {
+		return
+	}
+
+	gracePeriod := spec.GracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = DefaultTimeoutGracePeriod
+	}
+
+	deadline := time.NewTimer(p.startedAt.Add(spec.Duration).Sub(time.Now()))
+	defer deadline.Stop()
+
+	select {
+	case <-deadline.C:
+	case <-p.exited:
+		return
+	}
+
+	p.metaMutex.Lock()
+	p.timedOut = true
+	p.metaMutex.Unlock()
+
+	p.signaller.Signal(syscall.SIGTERM)
+
+	grace := time.NewTimer(gracePeriod)
+	defer grace.Stop()
+
+	select {
+	case <-grace.C:
+	case <-p.exited:
+		return
+	}
+
+	p.signaller.Signal(os.Kill)
+}
@@ -2,23 +2,29 @@ package process_tracker
 
 import (
 	"fmt"
+	"io"
 	"os/exec"
 	"sync"
+	"time"
 
 	"github.com/cloudfoundry-incubator/garden"
 	"github.com/cloudfoundry/gunk/command_runner"
 )
 
 type ProcessTracker interface {
-	Run(processID uint32, cmd *exec.Cmd, io garden.ProcessIO, tty *garden.TTYSpec, signaller Signaller) (garden.Process, error)
+	Run(processID uint32, spec ProcessSpec, cmd *exec.Cmd, io garden.ProcessIO, tty *garden.TTYSpec, signaller Signaller) (garden.Process, error)
 	Attach(processID uint32, io garden.ProcessIO) (garden.Process, error)
-	Restore(processID uint32, signaller Signaller)
+	Restore(metadata ProcessMetadata, signaller Signaller)
 	ActiveProcesses() []garden.Process
+	Processes() []ProcessMetadata
+	Log(processID uint32, request LogRequest, out io.Writer) error
+	Signal(processID uint32, request SignalRequest) error
 }
 
 type processTracker struct {
-	containerPath string
-	runner        command_runner.CommandRunner
+	containerPath  string
+	runner         command_runner.CommandRunner
+	scrollbackSize int
 
 	processes      map[uint32]*Process
 	processesMutex *sync.RWMutex
@@ -32,26 +38,39 @@ func (e UnknownProcessError) Error() string {
 	return fmt.Sprintf("process_tracker: unknown process: %d", e.ProcessID)
 }
 
-func New(containerPath string, runner command_runner.CommandRunner) ProcessTracker {
+// New returns a tracker for the processes of the container at
+// containerPath. Up to scrollbackSize bytes of each process's most recent
+// stdout and stderr are replayed to anything attaching to it; zero disables
+// this.
+func New(containerPath string, runner command_runner.CommandRunner, scrollbackSize int) ProcessTracker {
 	return &processTracker{
-		containerPath: containerPath,
-		runner:        runner,
+		containerPath:  containerPath,
+		runner:         runner,
+		scrollbackSize: scrollbackSize,
 
 		processesMutex: new(sync.RWMutex),
 		processes:      make(map[uint32]*Process),
 	}
 }
 
-func (t *processTracker) Run(processID uint32, cmd *exec.Cmd, processIO garden.ProcessIO, tty *garden.TTYSpec, signaller Signaller) (garden.Process, error) {
+func (t *processTracker) Run(processID uint32, spec ProcessSpec, cmd *exec.Cmd, processIO garden.ProcessIO, tty *garden.TTYSpec, signaller Signaller) (garden.Process, error) {
+	process := NewProcess(processID, spec, time.Now(), t.containerPath, t.runner, signaller, t.scrollbackSize)
+
+	err := process.startLogging(false)
+	if err != nil {
+		return nil, err
+	}
+
 	t.processesMutex.Lock()
-	process := NewProcess(processID, t.containerPath, t.runner, signaller)
 	t.processes[processID] = process
 	t.processesMutex.Unlock()
 
 	ready, active := process.Spawn(cmd, tty)
 
-	err := <-ready
+	err = <-ready
 	if err != nil {
+		process.stopLogging()
+		t.unregister(processID)
 		return nil, err
 	}
 
@@ -61,9 +80,12 @@ func (t *processTracker) Run(processID uint32, cmd *exec.Cmd, processIO garden.P
 
 	err = <-active
 	if err != nil {
+		process.stopLogging()
 		return nil, err
 	}
 
+	go process.enforceTimeout()
+
 	return process, nil
 }
 
@@ -83,14 +105,26 @@ func (t *processTracker) Attach(processID uint32, processIO garden.ProcessIO) (g
 	return process, nil
 }
 
-func (t *processTracker) Restore(processID uint32, signaller Signaller) {
+// Restore tracks a process started before a restart, keeping the metadata
+// it was started with.
+//
+// A process which exited in the meantime stays tracked with its recorded
+// exit status until it is next attached to.
+func (t *processTracker) Restore(metadata ProcessMetadata, signaller Signaller) {
 	t.processesMutex.Lock()
 
-	process := NewProcess(processID, t.containerPath, t.runner, signaller)
+	process := NewProcess(metadata.ID, metadata.Spec, metadata.StartedAt, t.containerPath, t.runner, signaller, t.scrollbackSize)
 
-	t.processes[processID] = process
+	t.processes[metadata.ID] = process
 
-	go t.link(processID)
+	if !process.restoreExitStatus() {
+		// the output of the process while it was not linked to is lost
+		// anyway, so it is no reason not to restore it
+		process.startLogging(true)
+
+		go t.link(metadata.ID)
+		go process.enforceTimeout()
+	}
 
 	t.processesMutex.Unlock()
 }
@@ -110,6 +144,47 @@ func (t *processTracker) ActiveProcesses() []garden.Process {
 	return processes
 }
 
+// Processes returns the metadata of every tracked process.
+func (t *processTracker) Processes() []ProcessMetadata {
+	t.processesMutex.RLock()
+	defer t.processesMutex.RUnlock()
+
+	processes := make([]ProcessMetadata, 0, len(t.processes))
+
+	for _, process := range t.processes {
+		processes = append(processes, process.Metadata())
+	}
+
+	return processes
+}
+
+// Log writes the log of a process to out, as described by request. The log
+// of a process no longer tracked is read from its files; it cannot be
+// followed.
+func (t *processTracker) Log(processID uint32, request LogRequest, out io.Writer) error {
+	t.processesMutex.RLock()
+	process, ok := t.processes[processID]
+	t.processesMutex.RUnlock()
+
+	if ok {
+		return process.Log(request, out)
+	}
+
+	return readProcessLog(t.containerPath, processID, request, out)
+}
+
+func (t *processTracker) Signal(processID uint32, request SignalRequest) error {
+	t.processesMutex.RLock()
+	process, ok := t.processes[processID]
+	t.processesMutex.RUnlock()
+
+	if !ok {
+		return UnknownProcessError{processID}
+	}
+
+	return process.SendSignal(request)
+}
+
 func (t *processTracker) link(processID uint32) {
 	t.processesMutex.RLock()
 	process, ok := t.processes[processID]
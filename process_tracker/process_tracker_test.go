@@ -3,12 +3,16 @@ package process_tracker_test
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
 	"syscall"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -45,18 +49,31 @@ var _ = AfterEach(func() {
 
 var _ = Describe("Running processes", func() {
 	BeforeEach(func() {
-		processTracker = process_tracker.New(tmpdir, linux_command_runner.New())
+		processTracker = process_tracker.New(tmpdir, linux_command_runner.New(), 0)
 	})
 
 	It("runs the process and returns its exit code", func() {
 		cmd := exec.Command("bash", "-c", "exit 42")
 
-		process, err := processTracker.Run(55, cmd, garden.ProcessIO{}, nil, nil)
+		process, err := processTracker.Run(55, process_tracker.ProcessSpec{}, cmd, garden.ProcessIO{}, nil, nil)
 		Expect(err).NotTo(HaveOccurred())
 
 		Ω(process.Wait()).Should(Equal(42))
 	})
 
+	It("reports how the process exited", func() {
+		cmd := exec.Command("bash", "-c", "kill -9 $$")
+
+		process, err := processTracker.Run(2, process_tracker.ProcessSpec{}, cmd, garden.ProcessIO{}, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		exitStatus, err := process.(process_tracker.ExitStatusWaiter).WaitForExitStatus()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(exitStatus.ExitCode).Should(Equal(-1))
+		Ω(exitStatus.Signal).Should(Equal(syscall.SIGKILL))
+		Ω(exitStatus.Rusage).ShouldNot(BeNil())
+	})
+
 	Describe("signalling a running process", func() {
 		var (
 			process   garden.Process
@@ -68,23 +85,23 @@ var _ = Describe("Running processes", func() {
 			cmd := exec.Command("bash", "-c", "echo hi")
 
 			var err error
-			process, err = processTracker.Run(2, cmd, garden.ProcessIO{}, nil, signaller)
+			process, err = processTracker.Run(2, process_tracker.ProcessSpec{}, cmd, garden.ProcessIO{}, nil, signaller)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
 		It("kills the process with a kill signal", func() {
 			Ω(process.Signal(garden.SignalKill)).Should(Succeed())
-			Ω(signaller.sent).Should(Equal([]os.Signal{os.Kill}))
+			Ω(signaller.Sent()).Should(Equal([]os.Signal{os.Kill}))
 		})
 
 		It("kills the process with a terminate signal", func() {
 			Ω(process.Signal(garden.SignalTerminate)).Should(Succeed())
-			Ω(signaller.sent).Should(Equal([]os.Signal{syscall.SIGTERM}))
+			Ω(signaller.Sent()).Should(Equal([]os.Signal{syscall.SIGTERM}))
 		})
 
 		It("errors when an unsupported signal is sent", func() {
 			Ω(process.Signal(garden.Signal(999))).Should(MatchError(HaveSuffix("failed to send signal: unknown signal: 999")))
-			Ω(signaller.sent).Should(BeNil())
+			Ω(signaller.Sent()).Should(BeNil())
 		})
 	})
 
@@ -98,7 +115,7 @@ var _ = Describe("Running processes", func() {
 		stdout := gbytes.NewBuffer()
 		stderr := gbytes.NewBuffer()
 
-		_, err := processTracker.Run(55, cmd, garden.ProcessIO{
+		_, err := processTracker.Run(55, process_tracker.ProcessSpec{}, cmd, garden.ProcessIO{
 			Stdout: stdout,
 			Stderr: stderr,
 		}, nil, nil)
@@ -111,7 +128,7 @@ var _ = Describe("Running processes", func() {
 	It("streams input to the process", func() {
 		stdout := gbytes.NewBuffer()
 
-		_, err := processTracker.Run(55, exec.Command("cat"), garden.ProcessIO{
+		_, err := processTracker.Run(55, process_tracker.ProcessSpec{}, exec.Command("cat"), garden.ProcessIO{
 			Stdin:  bytes.NewBufferString("stdin-line1\nstdin-line2\n"),
 			Stdout: stdout,
 		}, nil, nil)
@@ -125,7 +142,7 @@ var _ = Describe("Running processes", func() {
 			pipeR, pipeW := io.Pipe()
 			stdout := gbytes.NewBuffer()
 
-			process, err := processTracker.Run(55, exec.Command("cat"), garden.ProcessIO{
+			process, err := processTracker.Run(55, process_tracker.ProcessSpec{}, exec.Command("cat"), garden.ProcessIO{
 				Stdin:  pipeR,
 				Stdout: stdout,
 			}, nil, nil)
@@ -153,7 +170,7 @@ var _ = Describe("Running processes", func() {
 			pipeR, pipeW := io.Pipe()
 			stdout := gbytes.NewBuffer()
 
-			process, err := processTracker.Run(55, exec.Command("cat"), garden.ProcessIO{
+			process, err := processTracker.Run(55, process_tracker.ProcessSpec{}, exec.Command("cat"), garden.ProcessIO{
 				Stdin:  pipeR,
 				Stdout: stdout,
 			}, nil, nil)
@@ -199,7 +216,7 @@ var _ = Describe("Running processes", func() {
 
 			stdout := gbytes.NewBuffer()
 
-			process, err := processTracker.Run(55, cmd, garden.ProcessIO{
+			process, err := processTracker.Run(55, process_tracker.ProcessSpec{}, cmd, garden.ProcessIO{
 				Stdout: stdout,
 			}, &garden.TTYSpec{
 				WindowSize: &garden.WindowSize{
@@ -230,7 +247,7 @@ var _ = Describe("Running processes", func() {
 
 				stdout := gbytes.NewBuffer()
 
-				_, err := processTracker.Run(55, cmd, garden.ProcessIO{
+				_, err := processTracker.Run(55, process_tracker.ProcessSpec{}, cmd, garden.ProcessIO{
 					Stdout: stdout,
 				}, &garden.TTYSpec{}, nil)
 				Expect(err).NotTo(HaveOccurred())
@@ -242,7 +259,7 @@ var _ = Describe("Running processes", func() {
 
 	Context("when spawning fails", func() {
 		It("returns the error", func() {
-			_, err := processTracker.Run(55, exec.Command("/bin/does-not-exist"), garden.ProcessIO{}, nil, nil)
+			_, err := processTracker.Run(55, process_tracker.ProcessSpec{}, exec.Command("/bin/does-not-exist"), garden.ProcessIO{}, nil, nil)
 			Ω(err).Should(HaveOccurred())
 		})
 	})
@@ -250,11 +267,11 @@ var _ = Describe("Running processes", func() {
 
 var _ = Describe("Restoring processes", func() {
 	BeforeEach(func() {
-		processTracker = process_tracker.New(tmpdir, linux_command_runner.New())
+		processTracker = process_tracker.New(tmpdir, linux_command_runner.New(), 0)
 	})
 
 	It("tracks the restored process", func() {
-		processTracker.Restore(2, nil)
+		processTracker.Restore(process_tracker.ProcessMetadata{ID: 2}, nil)
 
 		activeProcesses := processTracker.ActiveProcesses()
 		Ω(activeProcesses).Should(HaveLen(1))
@@ -263,19 +280,83 @@ var _ = Describe("Restoring processes", func() {
 
 	It("assigns the signaller to the process", func() {
 		signaller := &FakeSignaller{}
-		processTracker.Restore(2, signaller)
+		processTracker.Restore(process_tracker.ProcessMetadata{ID: 2}, signaller)
 
 		activeProcesses := processTracker.ActiveProcesses()
 		Ω(activeProcesses).Should(HaveLen(1))
 
 		Ω(activeProcesses[0].Signal(garden.SignalKill)).Should(Succeed())
-		Ω(signaller.sent).Should(Equal([]os.Signal{os.Kill}))
+		Ω(signaller.Sent()).Should(Equal([]os.Signal{os.Kill}))
+	})
+
+	Context("when the process exited while the tracker was down", func() {
+		BeforeEach(func() {
+			cmd := exec.Command("bash", "-c", "exit 42")
+
+			process, err := processTracker.Run(2, process_tracker.ProcessSpec{}, cmd, garden.ProcessIO{}, nil, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(process.Wait()).Should(Equal(42))
+
+			processTracker = process_tracker.New(tmpdir, linux_command_runner.New(), 0)
+		})
+
+		It("reports the recorded exit status when attached to", func() {
+			processTracker.Restore(process_tracker.ProcessMetadata{ID: 2}, nil)
+
+			process, err := processTracker.Attach(2, garden.ProcessIO{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(process.Wait()).Should(Equal(42))
+		})
+
+		It("reports the recorded details of how it exited", func() {
+			processTracker.Restore(process_tracker.ProcessMetadata{ID: 2}, nil)
+
+			exitStatus := processTracker.Processes()[0].ExitStatus
+			Ω(exitStatus).ShouldNot(BeNil())
+			Ω(exitStatus.ExitCode).Should(Equal(42))
+			Ω(exitStatus.Rusage).ShouldNot(BeNil())
+		})
+
+		It("keeps tracking the process, as exited, until it is attached to", func() {
+			processTracker.Restore(process_tracker.ProcessMetadata{ID: 2}, nil)
+
+			Consistently(processTracker.Processes).Should(HaveLen(1))
+			Ω(processTracker.Processes()[0].ExitedAt).ShouldNot(BeNil())
+
+			_, err := processTracker.Attach(2, garden.ProcessIO{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Eventually(processTracker.Processes).Should(BeEmpty())
+		})
+
+		Context("and its id was reused by a process still running", func() {
+			BeforeEach(func() {
+				cmd := exec.Command("bash", "-c", "sleep 1")
+
+				_, err := processTracker.Run(2, process_tracker.ProcessSpec{}, cmd, garden.ProcessIO{}, nil, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				processTracker = process_tracker.New(tmpdir, linux_command_runner.New(), 0)
+			})
+
+			It("links to the running process rather than reporting the old exit status", func() {
+				processTracker.Restore(process_tracker.ProcessMetadata{ID: 2}, nil)
+
+				Ω(processTracker.Processes()[0].ExitedAt).Should(BeNil())
+
+				process, err := processTracker.Attach(2, garden.ProcessIO{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(process.Wait()).Should(Equal(0))
+			})
+		})
 	})
 })
 
 var _ = Describe("Attaching to running processes", func() {
 	BeforeEach(func() {
-		processTracker = process_tracker.New(tmpdir, linux_command_runner.New())
+		processTracker = process_tracker.New(tmpdir, linux_command_runner.New(), 0)
 	})
 
 	It("streams stdout, stdin, and stderr", func() {
@@ -285,7 +366,7 @@ var _ = Describe("Attaching to running processes", func() {
 			echo "hi stderr" $stuff >&2
 		`)
 
-		process, err := processTracker.Run(55, cmd, garden.ProcessIO{}, nil, nil)
+		process, err := processTracker.Run(55, process_tracker.ProcessSpec{}, cmd, garden.ProcessIO{}, nil, nil)
 		Expect(err).NotTo(HaveOccurred())
 
 		stdout := gbytes.NewBuffer()
@@ -301,11 +382,56 @@ var _ = Describe("Attaching to running processes", func() {
 		Eventually(stdout).Should(gbytes.Say("hi stdout this-is-stdin"))
 		Eventually(stderr).Should(gbytes.Say("hi stderr this-is-stdin"))
 	})
+
+	Context("with scrollback", func() {
+		BeforeEach(func() {
+			processTracker = process_tracker.New(tmpdir, linux_command_runner.New(), 1024)
+		})
+
+		It("replays recent output before streaming", func() {
+			cmd := exec.Command("bash", "-c", `
+				echo "before stdout"
+				echo "before stderr" >&2
+				read
+				echo "after stdout"
+			`)
+
+			stdin, stdinW := io.Pipe()
+			firstStdout := gbytes.NewBuffer()
+			firstStderr := gbytes.NewBuffer()
+
+			process, err := processTracker.Run(55, process_tracker.ProcessSpec{}, cmd, garden.ProcessIO{
+				Stdin:  stdin,
+				Stdout: firstStdout,
+				Stderr: firstStderr,
+			}, nil, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(firstStdout).Should(gbytes.Say("before stdout"))
+			Eventually(firstStderr).Should(gbytes.Say("before stderr"))
+
+			stdout := gbytes.NewBuffer()
+			stderr := gbytes.NewBuffer()
+
+			_, err = processTracker.Attach(process.ID(), garden.ProcessIO{
+				Stdout: stdout,
+				Stderr: stderr,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(stdout).Should(gbytes.Say("before stdout"))
+			Eventually(stderr).Should(gbytes.Say("before stderr"))
+
+			stdinW.Write([]byte("\n"))
+
+			Eventually(stdout).Should(gbytes.Say("after stdout"))
+		})
+	})
 })
 
 var _ = Describe("Listing active process IDs", func() {
 	BeforeEach(func() {
-		processTracker = process_tracker.New(tmpdir, linux_command_runner.New())
+		processTracker = process_tracker.New(tmpdir, linux_command_runner.New(), 0)
 	})
 
 	It("includes running process IDs", func() {
@@ -314,14 +440,14 @@ var _ = Describe("Listing active process IDs", func() {
 
 		Ω(processTracker.ActiveProcesses()).Should(BeEmpty())
 
-		process1, err := processTracker.Run(55, exec.Command("cat"), garden.ProcessIO{
+		process1, err := processTracker.Run(55, process_tracker.ProcessSpec{}, exec.Command("cat"), garden.ProcessIO{
 			Stdin: stdin1,
 		}, nil, nil)
 		Ω(err).ShouldNot(HaveOccurred())
 
 		Eventually(processTracker.ActiveProcesses).Should(ConsistOf(process1))
 
-		process2, err := processTracker.Run(56, exec.Command("cat"), garden.ProcessIO{
+		process2, err := processTracker.Run(56, process_tracker.ProcessSpec{}, exec.Command("cat"), garden.ProcessIO{
 			Stdin: stdin2,
 		}, nil, nil)
 		Ω(err).ShouldNot(HaveOccurred())
@@ -336,11 +462,506 @@ var _ = Describe("Listing active process IDs", func() {
 	})
 })
 
+var _ = Describe("Listing process metadata", func() {
+	var spec process_tracker.ProcessSpec
+
+	BeforeEach(func() {
+		processTracker = process_tracker.New(tmpdir, linux_command_runner.New(), 0)
+
+		spec = process_tracker.ProcessSpec{
+			Path: "cat",
+			User: "vcap",
+			Dir:  "/some/dir",
+		}
+	})
+
+	It("includes the spec and start time of running processes", func() {
+		stdin, stdinWriter := io.Pipe()
+		defer stdinWriter.Close()
+
+		before := time.Now()
+
+		_, err := processTracker.Run(55, spec, exec.Command("cat"), garden.ProcessIO{
+			Stdin: stdin,
+		}, nil, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		processes := processTracker.Processes()
+		Ω(processes).Should(HaveLen(1))
+
+		Ω(processes[0].ID).Should(Equal(uint32(55)))
+		Ω(processes[0].Spec).Should(Equal(spec))
+		Ω(processes[0].StartedAt).Should(BeTemporally(">=", before))
+		Ω(processes[0].ExitedAt).Should(BeNil())
+	})
+
+	It("reports the host PID when the signaller knows it", func() {
+		stdin, stdinWriter := io.Pipe()
+		defer stdinWriter.Close()
+
+		_, err := processTracker.Run(55, spec, exec.Command("cat"), garden.ProcessIO{
+			Stdin: stdin,
+		}, nil, &FakeHostPidSignaller{pid: 1234})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(processTracker.Processes()[0].HostPID).Should(Equal(1234))
+	})
+
+	It("only looks up the host PID once", func() {
+		stdin, stdinWriter := io.Pipe()
+		defer stdinWriter.Close()
+
+		signaller := &FakeHostPidSignaller{pid: 1234}
+
+		_, err := processTracker.Run(55, spec, exec.Command("cat"), garden.ProcessIO{
+			Stdin: stdin,
+		}, nil, signaller)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(processTracker.Processes()[0].HostPID).Should(Equal(1234))
+		Ω(processTracker.Processes()[0].HostPID).Should(Equal(1234))
+
+		Ω(signaller.Lookups()).Should(Equal(1))
+	})
+
+	It("records when the process exited", func() {
+		process, err := processTracker.Run(55, spec, exec.Command("true"), garden.ProcessIO{}, nil, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, err = process.Wait()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		metadata := process.(*process_tracker.Process).Metadata()
+		Ω(metadata.ExitedAt).ShouldNot(BeNil())
+		Ω(*metadata.ExitedAt).Should(BeTemporally(">=", metadata.StartedAt))
+	})
+
+	It("keeps the metadata of restored processes", func() {
+		metadata := process_tracker.ProcessMetadata{
+			ID:        2,
+			Spec:      spec,
+			StartedAt: time.Unix(123, 0),
+		}
+
+		processTracker.Restore(metadata, nil)
+
+		Ω(processTracker.Processes()).Should(Equal([]process_tracker.ProcessMetadata{metadata}))
+	})
+})
+
+var _ = Describe("Signalling processes", func() {
+	var link net.Listener
+
+	BeforeEach(func() {
+		processTracker = process_tracker.New(tmpdir, linux_command_runner.New(), 0)
+
+		link = holdLink(2)
+	})
+
+	AfterEach(func() {
+		link.Close()
+	})
+
+	It("sends any signal to the process", func() {
+		signaller := &FakeGroupSignaller{}
+		processTracker.Restore(process_tracker.ProcessMetadata{ID: 2}, signaller)
+
+		err := processTracker.Signal(2, process_tracker.SignalRequest{Signal: syscall.SIGHUP})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(signaller.Sent()).Should(Equal([]os.Signal{syscall.SIGHUP}))
+		Ω(signaller.sentToGroup).Should(BeEmpty())
+	})
+
+	It("sends signals to the process group", func() {
+		signaller := &FakeGroupSignaller{}
+		processTracker.Restore(process_tracker.ProcessMetadata{ID: 2}, signaller)
+
+		err := processTracker.Signal(2, process_tracker.SignalRequest{Signal: syscall.SIGUSR1, Group: true})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(signaller.sentToGroup).Should(Equal([]os.Signal{syscall.SIGUSR1}))
+		Ω(signaller.Sent()).Should(BeEmpty())
+	})
+
+	Context("when the signaller cannot signal process groups", func() {
+		It("returns an error", func() {
+			processTracker.Restore(process_tracker.ProcessMetadata{ID: 2}, &FakeSignaller{})
+
+			err := processTracker.Signal(2, process_tracker.SignalRequest{Signal: syscall.SIGUSR1, Group: true})
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("when the process is not tracked", func() {
+		It("returns an UnknownProcessError", func() {
+			err := processTracker.Signal(42, process_tracker.SignalRequest{Signal: syscall.SIGHUP})
+			Ω(err).Should(Equal(process_tracker.UnknownProcessError{42}))
+		})
+	})
+})
+
+var _ = Describe("Parsing signals", func() {
+	It("parses names with or without the SIG prefix, in any case", func() {
+		Ω(process_tracker.ParseSignal("HUP")).Should(Equal(syscall.SIGHUP))
+		Ω(process_tracker.ParseSignal("SIGUSR1")).Should(Equal(syscall.SIGUSR1))
+		Ω(process_tracker.ParseSignal("usr2")).Should(Equal(syscall.SIGUSR2))
+		Ω(process_tracker.ParseSignal("sigquit")).Should(Equal(syscall.SIGQUIT))
+	})
+
+	It("parses numbers", func() {
+		Ω(process_tracker.ParseSignal("2")).Should(Equal(syscall.SIGINT))
+	})
+
+	It("rejects unknown signals", func() {
+		_, err := process_tracker.ParseSignal("SIGNOPE")
+		Ω(err).Should(Equal(process_tracker.UnknownSignalError{"SIGNOPE"}))
+
+		_, err = process_tracker.ParseSignal("999")
+		Ω(err).Should(HaveOccurred())
+
+		_, err = process_tracker.ParseSignal("")
+		Ω(err).Should(HaveOccurred())
+	})
+})
+
+var _ = Describe("Process timeouts", func() {
+	var signaller *FakeSignaller
+
+	BeforeEach(func() {
+		processTracker = process_tracker.New(tmpdir, linux_command_runner.New(), 0)
+		signaller = &FakeSignaller{}
+	})
+
+	timeoutSpec := func(duration, gracePeriod time.Duration) process_tracker.ProcessSpec {
+		return process_tracker.ProcessSpec{
+			Timeout: &process_tracker.TimeoutSpec{Duration: duration, GracePeriod: gracePeriod},
+		}
+	}
+
+	It("terminates the process once it runs out of time, then kills it after the grace period", func() {
+		cmd := exec.Command("sleep", "1")
+
+		process, err := processTracker.Run(55, timeoutSpec(100*time.Millisecond, 300*time.Millisecond), cmd, garden.ProcessIO{}, nil, signaller)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Eventually(signaller.Sent).Should(Equal([]os.Signal{syscall.SIGTERM}))
+		Consistently(signaller.Sent, 200*time.Millisecond).Should(Equal([]os.Signal{syscall.SIGTERM}))
+		Eventually(signaller.Sent).Should(Equal([]os.Signal{syscall.SIGTERM, os.Kill}))
+
+		_, err = process.Wait()
+		Ω(err).Should(Equal(process_tracker.TimedOutError{100 * time.Millisecond}))
+
+		Ω(processTracker.Processes()).Should(BeEmpty())
+	})
+
+	It("reports that the process timed out in its metadata", func() {
+		cmd := exec.Command("sleep", "1")
+
+		_, err := processTracker.Run(55, timeoutSpec(100*time.Millisecond, time.Second), cmd, garden.ProcessIO{}, nil, signaller)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Eventually(signaller.Sent).Should(HaveLen(1))
+
+		processes := processTracker.Processes()
+		Ω(processes).Should(HaveLen(1))
+		Ω(processes[0].TimedOut).Should(BeTrue())
+	})
+
+	Context("when the process exits in time", func() {
+		It("neither signals it nor reports a timeout", func() {
+			cmd := exec.Command("bash", "-c", "exit 3")
+
+			process, err := processTracker.Run(55, timeoutSpec(500*time.Millisecond, 0), cmd, garden.ProcessIO{}, nil, signaller)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(process.Wait()).Should(Equal(3))
+
+			Consistently(signaller.Sent, 700*time.Millisecond).Should(BeEmpty())
+		})
+	})
+
+	Context("when restoring a process", func() {
+		It("counts the timeout from when the process started", func() {
+			defer holdLink(2).Close()
+
+			processTracker.Restore(process_tracker.ProcessMetadata{
+				ID:        2,
+				Spec:      timeoutSpec(time.Hour, 0),
+				StartedAt: time.Now().Add(-2 * time.Hour),
+			}, signaller)
+
+			Eventually(signaller.Sent).Should(Equal([]os.Signal{syscall.SIGTERM}))
+		})
+	})
+})
+
+var _ = Describe("Process logs", func() {
+	BeforeEach(func() {
+		processTracker = process_tracker.New(tmpdir, linux_command_runner.New(), 0)
+	})
+
+	logSpec := func(maxBytes int64, maxFiles int) process_tracker.ProcessSpec {
+		return process_tracker.ProcessSpec{
+			Log: &process_tracker.LogSpec{MaxBytes: maxBytes, MaxFiles: maxFiles},
+		}
+	}
+
+	readLog := func(name string) string {
+		contents, err := ioutil.ReadFile(filepath.Join(tmpdir, "processes", name))
+		Ω(err).ShouldNot(HaveOccurred())
+		return string(contents)
+	}
+
+	It("writes stdout and stderr to log files", func() {
+		cmd := exec.Command("bash", "-c", "echo hi stdout; echo hi stderr >&2")
+
+		process, err := processTracker.Run(55, logSpec(1024, 0), cmd, garden.ProcessIO{}, nil, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(process.Wait()).Should(Equal(0))
+
+		Ω(readLog("55.stdout.log")).Should(Equal("hi stdout\n"))
+		Ω(readLog("55.stderr.log")).Should(Equal("hi stderr\n"))
+	})
+
+	It("rotates the log files, keeping at most the given number", func() {
+		cmd := exec.Command("bash", "-c", "for i in 1 2 3 4; do echo line$i; sleep 0.05; done")
+
+		process, err := processTracker.Run(55, logSpec(10, 2), cmd, garden.ProcessIO{}, nil, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(process.Wait()).Should(Equal(0))
+
+		Ω(readLog("55.stdout.log")).Should(Equal("line4\n"))
+		Ω(readLog("55.stdout.log.1")).Should(Equal("line3\n"))
+		Ω(readLog("55.stdout.log.2")).Should(Equal("line2\n"))
+		_, err = os.Stat(filepath.Join(tmpdir, "processes", "55.stdout.log.3"))
+		Ω(os.IsNotExist(err)).Should(BeTrue())
+	})
+
+	It("tails the last lines, across rotated files", func() {
+		cmd := exec.Command("bash", "-c", "for i in 1 2 3 4; do echo line$i; sleep 0.05; done")
+
+		process, err := processTracker.Run(55, logSpec(12, 3), cmd, garden.ProcessIO{}, nil, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(process.Wait()).Should(Equal(0))
+
+		out := gbytes.NewBuffer()
+		err = processTracker.Log(55, process_tracker.LogRequest{
+			Stream: process_tracker.StdoutLog,
+			Lines:  3,
+		}, out)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(string(out.Contents())).Should(Equal("line2\nline3\nline4\n"))
+	})
+
+	It("follows the log until the process exits", func() {
+		cmd := exec.Command("bash", "-c", "echo before; read; echo after")
+
+		stdin, stdinW := io.Pipe()
+
+		process, err := processTracker.Run(55, logSpec(1024, 0), cmd, garden.ProcessIO{
+			Stdin: stdin,
+		}, nil, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Eventually(func() string {
+			contents, _ := ioutil.ReadFile(filepath.Join(tmpdir, "processes", "55.stdout.log"))
+			return string(contents)
+		}).Should(Equal("before\n"))
+
+		out := gbytes.NewBuffer()
+		followed := make(chan error)
+
+		go func() {
+			followed <- processTracker.Log(55, process_tracker.LogRequest{
+				Stream: process_tracker.StdoutLog,
+				Follow: true,
+			}, out)
+		}()
+
+		Eventually(out).Should(gbytes.Say("before\n"))
+		Consistently(followed).ShouldNot(Receive())
+
+		stdinW.Write([]byte("\n"))
+
+		Eventually(out).Should(gbytes.Say("after\n"))
+		Eventually(followed).Should(Receive(BeNil()))
+
+		Ω(process.Wait()).Should(Equal(0))
+	})
+
+	It("keeps logging while a follower is not reading", func() {
+		cmd := exec.Command("bash", "-c", "echo before; read; echo after")
+
+		stdin, stdinW := io.Pipe()
+
+		process, err := processTracker.Run(55, logSpec(1024, 0), cmd, garden.ProcessIO{
+			Stdin: stdin,
+		}, nil, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Eventually(func() string {
+			contents, _ := ioutil.ReadFile(filepath.Join(tmpdir, "processes", "55.stdout.log"))
+			return string(contents)
+		}).Should(Equal("before\n"))
+
+		stalledR, stalled := io.Pipe()
+		defer stalledR.Close()
+
+		go processTracker.Log(55, process_tracker.LogRequest{
+			Stream: process_tracker.StdoutLog,
+			Follow: true,
+		}, stalled)
+
+		stdinW.Write([]byte("\n"))
+
+		Ω(process.Wait()).Should(Equal(0))
+		Ω(readLog("55.stdout.log")).Should(Equal("before\nafter\n"))
+	})
+
+	Context("when a process with the same id was logged before", func() {
+		BeforeEach(func() {
+			cmd := exec.Command("bash", "-c", "echo first1; sleep 0.05; echo first2")
+
+			process, err := processTracker.Run(55, logSpec(8, 2), cmd, garden.ProcessIO{}, nil, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(process.Wait()).Should(Equal(0))
+
+			Ω(readLog("55.stdout.log.1")).Should(Equal("first1\n"))
+		})
+
+		It("starts the log afresh", func() {
+			cmd := exec.Command("bash", "-c", "echo second")
+
+			process, err := processTracker.Run(55, logSpec(8, 2), cmd, garden.ProcessIO{}, nil, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(process.Wait()).Should(Equal(0))
+
+			Ω(readLog("55.stdout.log")).Should(Equal("second\n"))
+
+			_, err = os.Stat(filepath.Join(tmpdir, "processes", "55.stdout.log.1"))
+			Ω(os.IsNotExist(err)).Should(BeTrue())
+		})
+	})
+
+	Context("when spawning fails", func() {
+		It("closes the log files", func() {
+			_, err := processTracker.Run(55, logSpec(1024, 0), exec.Command("/bin/does-not-exist"), garden.ProcessIO{}, nil, nil)
+			Ω(err).Should(HaveOccurred())
+
+			fds, err := ioutil.ReadDir("/proc/self/fd")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			for _, fd := range fds {
+				target, _ := os.Readlink(filepath.Join("/proc/self/fd", fd.Name()))
+				Ω(target).ShouldNot(HavePrefix(filepath.Join(tmpdir, "processes")))
+			}
+
+			Ω(processTracker.Processes()).Should(BeEmpty())
+		})
+	})
+
+	Context("when the process is no longer tracked", func() {
+		It("reads the log from its files", func() {
+			cmd := exec.Command("bash", "-c", "echo hi stderr >&2")
+
+			process, err := processTracker.Run(55, logSpec(1024, 0), cmd, garden.ProcessIO{}, nil, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(process.Wait()).Should(Equal(0))
+
+			Eventually(processTracker.Processes).Should(BeEmpty())
+
+			out := gbytes.NewBuffer()
+			err = processTracker.Log(55, process_tracker.LogRequest{
+				Stream: process_tracker.StderrLog,
+				Follow: true,
+			}, out)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(string(out.Contents())).Should(Equal("hi stderr\n"))
+		})
+	})
+
+	Context("when the process has no log", func() {
+		It("returns an error", func() {
+			cmd := exec.Command("true")
+
+			process, err := processTracker.Run(55, process_tracker.ProcessSpec{}, cmd, garden.ProcessIO{}, nil, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(process.Wait()).Should(Equal(0))
+
+			err = processTracker.Log(55, process_tracker.LogRequest{Stream: process_tracker.StdoutLog}, gbytes.NewBuffer())
+			Ω(err).Should(Equal(process_tracker.NoProcessLogError{55, process_tracker.StdoutLog}))
+		})
+	})
+})
+
+type FakeHostPidSignaller struct {
+	FakeSignaller
+
+	pid int
+
+	lookups      int
+	lookupsMutex sync.Mutex
+}
+
+func (f *FakeHostPidSignaller) HostPid() (int, error) {
+	f.lookupsMutex.Lock()
+	defer f.lookupsMutex.Unlock()
+
+	f.lookups++
+
+	return f.pid, nil
+}
+
+func (f *FakeHostPidSignaller) Lookups() int {
+	f.lookupsMutex.Lock()
+	defer f.lookupsMutex.Unlock()
+
+	return f.lookups
+}
+
+// holdLink listens where the i/o daemon of a process would, without ever
+// responding, so that the process being restored is neither linked to nor
+// considered exited.
+func holdLink(processID uint32) net.Listener {
+	err := os.MkdirAll(filepath.Join(tmpdir, "processes"), 0755)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	listener, err := net.Listen("unix", filepath.Join(tmpdir, "processes", fmt.Sprintf("%d.sock", processID)))
+	Ω(err).ShouldNot(HaveOccurred())
+
+	return listener
+}
+
+type FakeGroupSignaller struct {
+	FakeSignaller
+
+	sentToGroup []os.Signal
+}
+
+func (f *FakeGroupSignaller) SignalGroup(s os.Signal) error {
+	f.sentToGroup = append(f.sentToGroup, s)
+	return nil
+}
+
 type FakeSignaller struct {
 	sent []os.Signal
+	mu   sync.Mutex
 }
 
 func (f *FakeSignaller) Signal(s os.Signal) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
 	f.sent = append(f.sent, s)
 	return nil
 }
+
+func (f *FakeSignaller) Sent() []os.Signal {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.sent
+}
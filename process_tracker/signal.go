@@ -0,0 +1,97 @@
+package process_tracker
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// GroupSignaller is implemented by signallers which can signal the whole
+// process group of the process they signal.
+type GroupSignaller interface {
+	SignalGroup(os.Signal) error
+}
+
+type SignalRequest struct {
+	Signal syscall.Signal
+
+	// Signal the process group led by the process rather than only the
+	// process itself.
+	Group bool
+}
+
+type UnknownSignalError struct {
+	Signal string
+}
+
+func (e UnknownSignalError) Error() string {
+	return fmt.Sprintf("process_tracker: unknown signal: %s", e.Signal)
+}
+
+var signalsByName = map[string]syscall.Signal{
+	"HUP":    syscall.SIGHUP,
+	"INT":    syscall.SIGINT,
+	"QUIT":   syscall.SIGQUIT,
+	"ABRT":   syscall.SIGABRT,
+	"KILL":   syscall.SIGKILL,
+	"USR1":   syscall.SIGUSR1,
+	"USR2":   syscall.SIGUSR2,
+	"PIPE":   syscall.SIGPIPE,
+	"ALRM":   syscall.SIGALRM,
+	"TERM":   syscall.SIGTERM,
+	"CHLD":   syscall.SIGCHLD,
+	"CONT":   syscall.SIGCONT,
+	"STOP":   syscall.SIGSTOP,
+	"TSTP":   syscall.SIGTSTP,
+	"TTIN":   syscall.SIGTTIN,
+	"TTOU":   syscall.SIGTTOU,
+	"URG":    syscall.SIGURG,
+	"XCPU":   syscall.SIGXCPU,
+	"XFSZ":   syscall.SIGXFSZ,
+	"VTALRM": syscall.SIGVTALRM,
+	"PROF":   syscall.SIGPROF,
+	"WINCH":  syscall.SIGWINCH,
+	"IO":     syscall.SIGIO,
+	"SYS":    syscall.SIGSYS,
+}
+
+// ParseSignal parses a signal given by name, with or without the SIG
+// prefix and in any case, or by number, e.g. "HUP", "sigusr1" or "15".
+func ParseSignal(name string) (syscall.Signal, error) {
+	if number, err := strconv.Atoi(name); err == nil {
+		for _, signal := range signalsByName {
+			if int(signal) == number {
+				return signal, nil
+			}
+		}
+
+		return 0, UnknownSignalError{name}
+	}
+
+	signal, found := signalsByName[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !found {
+		return 0, UnknownSignalError{name}
+	}
+
+	return signal, nil
+}
+
+// SendSignal sends any signal to the process, or to its process group.
+func (p *Process) SendSignal(request SignalRequest) error {
+	if p.signaller == nil {
+		return fmt.Errorf("process_tracker: failed to send signal: process %d cannot be signalled", p.id)
+	}
+
+	if !request.Group {
+		return p.signaller.Signal(request.Signal)
+	}
+
+	groupSignaller, ok := p.signaller.(GroupSignaller)
+	if !ok {
+		return fmt.Errorf("process_tracker: failed to send signal: process %d cannot be signalled as a group", p.id)
+	}
+
+	return groupSignaller.SignalGroup(request.Signal)
+}
@@ -14,9 +14,21 @@ func NewFanOut() FanOut {
 	return &fanOut{}
 }
 
+// NewFanOutWithScrollback returns a FanOut which keeps the last size bytes
+// written and replays them to each sink as it is added.
+func NewFanOutWithScrollback(size int) FanOut {
+	if size <= 0 {
+		return NewFanOut()
+	}
+
+	return &fanOut{scrollback: newScrollback(size)}
+}
+
 type fanOut struct {
 	sinks  []io.Writer
 	sinksL sync.Mutex
+
+	scrollback *scrollback
 }
 
 func (w *fanOut) Write(data []byte) (int, error) {
@@ -29,6 +41,10 @@ func (w *fanOut) Write(data []byte) (int, error) {
 		s.Write(data)
 	}
 
+	if w.scrollback != nil {
+		w.scrollback.Write(data)
+	}
+
 	return len(data), nil
 }
 
@@ -36,5 +52,11 @@ func (w *fanOut) AddSink(sink io.Writer) {
 	w.sinksL.Lock()
 	defer w.sinksL.Unlock()
 
+	if w.scrollback != nil {
+		if data := w.scrollback.Bytes(); len(data) > 0 {
+			sink.Write(data)
+		}
+	}
+
 	w.sinks = append(w.sinks, sink)
 }
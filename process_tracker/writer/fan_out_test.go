@@ -3,6 +3,7 @@ package writer_test
 import (
 	"github.com/cloudfoundry-incubator/garden-linux/process_tracker/writer"
 
+	"bytes"
 	"errors"
 
 	. "github.com/onsi/ginkgo"
@@ -66,4 +67,45 @@ var _ = Describe("FanOut", func() {
 		Ω(err).ShouldNot(HaveOccurred())
 		Ω(n).Should(Equal(1))
 	})
+
+	Context("with scrollback", func() {
+		BeforeEach(func() {
+			fanOut = writer.NewFanOutWithScrollback(8)
+		})
+
+		It("replays what was written to a new sink", func() {
+			fanOut.Write([]byte("abc"))
+			fanOut.Write([]byte("def"))
+
+			sink := new(bytes.Buffer)
+			fanOut.AddSink(sink)
+			Ω(sink.String()).Should(Equal("abcdef"))
+
+			fanOut.Write([]byte("ghi"))
+			Ω(sink.String()).Should(Equal("abcdefghi"))
+		})
+
+		It("keeps only the most recent bytes", func() {
+			fanOut.Write([]byte("abcdef"))
+			fanOut.Write([]byte("ghijk"))
+
+			sink := new(bytes.Buffer)
+			fanOut.AddSink(sink)
+			Ω(sink.String()).Should(Equal("defghijk"))
+		})
+
+		It("keeps the end of writes larger than the scrollback", func() {
+			fanOut.Write([]byte("abc"))
+			fanOut.Write([]byte("0123456789"))
+
+			sink := new(bytes.Buffer)
+			fanOut.AddSink(sink)
+			Ω(sink.String()).Should(Equal("23456789"))
+		})
+
+		It("does not write to a new sink when nothing was written", func() {
+			fanOut.AddSink(fWriter)
+			Ω(fWriter.writeCalls()).Should(Equal(0))
+		})
+	})
 })
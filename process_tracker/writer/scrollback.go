@@ -0,0 +1,45 @@
+package writer
+
+// scrollback is a ring buffer keeping the last size bytes written to it.
+type scrollback struct {
+	buf  []byte
+	next int
+	full bool
+}
+
+func newScrollback(size int) *scrollback {
+	return &scrollback{buf: make([]byte, size)}
+}
+
+func (s *scrollback) Write(data []byte) {
+	if len(data) >= len(s.buf) {
+		copy(s.buf, data[len(data)-len(s.buf):])
+		s.next = 0
+		s.full = true
+		return
+	}
+
+	n := copy(s.buf[s.next:], data)
+	if n < len(data) {
+		copy(s.buf, data[n:])
+	}
+
+	if s.next+len(data) >= len(s.buf) {
+		s.full = true
+	}
+
+	s.next = (s.next + len(data)) % len(s.buf)
+}
+
+// Bytes returns the buffered data, oldest first.
+func (s *scrollback) Bytes() []byte {
+	if !s.full {
+		return append([]byte{}, s.buf[:s.next]...)
+	}
+
+	data := make([]byte, 0, len(s.buf))
+	data = append(data, s.buf[s.next:]...)
+	data = append(data, s.buf[:s.next]...)
+
+	return data
+}